@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/F0RG-2142/capstone-1/internal/apierror"
+	"github.com/F0RG-2142/capstone-1/internal/auth"
+	"github.com/F0RG-2142/capstone-1/internal/database"
+	"github.com/F0RG-2142/capstone-1/internal/entitlements"
+	"github.com/F0RG-2142/capstone-1/internal/validate"
+	"github.com/google/uuid"
+)
+
+type accessTokenResponse struct {
+	ID         uuid.UUID  `json:"token_id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"token,omitempty"`
+	TokenHint  string     `json:"token_hint"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Revoked    bool       `json:"revoked"`
+}
+
+func newAccessTokenResponse(t database.ApiToken) accessTokenResponse {
+	resp := accessTokenResponse{
+		ID:        t.ID,
+		Name:      t.Name,
+		TokenHint: t.TokenHint,
+		Scopes:    t.Scopes,
+		CreatedAt: t.CreatedAt,
+		Revoked:   t.RevokedAt.Valid,
+	}
+	if t.ExpiresAt.Valid {
+		resp.ExpiresAt = &t.ExpiresAt.Time
+	}
+	if t.LastUsedAt.Valid {
+		resp.LastUsedAt = &t.LastUsedAt.Time
+	}
+	return resp
+}
+
+type newAccessTokenRequest struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,max=20"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"omitempty,min=1,max=366"`
+}
+
+// Creates a personal access token. Only a logged in session (JWT) can create tokens. Needs:
+//
+//	{
+//		"name":"string"
+//		"scopes":["notes:read", "notes:write", "teams:read", "teams:write", "teams:admin"]
+//		"expires_in_days":"int" (optional, no expiry if left out)
+//	}
+//
+// and returns the token, which is only ever shown in this response:
+//
+//	{
+//		"token_id":"uuid"
+//		"name":"string"
+//		"token":"string"
+//		"token_hint":"string"
+//		"scopes":["string"]
+//		"created_at":"timestamp"
+//		"expires_at":"timestamp"
+//		"last_used_at":"timestamp"
+//		"revoked":"bool"
+//	}
+func (s *Server) HandleNewAccessToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	userId := principal(r).UserID
+	var req newAccessTokenRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		logger(r).Warn("Invalid request", "err", err)
+		apierror.Write(w, r, err)
+		return
+	}
+	scopes, err := auth.ValidateScopes(req.Scopes)
+	if err != nil {
+		apierror.Write(w, r, apierror.Validation(apierror.FieldError{Field: "scopes", Code: "oneof", Message: err.Error()}))
+		return
+	}
+	if !callerWithinLimit(w, r, entitlements.LimitAPITokens, s.DB.CountActiveAPITokens) {
+		return
+	}
+	var expiresAt sql.NullTime
+	if req.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{Time: s.now().AddDate(0, 0, req.ExpiresInDays), Valid: true}
+	}
+	token, err := auth.MakeAccessToken()
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Failed to generate access token", err))
+		return
+	}
+	params := database.NewAPITokenParams{
+		UserID:    userId,
+		Name:      req.Name,
+		TokenHash: auth.HashAccessToken(token),
+		TokenHint: auth.AccessTokenHint(token),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	apiToken, err := s.DB.NewAPIToken(r.Context(), params)
+	if err != nil {
+		logger(r).Error("Error creating access token", "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Failed to create access token"))
+		return
+	}
+	resp := newAccessTokenResponse(apiToken)
+	resp.Token = token
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Failed to create response", err))
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	_, err = w.Write(jsonResp)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+}
+
+// Lists the user's personal access tokens (without the secret part)
+func (s *Server) HandleGetAccessTokens(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	userId := principal(r).UserID
+	tokens, err := s.DB.GetAPITokens(r.Context(), userId)
+	if err != nil {
+		logger(r).Error("Error fetching access tokens", "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not get access tokens"))
+		return
+	}
+	resp := make([]accessTokenResponse, 0, len(tokens))
+	for _, t := range tokens {
+		resp = append(resp, newAccessTokenResponse(t))
+	}
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Failed to create response", err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(jsonResp)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+}
+
+// Revokes the personal access token with the id given in the url
+func (s *Server) HandleRevokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	userId := principal(r).UserID
+	tokenId, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		apierror.Write(w, r, apierror.InvalidParameter("tokenID", "Could not parse token id"))
+		return
+	}
+	revoked, err := s.DB.RevokeAPIToken(r.Context(), database.RevokeAPITokenParams{
+		ID:     tokenId,
+		UserID: userId,
+	})
+	if err != nil {
+		logger(r).Error("Error revoking access token", "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not revoke access token"))
+		return
+	}
+	if revoked == 0 {
+		apierror.Write(w, r, apierror.NotFound("Access token not found"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/F0RG-2142/capstone-1/internal/apierror"
+	"github.com/F0RG-2142/capstone-1/internal/openapi"
+	"github.com/F0RG-2142/capstone-1/internal/validate"
+)
+
+// How requests and responses are checked against the OpenAPI document, see Server.Contract
+type ContractMode string
+
+const (
+	// No checks, the default
+	ContractOff ContractMode = "off"
+	// Requests that don't match the document are answered with a 400 or 422 before the handler runs
+	ContractRequests ContractMode = "requests"
+	// Requests are checked and responses that don't match are logged as errors. For development and
+	// tests, every response is buffered a second time
+	ContractStrict ContractMode = "strict"
+)
+
+// Logged for every response that doesn't match the document, tests fail on it
+const contractViolation = "Response breaks the API contract"
+
+// Checks the requests of the route pattern against doc, and in strict mode its responses. Goes
+// innermost, after auth and rate limits, so a request without credentials is still a 401
+func (s *Server) contract(doc *openapi.Document, pattern string) Middleware {
+	if s.Contract != ContractRequests && s.Contract != ContractStrict {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	method, path, _ := strings.Cut(pattern, " ")
+	op := doc.Operation(method, path)
+	if op == nil {
+		panic(fmt.Sprintf("handlers: %s isn't in the OpenAPI document", pattern))
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := checkRequest(doc, op, w, r); err != nil {
+				apierror.Write(w, r, err)
+				return
+			}
+			if s.Contract != ContractStrict || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			rec := &contractRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if problem, fields := checkResponse(doc, op, rec); problem != "" {
+				logger(r).Error(contractViolation, "route", r.Pattern, "status", rec.status, "problem", problem, "fields", fields)
+			}
+		})
+	}
+}
+
+// Parameters are a 400 like the handlers' own parsing, the body a 400 when it isn't JSON and a 422
+// listing every field that doesn't match. The body is read here and put back for the handler
+func checkRequest(doc *openapi.Document, op *openapi.Operation, w http.ResponseWriter, r *http.Request) error {
+	var fields []apierror.FieldError
+	query := r.URL.Query()
+	for _, p := range op.Parameters {
+		switch p.In {
+		case "path":
+			fields = append(fields, doc.ValidateParameter(p, r.PathValue(p.Name))...)
+		case "query":
+			if !query.Has(p.Name) {
+				if p.Required {
+					fields = append(fields, apierror.FieldError{Field: p.Name, Code: "required", Message: "is required"})
+				}
+				continue
+			}
+			fields = append(fields, doc.ValidateParameter(p, query.Get(p.Name))...)
+		}
+	}
+	if len(fields) > 0 {
+		e := apierror.New(http.StatusBadRequest, apierror.CodeInvalidParameter, "The request has invalid parameters")
+		e.Fields = fields
+		return e
+	}
+	if op.RequestBody == nil {
+		return nil
+	}
+	media := op.RequestBody.Content["application/json"]
+	if media == nil {
+		return nil
+	}
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(http.MaxBytesReader(w, r.Body, validate.MaxBodyBytes))
+		_ = r.Body.Close()
+		if err != nil {
+			return apierror.InvalidBody(err)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.RequestBody.Required {
+			return apierror.InvalidBody(io.EOF)
+		}
+		return nil
+	}
+	v, err := decodeAny(body)
+	if err != nil {
+		return apierror.InvalidBody(err)
+	}
+	if fields := doc.Validate(media.Schema, v); len(fields) > 0 {
+		return apierror.Validation(fields...)
+	}
+	return nil
+}
+
+// What went wrong with the recorded response, "" when it matches its operation
+func checkResponse(doc *openapi.Document, op *openapi.Operation, rec *contractRecorder) (string, []apierror.FieldError) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	resp := op.Responses[strconv.Itoa(rec.status)]
+	if resp == nil {
+		return "status isn't documented", nil
+	}
+	//http.Redirect writes a short html body nobody reads
+	if len(resp.Content) == 0 || rec.status/100 == 3 {
+		return "", nil
+	}
+	contentType := rec.Header().Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Sprintf("content type %q isn't valid", contentType), nil
+	}
+	media := resp.Content[mediaType]
+	if media == nil {
+		return fmt.Sprintf("content type %q isn't documented", mediaType), nil
+	}
+	if media.Schema == nil || mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+		return "", nil
+	}
+	v, err := decodeAny(rec.body.Bytes())
+	if err != nil {
+		return "body isn't JSON: " + err.Error(), nil
+	}
+	if fields := doc.Validate(media.Schema, v); len(fields) > 0 {
+		return "body doesn't match the schema", fields
+	}
+	return "", nil
+}
+
+// Decodes a single JSON value the way openapi.Document.Validate expects it
+func decodeAny(body []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return nil, errors.New("body must hold a single JSON value")
+	}
+	return v, nil
+}
+
+// Keeps a copy of the status and body for checkResponse, the response itself goes out unchanged
+type contractRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (c *contractRecorder) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *contractRecorder) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	c.body.Write(b)
+	return c.ResponseWriter.Write(b)
+}
+
+func (c *contractRecorder) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
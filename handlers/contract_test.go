@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/F0RG-2142/capstone-1/internal/apierror"
+	"github.com/F0RG-2142/capstone-1/internal/logging"
+	"github.com/F0RG-2142/capstone-1/internal/openapi"
+)
+
+func TestContractRequests(t *testing.T) {
+	ts := newTestServer(t)
+	user := ts.signUp("contract@example.com")
+	team := ts.newTeam(user, "Contract")
+	members := "/api/v1/teams/" + team.ID.String() + "/members"
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		token    string
+		body     any
+		want     int
+		wantCode string
+		// "field:code" of every error
+		wantFields []string
+	}{
+		{name: "Credentials Checked First", method: "POST", path: "/api/v1/notes", body: `{"body":1}`, want: http.StatusUnauthorized, wantCode: apierror.CodeUnauthorized},
+		{name: "Bad Path Parameter", method: "GET", path: "/api/v1/notes/not-a-uuid", token: user.Token, want: http.StatusBadRequest, wantCode: apierror.CodeInvalidParameter, wantFields: []string{"noteID:uuid"}},
+		{name: "Bad Query Parameter", method: "GET", path: "/api/v1/admin/payment-events?status=lost", token: testAdminToken, want: http.StatusBadRequest, wantCode: apierror.CodeInvalidParameter, wantFields: []string{"status:oneof"}},
+		{name: "Missing Body", method: "POST", path: "/api/v1/notes", token: user.Token, want: http.StatusBadRequest, wantCode: apierror.CodeInvalidBody},
+		{name: "Trailing Data", method: "POST", path: "/api/v1/notes", token: user.Token, body: `{"body":"x"} {}`, want: http.StatusBadRequest, wantCode: apierror.CodeInvalidBody},
+		{name: "Wrong Type", method: "POST", path: "/api/v1/notes", token: user.Token, body: `{"body":1}`, want: http.StatusUnprocessableEntity, wantCode: apierror.CodeValidationFailed, wantFields: []string{"body:type"}},
+		{name: "Every Invalid Field", method: "POST", path: members, token: user.Token, body: map[string]any{"user_id": "someone", "role": "owner", "team": "x"}, want: http.StatusUnprocessableEntity, wantCode: apierror.CodeValidationFailed, wantFields: []string{"role:oneof", "team:unknown_field", "user_id:uuid"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := ts.do(tt.method, tt.path, tt.token, tt.body)
+			expectStatus(t, rec, tt.want)
+			problem := decode[apierror.Problem](t, rec)
+			if problem.Code != tt.wantCode {
+				t.Errorf("expected code %q, got %+v", tt.wantCode, problem)
+			}
+			var fields []string
+			for _, fe := range problem.Errors {
+				fields = append(fields, fe.Field+":"+fe.Code)
+			}
+			if !slices.Equal(fields, tt.wantFields) {
+				t.Errorf("expected errors %v, got %+v", tt.wantFields, problem.Errors)
+			}
+		})
+	}
+}
+
+func TestContractOff(t *testing.T) {
+	ts := newTestServer(t)
+	ts.srv.Contract = ContractOff
+	ts.handler = ts.srv.Handler()
+	user := ts.signUp("contract-off@example.com")
+
+	//the handler parses the id itself
+	rec := ts.do("GET", "/api/v1/notes/not-a-uuid", user.Token, nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+	problem := decode[apierror.Problem](t, rec)
+	if len(problem.Errors) != 1 || problem.Errors[0].Code != "invalid" {
+		t.Errorf("expected the handler's own error, got %+v", problem.Errors)
+	}
+}
+
+// Keeps the messages of every record logged through it
+type recordingLog struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordingLog) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (l *recordingLog) Handle(_ context.Context, rec slog.Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, rec.Message)
+	return nil
+}
+
+func (l *recordingLog) WithAttrs([]slog.Attr) slog.Handler { return l }
+func (l *recordingLog) WithGroup(string) slog.Handler      { return l }
+
+func TestContractResponses(t *testing.T) {
+	doc := openapi.New(openapi.Info{Title: "test", Version: "1"})
+	doc.Add("GET /things", &openapi.Operation{Responses: map[string]*openapi.Response{
+		"200": openapi.JSONResponse("A thing", &openapi.Schema{Type: "object", Required: []string{"name"}, Properties: map[string]*openapi.Schema{
+			"name": {Type: "string"},
+		}}),
+		"204": openapi.JSONResponse("Nothing", nil),
+	}})
+
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		wantLogged  bool
+	}{
+		{name: "Matching Body", status: http.StatusOK, contentType: "application/json", body: `{"name":"x"}`},
+		{name: "Documented Without Content", status: http.StatusNoContent},
+		{name: "Undocumented Status", status: http.StatusConflict, contentType: "application/json", body: `{"name":"x"}`, wantLogged: true},
+		{name: "Undocumented Content Type", status: http.StatusOK, contentType: "text/plain", body: "x", wantLogged: true},
+		{name: "Body Not Matching", status: http.StatusOK, contentType: "application/json", body: `{"name":1}`, wantLogged: true},
+		{name: "Body Not JSON", status: http.StatusOK, contentType: "application/json", body: `{"name":`, wantLogged: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{Contract: ContractStrict}
+			h := s.contract(doc, "GET /things")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			log := &recordingLog{}
+			req := httptest.NewRequest("GET", "/things", nil)
+			req = req.WithContext(logging.ContextWithLogger(req.Context(), slog.New(log)))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			//the response itself goes out as the handler wrote it
+			expectStatus(t, rec, tt.status)
+			if rec.Body.String() != tt.body {
+				t.Errorf("expected body %q, got %q", tt.body, rec.Body.String())
+			}
+			logged := slices.Contains(log.messages, contractViolation)
+			if logged != tt.wantLogged {
+				t.Errorf("expected logged %v, got messages %v", tt.wantLogged, log.messages)
+			}
+		})
+	}
+
+	t.Run("Requests Mode Doesn't Check Responses", func(t *testing.T) {
+		s := &Server{Contract: ContractRequests}
+		h := s.contract(doc, "GET /things")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}))
+		log := &recordingLog{}
+		req := httptest.NewRequest("GET", "/things", nil)
+		req = req.WithContext(logging.ContextWithLogger(req.Context(), slog.New(log)))
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		if len(log.messages) > 0 {
+			t.Errorf("expected nothing logged, got %v", strings.Join(log.messages, ", "))
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/F0RG-2142/capstone-1/internal/apierror"
+	"github.com/F0RG-2142/capstone-1/internal/entitlements"
+	"github.com/google/uuid"
+)
+
+// Checks that the caller can add one more of what the named limit counts. Writes the error and
+// returns false otherwise: 402 when premium would allow it, 403 when no plan does
+func withinLimit(w http.ResponseWriter, r *http.Request, limits entitlements.Limits, limit string, current int64) bool {
+	err := limits.Check(limit, current, 1)
+	if err == nil {
+		return true
+	}
+	var exceeded *entitlements.ExceededError
+	if !errors.As(err, &exceeded) {
+		apierror.Write(w, r, apierror.Internal("Could not check plan limits", err))
+		return false
+	}
+	status := http.StatusForbidden
+	if limits.CanUpgrade(limit) {
+		status = http.StatusPaymentRequired
+	}
+	apierror.Write(w, r, apierror.New(status, apierror.CodePlanLimitReached, "Plan limit reached").
+		With("limit", exceeded.Limit).
+		With("max", exceeded.Max).
+		With("plan", exceeded.Plan).
+		With("upgrade", status == http.StatusPaymentRequired))
+	return false
+}
+
+// Counts the caller's current usage of limit and checks it against their plan, see withinLimit
+func callerWithinLimit(w http.ResponseWriter, r *http.Request, limit string, count func(context.Context, uuid.UUID) (int64, error)) bool {
+	p := principal(r)
+	current, err := count(r.Context(), p.UserID)
+	if err != nil {
+		logger(r).Error("Error counting usage", "limit", limit, "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not check plan limits"))
+		return false
+	}
+	return withinLimit(w, r, entitlements.ForPremium(p.HasPremium), limit, current)
+}
+
+type usageEntry struct {
+	Used int64 `json:"used"`
+	// null when the plan doesn't limit it
+	Limit *int64 `json:"limit"`
+}
+
+type usageResponse struct {
+	Plan string `json:"plan"`
+	// Keyed by limit name
+	Usage map[string]usageEntry `json:"usage"`
+}
+
+// Returns the user's usage against their plan's limits. max_team_members reports the largest team
+// the user created:
+//
+//	{
+//		"plan":"free" or "premium"
+//		"usage":{
+//			"max_notes":{"used":"int", "limit":"int or null"}
+//			"max_teams_created":{...}
+//			"max_team_members":{...}
+//			"attachment_storage_bytes":{...}
+//			"revision_history_depth":{...}
+//			"max_api_tokens":{...}
+//		}
+//	}
+func (s *Server) HandleGetUsage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	p := principal(r)
+	limits := entitlements.ForPremium(p.HasPremium)
+	//attachments and revision history aren't stored yet, they report 0
+	counters := []struct {
+		limit string
+		count func(context.Context, uuid.UUID) (int64, error)
+	}{
+		{limit: entitlements.LimitNotes, count: s.DB.CountNotes},
+		{limit: entitlements.LimitTeamsCreated, count: s.DB.CountTeamsCreated},
+		{limit: entitlements.LimitTeamMembers, count: s.DB.GetLargestCreatedTeamSize},
+		{limit: entitlements.LimitAPITokens, count: s.DB.CountActiveAPITokens},
+	}
+	used := map[string]int64{}
+	for _, c := range counters {
+		n, err := c.count(r.Context(), p.UserID)
+		if err != nil {
+			logger(r).Error("Error counting usage", "limit", c.limit, "err", err)
+			apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not get usage"))
+			return
+		}
+		used[c.limit] = n
+	}
+	usage := map[string]usageEntry{}
+	for _, name := range entitlements.LimitNames {
+		entry := usageEntry{Used: used[name]}
+		if max := limits.Get(name); max != entitlements.Unlimited {
+			entry.Limit = &max
+		}
+		usage[name] = entry
+	}
+	jsonResp, err := json.Marshal(usageResponse{
+		Plan:  limits.Plan,
+		Usage: usage,
+	})
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Failed to create response", err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(jsonResp)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+}
@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/F0RG-2142/capstone-1/internal/apierror"
+	"github.com/F0RG-2142/capstone-1/internal/auth"
+	"github.com/F0RG-2142/capstone-1/internal/database/memdb"
+	"github.com/F0RG-2142/capstone-1/internal/server"
+	"github.com/google/uuid"
+)
+
+const (
+	testAdminToken    = "test-admin-token"
+	testWebhookSecret = "test-webhook-secret"
+	testPassword      = "correct horse battery staple"
+)
+
+// Server on an in-memory store with a clock tests can move
+type testServer struct {
+	t       *testing.T
+	srv     *Server
+	db      *memdb.Store
+	handler http.Handler
+	mailer  *recordingMailer
+	now     time.Time
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	ts := &testServer{
+		t:      t,
+		db:     memdb.New(),
+		mailer: &recordingMailer{},
+		now:    time.Now().UTC().Truncate(time.Second),
+	}
+	clock := func() time.Time { return ts.now }
+	ts.db.Now = clock
+	ts.srv = &Server{
+		DB:                   ts.db,
+		Clock:                clock,
+		Logger:               slog.New(contractLog{t}),
+		Tokens:               &auth.TokenIssuer{Secret: "test-secret-that-is-long-enough-for-hs256"},
+		Platform:             "test",
+		AdminToken:           testAdminToken,
+		Mailer:               ts.mailer,
+		UnlockURL:            "http://localhost/api/v1/login/unlock",
+		PaymentWebhookSecret: testWebhookSecret,
+		Health:               &server.Health{},
+		Contract:             ContractStrict,
+	}
+	ts.handler = ts.srv.Handler()
+	return ts
+}
+
+// Drops every log line but fails the test on responses that don't match the OpenAPI document
+type contractLog struct {
+	t *testing.T
+}
+
+func (c contractLog) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (c contractLog) Handle(_ context.Context, rec slog.Record) error {
+	if rec.Message != contractViolation {
+		return nil
+	}
+	var attrs []string
+	rec.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a.String())
+		return true
+	})
+	c.t.Errorf("%s: %s", rec.Message, strings.Join(attrs, " "))
+	return nil
+}
+
+func (c contractLog) WithAttrs([]slog.Attr) slog.Handler { return c }
+func (c contractLog) WithGroup(string) slog.Handler      { return c }
+
+// Sends a request through every middleware. body is sent as is when it is a string, as JSON otherwise
+func (ts *testServer) do(method, path, token string, body any) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	default:
+		payload, err := json.Marshal(b)
+		if err != nil {
+			ts.t.Fatalf("failed to marshal request body: %v", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	ts.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+type testUser struct {
+	ID           uuid.UUID `json:"id"`
+	Email        string    `json:"email"`
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+}
+
+// Registers and logs in a user through the API
+func (ts *testServer) signUp(email string) testUser {
+	ts.t.Helper()
+	rec := ts.do("POST", "/api/v1/register", "", map[string]string{"user_email": email, "user_password": testPassword})
+	expectStatus(ts.t, rec, http.StatusCreated)
+	return ts.login(email)
+}
+
+func (ts *testServer) login(email string) testUser {
+	ts.t.Helper()
+	rec := ts.do("POST", "/api/v1/login", "", map[string]string{"email": email, "password": testPassword})
+	expectStatus(ts.t, rec, http.StatusOK)
+	return decode[testUser](ts.t, rec)
+}
+
+// Personal access token of the user with the given scopes
+func (ts *testServer) accessToken(user testUser, scopes ...string) string {
+	ts.t.Helper()
+	rec := ts.do("POST", "/api/v1/user/me/tokens", user.Token, map[string]any{"name": "test", "scopes": scopes})
+	expectStatus(ts.t, rec, http.StatusCreated)
+	return decode[accessTokenResponse](ts.t, rec).Token
+}
+
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if rec.Code != want {
+		t.Fatalf("expected status %d, got %d: %s", want, rec.Code, rec.Body.String())
+	}
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("failed to decode response %q: %v", rec.Body.String(), err)
+	}
+	return v
+}
+
+// Keeps unlock emails instead of sending them
+type recordingMailer struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (m *recordingMailer) SendUnlockEmail(ctx context.Context, to, unlockURL string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, to)
+	return nil
+}
+
+// Every route behind RequireAuth or RequireSession, with path values filled in
+var protectedRoutes = []struct {
+	method string
+	path   string
+	scope  string
+}{
+	{"PUT", "/api/v1/user/me", ""},
+	{"POST", "/api/v1/user/me/tokens", ""},
+	{"GET", "/api/v1/user/me/subscription", ""},
+	{"GET", "/api/v1/user/me/usage", ""},
+	{"GET", "/api/v1/user/me/tokens", ""},
+	{"DELETE", "/api/v1/user/me/tokens/" + uuid.NewString(), ""},
+	{"POST", "/api/v1/user/me/identities/mock", ""},
+	{"POST", "/api/v1/notes", auth.ScopeNotesWrite},
+	{"GET", "/api/v1/notes", auth.ScopeNotesRead},
+	{"GET", "/api/v1/notes/" + uuid.NewString(), auth.ScopeNotesRead},
+	{"PUT", "/api/v1/notes/" + uuid.NewString(), auth.ScopeNotesWrite},
+	{"DELETE", "/api/v1/notes/" + uuid.NewString(), auth.ScopeNotesWrite},
+	{"POST", "/api/v1/teams", auth.ScopeTeamsWrite},
+	{"GET", "/api/v1/teams", auth.ScopeTeamsRead},
+	{"GET", "/api/v1/teams/" + uuid.NewString(), auth.ScopeTeamsRead},
+	{"DELETE", "/api/v1/teams/" + uuid.NewString(), auth.ScopeTeamsAdmin},
+	{"POST", "/api/v1/teams/" + uuid.NewString() + "/members", auth.ScopeTeamsAdmin},
+	{"DELETE", "/api/v1/teams/" + uuid.NewString() + "/members/" + uuid.NewString(), auth.ScopeTeamsAdmin},
+	{"GET", "/api/v1/teams/" + uuid.NewString() + "/subscription", auth.ScopeTeamsRead},
+	{"GET", "/api/v1/teams/" + uuid.NewString() + "/members", auth.ScopeTeamsRead},
+	{"POST", "/api/v1/teams/" + uuid.NewString() + "/notes", auth.ScopeNotesWrite},
+	{"GET", "/api/v1/teams/" + uuid.NewString() + "/notes", auth.ScopeNotesRead},
+	{"GET", "/api/v1/teams/" + uuid.NewString() + "/notes/" + uuid.NewString(), auth.ScopeNotesRead},
+	{"PUT", "/api/v1/teams/" + uuid.NewString() + "/notes/" + uuid.NewString(), auth.ScopeNotesWrite},
+	{"DELETE", "/api/v1/teams/" + uuid.NewString() + "/notes/" + uuid.NewString(), auth.ScopeNotesWrite},
+}
+
+func TestProtectedRoutes(t *testing.T) {
+	ts := newTestServer(t)
+	user := ts.signUp("routes@example.com")
+	//a token without any scope the routes accept, session-only routes refuse every access token
+	unrelated := ts.accessToken(user, auth.ScopeNotesRead)
+	expiredJWT, err := ts.srv.Tokens.MakeJWT(user.ID, -time.Minute)
+	if err != nil {
+		t.Fatalf("failed to make jwt: %v", err)
+	}
+
+	for _, route := range protectedRoutes {
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			rec := ts.do(route.method, route.path, "", nil)
+			expectStatus(t, rec, http.StatusUnauthorized)
+			if rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected a WWW-Authenticate challenge")
+			}
+			expectStatus(t, ts.do(route.method, route.path, "not-a-jwt", nil), http.StatusUnauthorized)
+			expectStatus(t, ts.do(route.method, route.path, expiredJWT, nil), http.StatusUnauthorized)
+			if route.scope != auth.ScopeNotesRead {
+				expectStatus(t, ts.do(route.method, route.path, unrelated, nil), http.StatusForbidden)
+			}
+		})
+	}
+}
+
+func TestAdminRoutes(t *testing.T) {
+	ts := newTestServer(t)
+	user := ts.signUp("admin@example.com")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{name: "Metrics Without Token", method: "GET", path: "/api/v1/admin/metrics", want: http.StatusUnauthorized},
+		{name: "Metrics With User Token", method: "GET", path: "/api/v1/admin/metrics", token: user.Token, want: http.StatusUnauthorized},
+		{name: "Metrics", method: "GET", path: "/api/v1/admin/metrics", token: testAdminToken, want: http.StatusOK},
+		{name: "Lockouts Without Token", method: "GET", path: "/api/v1/admin/lockouts", want: http.StatusUnauthorized},
+		{name: "Lockouts", method: "GET", path: "/api/v1/admin/lockouts", token: testAdminToken, want: http.StatusOK},
+		{name: "Clear Lockout Wrong Token", method: "DELETE", path: "/api/v1/admin/lockouts/account:nobody@example.com", token: "wrong", want: http.StatusUnauthorized},
+		{name: "Clear Unknown Lockout", method: "DELETE", path: "/api/v1/admin/lockouts/account:nobody@example.com", token: testAdminToken, want: http.StatusNotFound},
+		{name: "Payment Events Without Token", method: "GET", path: "/api/v1/admin/payment-events", want: http.StatusUnauthorized},
+		{name: "Payment Events", method: "GET", path: "/api/v1/admin/payment-events", token: testAdminToken, want: http.StatusOK},
+		{name: "Payment Events Unknown Status", method: "GET", path: "/api/v1/admin/payment-events?status=lost", token: testAdminToken, want: http.StatusBadRequest},
+		{name: "Payment Events Bad Limit", method: "GET", path: "/api/v1/admin/payment-events?limit=0", token: testAdminToken, want: http.StatusBadRequest},
+		{name: "Reprocess Without Token", method: "POST", path: "/api/v1/admin/payment-events/evt_1/reprocess", want: http.StatusUnauthorized},
+		{name: "Reprocess Unknown Event", method: "POST", path: "/api/v1/admin/payment-events/evt_1/reprocess", token: testAdminToken, want: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, ts.do(tt.method, tt.path, tt.token, nil), tt.want)
+		})
+	}
+}
+
+func TestAdminRoutesDisabledWithoutToken(t *testing.T) {
+	ts := newTestServer(t)
+	ts.srv.AdminToken = ""
+	expectStatus(t, ts.do("GET", "/api/v1/admin/metrics", "", nil), http.StatusUnauthorized)
+	expectStatus(t, ts.do("GET", "/api/v1/admin/metrics", testAdminToken, nil), http.StatusUnauthorized)
+}
+
+func TestUtilityRoutes(t *testing.T) {
+	ts := newTestServer(t)
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		//the process isn't started through server.Run so it never reports live
+		{name: "Livez", path: "/livez", want: http.StatusServiceUnavailable},
+		{name: "Readyz", path: "/readyz", want: http.StatusOK},
+		{name: "Healthz", path: "/api/v1/healthz", want: http.StatusOK},
+		{name: "JWKS", path: "/.well-known/jwks.json", want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := ts.do("GET", tt.path, "", nil)
+			expectStatus(t, rec, tt.want)
+			if rec.Header().Get("X-Request-ID") == "" {
+				t.Error("expected a request id header")
+			}
+		})
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	ts := newTestServer(t)
+	user := ts.signUp("problems@example.com")
+	viewer := ts.signUp("problems-viewer@example.com")
+	team := ts.newTeam(user, "Problems")
+	ts.addMember(user, team, viewer, roleViewer)
+	notesRead := ts.accessToken(user, auth.ScopeNotesRead)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		body       any
+		want       int
+		wantCode   string
+		wantFields []string
+	}{
+		{name: "Missing Token", method: "GET", path: "/api/v1/notes", want: http.StatusUnauthorized, wantCode: apierror.CodeUnauthorized},
+		{name: "Invalid Token", method: "GET", path: "/api/v1/notes", token: "not-a-jwt", want: http.StatusUnauthorized, wantCode: apierror.CodeInvalidToken},
+		{name: "Insufficient Scope", method: "POST", path: "/api/v1/notes", token: notesRead, body: map[string]string{"body": "x"}, want: http.StatusForbidden, wantCode: apierror.CodeInsufficientScope},
+		{name: "Malformed Body", method: "POST", path: "/api/v1/notes", token: user.Token, body: `{"body":`, want: http.StatusBadRequest, wantCode: apierror.CodeInvalidBody},
+		{name: "Bad Path Parameter", method: "GET", path: "/api/v1/notes/not-a-uuid", token: user.Token, want: http.StatusBadRequest, wantCode: apierror.CodeInvalidParameter, wantFields: []string{"noteID"}},
+		{name: "Invalid Fields", method: "POST", path: "/api/v1/register", body: map[string]string{"user_email": "not-an-email"}, want: http.StatusUnprocessableEntity, wantCode: apierror.CodeValidationFailed, wantFields: []string{"user_email", "user_password"}},
+		{name: "Unknown Field", method: "POST", path: "/api/v1/notes", token: user.Token, body: map[string]string{"body": "x", "owner": "me"}, want: http.StatusUnprocessableEntity, wantCode: apierror.CodeValidationFailed, wantFields: []string{"owner"}},
+		{name: "Missing Row", method: "GET", path: "/api/v1/notes/" + uuid.NewString(), token: user.Token, want: http.StatusNotFound, wantCode: apierror.CodeNotFound},
+		{name: "Unique Violation", method: "POST", path: "/api/v1/teams/" + team.ID.String() + "/members", token: user.Token, body: map[string]any{"user_id": viewer.ID, "role": roleViewer}, want: http.StatusConflict, wantCode: apierror.CodeAlreadyExists},
+		{name: "Foreign Key Violation", method: "POST", path: "/api/v1/teams/" + team.ID.String() + "/members", token: user.Token, body: map[string]any{"user_id": uuid.New(), "role": roleViewer}, want: http.StatusConflict, wantCode: apierror.CodeConflict},
+		{name: "Wrong Team Role", method: "DELETE", path: "/api/v1/teams/" + team.ID.String(), token: viewer.Token, want: http.StatusForbidden, wantCode: apierror.CodeForbidden},
+		{name: "Wrong Password", method: "POST", path: "/api/v1/login", body: map[string]string{"email": "problems@example.com", "password": "wrong"}, want: http.StatusUnauthorized, wantCode: apierror.CodeInvalidCredential},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := ts.do(tt.method, tt.path, tt.token, tt.body)
+			expectStatus(t, rec, tt.want)
+			if ct := rec.Header().Get("Content-Type"); ct != apierror.ContentType {
+				t.Errorf("expected content type %q, got %q", apierror.ContentType, ct)
+			}
+			//constraint violations must not reach the client as the database reports them
+			if body := rec.Body.String(); strings.Contains(body, "pq:") || strings.Contains(body, "violates") {
+				t.Errorf("expected no database error in the body, got %s", body)
+			}
+			problem := decode[apierror.Problem](t, rec)
+			if problem.Status != tt.want || problem.Code != tt.wantCode || problem.Type != apierror.TypePrefix+tt.wantCode {
+				t.Errorf("expected status %d and code %q, got %+v", tt.want, tt.wantCode, problem)
+			}
+			if problem.RequestID == "" || problem.RequestID != rec.Header().Get("X-Request-ID") {
+				t.Errorf("expected the request id %q, got %q", rec.Header().Get("X-Request-ID"), problem.RequestID)
+			}
+			var fields []string
+			for _, fe := range problem.Errors {
+				fields = append(fields, fe.Field)
+			}
+			if !slices.Equal(fields, tt.wantFields) {
+				t.Errorf("expected errors for fields %v, got %+v", tt.wantFields, problem.Errors)
+			}
+		})
+	}
+}
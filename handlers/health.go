@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/F0RG-2142/capstone-1/internal/apierror"
+	"github.com/F0RG-2142/capstone-1/internal/health"
+	"github.com/F0RG-2142/capstone-1/internal/server"
+)
+
+// Liveness probe, 200 while the process is serving at all. Doesn't look at dependencies, a database
+// outage is no reason to restart the server. Returns:
+//
+//	{
+//		"status":"ok" or "fail"
+//	}
+func HandleLivez(h *server.Health) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if !h.Live() {
+			http.Error(w, `{"status":"fail"}`, http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte(`{"status":"ok"}`))
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+	}
+}
+
+// Readiness probe, runs every check and answers 503 if any fails. Returns:
+//
+//	{
+//		"status":"ok" or "fail"
+//		"checks":[
+//			{
+//				"name":"string"
+//				"status":"ok" or "fail"
+//				"latency_ms":"float"
+//				"error":"string" (only for failed checks)
+//			}
+//		]
+//	}
+func HandleReadyz(checks []health.Check) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		report := health.Run(r.Context(), checks)
+		jsonResp, err := json.Marshal(report)
+		if err != nil {
+			apierror.Write(w, r, apierror.Internal("Failed to create response", err))
+			return
+		}
+		status := http.StatusOK
+		if !report.OK() {
+			status = http.StatusServiceUnavailable
+			logger(r).Warn("Not ready", "checks", report.Checks)
+		}
+		w.WriteHeader(status)
+		_, err = w.Write(jsonResp)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+	}
+}
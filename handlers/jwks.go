@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/F0RG-2142/capstone-1/internal/apierror"
+)
+
+// Serves the public keys tokens are signed with as a JSON Web Key Set so other services can
+// validate our tokens. Empty when tokens are signed with the shared HS256 secret
+func (s *Server) HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if s.Tokens.Keys == nil {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"keys":[]}`))
+		return
+	}
+	jwks, err := s.Tokens.Keys.JWKS()
+	if err != nil {
+		logger(r).Error("Error encoding jwks", "err", err)
+		apierror.Write(w, r, apierror.Internal("Failed to create response", err))
+		return
+	}
+	//keep caching short so verifiers pick up rotated keys quickly, new keys wait out
+	//auth.KeyPublishDelay before signing, which must stay longer than this
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(jwks)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/F0RG-2142/capstone-1/internal/apierror"
+	"github.com/F0RG-2142/capstone-1/internal/auth"
+	"github.com/F0RG-2142/capstone-1/internal/database"
+	"github.com/F0RG-2142/capstone-1/internal/lockout"
+	"github.com/F0RG-2142/capstone-1/internal/metrics"
+)
+
+// A login attempt, throttled both on the client ip and on the account (email)
+type loginAttempt struct {
+	s     *Server
+	r     *http.Request
+	email string
+	keys  []throttleKey
+	// Rows of the keys the attempt was counted against by allowed
+	recorded []recordedAttempt
+}
+
+type throttleKey struct {
+	key    string
+	policy lockout.Policy
+}
+
+type recordedAttempt struct {
+	throttleKey
+	throttle database.LoginThrottle
+}
+
+func (s *Server) newLoginAttempt(r *http.Request, email string) *loginAttempt {
+	return &loginAttempt{
+		s:     s,
+		r:     r,
+		email: email,
+		//the ip goes first so a blocked ip doesn't count against the account
+		keys: []throttleKey{
+			{key: lockout.IPKey(lockout.ClientIP(r)), policy: lockout.IPPolicy},
+			{key: lockout.AccountKey(email), policy: lockout.AccountPolicy},
+		},
+	}
+}
+
+func (k throttleKey) attemptParams(now time.Time) database.RecordLoginAttemptParams {
+	return database.RecordLoginAttemptParams{
+		Key:              k.key,
+		LockoutAfter:     int32(k.policy.LockoutAfter),
+		LockoutSeconds:   k.policy.LockoutFor.Seconds(),
+		FreeAttempts:     int32(k.policy.FreeAttempts),
+		BaseDelaySeconds: k.policy.BaseDelay.Seconds(),
+		MaxDelaySeconds:  k.policy.MaxDelay.Seconds(),
+		WindowStart:      k.policy.WindowStart(now),
+	}
+}
+
+// Counts the attempt as a failure against every key before the password is checked, in one
+// statement per key, so concurrent attempts can't all get past the block the first of them sets.
+// Writes the error response, takes the attempt back and returns false when it has to be refused
+func (a *loginAttempt) allowed(w http.ResponseWriter, captchaToken string) bool {
+	now := a.s.now().UTC()
+	needsCaptcha := false
+	for _, k := range a.keys {
+		throttle, err := a.s.DB.RecordLoginAttempt(a.r.Context(), k.attemptParams(now))
+		if errors.Is(err, sql.ErrNoRows) {
+			a.refund()
+			a.blocked(w, k, now)
+			return false
+		}
+		if err != nil {
+			logger(a.r).Error("Error recording login attempt", "key", k.key, "err", err)
+			continue
+		}
+		a.recorded = append(a.recorded, recordedAttempt{throttleKey: k, throttle: throttle})
+		//failures before this attempt
+		if k.policy.NeedsCaptcha(int(throttle.Failures) - 1) {
+			needsCaptcha = true
+		}
+	}
+	if needsCaptcha && a.s.Captcha != nil {
+		if err := a.s.Captcha.Verify(a.r.Context(), captchaToken, lockout.ClientIP(a.r)); err != nil {
+			if !errors.Is(err, lockout.ErrCaptchaFailed) {
+				logger(a.r).Error("Error verifying captcha", "err", err)
+			}
+			a.refund()
+			metrics.AuthFailures.WithLabelValues(metrics.AuthLoginThrottled).Inc()
+			apierror.Write(w, a.r, apierror.Forbidden(apierror.CodeCaptchaRequired, "Captcha required").With("captcha_required", true))
+			return false
+		}
+	}
+	return true
+}
+
+// Refuses an attempt on a key that is backing off or locked. Only accounts can be unlocked
+// from the email, a locked ip has to wait
+func (a *loginAttempt) blocked(w http.ResponseWriter, k throttleKey, now time.Time) {
+	metrics.AuthFailures.WithLabelValues(metrics.AuthLoginThrottled).Inc()
+	throttle, err := a.s.DB.GetLoginThrottle(a.r.Context(), k.key)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		logger(a.r).Error("Error fetching login throttle", "key", k.key, "err", err)
+	}
+	//the block may have run out since it was recorded
+	retryAfter := max(int(math.Ceil(throttle.BlockedUntil.Sub(now).Seconds())), 1)
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	switch {
+	case throttle.Locked && k.key == lockout.AccountKey(a.email):
+		apierror.Write(w, a.r, apierror.New(http.StatusLocked, apierror.CodeAccountLocked, "Too many failed logins, this account is temporarily locked. Check your email to unlock it"))
+	case throttle.Locked:
+		apierror.Write(w, a.r, apierror.New(http.StatusTooManyRequests, apierror.CodeLoginThrottled, "Too many failed logins from your network, logins from it are blocked for a while"))
+	default:
+		apierror.Write(w, a.r, apierror.New(http.StatusTooManyRequests, apierror.CodeLoginThrottled, "Too many failed logins, please wait before trying again"))
+	}
+}
+
+// The attempt was already counted by allowed, the keys it locked get logged and the account
+// an unlock email
+func (a *loginAttempt) failed() {
+	metrics.AuthFailures.WithLabelValues(metrics.AuthLoginFailed).Inc()
+	for _, rec := range a.recorded {
+		if !rec.throttle.Locked || int(rec.throttle.Failures) != rec.policy.LockoutAfter {
+			continue
+		}
+		logger(a.r).Warn("Locked after too many failed logins", "key", rec.key, "failures", rec.throttle.Failures)
+		if rec.key == lockout.AccountKey(a.email) {
+			a.sendUnlockEmail(rec.key)
+		}
+	}
+}
+
+// A successful login resets the account's failures. The ip only gets this attempt back so an
+// attacker can't reset its count by logging into their own account
+func (a *loginAttempt) succeeded() {
+	if _, err := a.s.DB.ClearLoginThrottle(a.r.Context(), lockout.AccountKey(a.email)); err != nil {
+		logger(a.r).Error("Error clearing login throttle", "err", err)
+	}
+	a.recorded = slices.DeleteFunc(a.recorded, func(rec recordedAttempt) bool { return rec.key == lockout.AccountKey(a.email) })
+	a.refund()
+}
+
+// Takes the attempt back from every key it was counted against
+func (a *loginAttempt) refund() {
+	for _, rec := range a.recorded {
+		_, locked := rec.policy.BlockedUntil(int(rec.throttle.Failures)-1, time.Time{})
+		err := a.s.DB.RefundLoginAttempt(a.r.Context(), database.RefundLoginAttemptParams{
+			Failures: rec.throttle.Failures,
+			Locked:   locked,
+			Key:      rec.key,
+		})
+		if err != nil {
+			logger(a.r).Error("Error taking back login attempt", "key", rec.key, "err", err)
+		}
+	}
+	a.recorded = nil
+}
+
+func (a *loginAttempt) sendUnlockEmail(key string) {
+	//only real accounts get an email, the lockout itself applies either way so it doesn't reveal who has an account
+	user, err := a.s.DB.GetUserByEmail(a.r.Context(), a.email)
+	if err != nil {
+		return
+	}
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		logger(a.r).Error("Error generating unlock token", "err", err)
+		return
+	}
+	err = a.s.DB.NewUnlockToken(a.r.Context(), database.NewUnlockTokenParams{
+		TokenHash:   auth.HashAccessToken(token),
+		ThrottleKey: key,
+	})
+	if err != nil {
+		logger(a.r).Error("Error saving unlock token", "err", err)
+		return
+	}
+	unlockURL := a.s.UnlockURL + "?token=" + url.QueryEscape(token)
+	//sent before responding so shutdown waits for it. It only happens once per lockout, the timeout
+	//keeps a slow mail server from holding the request and a client hanging up from cancelling it
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(a.r.Context()), 10*time.Second)
+	defer cancel()
+	if err := a.s.Mailer.SendUnlockEmail(ctx, user.Email, unlockURL); err != nil {
+		logger(a.r).Error("Error sending unlock email", "err", err)
+	}
+}
+
+// Unlocks an account with the token from the unlock email, given as the "token" query parameter
+func (s *Server) HandleUnlockAccount(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		apierror.Write(w, r, apierror.InvalidParameter("token", "Missing unlock token"))
+		return
+	}
+	unlock, err := s.DB.ConsumeUnlockToken(r.Context(), auth.HashAccessToken(token))
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("Invalid or expired unlock token"))
+		return
+	}
+	if _, err := s.DB.ClearLoginThrottle(r.Context(), unlock.ThrottleKey); err != nil {
+		logger(r).Error("Error clearing login throttle", "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not unlock account"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write([]byte(`{"message":"Account unlocked, you can log in again"}`))
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+}
+
+// Lists accounts and ips that are currently backing off or locked. Returns:
+//
+//	[
+//		{
+//			"key":"account:user@example.com" or "ip:203.0.113.7"
+//			"created_at":"timestamp"
+//			"updated_at":"timestamp"
+//			"failures":"int"
+//			"last_failure_at":"timestamp"
+//			"blocked_until":"timestamp"
+//			"locked":"bool"
+//		}
+//	]
+func (s *Server) HandleGetLockouts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	throttles, err := s.DB.GetBlockedLoginThrottles(r.Context())
+	if err != nil {
+		logger(r).Error("Error fetching lockouts", "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not get lockouts"))
+		return
+	}
+	if throttles == nil {
+		throttles = []database.LoginThrottle{}
+	}
+	jsonResp, err := json.Marshal(throttles)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Failed to create response", err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(jsonResp)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+}
+
+// Clears the failures and any lockout for the key given in the url (e.g. account:user@example.com)
+func (s *Server) HandleClearLockout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	key := r.PathValue("key")
+	cleared, err := s.DB.ClearLoginThrottle(r.Context(), key)
+	if err != nil {
+		logger(r).Error("Error clearing lockout", "key", key, "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not clear lockout"))
+		return
+	}
+	if cleared == 0 {
+		apierror.Write(w, r, apierror.NotFound("Lockout not found"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
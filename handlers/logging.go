@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/F0RG-2142/capstone-1/internal/auth"
+	"github.com/F0RG-2142/capstone-1/internal/logging"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Gives every request an id, reusing the client's X-Request-ID when it is usable, echoes it in the
+// response and puts the server's logger tagged with it in the request context. Wrap it around
+// everything else
+func (s *Server) RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(logging.RequestIDHeader)
+		if !logging.ValidRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		w.Header().Set(logging.RequestIDHeader, id)
+		ctx := logging.ContextWithRequestID(r.Context(), id)
+		ctx = context.WithValue(ctx, accessLogKey{}, &accessLogEntry{})
+		ctx = logging.ContextWithLogger(ctx, s.logger().With("request_id", id))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+type accessLogKey struct{}
+
+// Put in the context by RequestID and filled in while the request is handled, the auth middleware
+// runs inside the mux so it can't hand the user back through the request context
+type accessLogEntry struct {
+	userID uuid.UUID
+}
+
+// Logs one line per request with the method, route pattern, status, latency and user. Only the
+// path is logged, query strings can carry tokens (e.g. the unlock link). Goes inside RequestID and
+// passes the request on as is, the mux sets the matched pattern on the request it is given
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry, ok := r.Context().Value(accessLogKey{}).(*accessLogEntry)
+		if !ok {
+			entry = &accessLogEntry{}
+		}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("route", r.Pattern),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+		}
+		if entry.userID != uuid.Nil {
+			attrs = append(attrs, slog.String("user_id", entry.userID.String()))
+		}
+		level := slog.LevelInfo
+		if rec.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		logger(r).LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
+
+// Logger of the request, tagged with its request id and, once authenticated, the user
+func logger(r *http.Request) *slog.Logger {
+	return logging.FromContext(r.Context())
+}
+
+// Stores the authenticated caller in the request and tags the request's log lines with them
+func withPrincipal(r *http.Request, p auth.Principal) *http.Request {
+	if entry, ok := r.Context().Value(accessLogKey{}).(*accessLogEntry); ok {
+		entry.userID = p.UserID
+	}
+	ctx := auth.ContextWithPrincipal(r.Context(), p)
+	ctx = logging.With(ctx, "user_id", p.UserID.String())
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("enduser.id", p.UserID.String()))
+	return r.WithContext(ctx)
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/F0RG-2142/capstone-1/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Serves the Prometheus metrics in the text exposition format
+var HandleMetrics = promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}).ServeHTTP
+
+// Keeps the status code written by the handler so middleware can report it
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// Records request counts, latency and in-flight requests. Wrap the whole mux with it, requests are
+// labelled with the route pattern the mux matched ("unmatched" for 404s and preflights)
+func Instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		metrics.HTTPInFlight.Inc()
+		defer metrics.HTTPInFlight.Dec()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		status := strconv.Itoa(rec.status)
+		metrics.HTTPRequests.WithLabelValues(route, status).Inc()
+		metrics.HTTPDuration.WithLabelValues(route, status).Observe(time.Since(start).Seconds())
+	})
+}
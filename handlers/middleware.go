@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/F0RG-2142/capstone-1/internal/apierror"
+	"github.com/F0RG-2142/capstone-1/internal/auth"
+	"github.com/F0RG-2142/capstone-1/internal/metrics"
+)
+
+// Realm sent in WWW-Authenticate challenges
+const authRealm = "znotes"
+
+var (
+	errNoCredentials     = errors.New("no auth token provided")
+	errInvalidAdminToken = errors.New("invalid admin token")
+)
+
+// Validates the bearer token (JWT or personal access token) once and stores the caller in the
+// request context. Responds 401 for missing or invalid credentials and 403 when an access token
+// lacks the scope the route needs
+func (s *Server) RequireAuth(scope string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, err := s.authenticate(r)
+			if err != nil {
+				unauthorized(w, r, err)
+				return
+			}
+			if !p.HasScope(scope) {
+				insufficientScope(w, r, scope)
+				return
+			}
+			next.ServeHTTP(w, withPrincipal(r, p))
+		})
+	}
+}
+
+// Like RequireAuth but only accepts logged in sessions, for account management that
+// personal access tokens must not be able to do
+func (s *Server) RequireSession() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, err := s.authenticate(r)
+			if err != nil {
+				unauthorized(w, r, err)
+				return
+			}
+			if !p.IsSession() {
+				metrics.AuthFailures.WithLabelValues(metrics.AuthSessionRequired).Inc()
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q, error="insufficient_scope", error_description="a login session is required"`, authRealm))
+				apierror.Write(w, r, apierror.Forbidden(apierror.CodeSessionRequired, "A login session is required, access tokens are not accepted here"))
+				return
+			}
+			next.ServeHTTP(w, withPrincipal(r, p))
+		})
+	}
+}
+
+// Protects admin endpoints with the static ADMIN_TOKEN. Admin endpoints are disabled
+// (always 401) when no admin token is configured. With a client CA configured the request must
+// also come with a client certificate the TLS handshake verified, otherwise it gets a 403
+func (s *Server) RequireAdmin() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if s.AdminClientCert && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+				metrics.AuthFailures.WithLabelValues(metrics.AuthClientCertMissing).Inc()
+				apierror.Write(w, r, apierror.Forbidden(apierror.CodeClientCertMissing, "A client certificate is required"))
+				return
+			}
+			token, err := auth.GetBearerToken(r.Header)
+			if err != nil {
+				unauthorized(w, r, errNoCredentials)
+				return
+			}
+			if s.AdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.AdminToken)) != 1 {
+				unauthorized(w, r, errInvalidAdminToken)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Caller stored by RequireAuth or RequireSession. Handlers behind either can rely on it being set
+func principal(r *http.Request) auth.Principal {
+	p, _ := auth.PrincipalFromContext(r.Context())
+	return p
+}
+
+// Resolves the caller behind the bearer token. JWTs from login may do anything, personal access
+// tokens are looked up by hash and must be active
+func (s *Server) authenticate(r *http.Request) (auth.Principal, error) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return auth.Principal{}, errNoCredentials
+	}
+	if !auth.IsAccessToken(token) {
+		userId, err := s.Tokens.ValidateJWT(token)
+		if err != nil {
+			return auth.Principal{}, errors.New("invalid or expired token")
+		}
+		user, err := s.DB.GetUserByID(r.Context(), userId)
+		if err != nil {
+			return auth.Principal{}, errors.New("user no longer exists")
+		}
+		return auth.SessionPrincipal(user.ID, user.HasNotesPremium), nil
+	}
+	apiToken, err := s.DB.GetAPITokenByHash(r.Context(), auth.HashAccessToken(token))
+	if err != nil {
+		return auth.Principal{}, errors.New("invalid access token")
+	}
+	if apiToken.RevokedAt.Valid {
+		return auth.Principal{}, errors.New("access token is revoked")
+	}
+	if apiToken.ExpiresAt.Valid && s.now().After(apiToken.ExpiresAt.Time) {
+		return auth.Principal{}, errors.New("access token is expired")
+	}
+	user, err := s.DB.GetUserByID(r.Context(), apiToken.UserID)
+	if err != nil {
+		return auth.Principal{}, errors.New("user no longer exists")
+	}
+	if err := s.DB.TouchAPIToken(r.Context(), apiToken.ID); err != nil {
+		logger(r).Error("Error updating last use of access token", "token_id", apiToken.ID, "err", err)
+	}
+	return auth.Principal{
+		UserID:     user.ID,
+		HasPremium: user.HasNotesPremium,
+		Scopes:     apiToken.Scopes,
+		TokenID:    apiToken.ID,
+	}, nil
+}
+
+// 401 with a RFC 6750 challenge
+func unauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errNoCredentials):
+		metrics.AuthFailures.WithLabelValues(metrics.AuthMissingCredentials).Inc()
+	case errors.Is(err, errInvalidAdminToken):
+		metrics.AuthFailures.WithLabelValues(metrics.AuthInvalidAdminToken).Inc()
+	default:
+		metrics.AuthFailures.WithLabelValues(metrics.AuthInvalidToken).Inc()
+	}
+	if errors.Is(err, errNoCredentials) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q`, authRealm))
+		apierror.Write(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, err.Error()))
+		return
+	}
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q, error="invalid_token", error_description=%q`, authRealm, err.Error()))
+	apierror.Write(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidToken, err.Error()))
+}
+
+func insufficientScope(w http.ResponseWriter, r *http.Request, scope string) {
+	metrics.AuthFailures.WithLabelValues(metrics.AuthInsufficientScope).Inc()
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q, error="insufficient_scope", scope=%q`, authRealm, scope))
+	apierror.Write(w, r, apierror.Forbidden(apierror.CodeInsufficientScope, "Access token is missing the "+scope+" scope").With("scope", scope))
+}
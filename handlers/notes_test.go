@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/F0RG-2142/capstone-1/internal/auth"
+	"github.com/F0RG-2142/capstone-1/internal/database"
+	"github.com/google/uuid"
+)
+
+// Creates a private note through the API and returns it
+func (ts *testServer) newNote(user testUser, body string) database.Note {
+	ts.t.Helper()
+	expectStatus(ts.t, ts.do("POST", "/api/v1/notes", user.Token, map[string]string{"body": body}), http.StatusCreated)
+	notes := decode[[]database.Note](ts.t, ts.do("GET", "/api/v1/notes", user.Token, nil))
+	for _, n := range notes {
+		if n.Body == body {
+			return n
+		}
+	}
+	ts.t.Fatalf("note %q was not created", body)
+	return database.Note{}
+}
+
+func TestPrivateNotes(t *testing.T) {
+	ts := newTestServer(t)
+	owner := ts.signUp("owner@example.com")
+	stranger := ts.signUp("stranger@example.com")
+	readOnly := ts.accessToken(owner, auth.ScopeNotesRead)
+
+	//nothing yet is an empty list, not null
+	if rec := ts.do("GET", "/api/v1/notes", owner.Token, nil); rec.Body.String() != "[]" {
+		t.Errorf("expected an empty list, got %s", rec.Body.String())
+	}
+	note := ts.newNote(owner, "first")
+	notePath := "/api/v1/notes/" + note.ID.String()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   any
+		want   int
+	}{
+		{name: "Create With Read Only Token", method: "POST", path: "/api/v1/notes", token: readOnly, body: map[string]string{"body": "x"}, want: http.StatusForbidden},
+		{name: "Create Malformed JSON", method: "POST", path: "/api/v1/notes", token: owner.Token, body: `{"body":`, want: http.StatusBadRequest},
+		{name: "Create Empty", method: "POST", path: "/api/v1/notes", token: owner.Token, body: map[string]string{"body": ""}, want: http.StatusUnprocessableEntity},
+		{name: "Get", method: "GET", path: notePath, token: owner.Token, want: http.StatusOK},
+		{name: "Get With Read Only Token", method: "GET", path: notePath, token: readOnly, want: http.StatusOK},
+		{name: "Get Bad ID", method: "GET", path: "/api/v1/notes/not-a-uuid", token: owner.Token, want: http.StatusBadRequest},
+		{name: "Get Unknown", method: "GET", path: "/api/v1/notes/" + uuid.NewString(), token: owner.Token, want: http.StatusNotFound},
+		{name: "Get Someone Elses", method: "GET", path: notePath, token: stranger.Token, want: http.StatusNotFound},
+		{name: "Update", method: "PUT", path: notePath, token: owner.Token, body: map[string]string{"note_name": "renamed", "note_body": "changed"}, want: http.StatusNoContent},
+		{name: "Update Bad ID", method: "PUT", path: "/api/v1/notes/not-a-uuid", token: owner.Token, body: map[string]string{"note_body": "x"}, want: http.StatusBadRequest},
+		{name: "Update Malformed JSON", method: "PUT", path: notePath, token: owner.Token, body: `[`, want: http.StatusBadRequest},
+		{name: "Update Someone Elses", method: "PUT", path: notePath, token: stranger.Token, body: map[string]string{"note_body": "mine now"}, want: http.StatusNotFound},
+		{name: "Update With Read Only Token", method: "PUT", path: notePath, token: readOnly, body: map[string]string{"note_body": "x"}, want: http.StatusForbidden},
+		{name: "Delete Someone Elses", method: "DELETE", path: notePath, token: stranger.Token, want: http.StatusNotFound},
+		{name: "Delete Bad ID", method: "DELETE", path: "/api/v1/notes/not-a-uuid", token: owner.Token, want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, ts.do(tt.method, tt.path, tt.token, tt.body), tt.want)
+		})
+	}
+
+	got := decode[database.Note](t, ts.do("GET", notePath, owner.Token, nil))
+	if got.Name != "renamed" || got.Body != "changed" || got.UserID != owner.ID {
+		t.Errorf("unexpected note after update: %+v", got)
+	}
+	if notes := decode[[]database.Note](t, ts.do("GET", "/api/v1/notes", stranger.Token, nil)); len(notes) != 0 {
+		t.Errorf("expected no notes for another user, got %+v", notes)
+	}
+	expectStatus(t, ts.do("DELETE", notePath, owner.Token, nil), http.StatusNoContent)
+	expectStatus(t, ts.do("DELETE", notePath, owner.Token, nil), http.StatusNotFound)
+	expectStatus(t, ts.do("GET", notePath, owner.Token, nil), http.StatusNotFound)
+}
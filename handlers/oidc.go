@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/F0RG-2142/capstone-1/internal/apierror"
+	"github.com/F0RG-2142/capstone-1/internal/auth"
+	"github.com/F0RG-2142/capstone-1/internal/database"
+	"github.com/F0RG-2142/capstone-1/internal/oidc"
+	"github.com/google/uuid"
+)
+
+// Starts an OpenID Connect login with the provider named in the url.
+// Redirects the client to the provider's authorization endpoint
+func (s *Server) HandleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	provider, ok := s.OIDC[r.PathValue("provider")]
+	if !ok {
+		apierror.Write(w, r, apierror.NotFound("Unknown identity provider"))
+		return
+	}
+	authURL, ok := s.startOIDCLogin(w, r, provider, uuid.NullUUID{})
+	if !ok {
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+type linkIdentityResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// Starts linking the identity provider named in the url to the signed in user, the only way an
+// identity gets attached to an existing account. The client opens the returned url in the browser
+// that received the state cookie, the callback then links the identity and logs in like login:
+//
+//	{
+//		"authorization_url":"string"
+//	}
+func (s *Server) HandleLinkIdentity(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	provider, ok := s.OIDC[r.PathValue("provider")]
+	if !ok {
+		apierror.Write(w, r, apierror.NotFound("Unknown identity provider"))
+		return
+	}
+	authURL, ok := s.startOIDCLogin(w, r, provider, uuid.NullUUID{UUID: principal(r).UserID, Valid: true})
+	if !ok {
+		return
+	}
+	respJSON, err := json.Marshal(linkIdentityResponse{AuthorizationURL: authURL})
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Failed to create response", err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(respJSON)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+}
+
+// Saves a new login state, sets its cookie and returns the provider's authorization url. A valid
+// linkUserID makes the callback link the identity to that user. Writes the error when it fails
+func (s *Server) startOIDCLogin(w http.ResponseWriter, r *http.Request, provider *oidc.Provider, linkUserID uuid.NullUUID) (string, bool) {
+	//state protects against csrf, nonce binds the id token to this login and the verifier is for PKCE
+	state, err := oidc.RandomString()
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Failed to start login", err))
+		return "", false
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Failed to start login", err))
+		return "", false
+	}
+	verifier, err := oidc.RandomString()
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Failed to start login", err))
+		return "", false
+	}
+	//clean up abandoned logins before adding a new one
+	if err := s.DB.DeleteExpiredOIDCLoginStates(r.Context()); err != nil {
+		logger(r).Error("Error deleting expired oidc login states", "err", err)
+	}
+	params := database.NewOIDCLoginStateParams{
+		State:        state,
+		Provider:     provider.Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		LinkUserID:   linkUserID,
+	}
+	if err := s.DB.NewOIDCLoginState(r.Context(), params); err != nil {
+		logger(r).Error("Error saving oidc login state", "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Failed to start login"))
+		return "", false
+	}
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		logger(r).Error("Error building auth url", "provider", provider.Name, "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusBadGateway, "Identity provider unavailable"))
+		return "", false
+	}
+	//ties the state to this browser, so a callback started elsewhere (login csrf) is refused
+	http.SetCookie(w, s.stateCookie(provider.Name, stateHash(state), int(oidcStateTTL.Seconds())))
+	return authURL, true
+}
+
+// Callback the identity provider redirects to with "code" and "state" query parameters.
+// Logs in the user the identity is linked to, links it to the user that started linking, or
+// creates a new user for a new identity with a verified email. Returns the same body as login:
+//
+//	{
+//		"id":"uuid"
+//		"created_at":"timestamp"
+//		"updated_at":"timestamp"
+//		"email":"string"
+//		"token":"string"
+//		"refresh_token":"string"
+//		"has_notes_premium":"bool"
+//	}
+func (s *Server) HandleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	provider, ok := s.OIDC[r.PathValue("provider")]
+	if !ok {
+		apierror.Write(w, r, apierror.NotFound("Unknown identity provider"))
+		return
+	}
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		apierror.Write(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "Login was cancelled or denied by the identity provider"))
+		return
+	}
+	code, state := query.Get("code"), query.Get("state")
+	if code == "" || state == "" {
+		apierror.Write(w, r, apierror.BadRequest("Missing code or state"))
+		return
+	}
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(stateHash(state))) != 1 {
+		apierror.Write(w, r, apierror.BadRequest("Login wasn't started from this browser"))
+		return
+	}
+	http.SetCookie(w, s.stateCookie(provider.Name, "", -1))
+	//state can only be used once
+	loginState, err := s.DB.ConsumeOIDCLoginState(r.Context(), database.ConsumeOIDCLoginStateParams{
+		State:    state,
+		Provider: provider.Name,
+	})
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("Invalid or expired login state"))
+		return
+	}
+	claims, err := provider.Exchange(r.Context(), code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		logger(r).Warn("Error completing oidc login", "provider", provider.Name, "err", err)
+		apierror.Write(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidCredential, "Could not verify identity"))
+		return
+	}
+	var user database.User
+	if loginState.LinkUserID.Valid {
+		user, err = s.linkIdentity(r, provider.Name, claims, loginState.LinkUserID.UUID)
+	} else {
+		user, err = s.userForIdentity(r, provider.Name, claims)
+	}
+	switch {
+	case errors.Is(err, errEmailUnverified):
+		apierror.Write(w, r, apierror.Forbidden(apierror.CodeForbidden, "The identity provider did not verify the email"))
+		return
+	case errors.Is(err, errEmailTaken):
+		apierror.Write(w, r, apierror.New(http.StatusConflict, apierror.CodeConflict, "An account with this email already exists, log in to it and link the identity provider from there"))
+		return
+	case errors.Is(err, errIdentityTaken):
+		apierror.Write(w, r, apierror.New(http.StatusConflict, apierror.CodeConflict, "This identity is linked to another account"))
+		return
+	case err != nil:
+		logger(r).Error("Error linking identity", "provider", provider.Name, "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not link identity to an account"))
+		return
+	}
+	token, err := s.Tokens.MakeJWT(user.ID, time.Hour)
+	if err != nil {
+		logger(r).Error("Error generating JWT", "user_id", user.ID, "err", err)
+		apierror.Write(w, r, apierror.Internal("Failed to generate access token", err))
+		return
+	}
+	refreshToken, _ := auth.MakeRefreshToken()
+	usrRefreshToken, err := s.DB.NewRefreshToken(r.Context(), database.NewRefreshTokenParams{
+		Token:  refreshToken,
+		UserID: user.ID,
+	})
+	if err != nil {
+		logger(r).Error("Error generating refresh token", "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Failed to generate refresh token"))
+		return
+	}
+	resp := loginResponse{
+		ID:                user.ID,
+		CreatedAt:         user.CreatedAt,
+		UpdatedAt:         user.UpdatedAt,
+		Email:             user.Email,
+		Token:             token,
+		RefreshToken:      usrRefreshToken.Token,
+		Has_notes_premium: user.HasNotesPremium,
+	}
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Failed to create response", err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(jsonResp)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+}
+
+// Cookie holding the hash of the state of a login in progress, lives as long as the state row
+const (
+	oidcStateCookie = "oidc_state"
+	oidcStateTTL    = 10 * time.Minute
+)
+
+// Short lived cookie scoped to the provider's routes. Lax so it's sent on the provider's redirect back,
+// a negative maxAge deletes it. Secure unless turned off for development, r.TLS is nil behind a proxy
+func (s *Server) stateCookie(provider, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/api/v1/auth/oidc/" + provider,
+		MaxAge:   maxAge,
+		Secure:   !s.InsecureCookies,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func stateHash(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+var (
+	errEmailUnverified = errors.New("identity provider did not return a verified email")
+	errEmailTaken      = errors.New("an account with the identity's email already exists")
+	errIdentityTaken   = errors.New("identity is linked to another account")
+)
+
+// Finds the user behind an external identity. A new identity only gets a new passwordless user,
+// and only when the provider has verified the email. It's never linked to an existing user by
+// email, local emails aren't verified so whoever registered one first could be someone else
+func (s *Server) userForIdentity(r *http.Request, provider string, claims *oidc.IDTokenClaims) (database.User, error) {
+	identity, err := s.DB.GetUserIdentity(r.Context(), database.GetUserIdentityParams{
+		Provider: provider,
+		Subject:  claims.Subject,
+	})
+	if err == nil {
+		return s.DB.GetUserByID(r.Context(), identity.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+	if claims.Email == "" || !claims.EmailVerified {
+		return database.User{}, errEmailUnverified
+	}
+	_, err = s.DB.GetUserByEmail(r.Context(), claims.Email)
+	if err == nil {
+		return database.User{}, errEmailTaken
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+	user, err := s.DB.CreateExternalUser(r.Context(), claims.Email)
+	if err != nil {
+		return database.User{}, err
+	}
+	if err := s.newIdentity(r, user.ID, provider, claims); err != nil {
+		return database.User{}, err
+	}
+	return user, nil
+}
+
+// Links the identity to the user that started linking it, already linked to them is fine
+func (s *Server) linkIdentity(r *http.Request, provider string, claims *oidc.IDTokenClaims, userID uuid.UUID) (database.User, error) {
+	identity, err := s.DB.GetUserIdentity(r.Context(), database.GetUserIdentityParams{
+		Provider: provider,
+		Subject:  claims.Subject,
+	})
+	switch {
+	case err == nil && identity.UserID != userID:
+		return database.User{}, errIdentityTaken
+	case errors.Is(err, sql.ErrNoRows):
+		if err := s.newIdentity(r, userID, provider, claims); err != nil {
+			return database.User{}, err
+		}
+	case err != nil:
+		return database.User{}, err
+	}
+	return s.DB.GetUserByID(r.Context(), userID)
+}
+
+func (s *Server) newIdentity(r *http.Request, userID uuid.UUID, provider string, claims *oidc.IDTokenClaims) error {
+	_, err := s.DB.NewUserIdentity(r.Context(), database.NewUserIdentityParams{
+		UserID:   userID,
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+	return err
+}
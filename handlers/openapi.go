@@ -0,0 +1,491 @@
+package handlers
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/F0RG-2142/capstone-1/internal/apierror"
+	"github.com/F0RG-2142/capstone-1/internal/auth"
+	"github.com/F0RG-2142/capstone-1/internal/database"
+	"github.com/F0RG-2142/capstone-1/internal/entitlements"
+	"github.com/F0RG-2142/capstone-1/internal/health"
+	"github.com/F0RG-2142/capstone-1/internal/openapi"
+	"github.com/F0RG-2142/capstone-1/internal/payments"
+)
+
+// Where the specification and its docs page are served
+const (
+	openAPIPath = "/api/v1/openapi.json"
+	docsPath    = "/api/v1/docs"
+)
+
+const apiVersion = "0.0.7"
+
+// Security scheme names
+const (
+	schemeBearer    = "bearerAuth"
+	schemeSession   = "sessionAuth"
+	schemeRefresh   = "refreshToken"
+	schemeAdmin     = "adminToken"
+	schemeSignature = "webhookSignature"
+)
+
+// What protects a route, mirrors the middleware it is wrapped in by RegisterRoutes
+type access int
+
+const (
+	public access = iota
+	// RequireAuth, a session or an access token with the scope
+	scoped
+	// RequireSession
+	session
+	// Bearer refresh token checked by the handler
+	refresh
+	// RequireAdmin
+	admin
+	// Signed with the payment webhook secret
+	signed
+)
+
+// One route of the spec. Error responses every route of its kind can give (bad bodies, missing
+// credentials, rate limits, a failing database outside of monitoring) are added from access, body,
+// rateLimited and tag, errors lists the rest
+type route struct {
+	summary     string
+	description string
+	tag         string
+	access      access
+	scope       string
+	rateLimited bool
+	params      []*openapi.Parameter
+	body        *openapi.Schema
+	status      int
+	// Description of the success response
+	returns string
+	resp    *openapi.Schema
+	// Content type of resp when it isn't JSON
+	respType string
+	errors   []int
+	// Responses that aren't problem details, like a 503 with the health report
+	other map[int]*openapi.Response
+}
+
+// The OpenAPI document of every route RegisterRoutes adds. Keep both in step, TestOpenAPICoversRoutes
+// fails when a route isn't in here
+func (s *Server) OpenAPI() *openapi.Document {
+	doc := openapi.New(openapi.Info{
+		Title:   "ZNotes API",
+		Version: apiVersion,
+		Description: "Notes, teams and team notes behind JWT sessions or personal access tokens. " +
+			"Errors are application/problem+json with a stable code.",
+	})
+	doc.Tags = []openapi.Tag{
+		{Name: "users", Description: "Registration, login, sessions and personal access tokens"},
+		{Name: "oidc", Description: "Login with an external identity provider"},
+		{Name: "notes", Description: "Private notes"},
+		{Name: "teams", Description: "Teams and their members"},
+		{Name: "team notes", Description: "Notes shared with a team"},
+		{Name: "payments", Description: "Payment platform webhooks and stored events"},
+		{Name: "admin", Description: "Operator endpoints behind the admin token"},
+		{Name: "monitoring", Description: "Health checks, metrics, keys and this document"},
+	}
+	doc.Components.SecuritySchemes = map[string]*openapi.SecurityScheme{
+		schemeBearer: {Type: "http", Scheme: "bearer", BearerFormat: "JWT or znpat_ access token",
+			Description: "A session JWT or a personal access token. Sessions have every scope, access tokens only the ones they were created with"},
+		schemeSession: {Type: "http", Scheme: "bearer", BearerFormat: "JWT", Description: "A session JWT, access tokens are refused"},
+		schemeRefresh: {Type: "http", Scheme: "bearer", Description: "The refresh token from login"},
+		schemeAdmin:   {Type: "http", Scheme: "bearer", Description: "The ADMIN_TOKEN, plus a verified TLS client certificate when TLS_CLIENT_CA_FILE (tls.client_ca_file) is set"},
+		schemeSignature: {Type: "apiKey", In: "header", Name: payments.SignatureHeader,
+			Description: "HMAC of the body with the shared webhook secret, see payments.VerifySignature"},
+	}
+	problem := doc.Response(apierror.Problem{})
+
+	add := func(pattern string, rt route) {
+		op := &openapi.Operation{
+			OperationID: operationID(pattern),
+			Summary:     rt.summary,
+			Description: rt.description,
+			Tags:        []string{rt.tag},
+			Parameters:  rt.params,
+			Responses:   map[string]*openapi.Response{},
+		}
+		//ids in the url are uuids unless the route says otherwise
+		_, path, _ := strings.Cut(pattern, " ")
+		for _, name := range pathParams(path) {
+			if op.Parameter(name, "path") == nil && strings.HasSuffix(name, "ID") {
+				op.Parameters = append(op.Parameters, &openapi.Parameter{Name: name, In: "path", Required: true, Schema: &openapi.Schema{Type: "string", Format: "uuid"}})
+				rt.errors = append(rt.errors, http.StatusBadRequest)
+			}
+		}
+		if rt.body != nil {
+			op.RequestBody = openapi.JSONBody(rt.body)
+			rt.errors = append(rt.errors, http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity)
+		}
+		switch rt.access {
+		case scoped:
+			op.Security = []openapi.SecurityRequirement{{schemeBearer: {rt.scope}}}
+			rt.errors = append(rt.errors, http.StatusUnauthorized, http.StatusForbidden)
+		case session:
+			op.Security = []openapi.SecurityRequirement{{schemeSession: {}}}
+			rt.errors = append(rt.errors, http.StatusUnauthorized, http.StatusForbidden)
+		case refresh:
+			op.Security = []openapi.SecurityRequirement{{schemeRefresh: {}}}
+			rt.errors = append(rt.errors, http.StatusUnauthorized)
+		case admin:
+			op.Security = []openapi.SecurityRequirement{{schemeAdmin: {}}}
+			rt.errors = append(rt.errors, http.StatusUnauthorized, http.StatusForbidden)
+		case signed:
+			op.Security = []openapi.SecurityRequirement{{schemeSignature: {}}}
+			rt.errors = append(rt.errors, http.StatusUnauthorized)
+		}
+		if rt.rateLimited {
+			rt.errors = append(rt.errors, http.StatusTooManyRequests)
+		}
+		if rt.tag != "monitoring" {
+			rt.errors = append(rt.errors, http.StatusFailedDependency)
+		}
+		respType := rt.respType
+		if respType == "" {
+			respType = "application/json"
+		}
+		op.Responses[strconv.Itoa(rt.status)] = openapi.ContentResponse(rt.returns, respType, rt.resp)
+		for _, status := range append(rt.errors, http.StatusInternalServerError) {
+			resp := openapi.ContentResponse(http.StatusText(status), apierror.ContentType, problem)
+			if status == http.StatusTooManyRequests || status == http.StatusLocked {
+				resp.Headers = map[string]*openapi.Header{
+					"Retry-After": {Description: "Seconds to wait before trying again", Schema: &openapi.Schema{Type: "integer"}},
+				}
+			}
+			op.Responses[strconv.Itoa(status)] = resp
+		}
+		for status, resp := range rt.other {
+			op.Responses[strconv.Itoa(status)] = resp
+		}
+		doc.Add(pattern, op)
+	}
+
+	uuidParam := func(name, description string) *openapi.Parameter {
+		return &openapi.Parameter{Name: name, In: "path", Required: true, Description: description, Schema: &openapi.Schema{Type: "string", Format: "uuid"}}
+	}
+	statusBody := &openapi.Schema{Type: "object", Required: []string{"status"}, Properties: map[string]*openapi.Schema{
+		"status": {Type: "string", Enum: []any{health.StatusOK, health.StatusFail}},
+	}}
+	message := &openapi.Schema{Type: "object", Required: []string{"message"}, Properties: map[string]*openapi.Schema{
+		"message": {Type: "string"},
+	}}
+	providerParam := &openapi.Parameter{Name: "provider", In: "path", Required: true, Description: "Name of a configured identity provider", Schema: &openapi.Schema{Type: "string"}}
+	for _, name := range slices.Sorted(maps.Keys(s.OIDC)) {
+		providerParam.Schema.Enum = append(providerParam.Schema.Enum, name)
+	}
+	scopes := &openapi.Schema{Type: "string"}
+	for _, scope := range auth.AllScopes {
+		scopes.Enum = append(scopes.Enum, scope)
+	}
+	tokenRequest := doc.Request(newAccessTokenRequest{})
+	doc.Components.Schemas["NewAccessTokenRequest"].Properties["scopes"].Items = scopes
+
+	//Utility and admin
+	add("GET /livez", route{
+		summary: "Liveness probe", tag: "monitoring",
+		description: "200 while the process is serving at all, dependencies aren't checked",
+		status:      http.StatusOK, returns: "The process is live", resp: statusBody,
+		other: map[int]*openapi.Response{http.StatusServiceUnavailable: openapi.ContentResponse("The process is shutting down", "text/plain", statusBody)},
+	})
+	add("GET /readyz", route{
+		summary: "Readiness probe", tag: "monitoring",
+		description: "Runs every dependency check, 503 with the same body when one fails",
+		status:      http.StatusOK, returns: "Every check passed", resp: doc.Response(health.Report{}),
+		other: map[int]*openapi.Response{http.StatusServiceUnavailable: openapi.JSONResponse("A check failed", doc.Response(health.Report{}))},
+	})
+	add("GET /api/v1/healthz", route{
+		summary: "Readiness probe (deprecated)", tag: "monitoring",
+		description: "Same as /readyz, kept for existing clients",
+		status:      http.StatusOK, returns: "Every check passed", resp: doc.Response(health.Report{}),
+		other: map[int]*openapi.Response{http.StatusServiceUnavailable: openapi.JSONResponse("A check failed", doc.Response(health.Report{}))},
+	})
+	add("GET /api/v1/admin/metrics", route{
+		summary: "Prometheus metrics", tag: "monitoring", access: admin,
+		status: http.StatusOK, returns: "Metrics in the Prometheus text format", resp: &openapi.Schema{Type: "string"}, respType: "text/plain",
+	})
+	add("POST /api/v1/payment/webhooks", route{
+		summary: "Payment platform webhook", tag: "payments", access: signed,
+		description: "Events are stored by id so redeliveries are only applied once. Failed events answer 500 so the platform retries them, " +
+			"a delivery arriving while another one is still applying the event gets a 409",
+		//id and event aren't listed as required, the handler checks them only once the signature is
+		//verified and answers 400 rather than 422 when they are missing
+		body: &openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{
+			"id":    {Type: "string", Description: "Required"},
+			"event": {Type: "string", Description: "Required"},
+			"data":  {Type: "object"},
+		}},
+		status: http.StatusNoContent, returns: "The event was applied",
+		errors: []int{http.StatusConflict},
+		other:  map[int]*openapi.Response{http.StatusOK: openapi.JSONResponse("A redelivery of an event that was already processed", message)},
+	})
+	add("GET /.well-known/jwks.json", route{
+		summary: "JSON Web Key Set", tag: "monitoring",
+		description: "Public keys JWTs are signed with. Empty when tokens are signed with the shared HS256 secret",
+		status:      http.StatusOK, returns: "The key set",
+		resp: &openapi.Schema{Type: "object", Required: []string{"keys"}, Properties: map[string]*openapi.Schema{
+			"keys": {Type: "array", Items: &openapi.Schema{Type: "object", Required: []string{"kty", "kid"}}},
+		}},
+	})
+	add("GET /api/v1/admin/lockouts", route{
+		summary: "List login lockouts", tag: "admin", access: admin,
+		status: http.StatusOK, returns: "Accounts and ips backing off or locked", resp: doc.Response([]database.LoginThrottle{}),
+	})
+	add("DELETE /api/v1/admin/lockouts/{key}", route{
+		summary: "Clear a login lockout", tag: "admin", access: admin,
+		params: []*openapi.Parameter{{Name: "key", In: "path", Required: true, Description: "account:<email> or ip:<address>", Schema: &openapi.Schema{Type: "string"}}},
+		status: http.StatusNoContent, returns: "The lockout was cleared",
+		errors: []int{http.StatusNotFound},
+	})
+	add("GET /api/v1/admin/payment-events", route{
+		summary: "List stored payment events", tag: "admin", access: admin,
+		params: []*openapi.Parameter{
+			{Name: "status", In: "query", Schema: &openapi.Schema{Type: "string", Enum: []any{paymentEventReceived, paymentEventProcessing, paymentEventProcessed, paymentEventIgnored, paymentEventFailed}}},
+			{Name: "limit", In: "query", Description: "Defaults to 50", Schema: &openapi.Schema{Type: "integer", Minimum: float(1), Maximum: float(500)}},
+		},
+		status: http.StatusOK, returns: "Newest events first", resp: doc.Response([]paymentEventResponse{}),
+		errors: []int{http.StatusBadRequest},
+	})
+	add("POST /api/v1/admin/payment-events/{eventID}/reprocess", route{
+		summary: "Apply a stored payment event again", tag: "admin", access: admin,
+		params: []*openapi.Parameter{{Name: "eventID", In: "path", Required: true, Description: "Id the payment platform gave the event", Schema: &openapi.Schema{Type: "string"}}},
+		status: http.StatusOK, returns: "The event after processing", resp: doc.Response(paymentEventResponse{}),
+		errors: []int{http.StatusNotFound},
+	})
+	//Users and auth
+	add("POST /api/v1/register", route{
+		summary: "Register a user", tag: "users", rateLimited: true,
+		body:   doc.Request(newUserRequest{}),
+		status: http.StatusCreated, returns: "The new user", resp: doc.Response(database.User{}),
+		errors: []int{http.StatusConflict},
+	})
+	add("POST /api/v1/login", route{
+		summary: "Log in", tag: "users", rateLimited: true,
+		description: "Repeated failures back off with 429 and eventually lock the account (423) until the emailed unlock link is followed. " +
+			"With a CAPTCHA configured, logins after failures need captcha_token (403 captcha_required)",
+		body:   doc.Request(loginRequest{}),
+		status: http.StatusOK, returns: "A session and refresh token", resp: doc.Response(loginResponse{}),
+		errors: []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusLocked},
+	})
+	add("GET /api/v1/login/unlock", route{
+		summary: "Unlock an account", tag: "users", rateLimited: true,
+		params: []*openapi.Parameter{{Name: "token", In: "query", Required: true, Description: "Token from the unlock email", Schema: &openapi.Schema{Type: "string"}}},
+		status: http.StatusOK, returns: "The account is unlocked", resp: message,
+		errors: []int{http.StatusBadRequest},
+	})
+	add("POST /api/v1/logout", route{
+		summary: "Revoke a refresh token", tag: "users", access: refresh, rateLimited: true,
+		status: http.StatusNoContent, returns: "The refresh token is revoked",
+	})
+	add("POST /api/v1/token/refresh", route{
+		summary: "Get a new session JWT", tag: "users", access: refresh, rateLimited: true,
+		description: "JWTs expire after an hour, clients refresh them shortly before",
+		status:      http.StatusOK, returns: "A new JWT", resp: doc.Response(refreshResponse{}),
+	})
+	add("PUT /api/v1/user/me", route{
+		summary: "Update email and password", tag: "users", access: session, rateLimited: true,
+		body:   doc.Request(updateUserRequest{}),
+		status: http.StatusOK, returns: "The updated user", resp: doc.Response(database.User{}),
+		errors: []int{http.StatusConflict},
+	})
+	add("POST /api/v1/user/me/tokens", route{
+		summary: "Create a personal access token", tag: "users", access: session, rateLimited: true,
+		body:   tokenRequest,
+		status: http.StatusCreated, returns: "The token, the only time it is shown", resp: doc.Response(accessTokenResponse{}),
+		errors: []int{http.StatusPaymentRequired},
+	})
+	add("GET /api/v1/user/me/subscription", route{
+		summary: "Get the subscription", tag: "users", access: session, rateLimited: true,
+		status: http.StatusOK, returns: "Plan and subscription status", resp: doc.Response(subscriptionResponse{}),
+	})
+	add("GET /api/v1/user/me/usage", route{
+		summary: "Get usage against plan limits", tag: "users", access: session, rateLimited: true,
+		description: "Usage is keyed by limit: " + strings.Join(entitlements.LimitNames, ", "),
+		status:      http.StatusOK, returns: "The plan and its usage", resp: doc.Response(usageResponse{}),
+	})
+	add("GET /api/v1/user/me/tokens", route{
+		summary: "List personal access tokens", tag: "users", access: session, rateLimited: true,
+		status: http.StatusOK, returns: "Every token, without the secret", resp: doc.Response([]accessTokenResponse{}),
+	})
+	add("DELETE /api/v1/user/me/tokens/{tokenID}", route{
+		summary: "Revoke a personal access token", tag: "users", access: session, rateLimited: true,
+		status: http.StatusNoContent, returns: "The token is revoked",
+		errors: []int{http.StatusNotFound},
+	})
+	//External identity providers
+	add("GET /api/v1/auth/oidc/{provider}/login", route{
+		summary: "Log in with an identity provider", tag: "oidc", rateLimited: true,
+		description: "Sets a short lived oidc_state cookie the callback checks the state against",
+		params:      []*openapi.Parameter{providerParam},
+		status:      http.StatusFound, returns: "Redirect to the provider's authorization endpoint",
+		errors: []int{http.StatusNotFound, http.StatusFailedDependency, http.StatusBadGateway},
+	})
+	add("GET /api/v1/auth/oidc/{provider}/callback", route{
+		summary: "Identity provider callback", tag: "oidc", rateLimited: true,
+		description: "The provider redirects here, in the browser holding the oidc_state cookie from the login. Logs in the identity's user, links it when linking was started, or creates a user for a new identity with a verified email. A new identity is never linked to an existing account by email",
+		params: []*openapi.Parameter{
+			providerParam,
+			{Name: "code", In: "query", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "state", In: "query", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "error", In: "query", Description: "Set by the provider when the login was denied", Schema: &openapi.Schema{Type: "string"}},
+		},
+		status: http.StatusOK, returns: "A session and refresh token, like login", resp: doc.Response(loginResponse{}),
+		errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusFailedDependency, http.StatusBadGateway},
+	})
+	add("POST /api/v1/user/me/identities/{provider}", route{
+		summary: "Link an identity provider", tag: "oidc", access: session, rateLimited: true,
+		description: "Sets the oidc_state cookie like login. Open the returned url in the same browser, the callback links the identity to this account",
+		params:      []*openapi.Parameter{providerParam},
+		status:      http.StatusOK, returns: "The provider's authorization endpoint", resp: doc.Response(linkIdentityResponse{}),
+		errors: []int{http.StatusNotFound, http.StatusBadGateway},
+	})
+	//Private Notes
+	add("POST /api/v1/notes", route{
+		summary: "Create a note", tag: "notes", access: scoped, scope: auth.ScopeNotesWrite, rateLimited: true,
+		body:   doc.Request(noteRequest{}),
+		status: http.StatusCreated, returns: "The note was created",
+		errors: []int{http.StatusPaymentRequired},
+	})
+	add("GET /api/v1/notes", route{
+		summary: "List notes", tag: "notes", access: scoped, scope: auth.ScopeNotesRead, rateLimited: true,
+		status: http.StatusOK, returns: "Every private note of the caller", resp: doc.Response([]database.Note{}),
+		errors: []int{http.StatusBadGateway},
+	})
+	add("GET /api/v1/notes/{noteID}", route{
+		summary: "Get a note", tag: "notes", access: scoped, scope: auth.ScopeNotesRead, rateLimited: true,
+		status: http.StatusOK, returns: "The note", resp: doc.Response(database.Note{}),
+		errors: []int{http.StatusNotFound},
+	})
+	add("PUT /api/v1/notes/{noteID}", route{
+		summary: "Update a note", tag: "notes", access: scoped, scope: auth.ScopeNotesWrite, rateLimited: true,
+		body:   doc.Request(updateNoteRequest{}),
+		status: http.StatusNoContent, returns: "The note was updated",
+		errors: []int{http.StatusNotFound},
+	})
+	add("DELETE /api/v1/notes/{noteID}", route{
+		summary: "Delete a note", tag: "notes", access: scoped, scope: auth.ScopeNotesWrite, rateLimited: true,
+		status: http.StatusNoContent, returns: "The note was deleted",
+		errors: []int{http.StatusNotFound},
+	})
+	//Teams
+	add("POST /api/v1/teams", route{
+		summary: "Create a team", tag: "teams", access: scoped, scope: auth.ScopeTeamsWrite, rateLimited: true,
+		description: "The caller joins the new team as its admin",
+		body:        doc.Request(newTeamRequest{}),
+		status:      http.StatusCreated, returns: "The new team", resp: doc.Response(database.Team{}),
+		errors: []int{http.StatusPaymentRequired},
+	})
+	add("GET /api/v1/teams", route{
+		summary: "List teams", tag: "teams", access: scoped, scope: auth.ScopeTeamsRead, rateLimited: true,
+		status: http.StatusOK, returns: "Every team the caller is in", resp: doc.Response([]database.Team{}),
+	})
+	add("GET /api/v1/teams/{teamID}", route{
+		summary: "Get a team", tag: "teams", access: scoped, scope: auth.ScopeTeamsRead, rateLimited: true,
+		status: http.StatusOK, returns: "The team", resp: doc.Response(database.Team{}),
+		errors: []int{http.StatusNotFound},
+	})
+	add("DELETE /api/v1/teams/{teamID}", route{
+		summary: "Delete a team", tag: "teams", access: scoped, scope: auth.ScopeTeamsAdmin, rateLimited: true,
+		description: "Only admins of the team can delete it",
+		status:      http.StatusNoContent, returns: "The team was deleted",
+		errors: []int{http.StatusNotFound},
+	})
+	add("POST /api/v1/teams/{teamID}/members", route{
+		summary: "Add a member", tag: "teams", access: scoped, scope: auth.ScopeTeamsAdmin, rateLimited: true,
+		description: "Only admins of the team can add members, the team's plan limits the number of seats",
+		params:      []*openapi.Parameter{uuidParam("teamID", "Team to add the user to")},
+		body:        doc.Request(addTeamMemberRequest{}),
+		status:      http.StatusNoContent, returns: "The user was added",
+		errors: []int{http.StatusPaymentRequired, http.StatusNotFound, http.StatusConflict},
+	})
+	add("DELETE /api/v1/teams/{teamID}/members/{memberID}", route{
+		summary: "Remove a member", tag: "teams", access: scoped, scope: auth.ScopeTeamsAdmin, rateLimited: true,
+		status: http.StatusNoContent, returns: "The user was removed",
+		errors: []int{http.StatusNotFound},
+	})
+	add("GET /api/v1/teams/{teamID}/subscription", route{
+		summary: "Get the team subscription", tag: "teams", access: scoped, scope: auth.ScopeTeamsRead, rateLimited: true,
+		status: http.StatusOK, returns: "Plan and seats of the team", resp: doc.Response(teamSubscriptionResponse{}),
+		errors: []int{http.StatusNotFound},
+	})
+	add("GET /api/v1/teams/{teamID}/members", route{
+		summary: "List members", tag: "teams", access: scoped, scope: auth.ScopeTeamsRead, rateLimited: true,
+		status: http.StatusOK, returns: "Every member with their role", resp: doc.Response([]database.UserTeam{}),
+		errors: []int{http.StatusNotFound},
+	})
+	//Team Notes
+	add("POST /api/v1/teams/{teamID}/notes", route{
+		summary: "Create a team note", tag: "team notes", access: scoped, scope: auth.ScopeNotesWrite, rateLimited: true,
+		description: "Admins and editors of the team can post",
+		body:        doc.Request(noteRequest{}),
+		status:      http.StatusCreated, returns: "The note was created",
+		errors: []int{http.StatusPaymentRequired, http.StatusNotFound},
+	})
+	add("GET /api/v1/teams/{teamID}/notes", route{
+		summary: "List team notes", tag: "team notes", access: scoped, scope: auth.ScopeNotesRead, rateLimited: true,
+		status: http.StatusOK, returns: "Every note shared with the team", resp: doc.Response([]database.Note{}),
+		errors: []int{http.StatusNotFound},
+	})
+	add("GET /api/v1/teams/{teamID}/notes/{noteID}", route{
+		summary: "Get a team note", tag: "team notes", access: scoped, scope: auth.ScopeNotesRead, rateLimited: true,
+		status: http.StatusOK, returns: "The note", resp: doc.Response(database.Note{}),
+		errors: []int{http.StatusNotFound},
+	})
+	add("PUT /api/v1/teams/{teamID}/notes/{noteID}", route{
+		summary: "Update a team note", tag: "team notes", access: scoped, scope: auth.ScopeNotesWrite, rateLimited: true,
+		description: "Admins and editors of the team can update notes",
+		body:        doc.Request(noteRequest{}),
+		status:      http.StatusNoContent, returns: "The note was updated",
+		errors: []int{http.StatusNotFound},
+	})
+	add("DELETE /api/v1/teams/{teamID}/notes/{noteID}", route{
+		summary: "Delete a team note", tag: "team notes", access: scoped, scope: auth.ScopeNotesWrite, rateLimited: true,
+		description: "Only admins of the team can delete notes",
+		status:      http.StatusNoContent, returns: "The note was deleted",
+		errors: []int{http.StatusNotFound},
+	})
+	//This document
+	add("GET "+openAPIPath, route{
+		summary: "OpenAPI document", tag: "monitoring",
+		status: http.StatusOK, returns: "This document", resp: &openapi.Schema{Type: "object"},
+	})
+	add("GET "+docsPath, route{
+		summary: "API docs page", tag: "monitoring",
+		status: http.StatusOK, returns: "A page rendering this document", resp: &openapi.Schema{Type: "string"}, respType: "text/html",
+	})
+	return doc
+}
+
+// "GET /api/v1/teams/{teamID}/notes" becomes "get_api_v1_teams_teamID_notes"
+func operationID(pattern string) string {
+	method, path, _ := strings.Cut(pattern, " ")
+	return strings.ToLower(method) + strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '-', '.':
+			return '_'
+		case '{', '}':
+			return -1
+		}
+		return r
+	}, path)
+}
+
+func pathParams(path string) []string {
+	var names []string
+	for _, segment := range strings.Split(path, "/") {
+		if name, ok := strings.CutPrefix(segment, "{"); ok {
+			names = append(names, strings.TrimSuffix(name, "}"))
+		}
+	}
+	return names
+}
+
+func float(f float64) *float64 {
+	return &f
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/F0RG-2142/capstone-1/internal/openapi"
+)
+
+// Router that only remembers the patterns
+type patternRecorder []string
+
+func (p *patternRecorder) Handle(pattern string, handler http.Handler) {
+	*p = append(*p, pattern)
+}
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	ts := newTestServer(t)
+	var routes patternRecorder
+	ts.srv.RegisterRoutes(&routes)
+	doc := ts.srv.OpenAPI()
+
+	for _, pattern := range routes {
+		method, path, _ := strings.Cut(pattern, " ")
+		if doc.Operation(method, path) == nil {
+			t.Errorf("route %q is missing from the OpenAPI document", pattern)
+		}
+	}
+	for _, pattern := range doc.Patterns() {
+		if !slices.Contains(routes, pattern) {
+			t.Errorf("OpenAPI document has %q but no such route is registered", pattern)
+		}
+	}
+}
+
+func TestOpenAPIOperations(t *testing.T) {
+	doc := newTestServer(t).srv.OpenAPI()
+	for _, pattern := range doc.Patterns() {
+		method, path, _ := strings.Cut(pattern, " ")
+		op := doc.Operation(method, path)
+		if op.Summary == "" || len(op.Tags) == 0 {
+			t.Errorf("%s needs a summary and a tag", pattern)
+		}
+		for _, name := range pathParams(path) {
+			if p := op.Parameter(name, "path"); p == nil || !p.Required {
+				t.Errorf("%s doesn't declare the path parameter %q", pattern, name)
+			}
+		}
+		success := false
+		for status := range op.Responses {
+			success = success || strings.HasPrefix(status, "2") || status == "302"
+		}
+		if !success {
+			t.Errorf("%s has no success response", pattern)
+		}
+	}
+}
+
+func TestOpenAPIServed(t *testing.T) {
+	ts := newTestServer(t)
+
+	rec := ts.do("GET", openAPIPath, "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	doc := decode[openapi.Document](t, rec)
+	if doc.OpenAPI != openapi.Version || len(doc.Paths) == 0 || doc.Components.Schemas["Problem"] == nil {
+		t.Errorf("unexpected document: openapi %q with %d paths", doc.OpenAPI, len(doc.Paths))
+	}
+
+	rec = ts.do("GET", docsPath, "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("expected an html page, got %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), openAPIPath) {
+		t.Error("expected the page to load the document")
+	}
+	if rec.Header().Get("Content-Security-Policy") == "" {
+		t.Error("expected the page to have a content security policy")
+	}
+}
@@ -0,0 +1,383 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/F0RG-2142/capstone-1/internal/apierror"
+	"github.com/F0RG-2142/capstone-1/internal/billing"
+	"github.com/F0RG-2142/capstone-1/internal/database"
+	"github.com/F0RG-2142/capstone-1/internal/logging"
+	"github.com/F0RG-2142/capstone-1/internal/payments"
+	"github.com/google/uuid"
+)
+
+// Payment event statuses, see the payment_events table
+const (
+	paymentEventReceived   = "received"
+	paymentEventProcessing = "processing"
+	paymentEventProcessed  = "processed"
+	paymentEventIgnored    = "ignored"
+	paymentEventFailed     = "failed"
+)
+
+// Webhook bodies are small, anything bigger isn't from the payment platform
+const maxWebhookBytes = 64 << 10
+
+// Receives payment platform webhooks. The body must be signed with the shared webhook secret
+// (see payments.VerifySignature), events are stored by id so redeliveries are only applied once.
+// Failed events respond 500 so the platform retries them, deliveries racing one that is still
+// being applied get a 409
+func (s *Server) HandlePaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBytes))
+	if err != nil {
+		apierror.Write(w, r, apierror.InvalidBody(err))
+		return
+	}
+	defer r.Body.Close()
+	err = payments.VerifySignature(payload, r.Header.Get(payments.SignatureHeader), s.PaymentWebhookSecret, payments.DefaultTolerance, s.now())
+	if err != nil {
+		logger(r).Warn("Rejected payment webhook", "err", err)
+		apierror.Write(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidSignature, "Invalid webhook signature"))
+		return
+	}
+	event, err := payments.ParseEvent(payload)
+	if err != nil {
+		logger(r).Warn("Error decoding payment event", "err", err)
+		apierror.Write(w, r, apierror.InvalidBody(err))
+		return
+	}
+	_, err = s.DB.NewPaymentEvent(r.Context(), database.NewPaymentEventParams{
+		ID:        event.ID,
+		EventType: event.Type,
+		Payload:   payload,
+	})
+	//sql.ErrNoRows is a redelivery, the claim decides whether it is applied again
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		logger(r).Error("Error storing payment event", "event_id", event.ID, "err", err)
+		apierror.Write(w, r, apierror.Internal("Could not store event", err))
+		return
+	}
+	//only one delivery gets the event, and only while it is received or failed
+	stored, err := s.DB.ClaimPaymentEvent(r.Context(), event.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		stored, err = s.DB.GetPaymentEvent(r.Context(), event.ID)
+		if err == nil && stored.Status == paymentEventProcessing {
+			apierror.Write(w, r, apierror.New(http.StatusConflict, "", "Event is being processed, try again later"))
+			return
+		}
+		if err == nil {
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`{"message":"Event already processed"}`))
+			return
+		}
+	}
+	if err != nil {
+		logger(r).Error("Error claiming payment event", "event_id", event.ID, "err", err)
+		apierror.Write(w, r, apierror.Internal("Could not store event", err))
+		return
+	}
+	if _, err := s.processPaymentEvent(r.Context(), stored); err != nil {
+		apierror.Write(w, r, apierror.Internal("Could not process event", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Applies a stored event and records the outcome on it
+func (s *Server) processPaymentEvent(ctx context.Context, stored database.PaymentEvent) (database.PaymentEvent, error) {
+	status, applyErr := s.applyPaymentEvent(ctx, stored.Payload)
+	var lastError sql.NullString
+	if applyErr != nil {
+		logging.FromContext(ctx).Error("Error processing payment event", "event_id", stored.ID, "err", applyErr)
+		status = paymentEventFailed
+		lastError = sql.NullString{String: applyErr.Error(), Valid: true}
+	}
+	updated, err := s.DB.FinishPaymentEvent(ctx, database.FinishPaymentEventParams{
+		ID:        stored.ID,
+		Status:    status,
+		LastError: lastError,
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("Error recording outcome of payment event", "event_id", stored.ID, "err", err)
+		return stored, err
+	}
+	return updated, applyErr
+}
+
+// Returns the status to record for the event, events we don't act on are ignored. Every event
+// updates the user's subscription and their premium flag follows from it
+func (s *Server) applyPaymentEvent(ctx context.Context, payload []byte) (string, error) {
+	event, err := payments.ParseEvent(payload)
+	if err != nil {
+		return "", err
+	}
+	now := s.now().UTC()
+	if event.Data.TeamID != uuid.Nil {
+		return s.applyTeamPaymentEvent(ctx, event, now)
+	}
+	userId := event.Data.UserID
+	var sub database.Subscription
+	switch event.Type {
+	case payments.EventUserUpgraded:
+		status := billing.StatusActive
+		if event.Data.Status == billing.StatusTrialing {
+			status = billing.StatusTrialing
+		}
+		sub, err = s.upsertSubscription(ctx, event, status, now)
+	case payments.EventSubscriptionRenewed, payments.EventInvoicePaid:
+		sub, err = s.DB.RenewSubscription(ctx, database.RenewSubscriptionParams{
+			UserID:           userId,
+			CurrentPeriodEnd: periodEnd(event, now),
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			//paid without us knowing about the subscription yet. A late invoice for a canceled one
+			//doesn't bring it back, that takes a new upgrade
+			if _, getErr := s.DB.GetSubscriptionByUser(ctx, userId); errors.Is(getErr, sql.ErrNoRows) {
+				sub, err = s.upsertSubscription(ctx, event, billing.StatusActive, now)
+			} else if getErr != nil {
+				err = getErr
+			}
+		}
+	case payments.EventInvoicePaymentFailed:
+		sub, err = s.DB.GetSubscriptionByUser(ctx, userId)
+		if err == nil {
+			sub, err = s.DB.MarkSubscriptionPastDue(ctx, database.MarkSubscriptionPastDueParams{
+				UserID:         userId,
+				GracePeriodEnd: sql.NullTime{Time: billing.GraceEnd(sub.CurrentPeriodEnd, now), Valid: true},
+			})
+		}
+	case payments.EventUserDowngraded:
+		//premium was paid for until the end of the period, the expiry job cancels it then
+		sub, err = s.DB.CancelSubscriptionAtPeriodEnd(ctx, userId)
+	case payments.EventSubscriptionCanceled:
+		sub, err = s.DB.CancelSubscription(ctx, userId)
+	default:
+		return paymentEventIgnored, nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		//no subscription (or only a canceled one) to change
+		return paymentEventIgnored, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := billing.SyncPremium(ctx, s.DB, sub, now); err != nil {
+		return "", err
+	}
+	return paymentEventProcessed, nil
+}
+
+// Like applyPaymentEvent for events about a team subscription. Team premium is read from the
+// subscription when needed, there is no flag to keep in sync
+func (s *Server) applyTeamPaymentEvent(ctx context.Context, event payments.Event, now time.Time) (string, error) {
+	teamId := event.Data.TeamID
+	var err error
+	switch event.Type {
+	case payments.EventTeamSubscriptionCreated:
+		if event.Data.Seats <= 0 {
+			return "", errors.New("team subscription needs at least one seat")
+		}
+		status := billing.StatusActive
+		if event.Data.Status == billing.StatusTrialing {
+			status = billing.StatusTrialing
+		}
+		var providerId sql.NullString
+		if event.Data.SubscriptionID != "" {
+			providerId = sql.NullString{String: event.Data.SubscriptionID, Valid: true}
+		}
+		_, err = s.DB.UpsertTeamSubscription(ctx, database.UpsertTeamSubscriptionParams{
+			TeamID:                 teamId,
+			ProviderSubscriptionID: providerId,
+			Plan:                   billing.PlanTeam,
+			Status:                 status,
+			Seats:                  event.Data.Seats,
+			CurrentPeriodEnd:       periodEnd(event, now),
+		})
+	case payments.EventTeamSeatsChanged:
+		if event.Data.Seats <= 0 {
+			return "", errors.New("team subscription needs at least one seat")
+		}
+		//members over the new seat count stay, but nobody can be added until there is room again
+		_, err = s.DB.SetTeamSubscriptionSeats(ctx, database.SetTeamSubscriptionSeatsParams{
+			TeamID: teamId,
+			Seats:  event.Data.Seats,
+		})
+	case payments.EventSubscriptionRenewed, payments.EventInvoicePaid:
+		_, err = s.DB.RenewTeamSubscription(ctx, database.RenewTeamSubscriptionParams{
+			TeamID:           teamId,
+			CurrentPeriodEnd: periodEnd(event, now),
+		})
+	case payments.EventInvoicePaymentFailed:
+		var sub database.TeamSubscription
+		sub, err = s.DB.GetTeamSubscription(ctx, teamId)
+		if err == nil {
+			_, err = s.DB.MarkTeamSubscriptionPastDue(ctx, database.MarkTeamSubscriptionPastDueParams{
+				TeamID:         teamId,
+				GracePeriodEnd: sql.NullTime{Time: billing.GraceEnd(sub.CurrentPeriodEnd, now), Valid: true},
+			})
+		}
+	case payments.EventTeamSubscriptionCanceled:
+		_, err = s.DB.CancelTeamSubscription(ctx, teamId)
+	default:
+		return paymentEventIgnored, nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return paymentEventIgnored, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return paymentEventProcessed, nil
+}
+
+func (s *Server) upsertSubscription(ctx context.Context, event payments.Event, status string, now time.Time) (database.Subscription, error) {
+	plan := event.Data.Plan
+	if plan == "" {
+		plan = billing.PlanPremium
+	}
+	var providerId sql.NullString
+	if event.Data.SubscriptionID != "" {
+		providerId = sql.NullString{String: event.Data.SubscriptionID, Valid: true}
+	}
+	return s.DB.UpsertSubscription(ctx, database.UpsertSubscriptionParams{
+		UserID:                 event.Data.UserID,
+		ProviderSubscriptionID: providerId,
+		Plan:                   plan,
+		Status:                 status,
+		CurrentPeriodEnd:       periodEnd(event, now),
+	})
+}
+
+func periodEnd(event payments.Event, now time.Time) time.Time {
+	if event.Data.CurrentPeriodEnd != nil {
+		return event.Data.CurrentPeriodEnd.UTC()
+	}
+	return now.Add(billing.DefaultPeriod)
+}
+
+type paymentEventResponse struct {
+	ID          string          `json:"event_id"`
+	EventType   string          `json:"event_type"`
+	Status      string          `json:"status"`
+	Attempts    int32           `json:"attempts"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	ProcessedAt *time.Time      `json:"processed_at"`
+	LastError   *string         `json:"last_error"`
+	Payload     json.RawMessage `json:"payload"`
+}
+
+func newPaymentEventResponse(e database.PaymentEvent) paymentEventResponse {
+	resp := paymentEventResponse{
+		ID:        e.ID,
+		EventType: e.EventType,
+		Status:    e.Status,
+		Attempts:  e.Attempts,
+		CreatedAt: e.CreatedAt,
+		UpdatedAt: e.UpdatedAt,
+		Payload:   e.Payload,
+	}
+	if e.ProcessedAt.Valid {
+		resp.ProcessedAt = &e.ProcessedAt.Time
+	}
+	if e.LastError.Valid {
+		resp.LastError = &e.LastError.String
+	}
+	return resp
+}
+
+// Lists stored payment events, newest first. Optional query parameters "status" (received,
+// processing, processed, ignored or failed) and "limit" (default 50, max 500). Returns:
+//
+//	[
+//		{
+//			"event_id":"string"
+//			"event_type":"string"
+//			"status":"string"
+//			"attempts":"int"
+//			"created_at":"timestamp"
+//			"updated_at":"timestamp"
+//			"processed_at":"timestamp"
+//			"last_error":"string"
+//			"payload":{}
+//		}
+//	]
+func (s *Server) HandleGetPaymentEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	params := database.GetPaymentEventsParams{MaxEvents: 50}
+	if status := r.URL.Query().Get("status"); status != "" {
+		switch status {
+		case paymentEventReceived, paymentEventProcessing, paymentEventProcessed, paymentEventIgnored, paymentEventFailed:
+			params.Status = sql.NullString{String: status, Valid: true}
+		default:
+			apierror.Write(w, r, apierror.InvalidParameter("status", "Unknown status"))
+			return
+		}
+	}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > 500 {
+			apierror.Write(w, r, apierror.InvalidParameter("limit", "limit must be between 1 and 500"))
+			return
+		}
+		params.MaxEvents = int32(n)
+	}
+	events, err := s.DB.GetPaymentEvents(r.Context(), params)
+	if err != nil {
+		logger(r).Error("Error fetching payment events", "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not get payment events"))
+		return
+	}
+	resp := make([]paymentEventResponse, 0, len(events))
+	for _, e := range events {
+		resp = append(resp, newPaymentEventResponse(e))
+	}
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Failed to create response", err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(jsonResp)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+}
+
+// Applies the stored event with the id given in the url again, whatever its status, and returns
+// it with the new outcome
+func (s *Server) HandleReprocessPaymentEvent(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	stored, err := s.DB.GetPaymentEvent(r.Context(), r.PathValue("eventID"))
+	if errors.Is(err, sql.ErrNoRows) {
+		apierror.Write(w, r, apierror.NotFound("Payment event not found"))
+		return
+	}
+	if err != nil {
+		logger(r).Error("Error fetching payment event", "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not get payment event"))
+		return
+	}
+	//the outcome, failed or not, is part of the response
+	updated, _ := s.processPaymentEvent(r.Context(), stored)
+	jsonResp, err := json.Marshal(newPaymentEventResponse(updated))
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Failed to create response", err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(jsonResp)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/F0RG-2142/capstone-1/internal/billing"
+	"github.com/F0RG-2142/capstone-1/internal/database"
+	"github.com/F0RG-2142/capstone-1/internal/payments"
+	"github.com/google/uuid"
+)
+
+// Delivers a webhook signed with secret at the server's current time
+func (ts *testServer) webhook(payload, secret string) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	req := httptest.NewRequest("POST", "/api/v1/payment/webhooks", strings.NewReader(payload))
+	if secret != "" {
+		req.Header.Set(payments.SignatureHeader, payments.Sign([]byte(payload), secret, ts.now))
+	}
+	rec := httptest.NewRecorder()
+	ts.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandlePaymentWebhook(t *testing.T) {
+	ts := newTestServer(t)
+	user := ts.signUp("payer@example.com")
+	upgraded := fmt.Sprintf(`{"id":"evt_upgrade","event":%q,"data":{"user_id":%q,"subscription_id":"sub_1"}}`, payments.EventUserUpgraded, user.ID)
+
+	tests := []struct {
+		name    string
+		payload string
+		secret  string
+		want    int
+	}{
+		{name: "Unsigned", payload: upgraded, want: http.StatusUnauthorized},
+		{name: "Wrong Secret", payload: upgraded, secret: "wrong", want: http.StatusUnauthorized},
+		{name: "Malformed JSON", payload: `{"id":`, secret: testWebhookSecret, want: http.StatusBadRequest},
+		{name: "Missing ID", payload: `{"event":"user.upgraded"}`, secret: testWebhookSecret, want: http.StatusBadRequest},
+		{name: "Upgrade", payload: upgraded, secret: testWebhookSecret, want: http.StatusNoContent},
+		{name: "Redelivery", payload: upgraded, secret: testWebhookSecret, want: http.StatusOK},
+		{name: "Unknown Event Type", payload: `{"id":"evt_unknown","event":"user.waved"}`, secret: testWebhookSecret, want: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, ts.webhook(tt.payload, tt.secret), tt.want)
+		})
+	}
+
+	sub := decode[subscriptionResponse](t, ts.do("GET", "/api/v1/user/me/subscription", user.Token, nil))
+	if sub.Plan != billing.PlanPremium || sub.Status != billing.StatusActive || !sub.HasNotesPremium {
+		t.Errorf("expected an active premium subscription, got %+v", sub)
+	}
+
+	ts.now = ts.now.Add(time.Hour)
+	stale := `{"id":"evt_stale","event":"user.downgraded","data":{}}`
+	req := httptest.NewRequest("POST", "/api/v1/payment/webhooks", strings.NewReader(stale))
+	req.Header.Set(payments.SignatureHeader, payments.Sign([]byte(stale), testWebhookSecret, ts.now.Add(-time.Hour)))
+	rec := httptest.NewRecorder()
+	ts.handler.ServeHTTP(rec, req)
+	expectStatus(t, rec, http.StatusUnauthorized)
+}
+
+func TestPaymentEventClaim(t *testing.T) {
+	ts := newTestServer(t)
+	user := ts.signUp("claimed@example.com")
+	payload := fmt.Sprintf(`{"id":"evt_claimed","event":%q,"data":{"user_id":%q}}`, payments.EventUserUpgraded, user.ID)
+	//another delivery got the event and is still applying it
+	_, err := ts.db.NewPaymentEvent(context.Background(), database.NewPaymentEventParams{ID: "evt_claimed", EventType: payments.EventUserUpgraded, Payload: []byte(payload)})
+	if err != nil {
+		t.Fatalf("failed to store event: %v", err)
+	}
+	if _, err := ts.db.ClaimPaymentEvent(context.Background(), "evt_claimed"); err != nil {
+		t.Fatalf("failed to claim event: %v", err)
+	}
+
+	expectStatus(t, ts.webhook(payload, testWebhookSecret), http.StatusConflict)
+	//the other delivery never finished
+	ts.now = ts.now.Add(6 * time.Minute)
+	expectStatus(t, ts.webhook(payload, testWebhookSecret), http.StatusNoContent)
+	expectStatus(t, ts.webhook(payload, testWebhookSecret), http.StatusOK)
+}
+
+func TestLateInvoiceAfterCancel(t *testing.T) {
+	ts := newTestServer(t)
+	user := ts.signUp("canceled@example.com")
+	events := []string{
+		fmt.Sprintf(`{"id":"evt_up","event":%q,"data":{"user_id":%q}}`, payments.EventUserUpgraded, user.ID),
+		fmt.Sprintf(`{"id":"evt_cancel","event":%q,"data":{"user_id":%q}}`, payments.EventSubscriptionCanceled, user.ID),
+		fmt.Sprintf(`{"id":"evt_paid","event":%q,"data":{"user_id":%q}}`, payments.EventInvoicePaid, user.ID),
+	}
+	for _, event := range events {
+		expectStatus(t, ts.webhook(event, testWebhookSecret), http.StatusNoContent)
+	}
+
+	sub := decode[subscriptionResponse](t, ts.do("GET", "/api/v1/user/me/subscription", user.Token, nil))
+	if sub.Status != billing.StatusCanceled || sub.HasNotesPremium {
+		t.Errorf("expected the subscription to stay canceled, got %+v", sub)
+	}
+}
+
+func TestPaymentEventsAdmin(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.signUp("admin@example.com")
+	team := ts.newTeam(admin, "Paid")
+	//a team subscription needs seats, this one fails and is kept for retries
+	failing := fmt.Sprintf(`{"id":"evt_team","event":%q,"data":{"team_id":%q,"seats":0}}`, payments.EventTeamSubscriptionCreated, team.ID)
+	expectStatus(t, ts.webhook(failing, testWebhookSecret), http.StatusInternalServerError)
+
+	events := decode[[]paymentEventResponse](t, ts.do("GET", "/api/v1/admin/payment-events?status=failed", testAdminToken, nil))
+	if len(events) != 1 || events[0].ID != "evt_team" || events[0].LastError == nil {
+		t.Fatalf("expected the failed event, got %+v", events)
+	}
+	if processed := decode[[]paymentEventResponse](t, ts.do("GET", "/api/v1/admin/payment-events?status=processed", testAdminToken, nil)); len(processed) != 0 {
+		t.Errorf("expected no processed events, got %+v", processed)
+	}
+
+	rec := ts.do("POST", "/api/v1/admin/payment-events/evt_team/reprocess", testAdminToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if event := decode[paymentEventResponse](t, rec); event.Status != paymentEventFailed || event.Attempts != 2 {
+		t.Errorf("expected a second failed attempt, got %+v", event)
+	}
+
+	created := fmt.Sprintf(`{"id":"evt_team_ok","event":%q,"data":{"team_id":%q,"seats":10}}`, payments.EventTeamSubscriptionCreated, team.ID)
+	expectStatus(t, ts.webhook(created, testWebhookSecret), http.StatusNoContent)
+	sub := decode[teamSubscriptionResponse](t, ts.do("GET", "/api/v1/teams/"+team.ID.String()+"/subscription", admin.Token, nil))
+	if sub.Plan != billing.PlanTeam || sub.Seats == nil || *sub.Seats != 10 || !sub.Premium {
+		t.Errorf("expected a team subscription with 10 seats, got %+v", sub)
+	}
+
+	unknownTeam := fmt.Sprintf(`{"id":"evt_seats","event":%q,"data":{"team_id":%q,"seats":3}}`, payments.EventTeamSeatsChanged, uuid.New())
+	expectStatus(t, ts.webhook(unknownTeam, testWebhookSecret), http.StatusNoContent)
+}
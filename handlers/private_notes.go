@@ -2,196 +2,144 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
-	"log"
 	"net/http"
-	"path"
-	"strings"
 
-	"github.com/F0RG-2142/capstone-1/internal/auth"
+	"github.com/F0RG-2142/capstone-1/internal/apierror"
 	"github.com/F0RG-2142/capstone-1/internal/database"
-	"github.com/F0RG-2142/capstone-1/models"
+	"github.com/F0RG-2142/capstone-1/internal/entitlements"
+	"github.com/F0RG-2142/capstone-1/internal/validate"
 	"github.com/google/uuid"
 )
 
-func HandleUpdateNote(w http.ResponseWriter, r *http.Request) {
+type updateNoteRequest struct {
+	//ignored, the note comes from the url
+	NoteID uuid.UUID `json:"note_id"`
+	Body   string    `json:"note_body" validate:"required,max=100000"`
+	Name   string    `json:"note_name" validate:"max=255"`
+}
+
+func (s *Server) HandleUpdateNote(w http.ResponseWriter, r *http.Request) {
 	//loads note from db, replaces old body with new one. Way to optimise?
 	w.Header().Set("Content-Type", "application/json")
-	//Get auth get & validate token ->
-	userId, err := auth.GetAndValidateToken(r.Header, models.Cfg.Secret)
-	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
-		return
-	}
-	cleanPath := path.Clean(r.URL.Path)
-	parts := strings.Split(cleanPath, "/")
-
-	if len(parts) < 4 {
-		http.Error(w, `{"error": "Malformed note ID path"}`, http.StatusBadRequest)
-		return
-	}
-
-	idStr := parts[4] // Index 4 is the ID
-	if idStr == "" {
-		http.Error(w, `{"error": "Missing note ID in path"}`, http.StatusBadRequest)
-		return
-	}
-	id, err := uuid.Parse(idStr)
+	userId := principal(r).UserID
+	id, err := uuid.Parse(r.PathValue("noteID"))
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error": "Invalid note ID format: %s (%v)"}`, err.Error(), id), http.StatusBadRequest)
+		apierror.Write(w, r, apierror.InvalidParameter("noteID", "Could not parse note id"))
 		return
 	}
 	getParams := database.GetNoteByIDParams{
 		ID:     id,
 		UserID: userId,
 	}
-	note, err := models.Cfg.DB.GetNoteByID(r.Context(), getParams)
+	note, err := s.DB.GetNoteByID(r.Context(), getParams)
 	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusNotFound)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusNotFound, "Note not found"))
 		return
 	}
 	if note.UserID != userId {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Write(w, r, apierror.NotFound("Note not found"))
 		return
 	}
 	//decode req after auth
-	req := struct {
-		NoteID uuid.UUID `json:"note_id"`
-		Body   string    `json:"note_body"`
-		Name   string    `json:"note_name"`
-	}{}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Error decoding request: %v", err)
-		w.WriteHeader(500)
+	var req updateNoteRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		logger(r).Warn("Invalid request", "err", err)
+		apierror.Write(w, r, err)
 		return
 	}
-	defer r.Body.Close()
 
 	updateParams := database.UpdateNoteParams{
 		Body: req.Body,
 		Name: req.Name,
 		ID:   note.ID,
 	}
-	err = models.Cfg.DB.UpdateNote(r.Context(), updateParams)
+	err = s.DB.UpdateNote(r.Context(), updateParams)
 	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusFailedDependency)
+		logger(r).Error("Error updating note", "note_id", note.ID, "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not update note"))
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func HandleDeleteNote(w http.ResponseWriter, r *http.Request) {
+func (s *Server) HandleDeleteNote(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	//get and validate token
-	userId, err := auth.GetAndValidateToken(r.Header, models.Cfg.Secret)
-	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
-		return
-	}
-
-	cleanPath := path.Clean(r.URL.Path)
-	parts := strings.Split(cleanPath, "/")
-
-	if len(parts) < 4 {
-		http.Error(w, `{"error": "Malformed note ID path"}`, http.StatusBadRequest)
-		return
-	}
-
-	idStr := parts[4] // Index 4 is the ID
-	if idStr == "" {
-		http.Error(w, `{"error": "Missing note ID in path"}`, http.StatusBadRequest)
-		return
-	}
-	id, err := uuid.Parse(idStr)
+	userId := principal(r).UserID
+	id, err := uuid.Parse(r.PathValue("noteID"))
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error": "Invalid note ID format: %s (%v)"}`, err.Error(), id), http.StatusBadRequest)
+		apierror.Write(w, r, apierror.InvalidParameter("noteID", "Could not parse note id"))
 		return
 	}
 	deleteParams := database.DeleteNoteParams{
 		ID:     id,
 		UserID: userId,
 	}
-	err = models.Cfg.DB.DeleteNote(r.Context(), deleteParams)
+	deleted, err := s.DB.DeleteNote(r.Context(), deleteParams)
 	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusFailedDependency)
+		logger(r).Error("Error deleting note", "note_id", id, "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not delete note"))
+		return
+	}
+	if deleted == 0 {
+		apierror.Write(w, r, apierror.NotFound("Note not found"))
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func HandleGetNote(w http.ResponseWriter, r *http.Request) {
+func (s *Server) HandleGetNote(w http.ResponseWriter, r *http.Request) {
 	// Set Content-Type header early
 	w.Header().Set("Content-Type", "application/json")
 
-	cleanPath := path.Clean(r.URL.Path)
-	parts := strings.Split(cleanPath, "/")
-
-	if len(parts) < 4 {
-		http.Error(w, `{"error": "Malformed note ID path"}`, http.StatusBadRequest)
-		return
-	}
-
-	idStr := parts[4] // Index 4 is the ID
-	if idStr == "" {
-		http.Error(w, `{"error": "Missing note ID in path"}`, http.StatusBadRequest)
-		return
-	}
-	id, err := uuid.Parse(idStr)
+	id, err := uuid.Parse(r.PathValue("noteID"))
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error": "Invalid note ID format: %s (%v)"}`, err.Error(), id), http.StatusBadRequest)
+		apierror.Write(w, r, apierror.InvalidParameter("noteID", "Could not parse note id"))
 		return
 	}
 
-	userId, err := auth.GetAndValidateToken(r.Header, models.Cfg.Secret)
-	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusUnauthorized)
-		return
-	}
+	userId := principal(r).UserID
 
 	params := database.GetNoteByIDParams{
 		ID:     id,
 		UserID: userId,
 	}
-	note, err := models.Cfg.DB.GetNoteByID(r.Context(), params)
+	note, err := s.DB.GetNoteByID(r.Context(), params)
 	if err != nil {
-		log.Printf("Database error fetching note ID %s for user %s: %v", id, userId, err)
-		http.Error(w, `{"error": "Note not found or access denied"}`, http.StatusNotFound)
+		logger(r).Error("Error fetching note", "note_id", id, "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusNotFound, "Note not found or access denied"))
 		return
 	}
 
 	noteJSON, err := json.Marshal(note)
 	if err != nil {
-		log.Printf("Error marshaling note ID %s to JSON: %v", id, err)
-		http.Error(w, `{"error": "Internal server error while processing note"}`, http.StatusInternalServerError)
+		logger(r).Error("Error marshaling note", "note_id", id, "err", err)
+		apierror.Write(w, r, apierror.Internal("Internal server error while processing note", err))
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 	_, err = w.Write(noteJSON)
 	if err != nil {
-		log.Printf("Error writing note ID %s response: %v", id, err)
+		logger(r).Warn("Error writing note response", "note_id", id, "err", err)
 		return
 	}
 }
 
-func HandleGetNotes(w http.ResponseWriter, r *http.Request) {
+func (s *Server) HandleGetNotes(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	var notes []database.Note
-	userId, err := auth.GetAndValidateToken(r.Header, models.Cfg.Secret)
+	userId := principal(r).UserID
+	notes, err := s.DB.GetAllNotes(r.Context(), userId)
 	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+		logger(r).Error("Error fetching notes", "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusBadGateway, "Could not get notes"))
 		return
 	}
-	if userId != uuid.Nil {
-		notes, err = models.Cfg.DB.GetAllNotes(r.Context(), userId)
-		if err != nil {
-			w.WriteHeader(http.StatusBadGateway)
-			return
-		}
+	if notes == nil {
+		notes = []database.Note{}
 	}
 	notesJSON, err := json.Marshal(notes)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Internal("Failed to create response", err))
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -203,23 +151,22 @@ func HandleGetNotes(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func HandleNotes(w http.ResponseWriter, r *http.Request) {
+// Body of new and updated notes, private or shared with a team
+type noteRequest struct {
+	Body string `json:"body" validate:"required,max=100000"`
+}
+
+func (s *Server) HandleNotes(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	//req struct
-	var req struct {
-		Body string `json:"body"`
-	}
+	var req noteRequest
 	//decode req
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Error decoding request: %v", err)
-		w.WriteHeader(500)
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		logger(r).Warn("Invalid request", "err", err)
+		apierror.Write(w, r, err)
 		return
 	}
-	defer r.Body.Close()
-	//get bearer token
-	userId, err := auth.GetAndValidateToken(r.Header, models.Cfg.Secret)
-	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+	userId := principal(r).UserID
+	if !callerWithinLimit(w, r, entitlements.LimitNotes, s.DB.CountNotes) {
 		return
 	}
 	//save note to db
@@ -227,10 +174,10 @@ func HandleNotes(w http.ResponseWriter, r *http.Request) {
 		Body:   req.Body,
 		UserID: userId,
 	}
-	_, err = models.Cfg.DB.NewNote(r.Context(), params)
+	_, err := s.DB.NewNote(r.Context(), params)
 	if err != nil {
-		log.Printf("Error creating user: %v", err)
-		http.Error(w, `{"error":"Failed to create note"}`, http.StatusInternalServerError)
+		logger(r).Error("Error creating note", "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusInternalServerError, "Failed to create note"))
 		return
 	}
 	w.WriteHeader(http.StatusCreated)
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/F0RG-2142/capstone-1/internal/apierror"
+	"github.com/F0RG-2142/capstone-1/internal/auth"
+	"github.com/F0RG-2142/capstone-1/internal/lockout"
+)
+
+// Limits request rates for a group of routes, keyed by access token, user or client ip. Place it
+// before RequireAuth/RequireSession in Chain so it runs after authentication and sees the caller.
+// Responds 429 with Retry-After once the bucket is empty. If the store fails requests are let through
+func (s *Server) RateLimit(group string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limiter := s.RateLimiter
+			if limiter == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key, premium := rateLimitKey(r)
+			res, err := limiter.Allow(r.Context(), group, key, premium)
+			if err != nil {
+				logger(r).Error("Error checking rate limit", "key", key, "err", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if res.Limit.Burst > 0 {
+				w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit.Burst))
+				w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+				w.Header().Set("RateLimit-Reset", ceilSeconds(res.Reset))
+				w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%s", res.Limit.Burst, ceilSeconds(res.Limit.Window())))
+			}
+			if !res.Allowed {
+				w.Header().Set("Retry-After", ceilSeconds(res.RetryAfter))
+				apierror.Write(w, r, apierror.New(http.StatusTooManyRequests, apierror.CodeRateLimited, "Too many requests, please slow down"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Access tokens get their own bucket so one busy script doesn't starve the user's other clients
+func rateLimitKey(r *http.Request) (string, bool) {
+	p, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		return "ip:" + lockout.ClientIP(r), false
+	}
+	if !p.IsSession() {
+		return "token:" + p.TokenID.String(), p.HasPremium
+	}
+	return "user:" + p.UserID.String(), p.HasPremium
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/F0RG-2142/capstone-1/internal/auth"
+	"github.com/F0RG-2142/capstone-1/internal/cors"
+	"github.com/F0RG-2142/capstone-1/internal/database"
+	"github.com/F0RG-2142/capstone-1/internal/health"
+	"github.com/F0RG-2142/capstone-1/internal/lockout"
+	"github.com/F0RG-2142/capstone-1/internal/oidc"
+	"github.com/F0RG-2142/capstone-1/internal/openapi"
+	"github.com/F0RG-2142/capstone-1/internal/ratelimit"
+	"github.com/F0RG-2142/capstone-1/internal/server"
+)
+
+type Middleware func(http.Handler) http.Handler
+
+// Everything the handlers depend on. Build one per configuration, tests can wire theirs with fakes
+type Server struct {
+	DB database.Querier
+	// Current time, time.Now when nil
+	Clock func() time.Time
+	// Base logger requests log through, slog.Default when nil
+	Logger   *slog.Logger
+	Tokens   *auth.TokenIssuer
+	Platform string
+	OIDC     map[string]*oidc.Provider
+	// Admin endpoints are disabled when empty
+	AdminToken string
+	// Admin endpoints also need a verified TLS client certificate
+	AdminClientCert bool
+	// Optional, without it no CAPTCHA is asked for
+	Captcha   lockout.CaptchaVerifier
+	Mailer    lockout.Mailer
+	UnlockURL string
+	// Cookies (the OIDC login state) leave out the Secure attribute, for local development over HTTP
+	InsecureCookies bool
+	// Rate limits per route group, nil disables rate limiting
+	RateLimiter *ratelimit.Limiter
+	// Shared secret payment webhooks are signed with
+	PaymentWebhookSecret string
+	// CORS policy, nil sends no CORS headers
+	CORS *cors.Handler
+	// Process state and dependency checks behind /livez and /readyz
+	Health      *server.Health
+	ReadyChecks []health.Check
+	// Checks requests, and in strict mode responses, against the OpenAPI document. Off when empty
+	Contract ContractMode
+}
+
+func (s *Server) now() time.Time {
+	if s.Clock != nil {
+		return s.Clock()
+	}
+	return time.Now()
+}
+
+func (s *Server) logger() *slog.Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+	return slog.Default()
+}
+
+// Every route with its middleware wrapped in request ids, tracing, access logs, metrics and CORS
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	s.RegisterRoutes(mux)
+	var handler http.Handler = mux
+	if s.CORS != nil {
+		handler = s.CORS.Wrap(handler)
+	}
+	return s.RequestID(Trace(AccessLog(Instrument(handler))))
+}
+
+// What routes are registered on, an *http.ServeMux outside of tests
+type Router interface {
+	Handle(pattern string, handler http.Handler)
+}
+
+func (s *Server) RegisterRoutes(mux Router) {
+	//API description, see OpenAPI. With Contract on every route is checked against it first
+	doc := s.OpenAPI()
+	handle := func(pattern string, h http.Handler, middlewares ...Middleware) {
+		mux.Handle(pattern, Chain(s.contract(doc, pattern)(h), middlewares...))
+	}
+
+	//Utility and admin
+	handle("GET /livez", HandleLivez(s.Health))                                                                                        //Liveness probe
+	handle("GET /readyz", HandleReadyz(s.ReadyChecks))                                                                                 //Readiness probe with dependency checks
+	handle("GET /api/v1/healthz", HandleReadyz(s.ReadyChecks))                                                                         //Same as /readyz, kept for existing clients
+	handle("GET /api/v1/admin/metrics", http.HandlerFunc(HandleMetrics), s.RequireAdmin())                                             //Server metrics endpoint //Done
+	handle("POST /api/v1/payment/webhooks", http.HandlerFunc(s.HandlePaymentWebhook))                                                  //Payment platform webhook //Done
+	handle("GET /.well-known/jwks.json", http.HandlerFunc(s.HandleJWKS))                                                               //Public keys for verifying our JWTs
+	handle("GET /api/v1/admin/lockouts", http.HandlerFunc(s.HandleGetLockouts), s.RequireAdmin())                                      //Accounts and ips blocked after failed logins
+	handle("DELETE /api/v1/admin/lockouts/{key}", http.HandlerFunc(s.HandleClearLockout), s.RequireAdmin())                            //Clear a lockout
+	handle("GET /api/v1/admin/payment-events", http.HandlerFunc(s.HandleGetPaymentEvents), s.RequireAdmin())                           //Stored payment webhook events
+	handle("POST /api/v1/admin/payment-events/{eventID}/reprocess", http.HandlerFunc(s.HandleReprocessPaymentEvent), s.RequireAdmin()) //Apply a stored event again
+	//Users and auth
+	handle("POST /api/v1/register", http.HandlerFunc(s.HandleNewUser), s.RateLimit(ratelimit.GroupAuth))                                                  //New User Registration
+	handle("POST /api/v1/login", http.HandlerFunc(s.HandleLogin), s.RateLimit(ratelimit.GroupAuth))                                                       //Login to profile
+	handle("GET /api/v1/login/unlock", http.HandlerFunc(s.HandleUnlockAccount), s.RateLimit(ratelimit.GroupAuth))                                         //Unlock account from email link
+	handle("POST /api/v1/logout", http.HandlerFunc(s.HandleRevokeRefreshToken), s.RateLimit(ratelimit.GroupAuth))                                         //Revoke refresh tok
+	handle("POST /api/v1/token/refresh", http.HandlerFunc(s.HandleRefreshJWT), s.RateLimit(ratelimit.GroupAuth))                                          //Refresh JWT
+	handle("PUT /api/v1/user/me", http.HandlerFunc(s.HandleUpdateUser), s.RateLimit(ratelimit.GroupWrite), s.RequireSession())                            //Update user details
+	handle("POST /api/v1/user/me/tokens", http.HandlerFunc(s.HandleNewAccessToken), s.RateLimit(ratelimit.GroupWrite), s.RequireSession())                //Create personal access token
+	handle("GET /api/v1/user/me/subscription", http.HandlerFunc(s.HandleGetSubscription), s.RateLimit(ratelimit.GroupRead), s.RequireSession())           //Current plan and subscription status
+	handle("GET /api/v1/user/me/usage", http.HandlerFunc(s.HandleGetUsage), s.RateLimit(ratelimit.GroupRead), s.RequireSession())                         //Usage against plan limits
+	handle("GET /api/v1/user/me/tokens", http.HandlerFunc(s.HandleGetAccessTokens), s.RateLimit(ratelimit.GroupRead), s.RequireSession())                 //List personal access tokens
+	handle("DELETE /api/v1/user/me/tokens/{tokenID}", http.HandlerFunc(s.HandleRevokeAccessToken), s.RateLimit(ratelimit.GroupWrite), s.RequireSession()) //Revoke personal access token
+	//External identity providers
+	handle("GET /api/v1/auth/oidc/{provider}/login", http.HandlerFunc(s.HandleOIDCLogin), s.RateLimit(ratelimit.GroupAuth))                            //Redirect to provider
+	handle("GET /api/v1/auth/oidc/{provider}/callback", http.HandlerFunc(s.HandleOIDCCallback), s.RateLimit(ratelimit.GroupAuth))                      //Provider redirects back here
+	handle("POST /api/v1/user/me/identities/{provider}", http.HandlerFunc(s.HandleLinkIdentity), s.RateLimit(ratelimit.GroupAuth), s.RequireSession()) //Link provider to account
+	//Private Notes
+	handle("POST /api/v1/notes", http.HandlerFunc(s.HandleNotes), s.RateLimit(ratelimit.GroupWrite), s.RequireAuth(auth.ScopeNotesWrite))                 //Post Private Note //Done
+	handle("GET /api/v1/notes", http.HandlerFunc(s.HandleGetNotes), s.RateLimit(ratelimit.GroupRead), s.RequireAuth(auth.ScopeNotesRead))                 //Get all private notes //Done
+	handle("GET /api/v1/notes/{noteID}", http.HandlerFunc(s.HandleGetNote), s.RateLimit(ratelimit.GroupRead), s.RequireAuth(auth.ScopeNotesRead))         //Get one private note //Done
+	handle("PUT /api/v1/notes/{noteID}", http.HandlerFunc(s.HandleUpdateNote), s.RateLimit(ratelimit.GroupWrite), s.RequireAuth(auth.ScopeNotesWrite))    //Update private note //Done
+	handle("DELETE /api/v1/notes/{noteID}", http.HandlerFunc(s.HandleDeleteNote), s.RateLimit(ratelimit.GroupWrite), s.RequireAuth(auth.ScopeNotesWrite)) //Delete note based on id //Done
+	//Teams
+	handle("POST /api/v1/teams", http.HandlerFunc(s.HandleNewTeam), s.RateLimit(ratelimit.GroupWrite), s.RequireAuth(auth.ScopeTeamsWrite))                                          //Create new team
+	handle("GET /api/v1/teams", http.HandlerFunc(s.HandleGetTeams), s.RateLimit(ratelimit.GroupRead), s.RequireAuth(auth.ScopeTeamsRead))                                            //List all teams a user is part of
+	handle("GET /api/v1/teams/{teamID}", http.HandlerFunc(s.HandleGetTeam), s.RateLimit(ratelimit.GroupRead), s.RequireAuth(auth.ScopeTeamsRead))                                    //Get specific team details
+	handle("DELETE /api/v1/teams/{teamID}", http.HandlerFunc(s.HandleDeleteTeam), s.RateLimit(ratelimit.GroupWrite), s.RequireAuth(auth.ScopeTeamsAdmin))                            //Delete team
+	handle("POST /api/v1/teams/{teamID}/members", http.HandlerFunc(s.HandleAddUserToTeam), s.RateLimit(ratelimit.GroupWrite), s.RequireAuth(auth.ScopeTeamsAdmin))                   //Add new user to team
+	handle("DELETE /api/v1/teams/{teamID}/members/{memberID}", http.HandlerFunc(s.HandleRemoveUserFromTeam), s.RateLimit(ratelimit.GroupWrite), s.RequireAuth(auth.ScopeTeamsAdmin)) //Remove user from team
+	handle("GET /api/v1/teams/{teamID}/subscription", http.HandlerFunc(s.HandleGetTeamSubscription), s.RateLimit(ratelimit.GroupRead), s.RequireAuth(auth.ScopeTeamsRead))           //Team plan and seats
+	handle("GET /api/v1/teams/{teamID}/members", http.HandlerFunc(s.HandleGetTeamMembers), s.RateLimit(ratelimit.GroupRead), s.RequireAuth(auth.ScopeTeamsRead))                     //Get all users in team
+	//Team Notes
+	handle("POST /api/v1/teams/{teamID}/notes", http.HandlerFunc(s.HandleTeamNotes), s.RateLimit(ratelimit.GroupWrite), s.RequireAuth(auth.ScopeNotesWrite))                 //Post team Note
+	handle("GET /api/v1/teams/{teamID}/notes", http.HandlerFunc(s.HandleGetTeamNotes), s.RateLimit(ratelimit.GroupRead), s.RequireAuth(auth.ScopeNotesRead))                 //Get all team notes
+	handle("GET /api/v1/teams/{teamID}/notes/{noteID}", http.HandlerFunc(s.HandleGetTeamNote), s.RateLimit(ratelimit.GroupRead), s.RequireAuth(auth.ScopeNotesRead))         //Get one team note
+	handle("PUT /api/v1/teams/{teamID}/notes/{noteID}", http.HandlerFunc(s.HandleUpdateTeamNote), s.RateLimit(ratelimit.GroupWrite), s.RequireAuth(auth.ScopeNotesWrite))    //Update team Note
+	handle("DELETE /api/v1/teams/{teamID}/notes/{noteID}", http.HandlerFunc(s.HandleDeleteTeamNote), s.RateLimit(ratelimit.GroupWrite), s.RequireAuth(auth.ScopeNotesWrite)) //Delete team note based on id
+	//API description
+	handle("GET "+openAPIPath, openapi.Handler(doc))                          //OpenAPI document
+	handle("GET "+docsPath, openapi.DocsHandler(doc.Info.Title, openAPIPath)) //Docs page rendering it
+}
+
+// Applies middlewares in order, the last one runs first
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for _, m := range middlewares {
+		h = m(h)
+	}
+	return h
+}
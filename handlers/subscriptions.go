@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/F0RG-2142/capstone-1/internal/apierror"
+	"github.com/F0RG-2142/capstone-1/internal/billing"
+)
+
+type subscriptionResponse struct {
+	Plan              string     `json:"plan"`
+	Status            string     `json:"status"`
+	CurrentPeriodEnd  *time.Time `json:"current_period_end"`
+	GracePeriodEnd    *time.Time `json:"grace_period_end"`
+	CancelAtPeriodEnd bool       `json:"cancel_at_period_end"`
+	CanceledAt        *time.Time `json:"canceled_at"`
+	HasNotesPremium   bool       `json:"has_notes_premium"`
+}
+
+// Returns the user's subscription. Users that never subscribed are on the free plan with status "none":
+//
+//	{
+//		"plan":"free" or "premium"
+//		"status":"none", "trialing", "active", "past_due" or "canceled"
+//		"current_period_end":"timestamp"
+//		"grace_period_end":"timestamp" (while past_due)
+//		"cancel_at_period_end":"bool"
+//		"canceled_at":"timestamp"
+//		"has_notes_premium":"bool"
+//	}
+func (s *Server) HandleGetSubscription(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	userId := principal(r).UserID
+	resp := subscriptionResponse{Plan: billing.PlanFree, Status: "none"}
+	sub, err := s.DB.GetSubscriptionByUser(r.Context(), userId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		logger(r).Error("Error fetching subscription", "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not get subscription"))
+		return
+	}
+	if err == nil {
+		resp = subscriptionResponse{
+			Plan:              sub.Plan,
+			Status:            sub.Status,
+			CurrentPeriodEnd:  &sub.CurrentPeriodEnd,
+			CancelAtPeriodEnd: sub.CancelAtPeriodEnd,
+			HasNotesPremium:   billing.GrantsPremium(sub, s.now().UTC()),
+		}
+		if sub.GracePeriodEnd.Valid {
+			resp.GracePeriodEnd = &sub.GracePeriodEnd.Time
+		}
+		if sub.CanceledAt.Valid {
+			resp.CanceledAt = &sub.CanceledAt.Time
+		}
+	}
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Failed to create response", err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(jsonResp)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+}
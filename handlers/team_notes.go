@@ -1,47 +1,57 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
 
-	"github.com/F0RG-2142/capstone-1/internal/auth"
+	"github.com/F0RG-2142/capstone-1/internal/apierror"
 	"github.com/F0RG-2142/capstone-1/internal/database"
-	"github.com/F0RG-2142/capstone-1/models"
+	"github.com/F0RG-2142/capstone-1/internal/entitlements"
+	"github.com/F0RG-2142/capstone-1/internal/validate"
 	"github.com/google/uuid"
 )
 
-// Func to post new team note and needs the following params:
+// Func to post new team note, only admins and editors of the team can. Needs the following params:
 //
 //	{
 //		"body":"string"
-//		"user_id":"string"
 //	};
-func HandleTeamNotes(w http.ResponseWriter, r *http.Request) {
+func (s *Server) HandleTeamNotes(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	//Get and validate token
-	userId, err := auth.GetAndValidateToken(r.Header, models.Cfg.Secret)
+	userId := principal(r).UserID
+	//get teamID
+	teamId, err := uuid.Parse(r.PathValue("teamID"))
 	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+		apierror.Write(w, r, apierror.InvalidParameter("teamID", "Could not parse team id"))
 		return
 	}
-	//get teamID
-	teamId, err := uuid.Parse(r.URL.Query().Get("team_id"))
+	var req noteRequest
+	//decode req
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		logger(r).Warn("Invalid request", "err", err)
+		apierror.Write(w, r, err)
+		return
+	}
+	//AddNoteToTeam silently skips viewers, check first so no unshared note is left behind
+	if !s.requireTeamRole(w, r, teamId, roleAdmin, roleEditor) {
+		return
+	}
+	//team notes count towards their author, with the team's plan if it is paid
+	limits, err := s.teamLimits(r.Context(), teamId, principal(r).HasPremium)
 	if err != nil {
-		http.Error(w, "Could not parse uuid", http.StatusBadRequest)
+		logger(r).Error("Error getting team limits", "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not check plan limits"))
 		return
 	}
-	//req struct
-	var req struct {
-		Body   string    `json:"body"`
-		UserId uuid.UUID `json:"user_id"`
+	noteCount, err := s.DB.CountNotes(r.Context(), userId)
+	if err != nil {
+		logger(r).Error("Error counting notes", "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not check plan limits"))
+		return
 	}
-	//decode req
-	decoder := json.NewDecoder(r.Body)
-	defer r.Body.Close()
-	if err := decoder.Decode(&req); err != nil {
-		log.Printf("Error decoding request: %v", err)
-		w.WriteHeader(500)
+	if !withinLimit(w, r, limits, entitlements.LimitNotes, noteCount) {
 		return
 	}
 	//Create new note
@@ -49,9 +59,10 @@ func HandleTeamNotes(w http.ResponseWriter, r *http.Request) {
 		Body:   req.Body,
 		UserID: userId,
 	}
-	noteId, err := models.Cfg.DB.NewNote(r.Context(), newNoteParams)
+	noteId, err := s.DB.NewNote(r.Context(), newNoteParams)
 	if err != nil {
-		http.Error(w, `{"error":"Failed to create note"}`, http.StatusInternalServerError)
+		logger(r).Error("Error creating note", "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusInternalServerError, "Failed to create note"))
 		return
 	}
 	teamNoteParams := database.AddNoteToTeamParams{
@@ -59,9 +70,10 @@ func HandleTeamNotes(w http.ResponseWriter, r *http.Request) {
 		ID:     teamId,
 		UserID: userId,
 	}
-	err = models.Cfg.DB.AddNoteToTeam(r.Context(), teamNoteParams)
+	err = s.DB.AddNoteToTeam(r.Context(), teamNoteParams)
 	if err != nil {
-		http.Error(w, `{"error":"Failed to create note"}`, http.StatusInternalServerError)
+		logger(r).Error("Error sharing note with team", "team_id", teamId, "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusInternalServerError, "Failed to create note"))
 		return
 	}
 	w.WriteHeader(http.StatusCreated)
@@ -81,32 +93,35 @@ func HandleTeamNotes(w http.ResponseWriter, r *http.Request) {
 //	...
 //
 // }
-func HandleGetTeamNotes(w http.ResponseWriter, r *http.Request) {
+func (s *Server) HandleGetTeamNotes(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	//Get and validate token
-	userId, err := auth.GetAndValidateToken(r.Header, models.Cfg.Secret)
+	userId := principal(r).UserID
+	//get team id
+	teamId, err := uuid.Parse(r.PathValue("teamID"))
 	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+		apierror.Write(w, r, apierror.InvalidParameter("teamID", "Could not parse team id"))
 		return
 	}
-	//get team id
-	teamId, err := uuid.Parse(r.URL.Query().Get("team_id"))
-	if err != nil {
-		http.Error(w, "Could not parse team uuid", http.StatusBadRequest)
+	if !s.requireTeamRole(w, r, teamId) {
 		return
 	}
 	getTeamNotesParams := database.GetTeamNotesParams{
 		TeamID: teamId,
 		UserID: userId,
 	}
-	notes, err := models.Cfg.DB.GetTeamNotes(r.Context(), getTeamNotesParams)
+	notes, err := s.DB.GetTeamNotes(r.Context(), getTeamNotesParams)
 	if err != nil {
-		http.Error(w, "Could not get notes, please reload", http.StatusFailedDependency)
+		logger(r).Error("Error fetching team notes", "team_id", teamId, "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not get notes, please reload"))
 		return
 	}
+	if notes == nil {
+		notes = []database.Note{}
+	}
 	notesJSON, err := json.Marshal(notes)
 	if err != nil {
-		w.WriteHeader(http.StatusFailedDependency)
+		apierror.Write(w, r, apierror.Internal("Failed to create response", err))
+		return
 	}
 	w.WriteHeader(http.StatusOK)
 	_, err = w.Write(notesJSON)
@@ -126,24 +141,19 @@ func HandleGetTeamNotes(w http.ResponseWriter, r *http.Request) {
 //		"body":"string"
 //		"user_id":"uuid"
 //	}
-func HandleGetTeamNote(w http.ResponseWriter, r *http.Request) {
+func (s *Server) HandleGetTeamNote(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	//Get and validate token
-	userId, err := auth.GetAndValidateToken(r.Header, models.Cfg.Secret)
-	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
-		return
-	}
+	userId := principal(r).UserID
 	//get team id
-	teamId, err := uuid.Parse(r.URL.Query().Get("team_id"))
+	teamId, err := uuid.Parse(r.PathValue("teamID"))
 	if err != nil {
-		http.Error(w, "Could not parse team uuid", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.InvalidParameter("teamID", "Could not parse team id"))
 		return
 	}
 	//get note id
-	noteId, err := uuid.Parse(r.URL.Query().Get("note_id"))
+	noteId, err := uuid.Parse(r.PathValue("noteID"))
 	if err != nil {
-		http.Error(w, "Could not parse note uuid", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.InvalidParameter("noteID", "Could not parse note id"))
 		return
 	}
 	//Get team note
@@ -152,15 +162,21 @@ func HandleGetTeamNote(w http.ResponseWriter, r *http.Request) {
 		TeamID: teamId,
 		UserID: userId,
 	}
-	note, err := models.Cfg.DB.GetTeamNote(r.Context(), getTeamNoteParams)
+	note, err := s.DB.GetTeamNote(r.Context(), getTeamNoteParams)
+	if errors.Is(err, sql.ErrNoRows) {
+		apierror.Write(w, r, apierror.NotFound("Note not found"))
+		return
+	}
 	if err != nil {
-		http.Error(w, "Could note get note, please reload", http.StatusBadRequest)
+		logger(r).Error("Error fetching team note", "note_id", noteId, "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not get note"))
 		return
 	}
 	//marshal note to json
 	noteJSON, err := json.Marshal(note)
 	if err != nil {
-		w.WriteHeader(http.StatusFailedDependency)
+		apierror.Write(w, r, apierror.Internal("Failed to create response", err))
+		return
 	}
 	w.WriteHeader(http.StatusOK)
 	_, err = w.Write(noteJSON)
@@ -170,35 +186,45 @@ func HandleGetTeamNote(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Deletes the specified note from the team and database
-func HandleDeleteTeamNote(w http.ResponseWriter, r *http.Request) {
+// Deletes the specified note from the team and database. Only team admins can delete notes
+func (s *Server) HandleDeleteTeamNote(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	//Get and validate token
-	userId, err := auth.GetAndValidateToken(r.Header, models.Cfg.Secret)
+	userId := principal(r).UserID
+	//get team id
+	teamId, err := uuid.Parse(r.PathValue("teamID"))
 	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+		apierror.Write(w, r, apierror.InvalidParameter("teamID", "Could not parse team id"))
 		return
 	}
 	//get note id
-	noteId, err := uuid.Parse(r.URL.Query().Get("note_id"))
+	noteId, err := uuid.Parse(r.PathValue("noteID"))
 	if err != nil {
-		http.Error(w, "Could not parse note uuid", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.InvalidParameter("noteID", "Could not parse note id"))
+		return
+	}
+	if !s.requireTeamRole(w, r, teamId, roleAdmin) {
 		return
 	}
 	//Get team note
 	removeNoteFromTeamParams := database.RemoveNoteFromTeamParams{
 		NoteID: noteId,
+		TeamID: teamId,
 		UserID: userId,
 	}
-	err = models.Cfg.DB.RemoveNoteFromTeam(r.Context(), removeNoteFromTeamParams)
+	removed, err := s.DB.RemoveNoteFromTeam(r.Context(), removeNoteFromTeamParams)
 	if err != nil {
-		http.Error(w, "Could note delete note, please try again", http.StatusBadRequest)
+		logger(r).Error("Error removing note from team", "team_id", teamId, "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not delete note, please try again"))
+		return
+	}
+	if removed == 0 {
+		apierror.Write(w, r, apierror.NotFound("Note not found"))
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// Update note body and needs following params:
+// Update note body, only admins and editors of the team can. Needs following params:
 //
 //	{
 //		"body":"string"
@@ -213,46 +239,45 @@ func HandleDeleteTeamNote(w http.ResponseWriter, r *http.Request) {
 //		"body":"string"
 //		"user_id":"uuid"
 //	}
-func HandleUpdateTeamNote(w http.ResponseWriter, r *http.Request) {
+func (s *Server) HandleUpdateTeamNote(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	//Get and validate token
-	userId, err := auth.GetAndValidateToken(r.Header, models.Cfg.Secret)
-	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
-		return
-	}
+	userId := principal(r).UserID
 	//get team id
-	teamId, err := uuid.Parse(r.URL.Query().Get("team_id"))
+	teamId, err := uuid.Parse(r.PathValue("teamID"))
 	if err != nil {
-		http.Error(w, "Could not parse team uuid", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.InvalidParameter("teamID", "Could not parse team id"))
 		return
 	}
 	//get note id
-	noteId, err := uuid.Parse(r.URL.Query().Get("note_id"))
+	noteId, err := uuid.Parse(r.PathValue("noteID"))
 	if err != nil {
-		http.Error(w, "Could not parse note uuid", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.InvalidParameter("noteID", "Could not parse note id"))
 		return
 	}
-	//req struct
-	var req struct {
-		Body string `json:"body"`
-	}
+	var req noteRequest
 	//decode req
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Error decoding request: %v", err)
-		w.WriteHeader(500)
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		logger(r).Warn("Invalid request", "err", err)
+		apierror.Write(w, r, err)
+		return
+	}
+	if !s.requireTeamRole(w, r, teamId, roleAdmin, roleEditor) {
 		return
 	}
-	defer r.Body.Close()
 	updateTeamNoteParams := database.UpdateTeamNoteParams{
 		Body:   req.Body,
 		ID:     noteId,
 		TeamID: teamId,
 		UserID: userId,
 	}
-	err = models.Cfg.DB.UpdateTeamNote(r.Context(), updateTeamNoteParams)
+	updated, err := s.DB.UpdateTeamNote(r.Context(), updateTeamNoteParams)
 	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusFailedDependency)
+		logger(r).Error("Error updating team note", "team_id", teamId, "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not update note"))
+		return
+	}
+	if updated == 0 {
+		apierror.Write(w, r, apierror.NotFound("Note not found"))
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
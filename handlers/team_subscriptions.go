@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/F0RG-2142/capstone-1/internal/apierror"
+	"github.com/F0RG-2142/capstone-1/internal/billing"
+	"github.com/F0RG-2142/capstone-1/internal/database"
+	"github.com/F0RG-2142/capstone-1/internal/entitlements"
+	"github.com/google/uuid"
+)
+
+// Paid team subscription of the team, if it currently grants premium
+func (s *Server) activeTeamSubscription(ctx context.Context, teamId uuid.UUID) (database.TeamSubscription, bool, error) {
+	sub, err := s.DB.GetTeamSubscription(ctx, teamId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.TeamSubscription{}, false, nil
+	}
+	if err != nil {
+		return database.TeamSubscription{}, false, err
+	}
+	return sub, billing.TeamGrantsPremium(sub, s.now().UTC()), nil
+}
+
+// Limits a member has inside the team: those of a paid team for everyone in it, otherwise the member's own plan
+func (s *Server) teamLimits(ctx context.Context, teamId uuid.UUID, memberPremium bool) (entitlements.Limits, error) {
+	sub, paid, err := s.activeTeamSubscription(ctx, teamId)
+	if err != nil {
+		return entitlements.Limits{}, err
+	}
+	if paid {
+		return entitlements.ForTeam(int64(sub.Seats)), nil
+	}
+	return entitlements.ForPremium(memberPremium), nil
+}
+
+// Limits on the team's size: the seats of a paid team, otherwise the plan of the team's creator.
+// Every way of joining a team has to check these before adding the member
+func (s *Server) teamSizeLimits(ctx context.Context, teamId uuid.UUID) (entitlements.Limits, error) {
+	sub, paid, err := s.activeTeamSubscription(ctx, teamId)
+	if err != nil {
+		return entitlements.Limits{}, err
+	}
+	if paid {
+		return entitlements.ForTeam(int64(sub.Seats)), nil
+	}
+	creatorPremium, err := s.DB.GetTeamCreatorPremium(ctx, teamId)
+	if err != nil {
+		return entitlements.Limits{}, err
+	}
+	return entitlements.ForPremium(creatorPremium), nil
+}
+
+// Checks there is room in the team for one more member, see withinLimit
+func (s *Server) teamHasRoom(w http.ResponseWriter, r *http.Request, teamId uuid.UUID) bool {
+	limits, err := s.teamSizeLimits(r.Context(), teamId)
+	if err != nil {
+		logger(r).Error("Error getting team limits", "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not check plan limits"))
+		return false
+	}
+	memberCount, err := s.DB.CountTeamMembers(r.Context(), teamId)
+	if err != nil {
+		logger(r).Error("Error counting team members", "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not check plan limits"))
+		return false
+	}
+	return withinLimit(w, r, limits, entitlements.LimitTeamMembers, memberCount)
+}
+
+type teamSubscriptionResponse struct {
+	Plan             string     `json:"plan"`
+	Status           string     `json:"status"`
+	Seats            *int32     `json:"seats"`
+	SeatsUsed        int64      `json:"seats_used"`
+	CurrentPeriodEnd *time.Time `json:"current_period_end"`
+	GracePeriodEnd   *time.Time `json:"grace_period_end"`
+	CanceledAt       *time.Time `json:"canceled_at"`
+	Premium          bool       `json:"premium"`
+}
+
+// Returns the subscription of the team given in the url. Any member can see it. Teams without
+// one are on the free plan with status "none":
+//
+//	{
+//		"plan":"free" or "team"
+//		"status":"none", "trialing", "active", "past_due" or "canceled"
+//		"seats":"int"
+//		"seats_used":"int"
+//		"current_period_end":"timestamp"
+//		"grace_period_end":"timestamp" (while past_due)
+//		"canceled_at":"timestamp"
+//		"premium":"bool" (whether members get premium inside the team)
+//	}
+func (s *Server) HandleGetTeamSubscription(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	teamId, err := uuid.Parse(r.PathValue("teamID"))
+	if err != nil {
+		apierror.Write(w, r, apierror.InvalidParameter("teamID", "Could not parse team id"))
+		return
+	}
+	if !s.requireTeamRole(w, r, teamId) {
+		return
+	}
+	seatsUsed, err := s.DB.CountTeamMembers(r.Context(), teamId)
+	if err != nil {
+		logger(r).Error("Error counting team members", "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not get team subscription"))
+		return
+	}
+	resp := teamSubscriptionResponse{Plan: billing.PlanFree, Status: "none", SeatsUsed: seatsUsed}
+	sub, err := s.DB.GetTeamSubscription(r.Context(), teamId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		logger(r).Error("Error fetching team subscription", "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not get team subscription"))
+		return
+	}
+	if err == nil {
+		resp.Plan = sub.Plan
+		resp.Status = sub.Status
+		resp.Seats = &sub.Seats
+		resp.CurrentPeriodEnd = &sub.CurrentPeriodEnd
+		resp.Premium = billing.TeamGrantsPremium(sub, s.now().UTC())
+		if sub.GracePeriodEnd.Valid {
+			resp.GracePeriodEnd = &sub.GracePeriodEnd.Time
+		}
+		if sub.CanceledAt.Valid {
+			resp.CanceledAt = &sub.CanceledAt.Time
+		}
+	}
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Failed to create response", err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(jsonResp)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+}
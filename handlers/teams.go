@@ -1,53 +1,67 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
+	"slices"
 
-	"github.com/F0RG-2142/capstone-1/internal/auth"
+	"github.com/F0RG-2142/capstone-1/internal/apierror"
 	"github.com/F0RG-2142/capstone-1/internal/database"
-	"github.com/F0RG-2142/capstone-1/models"
+	"github.com/F0RG-2142/capstone-1/internal/entitlements"
+	"github.com/F0RG-2142/capstone-1/internal/validate"
 	"github.com/google/uuid"
 )
 
-// Creates a new team using the following parameters:
+type newTeamRequest struct {
+	TeamName  string `json:"team_name" validate:"required,max=100"`
+	IsPrivate bool   `json:"is_private"`
+}
+
+// Creates a new team owned by the requesting user, who joins it as its admin. Needs the following parameters:
 //
 //	{
 //		"team_name":"string",
-//		"user_id":"uuid",
 //		"is_private":"bool",
 //	}
-func HandleNewTeam(w http.ResponseWriter, r *http.Request) {
+//
+// and returns the team like HandleGetTeam
+func (s *Server) HandleNewTeam(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	userId := principal(r).UserID
 	//req struct and decoding
-	var req struct {
-		TeamName  string    `json:"team_name"`
-		UserId    uuid.UUID `json:"user_id"`
-		IsPrivate bool      `json:"is_private"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Error decoding request: %v", err)
-		w.WriteHeader(500)
+	var req newTeamRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		logger(r).Warn("Invalid request", "err", err)
+		apierror.Write(w, r, err)
 		return
 	}
-	defer r.Body.Close()
-	if req.TeamName == "" {
-		http.Error(w, `{"error":"Please enter a team name"}`, http.StatusNotAcceptable)
+	if !callerWithinLimit(w, r, entitlements.LimitTeamsCreated, s.DB.CountTeamsCreated) {
 		return
 	}
 	params := database.NewTeamParams{
 		TeamName:  req.TeamName,
-		CreatedBy: req.UserId,
+		CreatedBy: userId,
 		IsPrivate: req.IsPrivate,
 	}
-	err := models.Cfg.DB.NewTeam(r.Context(), params)
+	team, err := s.DB.NewTeam(r.Context(), params)
+	if err != nil {
+		logger(r).Error("Error creating team", "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusInternalServerError, "Failed to create team"))
+		return
+	}
+	teamJSON, err := json.Marshal(team)
 	if err != nil {
-		log.Printf("Error creating team: %v", err)
-		http.Error(w, `{"error":"Failed to create team"}`, http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Internal("Failed to create response", err))
 		return
 	}
 	w.WriteHeader(http.StatusCreated)
+	_, err = w.Write(teamJSON)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
 }
 
 // Gets one team from database bassed on team id given in url and returns:
@@ -60,33 +74,33 @@ func HandleNewTeam(w http.ResponseWriter, r *http.Request) {
 //	   "created_by":"uuid"
 //	   "is_private":"bool"
 //	}
-func HandleGetTeam(w http.ResponseWriter, r *http.Request) {
+func (s *Server) HandleGetTeam(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	teamId, err := uuid.Parse(r.URL.Query().Get("team_id"))
+	teamId, err := uuid.Parse(r.PathValue("teamID"))
 	if err != nil {
-		http.Error(w, "Could not parse uuid", http.StatusBadRequest)
-		return
-	}
-	//get and validate token
-	userId, err := auth.GetAndValidateToken(r.Header, models.Cfg.Secret)
-	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+		apierror.Write(w, r, apierror.InvalidParameter("teamID", "Could not parse team id"))
 		return
 	}
+	userId := principal(r).UserID
 	var team database.Team
 	params := database.GetTeamByIdParams{
 		UserID: userId,
 		TeamID: teamId,
 	}
-	team, err = models.Cfg.DB.GetTeamById(r.Context(), params)
+	team, err = s.DB.GetTeamById(r.Context(), params)
+	if errors.Is(err, sql.ErrNoRows) {
+		apierror.Write(w, r, apierror.NotFound("Team not found"))
+		return
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusBadGateway)
+		logger(r).Error("Error fetching team", "team_id", teamId, "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not get team"))
 		return
 	}
 	//check return value to see if it returns valid json as there is no json tag in database.Team
 	teamJSON, err := json.Marshal(team)
 	if err != nil {
-		w.WriteHeader(http.StatusFailedDependency)
+		apierror.Write(w, r, apierror.Internal("Failed to create response", err))
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -111,23 +125,21 @@ func HandleGetTeam(w http.ResponseWriter, r *http.Request) {
 //
 // ...
 // }
-func HandleGetTeams(w http.ResponseWriter, r *http.Request) {
+func (s *Server) HandleGetTeams(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	var teams []database.Team
-	//Get and validate token
-	userId, err := auth.GetAndValidateToken(r.Header, models.Cfg.Secret)
+	userId := principal(r).UserID
+	teams, err := s.DB.GetAllTeams(r.Context(), userId)
 	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+		logger(r).Error("Error fetching teams", "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not get teams"))
 		return
 	}
-	teams, err = models.Cfg.DB.GetAllTeams(r.Context(), userId)
-	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusForbidden)
-		return
+	if teams == nil {
+		teams = []database.Team{}
 	}
 	teamsJSON, err := json.Marshal(teams)
 	if err != nil {
-		w.WriteHeader(http.StatusFailedDependency)
+		apierror.Write(w, r, apierror.Internal("Failed to create response", err))
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -138,74 +150,67 @@ func HandleGetTeams(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Deletes team from database based on team id given in url
-func HandleDeleteTeam(w http.ResponseWriter, r *http.Request) {
+// Deletes team from database based on team id given in url. Only team admins can delete it
+func (s *Server) HandleDeleteTeam(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	//Get and validate token
-	userId, err := auth.GetAndValidateToken(r.Header, models.Cfg.Secret)
+	userId := principal(r).UserID
+	//get team id
+	teamId, err := uuid.Parse(r.PathValue("teamID"))
 	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+		apierror.Write(w, r, apierror.InvalidParameter("teamID", "Could not parse team id"))
 		return
 	}
-	//get team id
-	teamId, err := uuid.Parse(r.URL.Query().Get("team_id"))
-	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+	if !s.requireTeamRole(w, r, teamId, roleAdmin) {
 		return
 	}
 	deleteParams := database.DeleteTeamParams{
 		UserID: userId,
 		ID:     teamId,
 	}
-	err = models.Cfg.DB.DeleteTeam(r.Context(), deleteParams)
+	deleted, err := s.DB.DeleteTeam(r.Context(), deleteParams)
 	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusFailedDependency)
+		logger(r).Error("Error deleting team", "team_id", teamId, "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not delete team"))
+		return
+	}
+	if deleted == 0 {
+		apierror.Write(w, r, apierror.NotFound("Team not found"))
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
+type addTeamMemberRequest struct {
+	UserID uuid.UUID `json:"user_id" validate:"required"`
+	Role   string    `json:"role" validate:"required,oneof=admin editor viewer"`
+}
+
 // Adds user to team in database based on url provided and needs the following parameters:
 //
 //	{
 //		"user_id":"uuid"
 //		"role":"string"
 //	}
-func HandleAddUserToTeam(w http.ResponseWriter, r *http.Request) {
+func (s *Server) HandleAddUserToTeam(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	//Get and validate token
-	userId, err := auth.GetAndValidateToken(r.Header, models.Cfg.Secret)
-	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
-		return
-	}
 	//get teamID
-	teamId, err := uuid.Parse(r.URL.Query().Get("team_id"))
+	teamId, err := uuid.Parse(r.PathValue("teamID"))
 	if err != nil {
-		http.Error(w, "Could not parse uuid", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.InvalidParameter("teamID", "Could not parse team id"))
 		return
 	}
 	//decode req to add user and what their role should be
-	var req struct {
-		UserID uuid.UUID `json:"user_id"`
-		Role   string    `json:"role"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+	var req addTeamMemberRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		logger(r).Warn("Invalid request", "err", err)
+		apierror.Write(w, r, err)
 		return
 	}
-	//Set the parameters for what team member to get to see if they are authorized to add someone (be admin on specified team)
-	getMemberParams := database.GetTeamMemberParams{
-		UserID: userId,
-		TeamID: teamId,
-	}
-	var member database.UserTeam
-	if member, err = models.Cfg.DB.GetTeamMember(r.Context(), getMemberParams); err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+	//only admins of the team can add someone
+	if !s.requireTeamRole(w, r, teamId, roleAdmin) {
 		return
 	}
-	if member.Role != "admin" {
-		http.Error(w, `{"error":"You are not authorized to add people to this group"}`, http.StatusBadRequest)
+	if !s.teamHasRoom(w, r, teamId) {
 		return
 	}
 	//add user to team
@@ -214,46 +219,31 @@ func HandleAddUserToTeam(w http.ResponseWriter, r *http.Request) {
 		TeamID: teamId,
 		Role:   req.Role,
 	}
-	err = models.Cfg.DB.AddUserToTeam(r.Context(), addParams)
+	err = s.DB.AddUserToTeam(r.Context(), addParams)
 	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+		logger(r).Warn("Error adding user to team", "team_id", teamId, "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusBadRequest, "Could not add user to team"))
+		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // Remove a user from the team
-func HandleRemoveUserFromTeam(w http.ResponseWriter, r *http.Request) {
+func (s *Server) HandleRemoveUserFromTeam(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	//get team and member id
-	teamId, err := uuid.Parse(r.URL.Query().Get("team_id"))
-	if err != nil {
-		http.Error(w, "Could not parse uuid", http.StatusBadRequest)
-		return
-	}
-	memberId, err := uuid.Parse(r.URL.Query().Get("memberID"))
+	teamId, err := uuid.Parse(r.PathValue("teamID"))
 	if err != nil {
-		http.Error(w, "Could not parse uuid", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.InvalidParameter("teamID", "Could not parse team id"))
 		return
 	}
-
-	//Get and validate token
-	userId, err := auth.GetAndValidateToken(r.Header, models.Cfg.Secret)
+	memberId, err := uuid.Parse(r.PathValue("memberID"))
 	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+		apierror.Write(w, r, apierror.InvalidParameter("memberID", "Could not parse member id"))
 		return
 	}
 	//See if requester is authorized to remove someone (must be admin on specified team)
-	getMemberParams := database.GetTeamMemberParams{
-		UserID: userId,
-		TeamID: teamId,
-	}
-	var member database.UserTeam
-	if member, err = models.Cfg.DB.GetTeamMember(r.Context(), getMemberParams); err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
-		return
-	}
-	if member.Role != "admin" {
-		http.Error(w, `{"error":"You are not authorized to add people to this group"}`, http.StatusBadRequest)
+	if !s.requireTeamRole(w, r, teamId, roleAdmin) {
 		return
 	}
 	//remove specified member
@@ -261,48 +251,50 @@ func HandleRemoveUserFromTeam(w http.ResponseWriter, r *http.Request) {
 		UserID: memberId,
 		TeamID: teamId,
 	}
-	if err = models.Cfg.DB.RemoveUserFromTeam(r.Context(), removeUserParams); err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+	if err = s.DB.RemoveUserFromTeam(r.Context(), removeUserParams); err != nil {
+		logger(r).Error("Error removing user from team", "team_id", teamId, "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not remove user from team"))
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// Get all the members of a specified group
-func HandleGetTeamMembers(w http.ResponseWriter, r *http.Request) {
+// Get all the members of a specified group. Returns:
+//
+//	[
+//		{
+//			"user_id":"uuid"
+//			"team_id":"uuid"
+//			"user_role":"admin", "editor" or "viewer"
+//			"joined_at":"timestamp"
+//		}
+//	]
+func (s *Server) HandleGetTeamMembers(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	//Get and validate token
-	userId, err := auth.GetAndValidateToken(r.Header, models.Cfg.Secret)
-	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
-		return
-	}
 	//get team ID
-	teamId, err := uuid.Parse(r.URL.Query().Get("team_id"))
+	teamId, err := uuid.Parse(r.PathValue("teamID"))
 	if err != nil {
-		http.Error(w, "Could not parse uuid", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.InvalidParameter("teamID", "Could not parse team id"))
 		return
 	}
-	//See if requester is authorized to view this team
-	getMemberParams := database.GetTeamMemberParams{
-		UserID: userId,
-		TeamID: teamId,
-	}
-	//Doesnt need to make member var as we just need to  see if they are in the team, anyone in a team can view members
-	if _, err = models.Cfg.DB.GetTeamMember(r.Context(), getMemberParams); err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+	//anyone in a team can view members
+	if !s.requireTeamRole(w, r, teamId) {
 		return
 	}
 	//get all members
-	var members []database.Team
-	if members, err = models.Cfg.DB.GetTeamMembers(r.Context(), teamId); err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+	var members []database.UserTeam
+	if members, err = s.DB.GetTeamMembers(r.Context(), teamId); err != nil {
+		logger(r).Error("Error fetching team members", "team_id", teamId, "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not get team members"))
 		return
 	}
+	if members == nil {
+		members = []database.UserTeam{}
+	}
 
 	membersJSON, err := json.Marshal(members)
 	if err != nil {
-		w.WriteHeader(http.StatusFailedDependency)
+		apierror.Write(w, r, apierror.Internal("Failed to create response", err))
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -312,3 +304,33 @@ func HandleGetTeamMembers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// Team roles, see the user_teams table
+const (
+	roleAdmin  = "admin"
+	roleEditor = "editor"
+	roleViewer = "viewer"
+)
+
+// Checks the caller is a member of the team with one of roles (any role when none are given).
+// Writes 404 for non-members so teams don't leak, 403 for members without the role
+func (s *Server) requireTeamRole(w http.ResponseWriter, r *http.Request, teamId uuid.UUID, roles ...string) bool {
+	member, err := s.DB.GetTeamMember(r.Context(), database.GetTeamMemberParams{
+		UserID: principal(r).UserID,
+		TeamID: teamId,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		apierror.Write(w, r, apierror.NotFound("Team not found"))
+		return false
+	}
+	if err != nil {
+		logger(r).Error("Error fetching team member", "team_id", teamId, "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not check team membership"))
+		return false
+	}
+	if len(roles) > 0 && !slices.Contains(roles, member.Role) {
+		apierror.Write(w, r, apierror.Forbidden(apierror.CodeForbidden, "Your role in this team doesn't allow this"))
+		return false
+	}
+	return true
+}
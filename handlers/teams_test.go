@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/F0RG-2142/capstone-1/internal/auth"
+	"github.com/F0RG-2142/capstone-1/internal/database"
+	"github.com/google/uuid"
+)
+
+// Creates a team through the API, the user becomes its admin
+func (ts *testServer) newTeam(user testUser, name string) database.Team {
+	ts.t.Helper()
+	rec := ts.do("POST", "/api/v1/teams", user.Token, map[string]any{"team_name": name, "is_private": true})
+	expectStatus(ts.t, rec, http.StatusCreated)
+	return decode[database.Team](ts.t, rec)
+}
+
+func (ts *testServer) addMember(admin testUser, team database.Team, member testUser, role string) {
+	ts.t.Helper()
+	path := "/api/v1/teams/" + team.ID.String() + "/members"
+	expectStatus(ts.t, ts.do("POST", path, admin.Token, map[string]any{"user_id": member.ID, "role": role}), http.StatusNoContent)
+}
+
+func TestTeams(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.signUp("admin@example.com")
+	editor := ts.signUp("editor@example.com")
+	viewer := ts.signUp("viewer@example.com")
+	outsider := ts.signUp("outsider@example.com")
+	newcomer := ts.signUp("newcomer@example.com")
+	readOnly := ts.accessToken(admin, auth.ScopeTeamsRead)
+
+	team := ts.newTeam(admin, "Writers")
+	if team.TeamName != "Writers" || team.CreatedBy != admin.ID || !team.IsPrivate {
+		t.Fatalf("unexpected team: %+v", team)
+	}
+	ts.addMember(admin, team, editor, roleEditor)
+	ts.addMember(admin, team, viewer, roleViewer)
+	teamPath := "/api/v1/teams/" + team.ID.String()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   any
+		want   int
+	}{
+		{name: "Create Without Name", method: "POST", path: "/api/v1/teams", token: outsider.Token, body: map[string]any{"team_name": ""}, want: http.StatusUnprocessableEntity},
+		{name: "Create Malformed JSON", method: "POST", path: "/api/v1/teams", token: outsider.Token, body: `{`, want: http.StatusBadRequest},
+		{name: "Create Over Free Plan Limit", method: "POST", path: "/api/v1/teams", token: admin.Token, body: map[string]any{"team_name": "Second"}, want: http.StatusPaymentRequired},
+		{name: "Create With Read Only Token", method: "POST", path: "/api/v1/teams", token: readOnly, body: map[string]any{"team_name": "x"}, want: http.StatusForbidden},
+		{name: "Get As Viewer", method: "GET", path: teamPath, token: viewer.Token, want: http.StatusOK},
+		{name: "Get With Read Only Token", method: "GET", path: teamPath, token: readOnly, want: http.StatusOK},
+		{name: "Get As Outsider", method: "GET", path: teamPath, token: outsider.Token, want: http.StatusNotFound},
+		{name: "Get Bad ID", method: "GET", path: "/api/v1/teams/not-a-uuid", token: admin.Token, want: http.StatusBadRequest},
+		{name: "Members As Outsider", method: "GET", path: teamPath + "/members", token: outsider.Token, want: http.StatusNotFound},
+		{name: "Members Bad ID", method: "GET", path: "/api/v1/teams/not-a-uuid/members", token: admin.Token, want: http.StatusBadRequest},
+		{name: "Add Member As Editor", method: "POST", path: teamPath + "/members", token: editor.Token, body: map[string]any{"user_id": newcomer.ID, "role": roleViewer}, want: http.StatusForbidden},
+		{name: "Add Member As Outsider", method: "POST", path: teamPath + "/members", token: outsider.Token, body: map[string]any{"user_id": newcomer.ID, "role": roleViewer}, want: http.StatusNotFound},
+		{name: "Add Member Malformed JSON", method: "POST", path: teamPath + "/members", token: admin.Token, body: `{"user_id":`, want: http.StatusBadRequest},
+		{name: "Add Member Bad Team ID", method: "POST", path: "/api/v1/teams/not-a-uuid/members", token: admin.Token, body: map[string]any{"user_id": newcomer.ID, "role": roleViewer}, want: http.StatusBadRequest},
+		{name: "Add Member Unknown Role", method: "POST", path: teamPath + "/members", token: admin.Token, body: map[string]any{"user_id": newcomer.ID, "role": "owner"}, want: http.StatusUnprocessableEntity},
+		{name: "Add Unknown User", method: "POST", path: teamPath + "/members", token: admin.Token, body: map[string]any{"user_id": uuid.New(), "role": roleViewer}, want: http.StatusConflict},
+		{name: "Add Existing Member", method: "POST", path: teamPath + "/members", token: admin.Token, body: map[string]any{"user_id": viewer.ID, "role": roleViewer}, want: http.StatusConflict},
+		{name: "Remove Member As Viewer", method: "DELETE", path: teamPath + "/members/" + editor.ID.String(), token: viewer.Token, want: http.StatusForbidden},
+		{name: "Remove Member Bad ID", method: "DELETE", path: teamPath + "/members/not-a-uuid", token: admin.Token, want: http.StatusBadRequest},
+		{name: "Subscription As Viewer", method: "GET", path: teamPath + "/subscription", token: viewer.Token, want: http.StatusOK},
+		{name: "Subscription As Outsider", method: "GET", path: teamPath + "/subscription", token: outsider.Token, want: http.StatusNotFound},
+		{name: "Subscription Bad ID", method: "GET", path: "/api/v1/teams/not-a-uuid/subscription", token: admin.Token, want: http.StatusBadRequest},
+		{name: "Delete As Editor", method: "DELETE", path: teamPath, token: editor.Token, want: http.StatusForbidden},
+		{name: "Delete As Outsider", method: "DELETE", path: teamPath, token: outsider.Token, want: http.StatusNotFound},
+		{name: "Delete With Read Only Token", method: "DELETE", path: teamPath, token: readOnly, want: http.StatusForbidden},
+		{name: "Delete Bad ID", method: "DELETE", path: "/api/v1/teams/not-a-uuid", token: admin.Token, want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, ts.do(tt.method, tt.path, tt.token, tt.body), tt.want)
+		})
+	}
+
+	members := decode[[]database.UserTeam](t, ts.do("GET", teamPath+"/members", viewer.Token, nil))
+	roles := map[uuid.UUID]string{}
+	for _, m := range members {
+		if m.TeamID != team.ID {
+			t.Errorf("member of another team listed: %+v", m)
+		}
+		roles[m.UserID] = m.Role
+	}
+	if len(members) != 3 || roles[admin.ID] != roleAdmin || roles[editor.ID] != roleEditor || roles[viewer.ID] != roleViewer {
+		t.Errorf("unexpected members: %+v", members)
+	}
+
+	sub := decode[teamSubscriptionResponse](t, ts.do("GET", teamPath+"/subscription", admin.Token, nil))
+	if sub.Status != "none" || sub.SeatsUsed != 3 {
+		t.Errorf("unexpected team subscription: %+v", sub)
+	}
+
+	for _, user := range []testUser{admin, viewer} {
+		teams := decode[[]database.Team](t, ts.do("GET", "/api/v1/teams", user.Token, nil))
+		if len(teams) != 1 || teams[0].ID != team.ID {
+			t.Errorf("expected %s to see the team, got %+v", user.Email, teams)
+		}
+	}
+	if rec := ts.do("GET", "/api/v1/teams", outsider.Token, nil); rec.Body.String() != "[]" {
+		t.Errorf("expected no teams for an outsider, got %s", rec.Body.String())
+	}
+
+	expectStatus(t, ts.do("DELETE", teamPath+"/members/"+viewer.ID.String(), admin.Token, nil), http.StatusNoContent)
+	expectStatus(t, ts.do("GET", teamPath, viewer.Token, nil), http.StatusNotFound)
+
+	expectStatus(t, ts.do("DELETE", teamPath, admin.Token, nil), http.StatusNoContent)
+	expectStatus(t, ts.do("GET", teamPath, admin.Token, nil), http.StatusNotFound)
+	expectStatus(t, ts.do("DELETE", teamPath, admin.Token, nil), http.StatusNotFound)
+}
+
+func TestTeamMemberLimit(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.signUp("admin@example.com")
+	team := ts.newTeam(admin, "Crowd")
+	//the free plan allows five members including the admin
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com"} {
+		ts.addMember(admin, team, ts.signUp(email), roleViewer)
+	}
+	extra := ts.signUp("e@example.com")
+	path := "/api/v1/teams/" + team.ID.String() + "/members"
+	expectStatus(t, ts.do("POST", path, admin.Token, map[string]any{"user_id": extra.ID, "role": roleViewer}), http.StatusPaymentRequired)
+}
+
+// Store whose team lookups fail like a database that is down
+type brokenTeams struct {
+	database.Querier
+}
+
+func (brokenTeams) GetTeamById(context.Context, database.GetTeamByIdParams) (database.Team, error) {
+	return database.Team{}, errors.New("connection refused")
+}
+
+func (brokenTeams) GetTeamMember(context.Context, database.GetTeamMemberParams) (database.UserTeam, error) {
+	return database.UserTeam{}, errors.New("connection refused")
+}
+
+func TestTeamLookupFailure(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.signUp("admin@example.com")
+	teamPath := "/api/v1/teams/" + ts.newTeam(admin, "Writers").ID.String()
+	ts.srv.DB = brokenTeams{ts.db}
+
+	//a failing database isn't a missing team
+	tests := []struct {
+		name string
+		path string
+	}{
+		{name: "Get Team", path: teamPath},
+		{name: "Members", path: teamPath + "/members"},
+		{name: "Subscription", path: teamPath + "/subscription"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, ts.do("GET", tt.path, admin.Token, nil), http.StatusFailedDependency)
+		})
+	}
+}
+
+func TestTeamNotes(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.signUp("admin@example.com")
+	editor := ts.signUp("editor@example.com")
+	viewer := ts.signUp("viewer@example.com")
+	outsider := ts.signUp("outsider@example.com")
+	readOnly := ts.accessToken(editor, auth.ScopeNotesRead)
+
+	team := ts.newTeam(admin, "Writers")
+	ts.addMember(admin, team, editor, roleEditor)
+	ts.addMember(admin, team, viewer, roleViewer)
+	notesPath := "/api/v1/teams/" + team.ID.String() + "/notes"
+
+	if rec := ts.do("GET", notesPath, viewer.Token, nil); rec.Body.String() != "[]" {
+		t.Errorf("expected an empty list, got %s", rec.Body.String())
+	}
+	expectStatus(t, ts.do("POST", notesPath, editor.Token, map[string]string{"body": "shared"}), http.StatusCreated)
+	notes := decode[[]database.Note](t, ts.do("GET", notesPath, viewer.Token, nil))
+	if len(notes) != 1 || notes[0].Body != "shared" || notes[0].UserID != editor.ID {
+		t.Fatalf("unexpected team notes: %+v", notes)
+	}
+	notePath := notesPath + "/" + notes[0].ID.String()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   any
+		want   int
+	}{
+		{name: "Create As Viewer", method: "POST", path: notesPath, token: viewer.Token, body: map[string]string{"body": "x"}, want: http.StatusForbidden},
+		{name: "Create As Outsider", method: "POST", path: notesPath, token: outsider.Token, body: map[string]string{"body": "x"}, want: http.StatusNotFound},
+		{name: "Create With Read Only Token", method: "POST", path: notesPath, token: readOnly, body: map[string]string{"body": "x"}, want: http.StatusForbidden},
+		{name: "Create Malformed JSON", method: "POST", path: notesPath, token: editor.Token, body: `{"body"`, want: http.StatusBadRequest},
+		{name: "Create Bad Team ID", method: "POST", path: "/api/v1/teams/not-a-uuid/notes", token: editor.Token, body: map[string]string{"body": "x"}, want: http.StatusBadRequest},
+		{name: "List As Outsider", method: "GET", path: notesPath, token: outsider.Token, want: http.StatusNotFound},
+		{name: "List Bad Team ID", method: "GET", path: "/api/v1/teams/not-a-uuid/notes", token: viewer.Token, want: http.StatusBadRequest},
+		{name: "Get As Viewer", method: "GET", path: notePath, token: viewer.Token, want: http.StatusOK},
+		{name: "Get With Read Only Token", method: "GET", path: notePath, token: readOnly, want: http.StatusOK},
+		{name: "Get As Outsider", method: "GET", path: notePath, token: outsider.Token, want: http.StatusNotFound},
+		{name: "Get Unknown Note", method: "GET", path: notesPath + "/" + uuid.NewString(), token: viewer.Token, want: http.StatusNotFound},
+		{name: "Get Bad Note ID", method: "GET", path: notesPath + "/not-a-uuid", token: viewer.Token, want: http.StatusBadRequest},
+		{name: "Update As Viewer", method: "PUT", path: notePath, token: viewer.Token, body: map[string]string{"body": "x"}, want: http.StatusForbidden},
+		{name: "Update As Outsider", method: "PUT", path: notePath, token: outsider.Token, body: map[string]string{"body": "x"}, want: http.StatusNotFound},
+		{name: "Update Unknown Note", method: "PUT", path: notesPath + "/" + uuid.NewString(), token: editor.Token, body: map[string]string{"body": "x"}, want: http.StatusNotFound},
+		{name: "Update Malformed JSON", method: "PUT", path: notePath, token: editor.Token, body: `{`, want: http.StatusBadRequest},
+		{name: "Update Bad Note ID", method: "PUT", path: notesPath + "/not-a-uuid", token: editor.Token, body: map[string]string{"body": "x"}, want: http.StatusBadRequest},
+		{name: "Update As Editor", method: "PUT", path: notePath, token: editor.Token, body: map[string]string{"body": "edited"}, want: http.StatusNoContent},
+		{name: "Delete As Editor", method: "DELETE", path: notePath, token: editor.Token, want: http.StatusForbidden},
+		{name: "Delete As Outsider", method: "DELETE", path: notePath, token: outsider.Token, want: http.StatusNotFound},
+		{name: "Delete Unknown Note", method: "DELETE", path: notesPath + "/" + uuid.NewString(), token: admin.Token, want: http.StatusNotFound},
+		{name: "Delete Bad Note ID", method: "DELETE", path: notesPath + "/not-a-uuid", token: admin.Token, want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, ts.do(tt.method, tt.path, tt.token, tt.body), tt.want)
+		})
+	}
+
+	if note := decode[database.Note](t, ts.do("GET", notePath, viewer.Token, nil)); note.Body != "edited" {
+		t.Errorf("expected the edited body, got %+v", note)
+	}
+	//a private note of the admin isn't a note of the team
+	private := ts.newNote(admin, "private")
+	expectStatus(t, ts.do("GET", notesPath+"/"+private.ID.String(), viewer.Token, nil), http.StatusNotFound)
+	expectStatus(t, ts.do("DELETE", notesPath+"/"+private.ID.String(), admin.Token, nil), http.StatusNotFound)
+
+	expectStatus(t, ts.do("DELETE", notePath, admin.Token, nil), http.StatusNoContent)
+	expectStatus(t, ts.do("GET", notePath, viewer.Token, nil), http.StatusNotFound)
+	//deleting a team note deletes the note itself
+	if notes := decode[[]database.Note](t, ts.do("GET", "/api/v1/notes", editor.Token, nil)); len(notes) != 0 {
+		t.Errorf("expected the editor's note to be gone, got %+v", notes)
+	}
+}
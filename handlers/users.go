@@ -2,17 +2,22 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
-	"log"
+	"errors"
 	"net/http"
 	"time"
 
+	"github.com/F0RG-2142/capstone-1/internal/apierror"
 	"github.com/F0RG-2142/capstone-1/internal/auth"
 	"github.com/F0RG-2142/capstone-1/internal/database"
-	"github.com/F0RG-2142/capstone-1/models"
+	"github.com/F0RG-2142/capstone-1/internal/validate"
 	"github.com/google/uuid"
 )
 
+type updateUserRequest struct {
+	Email    string `json:"email" validate:"required,email,max=254"`
+	Password string `json:"password" validate:"required,maxbytes=72"`
+}
+
 // Updatse user username and/or password, needs theese parameters:
 //
 //	{
@@ -29,43 +34,40 @@ import (
 //		"user_email":"string"
 //		"has_notes_premium":"bool"
 //	}
-func HandleUpdateUser(w http.ResponseWriter, r *http.Request) {
+func (s *Server) HandleUpdateUser(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	//get and validate auth token
-	user_id, err := auth.GetAndValidateToken(r.Header, models.Cfg.Secret)
-	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusForbidden)
-		return
-	}
+	user_id := principal(r).UserID
 	//decode request
-	var req struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Error decoding request: %v", err)
-		http.Error(w, `{"error":"Invalid request body"}`, http.StatusBadRequest)
+	var req updateUserRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		logger(r).Warn("Invalid request", "err", err)
+		apierror.Write(w, r, err)
 		return
 	}
 	//hash passw and update user
-	hashed_pass, err := auth.HashPassword(req.Password)
+	hashed_pass, err := auth.HashPassword(r.Context(), req.Password)
 	if err != nil {
-
+		//never store an empty hash, the user couldn't log in anymore
+		logger(r).Error("Error hashing password", "err", err)
+		apierror.Write(w, r, apierror.Internal("Failed to hash password", err))
+		return
 	}
 	params := database.UpdateUserParams{
 		Email:          req.Email,
 		HashedPassword: hashed_pass,
 		ID:             user_id,
 	}
-	err = models.Cfg.DB.UpdateUser(r.Context(), params)
+	err = s.DB.UpdateUser(r.Context(), params)
 	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusFailedDependency)
+		logger(r).Error("Error updating user", "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not update user"))
 		return
 	}
 	//get updated user
-	user, err := models.Cfg.DB.GetUserByEmail(r.Context(), req.Email)
+	user, err := s.DB.GetUserByEmail(r.Context(), req.Email)
 	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusFailedDependency)
+		logger(r).Error("Error fetching updated user", "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not get user"))
 		return
 	}
 	//create response struct, marshal, and respond
@@ -78,7 +80,7 @@ func HandleUpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 	jsonResp, err := json.Marshal(resp)
 	if err != nil {
-		http.Error(w, `{"error":"Failed to create response"}`, http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Internal("Failed to create response", err))
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -89,6 +91,10 @@ func HandleUpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type refreshResponse struct {
+	AccessToken string `json:"token"`
+}
+
 // Needs JWT in Authorization header
 //
 // Refreshes the JWT. This will be called every 55 mins by the client as the JWT expires every hour
@@ -98,49 +104,40 @@ func HandleUpdateUser(w http.ResponseWriter, r *http.Request) {
 //	{
 //		"token":"string"
 //	}
-func HandleRefreshJWT(w http.ResponseWriter, r *http.Request) {
+func (s *Server) HandleRefreshJWT(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusForbidden)
+		unauthorized(w, r, errNoCredentials)
 		return
 	}
-	refreshToken, err := models.Cfg.DB.GetRefreshToken(r.Context(), token)
-	fmt.Println(token)
+	refreshToken, err := s.DB.GetRefreshToken(r.Context(), token)
 	if err != nil {
-		log.Printf("Error fetching refresh token: %v", err)
-		http.Error(w, `{"error":"Invalid refresh token"}`, http.StatusForbidden)
-		return
-	}
-	if !refreshToken.RevokedAt.Valid {
-		http.Error(w, `{"error":"Refresh token is revoked"}`, http.StatusForbidden)
+		logger(r).Warn("Error fetching refresh token", "err", err)
+		unauthorized(w, r, errors.New("Invalid refresh token"))
 		return
 	}
-	if time.Now().After(refreshToken.ExpiresAt) {
-		http.Error(w, `{"error":"Refresh token is expired"}`, http.StatusForbidden)
+	if refreshToken.RevokedAt.Valid {
+		unauthorized(w, r, errors.New("Refresh token is revoked"))
 		return
 	}
-	tokenSecret := models.Cfg.Secret
-	if tokenSecret == "" {
-		log.Println("JWT_SECRET not set")
-		http.Error(w, `{"error":"Server configuration error"}`, http.StatusInternalServerError)
+	if s.now().After(refreshToken.ExpiresAt) {
+		unauthorized(w, r, errors.New("Refresh token is expired"))
 		return
 	}
-	accessToken, err := auth.MakeJWT(refreshToken.UserID, tokenSecret, time.Hour)
+	accessToken, err := s.Tokens.MakeJWT(refreshToken.UserID, time.Hour)
 	if err != nil {
-		log.Printf("Error generating access token: %v", err)
-		http.Error(w, `{"error":"Failed to generate access token"}`, http.StatusInternalServerError)
+		logger(r).Error("Error generating access token", "err", err)
+		apierror.Write(w, r, apierror.Internal("Failed to generate access token", err))
 		return
 	}
-	resp := struct {
-		AccessToken string `json:"token"`
-	}{
+	resp := refreshResponse{
 		AccessToken: accessToken,
 	}
 	jsonResp, err := json.Marshal(resp)
 	if err != nil {
-		log.Printf("Error marshaling response: %v", err)
-		http.Error(w, `{"error":"Failed to create response"}`, http.StatusInternalServerError)
+		logger(r).Error("Error marshaling response", "err", err)
+		apierror.Write(w, r, apierror.Internal("Failed to create response", err))
 		return
 	}
 
@@ -152,6 +149,11 @@ func HandleRefreshJWT(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type newUserRequest struct {
+	Email    string `json:"user_email" validate:"required,email,max=254"`
+	Password string `json:"user_password" validate:"required,maxbytes=72"`
+}
+
 // Creatse a new user and needs the following params:
 //
 //	{
@@ -168,39 +170,27 @@ func HandleRefreshJWT(w http.ResponseWriter, r *http.Request) {
 //		"user_email":"string"
 //		"has_notes_premium":"bool"
 //	}
-func HandleNewUser(w http.ResponseWriter, r *http.Request) {
+func (s *Server) HandleNewUser(w http.ResponseWriter, r *http.Request) {
 	//decode request body
 	w.Header().Set("Content-Type", "application/json")
-	var req struct {
-		Email    string `json:"user_email"`
-		Password string `json:"user_password"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Error decoding request: %v", err)
-		http.Error(w, `{"error":"Invalid request body"}`, http.StatusBadRequest)
+	var req newUserRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		logger(r).Warn("Invalid request", "err", err)
+		apierror.Write(w, r, err)
 		return
 	}
-	defer r.Body.Close()
 
-	//validate email and password
-	if req.Email == "" {
-		http.Error(w, `{"error":"Email is required"}`, http.StatusBadRequest)
-		return
-	}
-	if req.Password == "" {
-		http.Error(w, `{"error":"Password is required"}`, http.StatusBadRequest)
-		return
-	}
 	//hash passw
-	hashedPass, err := auth.HashPassword(req.Password)
+	hashedPass, err := auth.HashPassword(r.Context(), req.Password)
 	if err != nil {
-		http.Error(w, `{"error":"Failed to hash password"}`, http.StatusFailedDependency)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Failed to hash password"))
+		return
 	}
 
 	//Check if user exists, returns error if there is no error getting user by email
-	_, err = models.Cfg.DB.GetUserByEmail(r.Context(), req.Email)
+	_, err = s.DB.GetUserByEmail(r.Context(), req.Email)
 	if err == nil {
-		http.Error(w, `{"error":"This user already exists"}`, http.StatusBadRequest)
+		apierror.Write(w, r, apierror.New(http.StatusConflict, apierror.CodeAlreadyExists, "This user already exists"))
 		return
 	}
 	//Create user and resepond with created user
@@ -209,10 +199,10 @@ func HandleNewUser(w http.ResponseWriter, r *http.Request) {
 		HashedPassword: hashedPass,
 	}
 
-	user, err := models.Cfg.DB.CreateUser(r.Context(), params)
+	user, err := s.DB.CreateUser(r.Context(), params)
 	if err != nil {
-		log.Printf("Error creating user: %v", err)
-		http.Error(w, `{"error":"Failed to create user"}`, http.StatusFailedDependency)
+		logger(r).Error("Error creating user", "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Failed to create user"))
 		return
 	}
 	resp := database.User{
@@ -224,8 +214,8 @@ func HandleNewUser(w http.ResponseWriter, r *http.Request) {
 	}
 	userJSON, err := json.Marshal(resp)
 	if err != nil {
-		log.Printf("Error marshalling user to JSON: %v", err)
-		http.Error(w, `{"error":"Internal server error"}`, http.StatusFailedDependency)
+		logger(r).Error("Error marshalling user to JSON", "err", err)
+		apierror.Write(w, r, apierror.Internal("Internal server error", err))
 		return
 	}
 	w.WriteHeader(http.StatusCreated)
@@ -236,13 +226,35 @@ func HandleNewUser(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type loginRequest struct {
+	Email        string `json:"email" validate:"required,max=254"`
+	Password     string `json:"password" validate:"required,maxbytes=72"`
+	CaptchaToken string `json:"captcha_token" validate:"max=4096"`
+}
+
+// Body of a successful login, also returned by the OIDC callback
+type loginResponse struct {
+	ID                uuid.UUID `json:"id"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+	Email             string    `json:"email"`
+	Token             string    `json:"token"`
+	RefreshToken      string    `json:"refresh_token"`
+	Has_notes_premium bool      `json:"has_notes_premium"`
+}
+
 // Log into specified account and needs the following params:
 //
 //	{
-//		"user_email":"string"
-//		"user_password":"string"
+//		"email":"string"
+//		"password":"string"
+//		"captcha_token":"string" (only needed after repeated failures)
 //	}
 //
+// Failed attempts are counted per account and per ip. Repeated failures are answered with 429 and
+// Retry-After (growing exponentially), then require a captcha and finally lock the account (423)
+// until the unlock link emailed to the user is followed or an admin clears the lockout.
+//
 // returns the following:
 //
 //	{
@@ -254,34 +266,37 @@ func HandleNewUser(w http.ResponseWriter, r *http.Request) {
 //		"refresh_token":"string"
 //		"has_notes_premium":"bool"
 //	}
-func HandleLogin(w http.ResponseWriter, r *http.Request) {
+func (s *Server) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	//parse req
-	var req struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
+	var req loginRequest
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Error decoding request: %v", err)
-		http.Error(w, `{"error":"Invalid request body"}`, http.StatusBadRequest)
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		logger(r).Warn("Invalid request", "err", err)
+		apierror.Write(w, r, err)
+		return
+	}
+	//refuse while the account or client ip is backing off or locked
+	attempt := s.newLoginAttempt(r, req.Email)
+	if !attempt.allowed(w, req.CaptchaToken) {
 		return
 	}
-	defer r.Body.Close()
 	//verify usern and passw
-	user, err := models.Cfg.DB.GetUserByEmail(r.Context(), req.Email)
-	if err != nil {
-		http.Error(w, `{"error":"Incorrect username or password"}`, http.StatusBadRequest)
+	user, err := s.DB.GetUserByEmail(r.Context(), req.Email)
+	if err == nil {
+		err = auth.CheckPasswordHash(r.Context(), user.HashedPassword, req.Password)
 	}
-	err = auth.CheckPasswordHash(user.HashedPassword, req.Password)
 	if err != nil {
-		http.Error(w, `{"error":"Incorrect username or password"}`, http.StatusBadRequest)
+		attempt.failed()
+		apierror.Write(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidCredential, "Incorrect username or password"))
+		return
 	}
+	attempt.succeeded()
 	//make jwt
-	Token, err := auth.MakeJWT(user.ID, models.Cfg.Secret, time.Hour)
+	Token, err := s.Tokens.MakeJWT(user.ID, time.Hour)
 	if err != nil {
-		log.Printf("Error generating JWT for user %q: %v", user.ID, err)
-		http.Error(w, `{"error":"Failed to generate access token"}`, http.StatusInternalServerError)
+		logger(r).Error("Error generating JWT", "user_id", user.ID, "err", err)
+		apierror.Write(w, r, apierror.Internal("Failed to generate access token", err))
 		return
 	}
 	refreshToken, _ := auth.MakeRefreshToken()
@@ -289,21 +304,13 @@ func HandleLogin(w http.ResponseWriter, r *http.Request) {
 		Token:  refreshToken,
 		UserID: user.ID,
 	}
-	usrRefreshToken, err := models.Cfg.DB.NewRefreshToken(r.Context(), params)
+	usrRefreshToken, err := s.DB.NewRefreshToken(r.Context(), params)
 	if err != nil {
-		log.Print(err)
-		w.WriteHeader(http.StatusFailedDependency)
+		logger(r).Error("Error generating refresh token", "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Failed to generate refresh token"))
 		return
 	}
-	resp := struct {
-		ID                uuid.UUID `json:"id"`
-		CreatedAt         time.Time `json:"created_at"`
-		UpdatedAt         time.Time `json:"updated_at"`
-		Email             string    `json:"email"`
-		Token             string    `json:"token"`
-		RefreshToken      string    `json:"refresh_token"`
-		Has_notes_premium bool      `json:"has_notes_premium"`
-	}{
+	resp := loginResponse{
 		ID:                user.ID,
 		CreatedAt:         user.CreatedAt,
 		UpdatedAt:         user.UpdatedAt,
@@ -315,7 +322,7 @@ func HandleLogin(w http.ResponseWriter, r *http.Request) {
 
 	jsonResp, err := json.Marshal(resp)
 	if err != nil {
-		http.Error(w, `{"error":"Failed to create response"}`, http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Internal("Failed to create response", err))
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -327,22 +334,24 @@ func HandleLogin(w http.ResponseWriter, r *http.Request) {
 }
 
 // Revoke the refresh token from a user. Needs token in auth header to authorize
-func HandleRevokeRefreshToken(w http.ResponseWriter, r *http.Request) {
+func (s *Server) HandleRevokeRefreshToken(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusForbidden)
+		unauthorized(w, r, errNoCredentials)
 		return
 	}
-	refreshToken, err := models.Cfg.DB.GetRefreshToken(r.Context(), token)
+	refreshToken, err := s.DB.GetRefreshToken(r.Context(), token)
 	if err != nil {
-		log.Printf("Error fetching refresh token: %v", err)
-		http.Error(w, `{"error":"Invalid refresh token"}`, http.StatusForbidden)
+		logger(r).Warn("Error fetching refresh token", "err", err)
+		unauthorized(w, r, errors.New("Invalid refresh token"))
 		return
 	}
-	err = models.Cfg.DB.RevokeRefreshToken(r.Context(), refreshToken.Token)
+	err = s.DB.RevokeRefreshToken(r.Context(), refreshToken.Token)
 	if err != nil {
-		http.Error(w, `"error":"Could not revoke Refresh Token"`, http.StatusFailedDependency)
+		logger(r).Error("Error revoking refresh token", "err", err)
+		apierror.Write(w, r, apierror.Wrap(err, http.StatusFailedDependency, "Could not revoke refresh token"))
+		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,547 @@
+package handlers
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/F0RG-2142/capstone-1/internal/apierror"
+	"github.com/F0RG-2142/capstone-1/internal/auth"
+	"github.com/F0RG-2142/capstone-1/internal/database"
+	"github.com/F0RG-2142/capstone-1/internal/entitlements"
+	"github.com/F0RG-2142/capstone-1/internal/lockout"
+	"github.com/F0RG-2142/capstone-1/internal/oidc"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestHandleNewUser(t *testing.T) {
+	ts := newTestServer(t)
+	ts.signUp("taken@example.com")
+
+	tests := []struct {
+		name string
+		body any
+		want int
+	}{
+		{name: "Valid User", body: map[string]string{"user_email": "new@example.com", "user_password": "pass"}, want: http.StatusCreated},
+		{name: "Existing Email", body: map[string]string{"user_email": "taken@example.com", "user_password": "pass"}, want: http.StatusConflict},
+		{name: "Missing Email", body: map[string]string{"user_password": "pass"}, want: http.StatusUnprocessableEntity},
+		{name: "Missing Password", body: map[string]string{"user_email": "other@example.com"}, want: http.StatusUnprocessableEntity},
+		{name: "Invalid Email", body: map[string]string{"user_email": "not-an-email", "user_password": "pass"}, want: http.StatusUnprocessableEntity},
+		{name: "Unknown Field", body: map[string]string{"user_email": "other@example.com", "user_password": "pass", "is_admin": "true"}, want: http.StatusUnprocessableEntity},
+		{name: "Malformed JSON", body: `{"user_email":`, want: http.StatusBadRequest},
+		//72 characters but 144 bytes, more than bcrypt takes
+		{name: "Password Too Many Bytes", body: map[string]string{"user_email": "other@example.com", "user_password": strings.Repeat("é", 72)}, want: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := ts.do("POST", "/api/v1/register", "", tt.body)
+			expectStatus(t, rec, tt.want)
+			if tt.want == http.StatusCreated {
+				user := decode[database.User](t, rec)
+				if user.Email != "new@example.com" || user.ID == uuid.Nil {
+					t.Errorf("unexpected user: %+v", user)
+				}
+				if user.HashedPassword != "" {
+					t.Error("response must not contain the password hash")
+				}
+			}
+		})
+	}
+}
+
+func TestHandleLogin(t *testing.T) {
+	ts := newTestServer(t)
+	user := ts.signUp("login@example.com")
+	if user.Token == "" || user.RefreshToken == "" || user.Email != "login@example.com" {
+		t.Fatalf("unexpected login response: %+v", user)
+	}
+
+	tests := []struct {
+		name string
+		body any
+		want int
+	}{
+		{name: "Valid Credentials", body: map[string]string{"email": "login@example.com", "password": testPassword}, want: http.StatusOK},
+		{name: "Wrong Password", body: map[string]string{"email": "login@example.com", "password": "wrong"}, want: http.StatusUnauthorized},
+		{name: "Unknown Email", body: map[string]string{"email": "nobody@example.com", "password": testPassword}, want: http.StatusUnauthorized},
+		{name: "Malformed JSON", body: `not json`, want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, ts.do("POST", "/api/v1/login", "", tt.body), tt.want)
+		})
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	ts := newTestServer(t)
+	ts.signUp("locked@example.com")
+	wrong := map[string]string{"email": "locked@example.com", "password": "wrong"}
+
+	//the free attempts and the first delayed one are answered normally
+	for range lockout.AccountPolicy.FreeAttempts + 1 {
+		expectStatus(t, ts.do("POST", "/api/v1/login", "", wrong), http.StatusUnauthorized)
+	}
+	rec := ts.do("POST", "/api/v1/login", "", map[string]string{"email": "locked@example.com", "password": testPassword})
+	expectStatus(t, rec, http.StatusTooManyRequests)
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("expected a Retry-After header")
+	}
+
+	lockouts := decode[[]database.LoginThrottle](t, ts.do("GET", "/api/v1/admin/lockouts", testAdminToken, nil))
+	if len(lockouts) != 1 || lockouts[0].Key != lockout.AccountKey("locked@example.com") {
+		t.Fatalf("expected the account to be listed, got %+v", lockouts)
+	}
+	expectStatus(t, ts.do("DELETE", "/api/v1/admin/lockouts/"+lockouts[0].Key, testAdminToken, nil), http.StatusNoContent)
+	ts.login("locked@example.com")
+}
+
+func TestUnlockEmail(t *testing.T) {
+	ts := newTestServer(t)
+	ts.signUp("forgetful@example.com")
+	wrong := map[string]string{"email": "forgetful@example.com", "password": "wrong"}
+	//waits out each backoff, all within the policy's window
+	for range lockout.AccountPolicy.LockoutAfter {
+		expectStatus(t, ts.do("POST", "/api/v1/login", "", wrong), http.StatusUnauthorized)
+		ts.now = ts.now.Add(5 * time.Minute)
+	}
+	if len(ts.mailer.sent) != 1 || ts.mailer.sent[0] != "forgetful@example.com" {
+		t.Errorf("expected one unlock email by the time the failed login answers, got %v", ts.mailer.sent)
+	}
+}
+
+func TestConcurrentLoginAttempts(t *testing.T) {
+	ts := newTestServer(t)
+	ts.signUp("concurrent@example.com")
+	wrong := map[string]string{"email": "concurrent@example.com", "password": "wrong"}
+	for range lockout.AccountPolicy.FreeAttempts {
+		expectStatus(t, ts.do("POST", "/api/v1/login", "", wrong), http.StatusUnauthorized)
+	}
+
+	//only the first attempt past the free ones gets its password checked, it blocks the rest
+	var wg sync.WaitGroup
+	statuses := make(chan int, 5)
+	for range cap(statuses) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses <- ts.do("POST", "/api/v1/login", "", wrong).Code
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusUnauthorized] != 1 || counts[http.StatusTooManyRequests] != 4 {
+		t.Errorf("expected one 401 and four 429s, got %v", counts)
+	}
+}
+
+func TestSuccessfulLoginsDontCountAgainstIP(t *testing.T) {
+	ts := newTestServer(t)
+	ts.signUp("regular@example.com")
+	for range lockout.IPPolicy.FreeAttempts + 1 {
+		ts.login("regular@example.com")
+	}
+	throttle, err := ts.db.GetLoginThrottle(context.Background(), lockout.IPKey("192.0.2.1"))
+	if err != nil || throttle.Failures != 0 || throttle.BlockedUntil.After(ts.now) {
+		t.Errorf("expected no failures on the ip, got %+v (%v)", throttle, err)
+	}
+}
+
+// Locks the key for an hour by recording an attempt under a policy that locks on the first one
+func (ts *testServer) lock(key string) {
+	ts.t.Helper()
+	params := database.RecordLoginAttemptParams{Key: key, LockoutAfter: 1, LockoutSeconds: time.Hour.Seconds(), WindowStart: ts.now}
+	if _, err := ts.db.RecordLoginAttempt(context.Background(), params); err != nil {
+		ts.t.Fatalf("failed to lock %s: %v", key, err)
+	}
+}
+
+func TestIPLockout(t *testing.T) {
+	ts := newTestServer(t)
+	ts.signUp("shared@example.com")
+	ts.lock(lockout.IPKey("192.0.2.1"))
+	ctx := context.Background()
+
+	//there's no unlock email for an ip
+	rec := ts.do("POST", "/api/v1/login", "", map[string]string{"email": "shared@example.com", "password": testPassword})
+	expectStatus(t, rec, http.StatusTooManyRequests)
+	problem := decode[apierror.Problem](t, rec)
+	if problem.Code != apierror.CodeLoginThrottled || strings.Contains(problem.Detail, "email") {
+		t.Errorf("expected the ip lock message, got %+v", problem)
+	}
+	if _, err := ts.db.GetLoginThrottle(ctx, lockout.AccountKey("shared@example.com")); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected nothing counted against the account, got %v", err)
+	}
+}
+
+func TestHandleUnlockAccount(t *testing.T) {
+	ts := newTestServer(t)
+	ts.signUp("unlock@example.com")
+	key := lockout.AccountKey("unlock@example.com")
+	ts.lock(key)
+	ctx := context.Background()
+	if err := ts.db.NewUnlockToken(ctx, database.NewUnlockTokenParams{TokenHash: auth.HashAccessToken("unlock-token"), ThrottleKey: key}); err != nil {
+		t.Fatalf("failed to save unlock token: %v", err)
+	}
+	expectStatus(t, ts.do("POST", "/api/v1/login", "", map[string]string{"email": "unlock@example.com", "password": testPassword}), http.StatusLocked)
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{name: "Missing Token", path: "/api/v1/login/unlock", want: http.StatusBadRequest},
+		{name: "Unknown Token", path: "/api/v1/login/unlock?token=guess", want: http.StatusBadRequest},
+		{name: "Valid Token", path: "/api/v1/login/unlock?token=unlock-token", want: http.StatusOK},
+		{name: "Used Token", path: "/api/v1/login/unlock?token=unlock-token", want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, ts.do("GET", tt.path, "", nil), tt.want)
+		})
+	}
+	ts.login("unlock@example.com")
+}
+
+func TestRefreshAndLogout(t *testing.T) {
+	ts := newTestServer(t)
+	user := ts.signUp("refresh@example.com")
+
+	rec := ts.do("POST", "/api/v1/token/refresh", user.RefreshToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	refreshed := decode[testUser](t, rec)
+	expectStatus(t, ts.do("GET", "/api/v1/notes", refreshed.Token, nil), http.StatusOK)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{name: "Refresh Without Token", method: "POST", path: "/api/v1/token/refresh", want: http.StatusUnauthorized},
+		{name: "Refresh With Unknown Token", method: "POST", path: "/api/v1/token/refresh", token: "unknown", want: http.StatusUnauthorized},
+		{name: "Logout Without Token", method: "POST", path: "/api/v1/logout", want: http.StatusUnauthorized},
+		{name: "Logout With Unknown Token", method: "POST", path: "/api/v1/logout", token: "unknown", want: http.StatusUnauthorized},
+		{name: "Logout", method: "POST", path: "/api/v1/logout", token: user.RefreshToken, want: http.StatusNoContent},
+		{name: "Refresh After Logout", method: "POST", path: "/api/v1/token/refresh", token: user.RefreshToken, want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, ts.do(tt.method, tt.path, tt.token, nil), tt.want)
+		})
+	}
+
+	ts.now = ts.now.Add(61 * 24 * time.Hour)
+	other := ts.login("refresh@example.com")
+	ts.now = ts.now.Add(61 * 24 * time.Hour)
+	expectStatus(t, ts.do("POST", "/api/v1/token/refresh", other.RefreshToken, nil), http.StatusUnauthorized)
+}
+
+func TestHandleUpdateUser(t *testing.T) {
+	ts := newTestServer(t)
+	user := ts.signUp("before@example.com")
+	token := ts.accessToken(user, auth.AllScopes...)
+
+	expectStatus(t, ts.do("PUT", "/api/v1/user/me", token, map[string]string{"email": "after@example.com", "password": "new"}), http.StatusForbidden)
+	expectStatus(t, ts.do("PUT", "/api/v1/user/me", user.Token, `{"email":`), http.StatusBadRequest)
+	expectStatus(t, ts.do("PUT", "/api/v1/user/me", user.Token, map[string]string{"email": "after@example.com", "password": strings.Repeat("é", 72)}), http.StatusUnprocessableEntity)
+	ts.login("before@example.com")
+
+	rec := ts.do("PUT", "/api/v1/user/me", user.Token, map[string]string{"email": "after@example.com", "password": testPassword})
+	expectStatus(t, rec, http.StatusOK)
+	if updated := decode[database.User](t, rec); updated.Email != "after@example.com" || updated.ID != user.ID {
+		t.Errorf("unexpected user: %+v", updated)
+	}
+	ts.login("after@example.com")
+	expectStatus(t, ts.do("POST", "/api/v1/login", "", map[string]string{"email": "before@example.com", "password": testPassword}), http.StatusUnauthorized)
+}
+
+func TestAccessTokens(t *testing.T) {
+	ts := newTestServer(t)
+	user := ts.signUp("tokens@example.com")
+	other := ts.signUp("other@example.com")
+	otherToken := decode[accessTokenResponse](t, ts.do("POST", "/api/v1/user/me/tokens", other.Token, map[string]any{"name": "other", "scopes": []string{auth.ScopeNotesRead}}))
+
+	tests := []struct {
+		name string
+		body any
+		want int
+	}{
+		{name: "Valid Token", body: map[string]any{"name": "ci", "scopes": []string{auth.ScopeNotesRead}, "expires_in_days": 30}, want: http.StatusCreated},
+		{name: "Missing Name", body: map[string]any{"scopes": []string{auth.ScopeNotesRead}}, want: http.StatusUnprocessableEntity},
+		{name: "Unknown Scope", body: map[string]any{"name": "ci", "scopes": []string{"everything"}}, want: http.StatusUnprocessableEntity},
+		{name: "Expiry Out Of Range", body: map[string]any{"name": "ci", "scopes": []string{auth.ScopeNotesRead}, "expires_in_days": 400}, want: http.StatusUnprocessableEntity},
+		{name: "Malformed JSON", body: `{"name":`, want: http.StatusBadRequest},
+	}
+
+	var created accessTokenResponse
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := ts.do("POST", "/api/v1/user/me/tokens", user.Token, tt.body)
+			expectStatus(t, rec, tt.want)
+			if tt.want == http.StatusCreated {
+				created = decode[accessTokenResponse](t, rec)
+			}
+		})
+	}
+	if !auth.IsAccessToken(created.Token) || created.ExpiresAt == nil {
+		t.Fatalf("unexpected token: %+v", created)
+	}
+	expectStatus(t, ts.do("GET", "/api/v1/notes", created.Token, nil), http.StatusOK)
+
+	listed := decode[[]accessTokenResponse](t, ts.do("GET", "/api/v1/user/me/tokens", user.Token, nil))
+	if len(listed) != 1 || listed[0].ID != created.ID || listed[0].Token != "" {
+		t.Fatalf("expected the token without its secret, got %+v", listed)
+	}
+
+	expectStatus(t, ts.do("DELETE", "/api/v1/user/me/tokens/not-a-uuid", user.Token, nil), http.StatusBadRequest)
+	expectStatus(t, ts.do("DELETE", "/api/v1/user/me/tokens/"+otherToken.ID.String(), user.Token, nil), http.StatusNotFound)
+	expectStatus(t, ts.do("DELETE", "/api/v1/user/me/tokens/"+created.ID.String(), user.Token, nil), http.StatusNoContent)
+	expectStatus(t, ts.do("DELETE", "/api/v1/user/me/tokens/"+created.ID.String(), user.Token, nil), http.StatusNotFound)
+	expectStatus(t, ts.do("GET", "/api/v1/notes", created.Token, nil), http.StatusUnauthorized)
+}
+
+func TestAccessTokenExpiry(t *testing.T) {
+	ts := newTestServer(t)
+	user := ts.signUp("expiry@example.com")
+	rec := ts.do("POST", "/api/v1/user/me/tokens", user.Token, map[string]any{"name": "short", "scopes": []string{auth.ScopeNotesRead}, "expires_in_days": 1})
+	expectStatus(t, rec, http.StatusCreated)
+	token := decode[accessTokenResponse](t, rec).Token
+
+	expectStatus(t, ts.do("GET", "/api/v1/notes", token, nil), http.StatusOK)
+	ts.now = ts.now.Add(25 * time.Hour)
+	expectStatus(t, ts.do("GET", "/api/v1/notes", token, nil), http.StatusUnauthorized)
+}
+
+func TestSubscriptionAndUsage(t *testing.T) {
+	ts := newTestServer(t)
+	user := ts.signUp("usage@example.com")
+	expectStatus(t, ts.do("POST", "/api/v1/notes", user.Token, map[string]string{"body": "one"}), http.StatusCreated)
+
+	rec := ts.do("GET", "/api/v1/user/me/subscription", user.Token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if sub := decode[subscriptionResponse](t, rec); sub.Status != "none" || sub.HasNotesPremium {
+		t.Errorf("expected no subscription, got %+v", sub)
+	}
+
+	rec = ts.do("GET", "/api/v1/user/me/usage", user.Token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	usage := decode[struct {
+		Plan  string                `json:"plan"`
+		Usage map[string]usageEntry `json:"usage"`
+	}](t, rec)
+	if usage.Plan != "free" || usage.Usage[entitlements.LimitNotes].Used != 1 {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+}
+
+func TestOIDCRoutes(t *testing.T) {
+	ts := newTestServer(t)
+	//only discovery is served, the token endpoint is unreachable so every code exchange fails
+	idp := newDiscoveryServer(t)
+	ts.srv.OIDC = map[string]*oidc.Provider{
+		"mock": {Name: "mock", IssuerURL: idp.URL, ClientID: "znotes", RedirectURL: "http://localhost/callback"},
+	}
+
+	rec := ts.do("GET", "/api/v1/auth/oidc/mock/login", "", nil)
+	expectStatus(t, rec, http.StatusFound)
+	location, err := rec.Result().Location()
+	if err != nil {
+		t.Fatalf("expected a redirect location: %v", err)
+	}
+	state := location.Query().Get("state")
+	if state == "" || location.Query().Get("code_challenge") == "" {
+		t.Fatalf("redirect is missing state or pkce: %s", location)
+	}
+	var cookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "oidc_state" {
+			cookie = c
+		}
+	}
+	if cookie == nil || cookie.Value == state || !cookie.Secure || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.MaxAge <= 0 {
+		t.Fatalf("expected a short lived httponly cookie with the hash of the state, got %+v", cookie)
+	}
+	other := ts.do("GET", "/api/v1/auth/oidc/mock/login", "", nil).Result().Cookies()[0]
+
+	tests := []struct {
+		name   string
+		path   string
+		cookie *http.Cookie
+		want   int
+	}{
+		{name: "Unknown Provider Login", path: "/api/v1/auth/oidc/unknown/login", want: http.StatusNotFound},
+		{name: "Unknown Provider Callback", path: "/api/v1/auth/oidc/unknown/callback?code=c&state=" + state, cookie: cookie, want: http.StatusNotFound},
+		{name: "Denied By Provider", path: "/api/v1/auth/oidc/mock/callback?error=access_denied", want: http.StatusUnauthorized},
+		{name: "Missing Code", path: "/api/v1/auth/oidc/mock/callback?state=" + state, cookie: cookie, want: http.StatusBadRequest},
+		{name: "Missing Cookie", path: "/api/v1/auth/oidc/mock/callback?code=c&state=" + state, want: http.StatusBadRequest},
+		{name: "Cookie Of Another Login", path: "/api/v1/auth/oidc/mock/callback?code=c&state=" + state, cookie: other, want: http.StatusBadRequest},
+		{name: "Unknown State", path: "/api/v1/auth/oidc/mock/callback?code=c&state=forged", cookie: cookie, want: http.StatusBadRequest},
+		{name: "Failed Exchange", path: "/api/v1/auth/oidc/mock/callback?code=c&state=" + state, cookie: cookie, want: http.StatusUnauthorized},
+		{name: "Reused State", path: "/api/v1/auth/oidc/mock/callback?code=c&state=" + state, cookie: cookie, want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			rec := httptest.NewRecorder()
+			ts.handler.ServeHTTP(rec, req)
+			expectStatus(t, rec, tt.want)
+		})
+	}
+}
+
+// Identity provider that only serves its discovery document
+func newDiscoveryServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	var idp *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidc.Discovery{
+			Issuer:                idp.URL,
+			AuthorizationEndpoint: idp.URL + "/authorize",
+			TokenEndpoint:         idp.URL + "/token",
+			JWKSURI:               idp.URL + "/jwks",
+		})
+	})
+	idp = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// Identity provider that issues whatever ID token the test sets for the code "good"
+type testIdP struct {
+	server  *httptest.Server
+	key     ed25519.PrivateKey
+	idToken string
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	idp := &testIdP{key: private}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidc.Discovery{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JWKSURI:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "OKP", "crv": "Ed25519", "kid": "idp", "use": "sig", "alg": "EdDSA",
+			"x": base64.RawURLEncoding.EncodeToString(public),
+		}}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "good" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "access", "token_type": "Bearer", "id_token": idp.idToken})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// Finishes the login the provider was sent to at location, as the identity in claims
+func (idp *testIdP) callback(ts *testServer, location string, cookie *http.Cookie, claims oidc.IDTokenClaims) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	authURL, err := url.Parse(location)
+	if err != nil {
+		ts.t.Fatalf("invalid authorization url: %v", err)
+	}
+	claims.Nonce = authURL.Query().Get("nonce")
+	claims.Issuer = idp.server.URL
+	claims.Audience = jwt.ClaimStrings{"znotes"}
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Hour))
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = "idp"
+	if idp.idToken, err = token.SignedString(idp.key); err != nil {
+		ts.t.Fatalf("failed to sign id token: %v", err)
+	}
+	req := httptest.NewRequest("GET", "/api/v1/auth/oidc/mock/callback?code=good&state="+url.QueryEscape(authURL.Query().Get("state")), nil)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	ts.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestOIDCIdentities(t *testing.T) {
+	ts := newTestServer(t)
+	idp := newTestIdP(t)
+	ts.srv.OIDC = map[string]*oidc.Provider{
+		"mock": {Name: "mock", IssuerURL: idp.server.URL, ClientID: "znotes", RedirectURL: "http://localhost/callback"},
+	}
+	//someone registered the owner's email with a password before the owner ever used the provider
+	registered := ts.signUp("owner@example.com")
+	identity := func(subject, email string, verified bool) oidc.IDTokenClaims {
+		return oidc.IDTokenClaims{Email: email, EmailVerified: verified, RegisteredClaims: jwt.RegisteredClaims{Subject: subject}}
+	}
+	login := func(claims oidc.IDTokenClaims) *httptest.ResponseRecorder {
+		rec := ts.do("GET", "/api/v1/auth/oidc/mock/login", "", nil)
+		expectStatus(t, rec, http.StatusFound)
+		return idp.callback(ts, rec.Header().Get("Location"), rec.Result().Cookies()[0], claims)
+	}
+	link := func(user testUser, claims oidc.IDTokenClaims) *httptest.ResponseRecorder {
+		rec := ts.do("POST", "/api/v1/user/me/identities/mock", user.Token, nil)
+		expectStatus(t, rec, http.StatusOK)
+		return idp.callback(ts, decode[linkIdentityResponse](t, rec).AuthorizationURL, rec.Result().Cookies()[0], claims)
+	}
+
+	//a new identity is never linked to an existing account by email
+	expectStatus(t, login(identity("owner", "owner@example.com", true)), http.StatusConflict)
+	expectStatus(t, login(identity("unverified", "new@example.com", false)), http.StatusForbidden)
+
+	created := login(identity("newcomer", "new@example.com", true))
+	expectStatus(t, created, http.StatusOK)
+	newcomer := decode[testUser](t, created)
+	if newcomer.ID == registered.ID || newcomer.Email != "new@example.com" {
+		t.Fatalf("expected a new user for a new identity, got %+v", newcomer)
+	}
+	expectStatus(t, login(identity("newcomer", "new@example.com", true)), http.StatusOK)
+
+	//linking is done from the signed in account
+	linked := link(registered, identity("owner", "owner@example.com", true))
+	expectStatus(t, linked, http.StatusOK)
+	if user := decode[testUser](t, linked); user.ID != registered.ID {
+		t.Errorf("expected the identity linked to the signed in user, got %+v", user)
+	}
+	relogin := login(identity("owner", "owner@example.com", true))
+	expectStatus(t, relogin, http.StatusOK)
+	if user := decode[testUser](t, relogin); user.ID != registered.ID {
+		t.Errorf("expected the linked identity to log into the same user, got %+v", user)
+	}
+	expectStatus(t, link(registered, identity("newcomer", "new@example.com", true)), http.StatusConflict)
+}
@@ -0,0 +1,319 @@
+// Package apierror writes every API error the same way, as RFC 7807 problem details
+// (application/problem+json) with a stable machine-readable code and the request id:
+//
+//	{
+//		"type":"urn:znotes:problem:not_found",
+//		"title":"Not Found",
+//		"status":404,
+//		"code":"not_found",
+//		"detail":"Note not found",
+//		"instance":"/api/v1/notes/…",
+//		"request_id":"…",
+//		"errors":[{"field":"…","code":"…","message":"…"}] (only for invalid fields)
+//	}
+//
+// Database errors are classified instead of shown: sql.ErrNoRows becomes a 404, constraint
+// violations a 409, anything else keeps the status and message the handler chose
+package apierror
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+
+	"github.com/F0RG-2142/capstone-1/internal/logging"
+	"github.com/lib/pq"
+)
+
+const ContentType = "application/problem+json"
+
+// Prefix of the problem type, the code follows it
+const TypePrefix = "urn:znotes:problem:"
+
+// Stable error codes clients can branch on. Messages (detail) may change, these don't
+const (
+	CodeBadRequest        = "bad_request"
+	CodeInvalidBody       = "invalid_body"
+	CodeInvalidParameter  = "invalid_parameter"
+	CodeValidationFailed  = "validation_failed"
+	CodeBodyTooLarge      = "body_too_large"
+	CodeUnauthorized      = "unauthorized"
+	CodeInvalidToken      = "invalid_token"
+	CodeInvalidSignature  = "invalid_signature"
+	CodeInvalidCredential = "invalid_credentials"
+	CodeForbidden         = "forbidden"
+	CodeInsufficientScope = "insufficient_scope"
+	CodeSessionRequired   = "session_required"
+	CodeClientCertMissing = "client_certificate_required"
+	CodeCaptchaRequired   = "captcha_required"
+	CodeNotFound          = "not_found"
+	CodeConflict          = "conflict"
+	CodeAlreadyExists     = "already_exists"
+	CodePlanLimitReached  = "plan_limit_reached"
+	CodeLoginThrottled    = "login_throttled"
+	CodeAccountLocked     = "account_locked"
+	CodeRateLimited       = "rate_limited"
+	CodeInternal          = "internal_error"
+	CodeDependencyFailed  = "dependency_failed"
+	CodeUpstreamFailed    = "upstream_failed"
+)
+
+// Postgres error codes of constraint violations
+const (
+	pqForeignKeyViolation = "23503"
+	pqUniqueViolation     = "23505"
+	pqCheckViolation      = "23514"
+	pqNotNullViolation    = "23502"
+)
+
+// Code used when an error is created without one
+func defaultCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusPaymentRequired:
+		return CodePlanLimitReached
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodeBodyTooLarge
+	case http.StatusUnprocessableEntity:
+		return CodeValidationFailed
+	case http.StatusLocked:
+		return CodeAccountLocked
+	case http.StatusFailedDependency:
+		return CodeDependencyFailed
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusBadGateway:
+		return CodeUpstreamFailed
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+// A single invalid field of the request
+type FieldError struct {
+	// JSON name of the field, or the path or query parameter
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// An error with everything needed to answer the request. Err is the cause, Write logs it for
+// 5xx responses and it is never sent to the client
+type Error struct {
+	Status     int
+	Code       string
+	Detail     string
+	Fields     []FieldError
+	Extensions map[string]any
+	Err        error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Detail + ": " + e.Err.Error()
+	}
+	return e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func New(status int, code, detail string) *Error {
+	if code == "" {
+		code = defaultCode(status)
+	}
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+// Adds an extension member to the problem, e.g. the limit that was reached
+func (e *Error) With(key string, value any) *Error {
+	if e.Extensions == nil {
+		e.Extensions = map[string]any{}
+	}
+	e.Extensions[key] = value
+	return e
+}
+
+func BadRequest(detail string) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, detail)
+}
+
+// Request body that isn't valid JSON for the endpoint. Bodies cut off by http.MaxBytesReader
+// are a 413 instead
+func InvalidBody(err error) *Error {
+	e := New(http.StatusBadRequest, CodeInvalidBody, "Invalid request body")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		e = New(http.StatusRequestEntityTooLarge, CodeBodyTooLarge, "Request body too large").With("max_bytes", tooLarge.Limit)
+	}
+	e.Err = err
+	return e
+}
+
+// Path or query parameter that couldn't be parsed
+func InvalidParameter(name, detail string) *Error {
+	e := New(http.StatusBadRequest, CodeInvalidParameter, detail)
+	e.Fields = []FieldError{{Field: name, Code: "invalid", Message: detail}}
+	return e
+}
+
+// 422 listing every invalid field
+func Validation(fields ...FieldError) *Error {
+	e := New(http.StatusUnprocessableEntity, CodeValidationFailed, "The request has invalid fields")
+	e.Fields = fields
+	return e
+}
+
+func NotFound(detail string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, detail)
+}
+
+func Forbidden(code, detail string) *Error {
+	return New(http.StatusForbidden, code, detail)
+}
+
+// 500 for failures that aren't the client's fault, detail must not contain the cause
+func Internal(detail string, err error) *Error {
+	e := New(http.StatusInternalServerError, CodeInternal, detail)
+	e.Err = err
+	return e
+}
+
+// Classifies err from the database. Missing rows and constraint violations say what went wrong
+// without the database's own message, anything else gets status and detail. detail is kept for
+// missing rows when status is already a 404
+func Wrap(err error, status int, detail string) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		if status != http.StatusNotFound {
+			detail = "Resource not found"
+		}
+		e = NotFound(detail)
+		e.Err = err
+		return e
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case pqUniqueViolation:
+			e = New(http.StatusConflict, CodeAlreadyExists, "Resource already exists")
+		case pqForeignKeyViolation:
+			e = New(http.StatusConflict, CodeConflict, "Resource references something that doesn't exist or is still in use")
+		case pqCheckViolation, pqNotNullViolation:
+			e = New(http.StatusConflict, CodeConflict, "Value is not allowed")
+		}
+		if e != nil {
+			e.Err = err
+			return e
+		}
+	}
+	e = New(status, "", detail)
+	e.Err = err
+	return e
+}
+
+// Body of an error response
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Code      string       `json:"code"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	// Members specific to the problem, e.g. "retry_after". Can't replace the members above
+	Extensions map[string]any `json:"-"`
+}
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type problem Problem
+	body, err := json.Marshal(problem(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return body, err
+	}
+	var buf bytes.Buffer
+	buf.Write(body[:len(body)-1])
+	reserved := []string{"type", "title", "status", "code", "detail", "instance", "request_id", "errors"}
+	for _, key := range slices.Sorted(maps.Keys(p.Extensions)) {
+		if slices.Contains(reserved, key) {
+			continue
+		}
+		value, err := json.Marshal(p.Extensions[key])
+		if err != nil {
+			return nil, err
+		}
+		name, _ := json.Marshal(key)
+		buf.WriteByte(',')
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Problem for err, errors that aren't an *Error are answered with a 500 that doesn't reveal them
+func ProblemFor(r *http.Request, err error) Problem {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = Internal("Internal server error", err)
+	}
+	p := Problem{
+		Type:       TypePrefix + e.Code,
+		Title:      http.StatusText(e.Status),
+		Status:     e.Status,
+		Code:       e.Code,
+		Detail:     e.Detail,
+		Errors:     e.Fields,
+		Extensions: e.Extensions,
+	}
+	if r != nil {
+		p.Instance = r.URL.Path
+		p.RequestID = logging.RequestIDFromContext(r.Context())
+	}
+	return p
+}
+
+// Writes err as problem details. Headers already set on w (Retry-After, WWW-Authenticate) are kept.
+// Server errors are logged with their cause through the request's logger
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	p := ProblemFor(r, err)
+	if p.Status >= 500 && r != nil {
+		cause := err
+		var e *Error
+		if errors.As(err, &e) {
+			cause = e.Err
+		}
+		logging.FromContext(r.Context()).Error("Request failed", "status", p.Status, "code", p.Code, "detail", p.Detail, "err", cause)
+	}
+	body, marshalErr := json.Marshal(p)
+	if marshalErr != nil {
+		p = ProblemFor(r, Internal("Internal server error", marshalErr))
+		body, _ = json.Marshal(p)
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(p.Status)
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,202 @@
+package apierror
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/F0RG-2142/capstone-1/internal/logging"
+	"github.com/lib/pq"
+)
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		status     int
+		detail     string
+		wantStatus int
+		wantCode   string
+		wantDetail string
+	}{
+		{
+			name:       "No Rows Keeps 404 Detail",
+			err:        sql.ErrNoRows,
+			status:     http.StatusNotFound,
+			detail:     "Note not found",
+			wantStatus: http.StatusNotFound,
+			wantCode:   CodeNotFound,
+			wantDetail: "Note not found",
+		},
+		{
+			name:       "No Rows Overrides Status",
+			err:        fmt.Errorf("get team: %w", sql.ErrNoRows),
+			status:     http.StatusFailedDependency,
+			detail:     "Could not get team",
+			wantStatus: http.StatusNotFound,
+			wantCode:   CodeNotFound,
+			wantDetail: "Resource not found",
+		},
+		{
+			name:       "Unique Violation",
+			err:        &pq.Error{Code: pqUniqueViolation, Message: `duplicate key value violates unique constraint "team_members_pkey"`},
+			status:     http.StatusBadRequest,
+			wantStatus: http.StatusConflict,
+			wantCode:   CodeAlreadyExists,
+			wantDetail: "Resource already exists",
+		},
+		{
+			name:       "Foreign Key Violation",
+			err:        &pq.Error{Code: pqForeignKeyViolation},
+			status:     http.StatusBadRequest,
+			wantStatus: http.StatusConflict,
+			wantCode:   CodeConflict,
+		},
+		{
+			name:       "Check Violation",
+			err:        &pq.Error{Code: pqCheckViolation},
+			status:     http.StatusBadRequest,
+			wantStatus: http.StatusConflict,
+			wantCode:   CodeConflict,
+			wantDetail: "Value is not allowed",
+		},
+		{
+			name:       "Other Database Error",
+			err:        &pq.Error{Code: "08006", Message: "connection failure"},
+			status:     http.StatusFailedDependency,
+			detail:     "Could not get notes",
+			wantStatus: http.StatusFailedDependency,
+			wantCode:   CodeDependencyFailed,
+			wantDetail: "Could not get notes",
+		},
+		{
+			name:       "Already An Error",
+			err:        Forbidden(CodeInsufficientScope, "Missing scope"),
+			status:     http.StatusInternalServerError,
+			wantStatus: http.StatusForbidden,
+			wantCode:   CodeInsufficientScope,
+			wantDetail: "Missing scope",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := Wrap(tt.err, tt.status, tt.detail)
+			if e.Status != tt.wantStatus || e.Code != tt.wantCode {
+				t.Errorf("expected %d %q, got %d %q", tt.wantStatus, tt.wantCode, e.Status, e.Code)
+			}
+			if tt.wantDetail != "" && e.Detail != tt.wantDetail {
+				t.Errorf("expected detail %q, got %q", tt.wantDetail, e.Detail)
+			}
+			if !errors.Is(e, tt.err) {
+				t.Error("expected the cause to be kept")
+			}
+		})
+	}
+}
+
+func TestInvalidBody(t *testing.T) {
+	if e := InvalidBody(errors.New("unexpected EOF")); e.Status != http.StatusBadRequest || e.Code != CodeInvalidBody {
+		t.Errorf("expected 400 %q, got %d %q", CodeInvalidBody, e.Status, e.Code)
+	}
+	e := InvalidBody(&http.MaxBytesError{Limit: 1024})
+	if e.Status != http.StatusRequestEntityTooLarge || e.Code != CodeBodyTooLarge || e.Extensions["max_bytes"] != int64(1024) {
+		t.Errorf("expected 413 with the limit, got %+v", e)
+	}
+}
+
+func TestProblemMarshalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		p    Problem
+		want string
+	}{
+		{
+			name: "Without Extensions",
+			p:    Problem{Type: TypePrefix + CodeNotFound, Title: "Not Found", Status: 404, Code: CodeNotFound},
+			want: `{"type":"urn:znotes:problem:not_found","title":"Not Found","status":404,"code":"not_found"}`,
+		},
+		{
+			name: "Extensions Sorted",
+			p: Problem{Type: TypePrefix + CodePlanLimitReached, Title: "Payment Required", Status: 402, Code: CodePlanLimitReached,
+				Extensions: map[string]any{"max": 100, "limit": "max_notes"}},
+			want: `{"type":"urn:znotes:problem:plan_limit_reached","title":"Payment Required","status":402,"code":"plan_limit_reached","limit":"max_notes","max":100}`,
+		},
+		{
+			name: "Reserved Keys Skipped",
+			p: Problem{Type: TypePrefix + CodeForbidden, Title: "Forbidden", Status: 403, Code: CodeForbidden,
+				Extensions: map[string]any{"status": 200, "code": "ok"}},
+			want: `{"type":"urn:znotes:problem:forbidden","title":"Forbidden","status":403,"code":"forbidden"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(tt.p)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+		// cause that has to be in the log, client errors log nothing
+		wantLogged string
+	}{
+		{name: "API Error", err: Wrap(sql.ErrNoRows, http.StatusNotFound, "Note not found"), wantStatus: http.StatusNotFound, wantCode: CodeNotFound},
+		{name: "Validation", err: Validation(FieldError{Field: "email", Code: "format", Message: "must be an email"}), wantStatus: http.StatusUnprocessableEntity, wantCode: CodeValidationFailed},
+		{name: "Plain Error", err: errors.New(`pq: password authentication failed for user "admin"`), wantStatus: http.StatusInternalServerError, wantCode: CodeInternal, wantLogged: "pq: password authentication failed"},
+		{name: "Internal Error", err: Internal("Failed to create response", errors.New("pq: connection refused")), wantStatus: http.StatusInternalServerError, wantCode: CodeInternal, wantLogged: "pq: connection refused"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/notes/1", nil)
+			req = req.WithContext(logging.ContextWithRequestID(req.Context(), "req-1"))
+			var logged bytes.Buffer
+			req = req.WithContext(logging.ContextWithLogger(req.Context(), slog.New(slog.NewJSONHandler(&logged, nil))))
+			rec := httptest.NewRecorder()
+			rec.Header().Set("Retry-After", "5")
+			Write(rec, req, tt.err)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+				t.Errorf("expected content type %q, got %q", ContentType, ct)
+			}
+			if rec.Header().Get("Retry-After") != "5" {
+				t.Error("expected headers set before Write to be kept")
+			}
+			if strings.Contains(rec.Body.String(), "pq:") {
+				t.Errorf("expected the cause to stay out of the body, got %s", rec.Body.String())
+			}
+			var p Problem
+			if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+				t.Fatalf("failed to decode body: %v", err)
+			}
+			if p.Code != tt.wantCode || p.Status != tt.wantStatus || p.RequestID != "req-1" || p.Instance != "/api/v1/notes/1" {
+				t.Errorf("unexpected problem %+v", p)
+			}
+			if tt.wantLogged == "" && logged.Len() > 0 || !strings.Contains(logged.String(), tt.wantLogged) {
+				t.Errorf("expected %q logged, got %q", tt.wantLogged, logged.String())
+			}
+		})
+	}
+}
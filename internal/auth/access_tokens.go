@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Personal access tokens start with this prefix so secret scanners can recognise leaked tokens
+const AccessTokenPrefix = "znpat_"
+
+// Scopes a personal access token can be granted. Sessions (JWTs) implicitly have every scope
+const (
+	ScopeNotesRead  = "notes:read"
+	ScopeNotesWrite = "notes:write"
+	ScopeTeamsRead  = "teams:read"
+	ScopeTeamsWrite = "teams:write"
+	ScopeTeamsAdmin = "teams:admin"
+)
+
+var AllScopes = []string{ScopeNotesRead, ScopeNotesWrite, ScopeTeamsRead, ScopeTeamsWrite, ScopeTeamsAdmin}
+
+// Number of characters (after the prefix) kept in plain text so users can tell their tokens apart
+const accessTokenHintLength = 6
+
+// Creates a new personal access token. Only the hash is stored, the token itself is shown to the user once
+func MakeAccessToken() (string, error) {
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return AccessTokenPrefix + hex.EncodeToString(randomBytes), nil
+}
+
+// Tokens have 256 bits of entropy so a fast hash is enough (and lets us look tokens up by hash)
+func HashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, AccessTokenPrefix)
+}
+
+// Non secret part of the token for display, e.g. "znpat_1a2b3c"
+func AccessTokenHint(token string) string {
+	if len(token) < len(AccessTokenPrefix)+accessTokenHintLength {
+		return token
+	}
+	return token[:len(AccessTokenPrefix)+accessTokenHintLength]
+}
+
+// Checks that every requested scope exists and removes duplicates
+func ValidateScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	var valid []string
+	for _, scope := range scopes {
+		if !slices.Contains(AllScopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q", scope)
+		}
+		if !slices.Contains(valid, scope) {
+			valid = append(valid, scope)
+		}
+	}
+	return valid, nil
+}
+
+// teams:admin implies teams:write, and write scopes imply their read scope
+func HasScope(granted []string, required string) bool {
+	for _, scope := range granted {
+		switch {
+		case scope == required:
+			return true
+		case scope == ScopeNotesWrite && required == ScopeNotesRead:
+			return true
+		case scope == ScopeTeamsWrite && required == ScopeTeamsRead:
+			return true
+		case scope == ScopeTeamsAdmin && (required == ScopeTeamsWrite || required == ScopeTeamsRead):
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMakeAccessToken(t *testing.T) {
+	token, err := MakeAccessToken()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !IsAccessToken(token) {
+		t.Errorf("expected token to start with %q, got %q", AccessTokenPrefix, token)
+	}
+	other, err := MakeAccessToken()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token == other {
+		t.Error("expected two different tokens")
+	}
+	hash := HashAccessToken(token)
+	if hash == token || strings.Contains(hash, token) {
+		t.Error("expected hash to not contain the token")
+	}
+	if HashAccessToken(token) != hash {
+		t.Error("expected hashing to be deterministic")
+	}
+	if hint := AccessTokenHint(token); !strings.HasPrefix(token, hint) || len(hint) >= len(token) {
+		t.Errorf("unexpected hint %q for token %q", hint, token)
+	}
+}
+
+func TestValidateScopes(t *testing.T) {
+	tests := []struct {
+		name        string
+		scopes      []string
+		expected    int
+		expectError bool
+	}{
+		{
+			name:        "Valid Scopes",
+			scopes:      []string{ScopeNotesRead, ScopeTeamsAdmin},
+			expected:    2,
+			expectError: false,
+		},
+		{
+			name:        "Duplicate Scopes",
+			scopes:      []string{ScopeNotesRead, ScopeNotesRead},
+			expected:    1,
+			expectError: false,
+		},
+		{
+			name:        "Unknown Scope",
+			scopes:      []string{ScopeNotesRead, "admin:everything"},
+			expectError: true,
+		},
+		{
+			name:        "No Scopes",
+			scopes:      nil,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scopes, err := ValidateScopes(tt.scopes)
+			if tt.expectError && err == nil {
+				t.Error("expected error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tt.expectError && len(scopes) != tt.expected {
+				t.Errorf("expected %d scopes, got %v", tt.expected, scopes)
+			}
+		})
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	tests := []struct {
+		name     string
+		granted  []string
+		required string
+		expected bool
+	}{
+		{name: "Exact Scope", granted: []string{ScopeNotesRead}, required: ScopeNotesRead, expected: true},
+		{name: "Write Implies Read", granted: []string{ScopeNotesWrite}, required: ScopeNotesRead, expected: true},
+		{name: "Read Does Not Imply Write", granted: []string{ScopeNotesRead}, required: ScopeNotesWrite, expected: false},
+		{name: "Admin Implies Team Write", granted: []string{ScopeTeamsAdmin}, required: ScopeTeamsWrite, expected: true},
+		{name: "Team Scope Does Not Grant Notes", granted: []string{ScopeTeamsAdmin}, required: ScopeNotesRead, expected: false},
+		{name: "No Scopes", granted: nil, required: ScopeNotesRead, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasScope(tt.granted, tt.required); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
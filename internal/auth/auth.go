@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
@@ -8,8 +9,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/F0RG-2142/capstone-1/internal/tracing"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -22,7 +25,10 @@ func GetAPIKey(headers http.Header) (string, error) {
 	return apiKey, nil
 }
 
-func HashPassword(password string) (string, error) {
+// bcrypt is deliberately slow, so hashing and checking get their own spans
+func HashPassword(ctx context.Context, password string) (string, error) {
+	_, span := tracing.Start(ctx, "bcrypt.GenerateFromPassword", attribute.Int("bcrypt.cost", bcrypt.DefaultCost))
+	defer span.End()
 	hashPass, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return "", err
@@ -30,35 +36,99 @@ func HashPassword(password string) (string, error) {
 	return string(hashPass), nil
 }
 
-func CheckPasswordHash(hash, password string) error {
+func CheckPasswordHash(ctx context.Context, hash, password string) error {
+	_, span := tracing.Start(ctx, "bcrypt.CompareHashAndPassword")
+	defer span.End()
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	if tokenSecret == "" {
-		return "", fmt.Errorf("no secret entered")
+// Issuer and audience put in (and required of) every token unless a TokenIssuer overrides them
+const (
+	DefaultIssuer   = "znotes"
+	DefaultAudience = "znotes"
+)
+
+// Creates and validates access tokens. With Keys set tokens are signed with the active asymmetric key
+// and carry its kid, otherwise they are signed HS256 with Secret
+type TokenIssuer struct {
+	Secret   string
+	Keys     *KeySet
+	Issuer   string
+	Audience string
+}
+
+func (ti *TokenIssuer) issuer() string {
+	if ti.Issuer == "" {
+		return DefaultIssuer
 	}
-	if len(tokenSecret) < 32 {
-		return "", fmt.Errorf("enter a secure secret(minimum 32 bytes)")
+	return ti.Issuer
+}
+
+func (ti *TokenIssuer) audience() string {
+	if ti.Audience == "" {
+		return DefaultAudience
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    "yappy",
+	return ti.Audience
+}
+
+func (ti *TokenIssuer) MakeJWT(userID uuid.UUID, expiresIn time.Duration) (string, error) {
+	claims := jwt.RegisteredClaims{
+		Issuer:    ti.issuer(),
+		Audience:  jwt.ClaimStrings{ti.audience()},
 		IssuedAt:  jwt.NewNumericDate(time.Now()),
 		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
 		Subject:   userID.String(),
-	})
-	wt, err := token.SignedString([]byte(tokenSecret))
+	}
+	if ti.Keys != nil {
+		key := ti.Keys.Active()
+		if key == nil {
+			return "", fmt.Errorf("no signing key available")
+		}
+		token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+		token.Header["kid"] = key.ID
+		return token.SignedString(key.Private)
+	}
+	if ti.Secret == "" {
+		return "", fmt.Errorf("no secret entered")
+	}
+	if len(ti.Secret) < 32 {
+		return "", fmt.Errorf("enter a secure secret(minimum 32 bytes)")
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	wt, err := token.SignedString([]byte(ti.Secret))
 	if err != nil {
 		return "", err
 	}
 	return wt, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	parsedToken, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (any, error) {
-		return []byte(tokenSecret), nil
-	})
+// Only accepts the algorithms we sign with (no "none" or HS256/RS256 confusion) and checks issuer and audience
+func (ti *TokenIssuer) ValidateJWT(tokenString string) (uuid.UUID, error) {
+	methods := []string{jwt.SigningMethodHS256.Alg()}
+	keyFunc := func(token *jwt.Token) (any, error) {
+		return []byte(ti.Secret), nil
+	}
+	if ti.Keys != nil {
+		methods = ti.Keys.Algorithms()
+		keyFunc = func(token *jwt.Token) (any, error) {
+			kid, _ := token.Header["kid"].(string)
+			key, err := ti.Keys.Lookup(kid)
+			if err != nil {
+				return nil, err
+			}
+			if token.Method.Alg() != key.Algorithm {
+				return nil, fmt.Errorf("token algorithm %s does not match key %s", token.Method.Alg(), kid)
+			}
+			return key.Public, nil
+		}
+	}
+	parsedToken, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, keyFunc,
+		jwt.WithValidMethods(methods),
+		jwt.WithIssuer(ti.issuer()),
+		jwt.WithAudience(ti.audience()),
+		jwt.WithExpirationRequired(),
+	)
 	if err != nil {
 		return uuid.Nil, err
 	}
@@ -76,6 +146,23 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 	return userID, nil
 }
 
+func (ti *TokenIssuer) GetAndValidateToken(headers http.Header) (uuid.UUID, error) {
+	token, err := GetBearerToken(headers)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return ti.ValidateJWT(token)
+}
+
+// HS256 token signed with tokenSecret
+func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return (&TokenIssuer{Secret: tokenSecret}).MakeJWT(userID, expiresIn)
+}
+
+func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+	return (&TokenIssuer{Secret: tokenSecret}).ValidateJWT(tokenString)
+}
+
 func GetBearerToken(headers http.Header) (string, error) {
 	authHeader := headers.Get("Authorization")
 	if authHeader == "" {
@@ -96,13 +183,5 @@ func MakeRefreshToken() (string, error) {
 }
 
 func GetAndValidateToken(headers http.Header, tokenSecret string) (uuid.UUID, error) {
-	token, err := GetBearerToken(headers)
-	if err != nil {
-		return uuid.Nil, err
-	}
-	userId, err := ValidateJWT(token, tokenSecret)
-	if err != nil {
-		return uuid.Nil, err
-	}
-	return userId, nil
+	return (&TokenIssuer{Secret: tokenSecret}).GetAndValidateToken(headers)
 }
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"net/http"
 	"testing"
 	"time"
@@ -33,7 +34,7 @@ func TestHashPassword(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			hash, err := HashPassword(tt.password)
+			hash, err := HashPassword(context.Background(), tt.password)
 			if tt.expectError && err == nil {
 				t.Error("expected error, got nil")
 			}
@@ -89,7 +90,7 @@ func TestCheckPasswordHash(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := CheckPasswordHash(tt.hash, tt.password)
+			err := CheckPasswordHash(context.Background(), tt.hash, tt.password)
 			if tt.expectError && err == nil {
 				t.Error("expected error, got nil")
 			}
@@ -0,0 +1,365 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Algorithms keys can be generated for
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// A key loaded from the key directory. Keys without a private part can only verify tokens
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+	Public    crypto.PublicKey
+	Created   time.Time
+	// Named by generate, with Created in the id. Only these are deleted by Rotate, keys placed by
+	// operators are dated by their file's mtime
+	Generated bool
+}
+
+// How long a new key is only published in the JWKS before it signs tokens. Services that cached
+// the JWKS (it's served with max-age=300) have fetched it again by then and know the key
+const KeyPublishDelay = 10 * time.Minute
+
+// Set of keys loaded from a directory of PEM files, one key per file with the file name (without
+// extension) as key id. The newest private key older than the publish delay signs new tokens,
+// every key can verify tokens
+type KeySet struct {
+	dir       string
+	algorithm string
+
+	mu     sync.RWMutex
+	keys   map[string]*SigningKey
+	active *SigningKey
+	// Newest private key, still waiting out the publish delay when it isn't active
+	newest *SigningKey
+
+	// Clock for key ages and the publish delay, replaced in tests
+	now          func() time.Time
+	publishDelay time.Duration
+}
+
+// Loads all keys in dir, generating a first key with the given algorithm if there are none
+func LoadKeySet(dir, algorithm string) (*KeySet, error) {
+	if algorithm == "" {
+		algorithm = AlgRS256
+	}
+	if algorithm != AlgRS256 && algorithm != AlgEdDSA {
+		return nil, fmt.Errorf("unsupported signing algorithm %q (use %s or %s)", algorithm, AlgRS256, AlgEdDSA)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	ks := &KeySet{dir: dir, algorithm: algorithm, now: time.Now, publishDelay: KeyPublishDelay}
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+	if ks.Active() == nil {
+		if _, err := ks.generate(); err != nil {
+			return nil, err
+		}
+		if err := ks.Reload(); err != nil {
+			return nil, err
+		}
+	}
+	return ks, nil
+}
+
+// Re-reads the key directory, picking up keys added or removed by other instances or operators.
+// A key becomes active once it has been published for the publish delay, unless no key has been
+func (ks *KeySet) Reload() error {
+	files, err := filepath.Glob(filepath.Join(ks.dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	keys := map[string]*SigningKey{}
+	var active, newest *SigningKey
+	published := ks.now().Add(-ks.publishDelay)
+	for _, file := range files {
+		key, err := loadKeyFile(file)
+		if err != nil {
+			return fmt.Errorf("loading key %s: %w", file, err)
+		}
+		keys[key.ID] = key
+		if key.Private == nil {
+			continue
+		}
+		if newer(key, newest) {
+			newest = key
+		}
+		if !key.Created.After(published) && newer(key, active) {
+			active = key
+		}
+	}
+	//a fresh key directory has nothing published yet, signing can't wait for it
+	if active == nil {
+		active = newest
+	}
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.active = active
+	ks.newest = newest
+	ks.mu.Unlock()
+	return nil
+}
+
+func newer(key, than *SigningKey) bool {
+	return than == nil || key.Created.After(than.Created) || (key.Created.Equal(than.Created) && key.ID > than.ID)
+}
+
+// Key currently used to sign new tokens
+func (ks *KeySet) Active() *SigningKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.active
+}
+
+// Key used to verify a token with the given key id
+func (ks *KeySet) Lookup(kid string) (*SigningKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// Algorithms of all loaded keys, used to pin what ValidateJWT accepts
+func (ks *KeySet) Algorithms() []string {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	var algs []string
+	seen := map[string]bool{}
+	for _, key := range ks.keys {
+		if !seen[key.Algorithm] {
+			seen[key.Algorithm] = true
+			algs = append(algs, key.Algorithm)
+		}
+	}
+	return algs
+}
+
+// Generates a new signing key once the newest one is older than maxAge, and deletes generated keys
+// that are older than maxAge+retain plus the publish delay they kept signing for (by then every
+// token they signed has expired)
+func (ks *KeySet) Rotate(maxAge, retain time.Duration) error {
+	//another instance sharing the directory may already have rotated
+	if err := ks.Reload(); err != nil {
+		return err
+	}
+	ks.mu.RLock()
+	newest := ks.newest
+	ks.mu.RUnlock()
+	if newest == nil || ks.now().Sub(newest.Created) >= maxAge {
+		id, err := ks.generate()
+		if err != nil {
+			return err
+		}
+		slog.Info("Rotated JWT signing key", "key_id", id)
+	}
+	if err := ks.Reload(); err != nil {
+		return err
+	}
+	ks.mu.RLock()
+	var expired []string
+	for id, key := range ks.keys {
+		if key.Generated && key != ks.active && ks.now().Sub(key.Created) > maxAge+ks.publishDelay+retain {
+			expired = append(expired, id)
+		}
+	}
+	ks.mu.RUnlock()
+	for _, id := range expired {
+		if err := os.Remove(filepath.Join(ks.dir, id+".pem")); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		slog.Info("Removed retired JWT signing key", "key_id", id)
+	}
+	if len(expired) > 0 {
+		return ks.Reload()
+	}
+	return nil
+}
+
+// Periodically reloads the key directory and, if rotateEvery is set, rotates keys.
+// Blocks until ctx is cancelled
+func (ks *KeySet) Watch(ctx context.Context, interval, rotateEvery, retain time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var err error
+			if rotateEvery > 0 {
+				err = ks.Rotate(rotateEvery, retain)
+			} else {
+				err = ks.Reload()
+			}
+			if err != nil {
+				slog.ErrorContext(ctx, "Error refreshing JWT signing keys", "err", err)
+			}
+		}
+	}
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// Public keys as a JSON Web Key Set, for other services to verify our tokens
+func (ks *KeySet) JWKS() ([]byte, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	set := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{Keys: []jsonWebKey{}}
+	for _, key := range ks.keys {
+		jwk := jsonWebKey{Kid: key.ID, Use: "sig", Alg: key.Algorithm}
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return json.Marshal(set)
+}
+
+// Layout of the time at the start of generated key ids
+const keyIDTime = "20060102T150405Z"
+
+// Writes a new private key named after the current time so key ids sort by age
+func (ks *KeySet) generate() (string, error) {
+	var private crypto.Signer
+	var err error
+	switch ks.algorithm {
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return "", err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	id := ks.now().UTC().Format(keyIDTime) + "-" + hex.EncodeToString(suffix)
+	//write to a temporary name first so other instances never load a half written key
+	path := filepath.Join(ks.dir, id+".pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path+".tmp", data, 0o600); err != nil {
+		return "", err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func loadKeyFile(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	key := &SigningKey{ID: strings.TrimSuffix(filepath.Base(path), ".pem")}
+	//copying a key directory doesn't keep mtimes, the id of a generated key does
+	key.Created, key.Generated = generatedAt(key.ID)
+	if !key.Generated {
+		key.Created = info.ModTime()
+	}
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Algorithm, key.Private, key.Public = AlgRS256, k, &k.PublicKey
+	case ed25519.PrivateKey:
+		key.Algorithm, key.Private, key.Public = AlgEdDSA, k, k.Public()
+	case *rsa.PublicKey:
+		key.Algorithm, key.Public = AlgRS256, k
+	case ed25519.PublicKey:
+		key.Algorithm, key.Public = AlgEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+	return key, nil
+}
+
+// Creation time of a key id written by generate, false for any other id
+func generatedAt(id string) (time.Time, bool) {
+	stamp, suffix, ok := strings.Cut(id, "-")
+	if !ok || len(suffix) != 8 {
+		return time.Time{}, false
+	}
+	if _, err := hex.DecodeString(suffix); err != nil {
+		return time.Time{}, false
+	}
+	created, err := time.Parse(keyIDTime, stamp)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return created, true
+}
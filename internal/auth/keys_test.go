@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestKeySetSignAndValidate(t *testing.T) {
+	userID := uuid.MustParse("123e4567-e89b-12d3-a456-426614174000")
+	for _, alg := range []string{AlgRS256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			keys, err := LoadKeySet(t.TempDir(), alg)
+			if err != nil {
+				t.Fatalf("failed to load key set: %v", err)
+			}
+			issuer := &TokenIssuer{Keys: keys}
+			token, err := issuer.MakeJWT(userID, time.Hour)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			parsedUserID, err := issuer.ValidateJWT(token)
+			if err != nil {
+				t.Fatalf("token validation failed: %v", err)
+			}
+			if parsedUserID != userID {
+				t.Errorf("expected userID %v, got %v", userID, parsedUserID)
+			}
+
+			otherAudience := &TokenIssuer{Keys: keys, Audience: "another-service"}
+			if _, err := otherAudience.ValidateJWT(token); err == nil {
+				t.Error("expected error for wrong audience, got nil")
+			}
+			otherIssuer := &TokenIssuer{Keys: keys, Issuer: "someone-else"}
+			if _, err := otherIssuer.ValidateJWT(token); err == nil {
+				t.Error("expected error for wrong issuer, got nil")
+			}
+		})
+	}
+}
+
+func TestKeySetRejectsSymmetricTokens(t *testing.T) {
+	userID := uuid.MustParse("123e4567-e89b-12d3-a456-426614174000")
+	secret := "test-secret-12345678901234567890123456789012"
+	keys, err := LoadKeySet(t.TempDir(), AlgRS256)
+	if err != nil {
+		t.Fatalf("failed to load key set: %v", err)
+	}
+	hsToken, err := MakeJWT(userID, secret, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to make token: %v", err)
+	}
+	issuer := &TokenIssuer{Secret: secret, Keys: keys}
+	if _, err := issuer.ValidateJWT(hsToken); err == nil {
+		t.Error("expected HS256 token to be rejected when asymmetric keys are configured")
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	userID := uuid.MustParse("123e4567-e89b-12d3-a456-426614174000")
+	dir := t.TempDir()
+	keys, err := LoadKeySet(dir, AlgEdDSA)
+	if err != nil {
+		t.Fatalf("failed to load key set: %v", err)
+	}
+	issuer := &TokenIssuer{Keys: keys}
+	oldKey := keys.Active()
+	oldToken, err := issuer.MakeJWT(userID, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	//an operator's public key, whatever its mtime, is never removed
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	operatorKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, "partner.pem"), operatorKey, 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	aged := time.Now().Add(-96 * time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "partner.pem"), aged, aged); err != nil {
+		t.Fatalf("failed to age key: %v", err)
+	}
+
+	//the age of a generated key comes from its id, not the file
+	if err := os.Chtimes(filepath.Join(dir, oldKey.ID+".pem"), aged, aged); err != nil {
+		t.Fatalf("failed to age key: %v", err)
+	}
+	if err := keys.Rotate(24*time.Hour, 48*time.Hour); err != nil {
+		t.Fatalf("unexpected rotation error: %v", err)
+	}
+	if keys.Active().ID != oldKey.ID {
+		t.Fatal("expected the key to stay active")
+	}
+
+	//move past the rotation period, the new key is only published at first
+	keys.now = func() time.Time { return time.Now().Add(48 * time.Hour) }
+	for range 2 {
+		if err := keys.Rotate(24*time.Hour, 48*time.Hour); err != nil {
+			t.Fatalf("unexpected rotation error: %v", err)
+		}
+	}
+	if keys.Active().ID != oldKey.ID {
+		t.Fatal("expected the old key to keep signing until the new one has been published")
+	}
+	keys.now = func() time.Time { return time.Now().Add(48*time.Hour + KeyPublishDelay) }
+	if err := keys.Reload(); err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+	if keys.Active().ID == oldKey.ID {
+		t.Fatal("expected a new active key after the publish delay")
+	}
+	if _, err := issuer.ValidateJWT(oldToken); err != nil {
+		t.Errorf("expected token signed by retired key to still validate: %v", err)
+	}
+	jwks, err := keys.JWKS()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(jwks, &set); err != nil {
+		t.Fatalf("invalid jwks: %v", err)
+	}
+	if len(set.Keys) != 3 {
+		t.Errorf("expected 3 keys in jwks, got %d", len(set.Keys))
+	}
+
+	//past the retention window the old key is removed
+	keys.now = func() time.Time { return time.Now().Add(96 * time.Hour) }
+	if err := keys.Rotate(24*time.Hour, 48*time.Hour); err != nil {
+		t.Fatalf("unexpected rotation error: %v", err)
+	}
+	if _, err := issuer.ValidateJWT(oldToken); err == nil {
+		t.Error("expected token signed by removed key to be rejected")
+	}
+	if _, err := keys.Lookup("partner"); err != nil {
+		t.Errorf("expected the operator's key to be kept: %v", err)
+	}
+}
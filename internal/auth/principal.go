@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// The authenticated caller of a request, put in the request context by the auth middleware
+type Principal struct {
+	UserID     uuid.UUID
+	HasPremium bool
+	// Scopes the credential grants. Sessions (JWTs) have every scope
+	Scopes []string
+	// Personal access token used, uuid.Nil for sessions
+	TokenID uuid.UUID
+}
+
+// Whether the caller logged in (JWT) rather than using a personal access token
+func (p Principal) IsSession() bool {
+	return p.TokenID == uuid.Nil
+}
+
+func (p Principal) HasScope(scope string) bool {
+	return HasScope(p.Scopes, scope)
+}
+
+type principalKey struct{}
+
+func ContextWithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// Principal for a logged in session
+func SessionPrincipal(userID uuid.UUID, hasPremium bool) Principal {
+	return Principal{UserID: userID, HasPremium: hasPremium, Scopes: slices.Clone(AllScopes)}
+}
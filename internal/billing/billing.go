@@ -0,0 +1,122 @@
+package billing
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/F0RG-2142/capstone-1/internal/database"
+)
+
+// Plans a subscription can be on
+const (
+	PlanFree    = "free"
+	PlanPremium = "premium"
+)
+
+// Subscription statuses, see the subscriptions table
+const (
+	StatusTrialing = "trialing"
+	StatusActive   = "active"
+	StatusPastDue  = "past_due"
+	StatusCanceled = "canceled"
+)
+
+// How long premium is kept after a failed payment, or after the period ended without a renewal,
+// before the subscription is canceled
+const GracePeriod = 7 * 24 * time.Hour
+
+// Period assumed when an event doesn't say when the paid period ends
+const DefaultPeriod = 30 * 24 * time.Hour
+
+// Plan of team subscriptions, paid per seat
+const PlanTeam = "team"
+
+// Whether the subscription currently gives its user premium
+func GrantsPremium(sub database.Subscription, now time.Time) bool {
+	return grants(sub.Status, sub.GracePeriodEnd, now)
+}
+
+// Whether the team subscription currently gives the team's members premium inside the team
+func TeamGrantsPremium(sub database.TeamSubscription, now time.Time) bool {
+	return grants(sub.Status, sub.GracePeriodEnd, now)
+}
+
+func grants(status string, graceEnd sql.NullTime, now time.Time) bool {
+	switch status {
+	case StatusTrialing, StatusActive:
+		return true
+	case StatusPastDue:
+		return graceEnd.Valid && graceEnd.Time.After(now)
+	default:
+		return false
+	}
+}
+
+// End of the grace period for a payment that failed at now, for a period ending at periodEnd
+func GraceEnd(periodEnd, now time.Time) time.Time {
+	return later(now, periodEnd).Add(GracePeriod)
+}
+
+// Keeps users' premium flag in line with their subscription
+func SyncPremium(ctx context.Context, db database.Querier, sub database.Subscription, now time.Time) error {
+	return db.SetPremium(ctx, database.SetPremiumParams{
+		ID:              sub.UserID,
+		HasNotesPremium: GrantsPremium(sub, now),
+	})
+}
+
+// Cancels user and team subscriptions that were set to cancel at period end, ran out of grace
+// after a failed payment, or were never renewed, and takes premium away from their users
+func ExpireLapsed(ctx context.Context, db database.Querier, now time.Time) (int, error) {
+	expired, err := db.ExpireLapsedSubscriptions(ctx, database.ExpireLapsedSubscriptionsParams{
+		Now:          now,
+		LapsedBefore: now.Add(-GracePeriod),
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, sub := range expired {
+		if err := SyncPremium(ctx, db, sub, now); err != nil {
+			slog.ErrorContext(ctx, "Error removing premium", "user_id", sub.UserID, "err", err)
+			continue
+		}
+		slog.InfoContext(ctx, "Subscription lapsed and was canceled", "user_id", sub.UserID)
+	}
+	//team premium is looked up from the subscription itself, nothing to sync
+	expiredTeams, err := db.ExpireLapsedTeamSubscriptions(ctx, database.ExpireLapsedTeamSubscriptionsParams{
+		Now:          now,
+		LapsedBefore: now.Add(-GracePeriod),
+	})
+	if err != nil {
+		return len(expired), err
+	}
+	for _, sub := range expiredTeams {
+		slog.InfoContext(ctx, "Subscription lapsed and was canceled", "team_id", sub.TeamID)
+	}
+	return len(expired) + len(expiredTeams), nil
+}
+
+// Runs ExpireLapsed every interval at the time now gives. Blocks until ctx is cancelled
+func RunExpiry(ctx context.Context, db database.Querier, interval time.Duration, now func() time.Time) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := ExpireLapsed(ctx, db, now().UTC()); err != nil {
+				slog.ErrorContext(ctx, "Error expiring subscriptions", "err", err)
+			}
+		}
+	}
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,72 @@
+package billing
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/F0RG-2142/capstone-1/internal/database"
+)
+
+func TestGrantsPremium(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		sub      database.Subscription
+		expected bool
+	}{
+		{name: "Trialing", sub: database.Subscription{Status: StatusTrialing}, expected: true},
+		{name: "Active", sub: database.Subscription{Status: StatusActive}, expected: true},
+		{name: "Past Due In Grace", sub: database.Subscription{Status: StatusPastDue, GracePeriodEnd: sql.NullTime{Time: now.Add(time.Hour), Valid: true}}, expected: true},
+		{name: "Past Due After Grace", sub: database.Subscription{Status: StatusPastDue, GracePeriodEnd: sql.NullTime{Time: now.Add(-time.Hour), Valid: true}}, expected: false},
+		{name: "Past Due Without Grace", sub: database.Subscription{Status: StatusPastDue}, expected: false},
+		{name: "Canceled", sub: database.Subscription{Status: StatusCanceled}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GrantsPremium(tt.sub, now); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestGraceEnd(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	//a payment failing before the period ends keeps premium until the period end plus grace
+	if got := GraceEnd(now.Add(48*time.Hour), now); !got.Equal(now.Add(48*time.Hour + GracePeriod)) {
+		t.Errorf("unexpected grace end %v", got)
+	}
+	if got := GraceEnd(now.Add(-48*time.Hour), now); !got.Equal(now.Add(GracePeriod)) {
+		t.Errorf("unexpected grace end %v", got)
+	}
+}
+
+// Records the time expiry runs at and cancels the run after the first tick
+type expiryRecorder struct {
+	database.Querier
+	cancel context.CancelFunc
+	now    time.Time
+}
+
+func (e *expiryRecorder) ExpireLapsedSubscriptions(ctx context.Context, arg database.ExpireLapsedSubscriptionsParams) ([]database.Subscription, error) {
+	e.now = arg.Now
+	return nil, nil
+}
+
+func (e *expiryRecorder) ExpireLapsedTeamSubscriptions(ctx context.Context, arg database.ExpireLapsedTeamSubscriptionsParams) ([]database.TeamSubscription, error) {
+	e.cancel()
+	return nil, nil
+}
+
+func TestRunExpiry(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx, cancel := context.WithCancel(context.Background())
+	db := &expiryRecorder{cancel: cancel}
+	RunExpiry(ctx, db, time.Millisecond, func() time.Time { return now })
+	if !db.now.Equal(now) {
+		t.Errorf("expected expiry to run at the injected time %v, got %v", now, db.now)
+	}
+}
@@ -0,0 +1,181 @@
+package config
+
+import (
+	"time"
+
+	"github.com/F0RG-2142/capstone-1/internal/server"
+)
+
+// Every setting of the server. Load fills it from, in increasing priority: the defaults below, a
+// YAML or TOML file, environment variables and command line flags. Fields tagged secret may also be
+// read from a file named by <ENV>_FILE (e.g. JWT_SECRET_FILE=/run/secrets/jwt) and are redacted
+// when the config is printed
+type Config struct {
+	Platform    string `yaml:"platform" toml:"platform" env:"PLATFORM" usage:"deployment platform, \"dev\" logs unlock links"`
+	DatabaseURL string `yaml:"database_url" toml:"database_url" env:"DB_URL" secret:"true" usage:"Postgres connection string"`
+	LogLevel    string `yaml:"log_level" toml:"log_level" env:"LOG_LEVEL" usage:"debug, info, warn or error"`
+	AutoMigrate bool   `yaml:"auto_migrate" toml:"auto_migrate" env:"AUTO_MIGRATE" usage:"apply pending database migrations before starting"`
+	AdminToken  string `yaml:"admin_token" toml:"admin_token" env:"ADMIN_TOKEN" secret:"true" usage:"bearer token for the admin endpoints, admin endpoints are off without it"`
+	UnlockURL   string `yaml:"unlock_url" toml:"unlock_url" env:"UNLOCK_URL" usage:"link sent in account unlock emails"`
+	// Cookies are Secure unless this is set, behind a TLS terminating proxy the server can't tell
+	InsecureCookies bool `yaml:"insecure_cookies" toml:"insecure_cookies" env:"INSECURE_COOKIES" usage:"send cookies over plain HTTP too, for local development only"`
+	// Checks requests against the OpenAPI document, strict also logs responses that don't match it
+	ContractValidation string `yaml:"contract_validation" toml:"contract_validation" env:"CONTRACT_VALIDATION" usage:"off, requests or strict (requests and responses, for development)"`
+
+	HTTP      HTTP      `yaml:"http" toml:"http"`
+	TLS       TLS       `yaml:"tls" toml:"tls"`
+	CORS      CORS      `yaml:"cors" toml:"cors"`
+	JWT       JWT       `yaml:"jwt" toml:"jwt"`
+	Payments  Payments  `yaml:"payments" toml:"payments"`
+	Captcha   Captcha   `yaml:"captcha" toml:"captcha"`
+	SMTP      SMTP      `yaml:"smtp" toml:"smtp"`
+	RateLimit RateLimit `yaml:"rate_limit" toml:"rate_limit"`
+	Tracing   Tracing   `yaml:"tracing" toml:"tracing"`
+	// Identity providers by name. From the environment, OIDC_PROVIDERS lists the names and each
+	// provider reads OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET, _REDIRECT_URL and _SCOPES
+	OIDC map[string]OIDCProvider `yaml:"oidc" toml:"oidc"`
+}
+
+type HTTP struct {
+	Addr              string        `yaml:"addr" toml:"addr" env:"HTTP_ADDR" usage:"address to listen on"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout" env:"HTTP_READ_TIMEOUT" usage:"time to read a whole request"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT" usage:"time to read request headers"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout" env:"HTTP_WRITE_TIMEOUT" usage:"time to write a response"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT" usage:"how long idle keep-alive connections stay open"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" toml:"max_header_bytes" env:"HTTP_MAX_HEADER_BYTES" usage:"largest request headers accepted"`
+	MaxBodyBytes      int64         `yaml:"max_body_bytes" toml:"max_body_bytes" env:"HTTP_MAX_BODY_BYTES" usage:"largest request body accepted"`
+	ShutdownDelay     time.Duration `yaml:"shutdown_delay" toml:"shutdown_delay" env:"SHUTDOWN_DELAY" usage:"how long to keep serving after reporting not ready"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" usage:"deadline for requests and workers to finish on shutdown"`
+}
+
+// HTTPS is served when CertFile and KeyFile are set, otherwise plain HTTP
+type TLS struct {
+	CertFile       string        `yaml:"cert_file" toml:"cert_file" env:"TLS_CERT_FILE" usage:"PEM certificate chain, reloaded when it changes"`
+	KeyFile        string        `yaml:"key_file" toml:"key_file" env:"TLS_KEY_FILE" usage:"PEM private key of the certificate"`
+	ReloadInterval time.Duration `yaml:"reload_interval" toml:"reload_interval" env:"TLS_RELOAD_INTERVAL" usage:"how often to check the certificate files for changes"`
+	MinVersion     string        `yaml:"min_version" toml:"min_version" env:"TLS_MIN_VERSION" usage:"1.2 or 1.3"`
+	CipherSuites   []string      `yaml:"cipher_suites" toml:"cipher_suites" env:"TLS_CIPHER_SUITES" usage:"TLS 1.2 cipher suites, Go's secure defaults when empty"`
+	RedirectAddr   string        `yaml:"redirect_addr" toml:"redirect_addr" env:"TLS_REDIRECT_ADDR" usage:"plain HTTP address redirecting to HTTPS, e.g. :80"`
+	// Strict-Transport-Security, off when 0
+	HSTSMaxAge            time.Duration `yaml:"hsts_max_age" toml:"hsts_max_age" env:"HSTS_MAX_AGE" usage:"max-age of the Strict-Transport-Security header, 0 leaves it out"`
+	HSTSIncludeSubdomains bool          `yaml:"hsts_include_subdomains" toml:"hsts_include_subdomains" env:"HSTS_INCLUDE_SUBDOMAINS" usage:"apply HSTS to subdomains too"`
+	// Admin routes then also require a client certificate signed by one of these CAs
+	ClientCAFile string `yaml:"client_ca_file" toml:"client_ca_file" env:"TLS_CLIENT_CA_FILE" usage:"CA bundle admin client certificates must be signed by"`
+}
+
+// Whether HTTPS is served
+func (t TLS) Enabled() bool {
+	return t.CertFile != ""
+}
+
+// Origins are exact, with a wildcard subdomain (https://*.example.com) or port (http://localhost:*),
+// or "*" for any origin without credentials
+type CORS struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins" toml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS" usage:"origins browsers may call the API from, comma separated"`
+	AllowedMethods   []string      `yaml:"allowed_methods" toml:"allowed_methods" env:"CORS_ALLOWED_METHODS" usage:"methods allowed in cross-origin requests"`
+	AllowedHeaders   []string      `yaml:"allowed_headers" toml:"allowed_headers" env:"CORS_ALLOWED_HEADERS" usage:"request headers allowed in cross-origin requests"`
+	ExposedHeaders   []string      `yaml:"exposed_headers" toml:"exposed_headers" env:"CORS_EXPOSED_HEADERS" usage:"response headers scripts may read"`
+	MaxAge           time.Duration `yaml:"max_age" toml:"max_age" env:"CORS_MAX_AGE" usage:"how long browsers may cache preflight responses"`
+	AllowCredentials bool          `yaml:"allow_credentials" toml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS" usage:"let browsers send cookies and client certificates"`
+	// Overrides by path prefix (e.g. /api/v1/admin/), the longest matching prefix wins. Only settable
+	// in the config file
+	Routes map[string]CORSRoute `yaml:"routes" toml:"routes"`
+}
+
+// Unset fields keep the value of the top level cors settings
+type CORSRoute struct {
+	// Turns CORS off for the route, browsers then can't call it from other origins
+	Disabled         bool           `yaml:"disabled" toml:"disabled"`
+	AllowedOrigins   []string       `yaml:"allowed_origins" toml:"allowed_origins"`
+	AllowedMethods   []string       `yaml:"allowed_methods" toml:"allowed_methods"`
+	AllowedHeaders   []string       `yaml:"allowed_headers" toml:"allowed_headers"`
+	ExposedHeaders   []string       `yaml:"exposed_headers" toml:"exposed_headers"`
+	MaxAge           *time.Duration `yaml:"max_age" toml:"max_age"`
+	AllowCredentials *bool          `yaml:"allow_credentials" toml:"allow_credentials"`
+}
+
+// Tokens are signed with asymmetric keys from KeyDir when it is set, otherwise with Secret (HS256)
+type JWT struct {
+	Secret       string        `yaml:"secret" toml:"secret" env:"JWT_SECRET" secret:"true" usage:"HS256 signing secret, at least 32 bytes"`
+	Issuer       string        `yaml:"issuer" toml:"issuer" env:"JWT_ISSUER" usage:"iss claim of issued tokens"`
+	Audience     string        `yaml:"audience" toml:"audience" env:"JWT_AUDIENCE" usage:"aud claim of issued tokens"`
+	KeyDir       string        `yaml:"key_dir" toml:"key_dir" env:"JWT_KEY_DIR" usage:"directory of PEM signing keys, replaces the secret"`
+	KeyAlgorithm string        `yaml:"key_algorithm" toml:"key_algorithm" env:"JWT_KEY_ALGORITHM" usage:"RS256 or EdDSA, for generated keys"`
+	RotateEvery  time.Duration `yaml:"rotate_every" toml:"rotate_every" env:"JWT_KEY_ROTATE_EVERY" usage:"generate a new signing key this often, 0 disables rotation"`
+}
+
+type Payments struct {
+	WebhookSecret string `yaml:"webhook_secret" toml:"webhook_secret" env:"PP_WEBHOOK_SECRET" secret:"true" usage:"secret payment webhooks are signed with"`
+}
+
+// A CAPTCHA is only enforced when both are set
+type Captcha struct {
+	VerifyURL string `yaml:"verify_url" toml:"verify_url" env:"CAPTCHA_VERIFY_URL" usage:"siteverify endpoint of the CAPTCHA provider"`
+	Secret    string `yaml:"secret" toml:"secret" env:"CAPTCHA_SECRET" secret:"true" usage:"CAPTCHA provider secret"`
+}
+
+// Unlock emails go through Addr when it is set, otherwise they are only logged
+type SMTP struct {
+	Addr     string `yaml:"addr" toml:"addr" env:"SMTP_ADDR" usage:"SMTP server host:port"`
+	Username string `yaml:"username" toml:"username" env:"SMTP_USERNAME" usage:"SMTP user"`
+	Password string `yaml:"password" toml:"password" env:"SMTP_PASSWORD" secret:"true" usage:"SMTP password"`
+	From     string `yaml:"from" toml:"from" env:"SMTP_FROM" usage:"sender address of emails"`
+}
+
+// Limits are written like "60/m", empty keeps the default of the group
+type RateLimit struct {
+	Disabled     bool   `yaml:"disabled" toml:"disabled" env:"RATE_LIMIT_DISABLED" usage:"turn rate limiting off"`
+	Store        string `yaml:"store" toml:"store" env:"RATE_LIMIT_STORE" usage:"memory or postgres (shared between instances)"`
+	Auth         string `yaml:"auth" toml:"auth" env:"RATE_LIMIT_AUTH" usage:"limit of the auth group"`
+	AuthPremium  string `yaml:"auth_premium" toml:"auth_premium" env:"RATE_LIMIT_AUTH_PREMIUM" usage:"limit of the auth group for premium users"`
+	Read         string `yaml:"read" toml:"read" env:"RATE_LIMIT_READ" usage:"limit of the read group"`
+	ReadPremium  string `yaml:"read_premium" toml:"read_premium" env:"RATE_LIMIT_READ_PREMIUM" usage:"limit of the read group for premium users"`
+	Write        string `yaml:"write" toml:"write" env:"RATE_LIMIT_WRITE" usage:"limit of the write group"`
+	WritePremium string `yaml:"write_premium" toml:"write_premium" env:"RATE_LIMIT_WRITE_PREMIUM" usage:"limit of the write group for premium users"`
+}
+
+// Tracing is off without an endpoint
+type Tracing struct {
+	Endpoint    string  `yaml:"endpoint" toml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT" usage:"OTLP/HTTP collector, e.g. http://localhost:4318"`
+	Disabled    bool    `yaml:"disabled" toml:"disabled" env:"OTEL_SDK_DISABLED" usage:"turn tracing off even with an endpoint"`
+	ServiceName string  `yaml:"service_name" toml:"service_name" env:"OTEL_SERVICE_NAME" usage:"service name traces are reported under"`
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio" env:"OTEL_TRACES_SAMPLER_ARG" usage:"fraction of new traces to keep"`
+}
+
+type OIDCProvider struct {
+	IssuerURL    string   `yaml:"issuer" toml:"issuer" env:"ISSUER"`
+	ClientID     string   `yaml:"client_id" toml:"client_id" env:"CLIENT_ID"`
+	ClientSecret string   `yaml:"client_secret" toml:"client_secret" env:"CLIENT_SECRET" secret:"true"`
+	RedirectURL  string   `yaml:"redirect_url" toml:"redirect_url" env:"REDIRECT_URL"`
+	Scopes       []string `yaml:"scopes" toml:"scopes" env:"SCOPES"`
+}
+
+func Default() Config {
+	return Config{
+		LogLevel:           "info",
+		UnlockURL:          "http://localhost:8080/api/v1/login/unlock",
+		ContractValidation: "off",
+		HTTP: HTTP{
+			Addr:              server.DefaultConfig.Addr,
+			ReadTimeout:       server.DefaultConfig.ReadTimeout,
+			ReadHeaderTimeout: server.DefaultConfig.ReadHeaderTimeout,
+			WriteTimeout:      server.DefaultConfig.WriteTimeout,
+			IdleTimeout:       server.DefaultConfig.IdleTimeout,
+			MaxHeaderBytes:    server.DefaultConfig.MaxHeaderBytes,
+			MaxBodyBytes:      server.DefaultConfig.MaxBodyBytes,
+			ShutdownDelay:     server.DefaultConfig.ShutdownDelay,
+			ShutdownTimeout:   server.DefaultConfig.ShutdownTimeout,
+		},
+		TLS: TLS{ReloadInterval: time.Minute, MinVersion: "1.2"},
+		CORS: CORS{
+			AllowedOrigins:   []string{"http://localhost:*", "https://localhost:*"},
+			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE"},
+			AllowedHeaders:   []string{"Content-Type", "Authorization", "X-Request-ID", "traceparent", "tracestate"},
+			ExposedHeaders:   []string{"ETag", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After", "X-Request-ID"},
+			MaxAge:           10 * time.Minute,
+			AllowCredentials: true,
+		},
+		RateLimit: RateLimit{Store: "memory"},
+		Tracing:   Tracing{ServiceName: "znotes", SampleRatio: 1},
+	}
+}
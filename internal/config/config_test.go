@@ -0,0 +1,314 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadLayers(t *testing.T) {
+	file := writeFile(t, "config.yaml", `
+database_url: postgres://file
+log_level: warn
+http:
+  addr: ":9000"
+  read_timeout: 20s
+jwt:
+  secret: `+testSecret+`
+rate_limit:
+  write: 10/m
+`)
+	loaded, err := Load("test", []string{"-config", file, "-http.addr", ":9100", "-auto-migrate", "migrate", "up"}, env(map[string]string{
+		"DB_URL":              "postgres://env",
+		"HTTP_ADDR":           ":9050",
+		"HTTP_WRITE_TIMEOUT":  "45s",
+		"OTEL_SERVICE_NAME":   "notes-api",
+		"RATE_LIMIT_DISABLED": "true",
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := loaded.Config
+	tests := []struct {
+		name     string
+		got      any
+		expected any
+	}{
+		{name: "Default", got: cfg.HTTP.IdleTimeout, expected: 2 * time.Minute},
+		{name: "File Over Default", got: cfg.HTTP.ReadTimeout, expected: 20 * time.Second},
+		{name: "File Only", got: cfg.LogLevel, expected: "warn"},
+		{name: "Env Over File", got: cfg.DatabaseURL, expected: "postgres://env"},
+		{name: "Env Over Default", got: cfg.HTTP.WriteTimeout, expected: 45 * time.Second},
+		{name: "Env Bool", got: cfg.RateLimit.Disabled, expected: true},
+		{name: "Flag Over Env", got: cfg.HTTP.Addr, expected: ":9100"},
+		{name: "Bool Flag", got: cfg.AutoMigrate, expected: true},
+		{name: "Nested File Value", got: cfg.RateLimit.Write, expected: "10/m"},
+		{name: "Env Service Name", got: cfg.Tracing.ServiceName, expected: "notes-api"},
+		{name: "Remaining Args", got: strings.Join(loaded.Args, " "), expected: "migrate up"},
+		{name: "File", got: loaded.File, expected: file},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, tt.got)
+			}
+		})
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+	file := writeFile(t, "config.toml", `
+database_url = "postgres://toml"
+
+[jwt]
+secret = "`+testSecret+`"
+
+[oidc.corp]
+issuer = "https://sso.example.com"
+client_id = "znotes"
+redirect_url = "https://api.example.com/api/v1/auth/oidc/corp/callback"
+scopes = ["openid", "email"]
+`)
+	loaded, err := Load("test", nil, env(map[string]string{"CONFIG_FILE": file}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if loaded.Config.DatabaseURL != "postgres://toml" {
+		t.Errorf("expected database url from file, got %q", loaded.Config.DatabaseURL)
+	}
+	if corp := loaded.Config.OIDC["corp"]; len(corp.Scopes) != 2 || corp.ClientID != "znotes" {
+		t.Errorf("unexpected provider: %+v", corp)
+	}
+}
+
+func TestLoadUnknownFileKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{name: "YAML", file: "config.yaml", content: "http:\n  adr: \":9000\"\n"},
+		{name: "TOML", file: "config.toml", content: "[http]\nadr = \":9000\"\n"},
+		{name: "Unknown Extension", file: "config.json", content: "{}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeFile(t, tt.file, tt.content)
+			if _, err := Load("test", []string{"-config", path}, env(nil)); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestLoadSecretFile(t *testing.T) {
+	secretFile := writeFile(t, "jwt", testSecret+"\n")
+	vars := map[string]string{
+		"DB_URL":          "postgres://env",
+		"JWT_SECRET_FILE": secretFile,
+	}
+	loaded, err := Load("test", nil, env(vars))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if loaded.Config.JWT.Secret != testSecret {
+		t.Errorf("expected secret from file without the newline, got %q", loaded.Config.JWT.Secret)
+	}
+
+	vars["JWT_SECRET"] = testSecret
+	if _, err := Load("test", nil, env(vars)); err == nil || !strings.Contains(err.Error(), "JWT_SECRET_FILE") {
+		t.Errorf("expected error for both JWT_SECRET and JWT_SECRET_FILE, got %v", err)
+	}
+}
+
+func TestLoadOIDCFromEnv(t *testing.T) {
+	vars := map[string]string{
+		"DB_URL":                  "postgres://env",
+		"JWT_SECRET":              testSecret,
+		"OIDC_PROVIDERS":          "Corp, google",
+		"OIDC_CORP_ISSUER":        "https://sso.example.com",
+		"OIDC_CORP_CLIENT_ID":     "znotes",
+		"OIDC_CORP_CLIENT_SECRET": "corp-secret",
+		"OIDC_CORP_REDIRECT_URL":  "https://api.example.com/api/v1/auth/oidc/corp/callback",
+		"OIDC_CORP_SCOPES":        "openid,email",
+		"OIDC_GOOGLE_CLIENT_ID":   "znotes",
+	}
+	if _, err := Load("test", nil, env(vars)); err == nil || !strings.Contains(err.Error(), `"google"`) {
+		t.Errorf("expected error for incomplete google provider, got %v", err)
+	}
+
+	vars["OIDC_PROVIDERS"] = "Corp"
+	loaded, err := Load("test", nil, env(vars))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	corp, ok := loaded.Config.OIDC["corp"]
+	if !ok {
+		t.Fatal("expected provider corp to be configured")
+	}
+	if len(corp.Scopes) != 2 || corp.Scopes[1] != "email" || corp.ClientSecret != "corp-secret" {
+		t.Errorf("unexpected provider: %+v", corp)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "Missing Database URL", env: map[string]string{"JWT_SECRET": testSecret}, wantErr: "DB_URL"},
+		{name: "Short JWT Secret", env: map[string]string{"DB_URL": "postgres://", "JWT_SECRET": "short"}, wantErr: "jwt.secret"},
+		{name: "Bad Duration Env", env: map[string]string{"HTTP_READ_TIMEOUT": "soon"}, wantErr: "HTTP_READ_TIMEOUT"},
+		{name: "Bad Duration Flag", args: []string{"-http.read-timeout", "soon"}, wantErr: "http.read-timeout"},
+		{name: "Bad Rate Limit", env: map[string]string{"DB_URL": "postgres://", "JWT_SECRET": testSecret, "RATE_LIMIT_READ": "lots"}, wantErr: "rate_limit.read"},
+		{name: "Bad Sample Ratio", env: map[string]string{"DB_URL": "postgres://", "JWT_SECRET": testSecret, "OTEL_TRACES_SAMPLER_ARG": "2"}, wantErr: "sample_ratio"},
+		{name: "Half Captcha", env: map[string]string{"DB_URL": "postgres://", "JWT_SECRET": testSecret, "CAPTCHA_SECRET": "x"}, wantErr: "captcha"},
+		{name: "Key Without Cert", env: map[string]string{"DB_URL": "postgres://", "JWT_SECRET": testSecret, "TLS_KEY_FILE": "/tls/tls.key"}, wantErr: "tls.cert_file"},
+		{name: "Redirect Without TLS", env: map[string]string{"DB_URL": "postgres://", "JWT_SECRET": testSecret, "TLS_REDIRECT_ADDR": ":80"}, wantErr: "tls.redirect_addr"},
+		{name: "Old TLS Version", env: map[string]string{"DB_URL": "postgres://", "JWT_SECRET": testSecret, "TLS_MIN_VERSION": "1.0"}, wantErr: "tls.min_version"},
+		{name: "Bad CORS Origin", env: map[string]string{"DB_URL": "postgres://", "JWT_SECRET": testSecret, "CORS_ALLOWED_ORIGINS": "app.example.com"}, wantErr: "cors"},
+		{name: "Bad Contract Validation", env: map[string]string{"DB_URL": "postgres://", "JWT_SECRET": testSecret, "CONTRACT_VALIDATION": "always"}, wantErr: "contract_validation"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load("test", tt.args, env(tt.env))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error mentioning %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	_, err := Load("test", []string{"-log-level", "loud"}, env(nil))
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	for _, want := range []string{"DB_URL", "jwt.secret", "log_level"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %v", want, err)
+		}
+	}
+}
+
+func TestLoadKeyDirReplacesSecret(t *testing.T) {
+	_, err := Load("test", []string{"-jwt.key-dir", "/keys"}, env(map[string]string{"DB_URL": "postgres://"}))
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestLoadHelp(t *testing.T) {
+	_, err := Load("test", []string{"-h"}, env(nil))
+	if !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("expected flag.ErrHelp, got %v", err)
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.DatabaseURL = "postgres://user:hunter2@db/znotes"
+	cfg.JWT.Secret = testSecret
+	cfg.JWT.Issuer = "znotes"
+	cfg.OIDC = map[string]OIDCProvider{"corp": {ClientID: "znotes", ClientSecret: "corp-secret"}}
+
+	var buf bytes.Buffer
+	if err := cfg.Print(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := buf.String()
+	for _, secret := range []string{"hunter2", testSecret, "corp-secret"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("secret %q was printed:\n%s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "issuer: znotes") || !strings.Contains(out, "client_id: znotes") {
+		t.Errorf("expected other settings to be printed:\n%s", out)
+	}
+	if cfg.JWT.Secret != testSecret || cfg.OIDC["corp"].ClientSecret != "corp-secret" {
+		t.Error("expected the config itself to be left alone")
+	}
+}
+
+func TestCORSRoutes(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{name: "YAML", file: "config.yaml", content: `
+cors:
+  allowed_origins: ["https://*.example.com"]
+  routes:
+    /api/v1/admin/:
+      disabled: true
+    /api/v1/payment/webhooks:
+      allowed_origins: ["*"]
+      allow_credentials: false
+      max_age: 1h
+`},
+		{name: "TOML", file: "config.toml", content: `
+[cors]
+allowed_origins = ["https://*.example.com"]
+
+[cors.routes."/api/v1/admin/"]
+disabled = true
+
+[cors.routes."/api/v1/payment/webhooks"]
+allowed_origins = ["*"]
+allow_credentials = false
+max_age = "1h"
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeFile(t, tt.file, tt.content)
+			loaded, err := Load("test", []string{"-config", path}, env(map[string]string{"DB_URL": "postgres://", "JWT_SECRET": testSecret}))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			def, routes := loaded.Config.CORS.Policies()
+			if len(def.AllowedOrigins) != 1 || !def.AllowCredentials {
+				t.Errorf("unexpected default policy: %+v", def)
+			}
+			if p, ok := routes["/api/v1/admin/"]; !ok || p != nil {
+				t.Errorf("expected admin routes to be disabled, got %+v", p)
+			}
+			webhooks := routes["/api/v1/payment/webhooks"]
+			if webhooks == nil || webhooks.AllowCredentials || webhooks.MaxAge != time.Hour || webhooks.AllowedOrigins[0] != "*" {
+				t.Fatalf("unexpected webhook policy: %+v", webhooks)
+			}
+			if len(webhooks.ExposedHeaders) != len(def.ExposedHeaders) {
+				t.Errorf("expected unset fields to be inherited, got %+v", webhooks)
+			}
+		})
+	}
+}
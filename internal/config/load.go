@@ -0,0 +1,279 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Result of Load
+type Loaded struct {
+	Config Config
+	// Config file that was read, empty if none
+	File string
+	// Arguments left after the flags, e.g. a subcommand
+	Args []string
+	// Set by -print-config
+	PrintConfig bool
+}
+
+// Builds the config from defaults, the file given by -config (or CONFIG_FILE), the environment and
+// the flags in args, in that order, and validates it. lookupEnv is os.LookupEnv outside of tests
+func Load(name string, args []string, lookupEnv func(string) (string, bool)) (*Loaded, error) {
+	cfg := Default()
+	loaded := &Loaded{}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&loaded.File, "config", "", "YAML or TOML config file (env CONFIG_FILE)")
+	fs.BoolVar(&loaded.PrintConfig, "print-config", false, "print the effective config with secrets redacted and exit")
+	//flags win over everything, so they are only applied once the file and environment are read
+	var pending []func() error
+	defaults := Default()
+	for _, f := range fields(reflect.ValueOf(&cfg).Elem(), reflect.ValueOf(&defaults).Elem(), nil, "") {
+		usage := f.usage
+		if f.env != "" {
+			usage += " (env " + f.env + ")"
+		}
+		if def := f.defaultString(); def != "" && !f.secret {
+			usage += " (default " + def + ")"
+		}
+		apply := func(s string) error {
+			//check the value right away so the error points at the flag
+			if err := setString(reflect.New(f.value.Type()).Elem(), s); err != nil {
+				return err
+			}
+			pending = append(pending, func() error { return setString(f.value, s) })
+			return nil
+		}
+		if f.value.Kind() == reflect.Bool {
+			fs.BoolFunc(f.flagName(), usage, apply)
+			continue
+		}
+		fs.Func(f.flagName(), usage, apply)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [flags]\n       %s migrate up|down|status|redo\n\nFlags:\n", name, name)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	loaded.Args = fs.Args()
+
+	if loaded.File == "" {
+		loaded.File, _ = lookupEnv("CONFIG_FILE")
+	}
+	if loaded.File != "" {
+		if err := loadFile(&cfg, loaded.File); err != nil {
+			return nil, err
+		}
+	}
+	if err := loadEnv(&cfg, lookupEnv); err != nil {
+		return nil, err
+	}
+	for _, apply := range pending {
+		if err := apply(); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	loaded.Config = cfg
+	return loaded, nil
+}
+
+// Reads a .yaml/.yml or .toml file over cfg. Unknown keys are an error, they're most likely typos
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("parsing %s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("parsing %s: unknown key %s", path, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("config file %s must end in .yaml, .yml or .toml", path)
+	}
+	return nil
+}
+
+func loadEnv(cfg *Config, lookupEnv func(string) (string, bool)) error {
+	for _, f := range fields(reflect.ValueOf(cfg).Elem(), reflect.Value{}, nil, "") {
+		if err := f.loadEnv(lookupEnv); err != nil {
+			return err
+		}
+	}
+	names, ok := lookupEnv("OIDC_PROVIDERS")
+	if !ok {
+		return nil
+	}
+	if cfg.OIDC == nil {
+		cfg.OIDC = map[string]OIDCProvider{}
+	}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		provider := cfg.OIDC[name]
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		for _, f := range fields(reflect.ValueOf(&provider).Elem(), reflect.Value{}, nil, prefix) {
+			if err := f.loadEnv(lookupEnv); err != nil {
+				return err
+			}
+		}
+		cfg.OIDC[name] = provider
+	}
+	return nil
+}
+
+// A single setting, found by walking the Config struct
+type field struct {
+	path   []string
+	env    string
+	secret bool
+	usage  string
+	value  reflect.Value
+	// Same field in the defaults, invalid when not needed
+	def reflect.Value
+}
+
+// Settings in v and nested structs. Maps are skipped, they have no fixed env or flag names
+func fields(v, def reflect.Value, path []string, envPrefix string) []field {
+	var out []field
+	t := v.Type()
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		key, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		fieldPath := append(append([]string{}, path...), key)
+		var fieldDef reflect.Value
+		if def.IsValid() {
+			fieldDef = def.Field(i)
+		}
+		switch {
+		case sf.Type.Kind() == reflect.Map:
+			continue
+		case sf.Type.Kind() == reflect.Struct:
+			out = append(out, fields(v.Field(i), fieldDef, fieldPath, envPrefix)...)
+			continue
+		}
+		f := field{
+			path:   fieldPath,
+			secret: sf.Tag.Get("secret") == "true",
+			usage:  sf.Tag.Get("usage"),
+			value:  v.Field(i),
+			def:    fieldDef,
+		}
+		if env := sf.Tag.Get("env"); env != "" {
+			f.env = envPrefix + env
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// Dotted path of the field with dashes, e.g. http.read-timeout
+func (f field) flagName() string {
+	return strings.ReplaceAll(strings.Join(f.path, "."), "_", "-")
+}
+
+func (f field) defaultString() string {
+	if !f.def.IsValid() || f.def.IsZero() {
+		return ""
+	}
+	if d, ok := f.def.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	return fmt.Sprint(f.def.Interface())
+}
+
+// Secrets can come from <ENV>_FILE instead, as mounted by Docker and Kubernetes secrets
+func (f field) loadEnv(lookupEnv func(string) (string, bool)) error {
+	if f.env == "" {
+		return nil
+	}
+	value, ok := lookupEnv(f.env)
+	if f.secret {
+		if path, fileOK := lookupEnv(f.env + "_FILE"); fileOK && path != "" {
+			if ok {
+				return fmt.Errorf("both %s and %s_FILE are set", f.env, f.env)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("%s_FILE: %w", f.env, err)
+			}
+			value, ok = strings.TrimRight(string(data), "\r\n"), true
+		}
+	}
+	if !ok {
+		return nil
+	}
+	if err := setString(f.value, value); err != nil {
+		return fmt.Errorf("%s: %w", f.env, err)
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setString(v reflect.Value, s string) error {
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", s)
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int || v.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+		v.SetInt(n)
+	case v.Kind() == reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		v.SetFloat(n)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		v.Set(reflect.ValueOf(strings.Fields(strings.ReplaceAll(s, ",", " "))))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
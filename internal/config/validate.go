@@ -0,0 +1,225 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"sort"
+
+	"github.com/F0RG-2142/capstone-1/internal/auth"
+	"github.com/F0RG-2142/capstone-1/internal/cors"
+	"github.com/F0RG-2142/capstone-1/internal/logging"
+	"github.com/F0RG-2142/capstone-1/internal/ratelimit"
+	"github.com/F0RG-2142/capstone-1/internal/server"
+	"gopkg.in/yaml.v3"
+)
+
+// Shortest HS256 secret accepted, same as auth.TokenIssuer requires when signing
+const minJWTSecretBytes = 32
+
+// Checks everything that would otherwise only fail once a request needs it. Returns every problem
+// at once rather than one per restart
+func (c Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	if c.DatabaseURL == "" {
+		fail("database_url (DB_URL) is required")
+	}
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		fail("log_level: %v", err)
+	}
+	if c.UnlockURL != "" && !isHTTPURL(c.UnlockURL) {
+		fail("unlock_url must be an http(s) URL")
+	}
+	switch c.ContractValidation {
+	case "off", "requests", "strict":
+	default:
+		fail("contract_validation must be off, requests or strict")
+	}
+
+	if c.HTTP.Addr == "" {
+		fail("http.addr is required")
+	}
+	for name, d := range map[string]int64{
+		"http.read_timeout":        int64(c.HTTP.ReadTimeout),
+		"http.read_header_timeout": int64(c.HTTP.ReadHeaderTimeout),
+		"http.write_timeout":       int64(c.HTTP.WriteTimeout),
+		"http.idle_timeout":        int64(c.HTTP.IdleTimeout),
+		"http.shutdown_timeout":    int64(c.HTTP.ShutdownTimeout),
+		"http.max_header_bytes":    int64(c.HTTP.MaxHeaderBytes),
+	} {
+		if d <= 0 {
+			fail("%s must be positive", name)
+		}
+	}
+	if c.HTTP.ShutdownDelay < 0 || c.HTTP.MaxBodyBytes < 0 {
+		fail("http.shutdown_delay and http.max_body_bytes can't be negative")
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		fail("tls.cert_file and tls.key_file must be set together")
+	}
+	if !c.TLS.Enabled() && (c.TLS.RedirectAddr != "" || c.TLS.ClientCAFile != "" || c.TLS.HSTSMaxAge > 0) {
+		fail("tls.redirect_addr, tls.client_ca_file and tls.hsts_max_age need tls.cert_file and tls.key_file")
+	}
+	if c.TLS.ReloadInterval <= 0 {
+		fail("tls.reload_interval must be positive")
+	}
+	if _, err := server.ParseTLSVersion(c.TLS.MinVersion); err != nil {
+		fail("tls.min_version: %v", err)
+	}
+	if _, err := server.ParseCipherSuites(c.TLS.CipherSuites); err != nil {
+		fail("tls.cipher_suites: %v", err)
+	}
+
+	if _, err := cors.New(c.CORS.Policies()); err != nil {
+		fail("cors: %v", err)
+	}
+
+	if c.JWT.KeyDir == "" && len(c.JWT.Secret) < minJWTSecretBytes {
+		fail("jwt.secret (JWT_SECRET) must be at least %d bytes when jwt.key_dir is not set", minJWTSecretBytes)
+	}
+	if alg := c.JWT.KeyAlgorithm; alg != "" && alg != auth.AlgRS256 && alg != auth.AlgEdDSA {
+		fail("jwt.key_algorithm must be %s or %s", auth.AlgRS256, auth.AlgEdDSA)
+	}
+	if c.JWT.RotateEvery < 0 {
+		fail("jwt.rotate_every can't be negative")
+	}
+
+	if (c.Captcha.VerifyURL == "") != (c.Captcha.Secret == "") {
+		fail("captcha.verify_url and captcha.secret must be set together")
+	}
+	if c.SMTP.Addr != "" && c.SMTP.From == "" {
+		fail("smtp.from is required when smtp.addr is set")
+	}
+
+	if c.RateLimit.Store != "memory" && c.RateLimit.Store != "postgres" {
+		fail("rate_limit.store must be memory or postgres")
+	}
+	for name, limit := range c.RateLimit.Overrides() {
+		if _, err := ratelimit.ParseLimit(limit); err != nil {
+			fail("rate_limit.%s: %v", name, err)
+		}
+	}
+
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		fail("tracing.sample_ratio must be between 0 and 1")
+	}
+	if c.Tracing.Endpoint != "" && !isHTTPURL(c.Tracing.Endpoint) {
+		fail("tracing.endpoint must be an http(s) URL")
+	}
+
+	names := make([]string, 0, len(c.OIDC))
+	for name := range c.OIDC {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := c.OIDC[name]
+		if p.IssuerURL == "" || p.ClientID == "" || p.RedirectURL == "" {
+			fail("oidc provider %q needs issuer, client_id and redirect_url", name)
+		}
+	}
+	//map iteration above makes the order random
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Limits set for the rate limit groups by key (e.g. "write_premium"), unset ones are left out
+func (r RateLimit) Overrides() map[string]string {
+	overrides := map[string]string{}
+	for key, limit := range map[string]string{
+		"auth": r.Auth, "auth_premium": r.AuthPremium,
+		"read": r.Read, "read_premium": r.ReadPremium,
+		"write": r.Write, "write_premium": r.WritePremium,
+	} {
+		if limit != "" {
+			overrides[key] = limit
+		}
+	}
+	return overrides
+}
+
+// The top level policy and the route overrides merged over it, nil for disabled routes
+func (c CORS) Policies() (cors.Policy, map[string]*cors.Policy) {
+	def := cors.Policy{
+		AllowedOrigins:   c.AllowedOrigins,
+		AllowedMethods:   c.AllowedMethods,
+		AllowedHeaders:   c.AllowedHeaders,
+		ExposedHeaders:   c.ExposedHeaders,
+		MaxAge:           c.MaxAge,
+		AllowCredentials: c.AllowCredentials,
+	}
+	routes := make(map[string]*cors.Policy, len(c.Routes))
+	for prefix, r := range c.Routes {
+		if r.Disabled {
+			routes[prefix] = nil
+			continue
+		}
+		p := def
+		if r.AllowedOrigins != nil {
+			p.AllowedOrigins = r.AllowedOrigins
+		}
+		if r.AllowedMethods != nil {
+			p.AllowedMethods = r.AllowedMethods
+		}
+		if r.AllowedHeaders != nil {
+			p.AllowedHeaders = r.AllowedHeaders
+		}
+		if r.ExposedHeaders != nil {
+			p.ExposedHeaders = r.ExposedHeaders
+		}
+		if r.MaxAge != nil {
+			p.MaxAge = *r.MaxAge
+		}
+		if r.AllowCredentials != nil {
+			p.AllowCredentials = *r.AllowCredentials
+		}
+		routes[prefix] = &p
+	}
+	return def, routes
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// Copy of the config with every secret that is set replaced by logging.Redacted
+func (c Config) Redacted() Config {
+	redactSecrets(reflect.ValueOf(&c).Elem())
+	providers := make(map[string]OIDCProvider, len(c.OIDC))
+	for name, p := range c.OIDC {
+		redactSecrets(reflect.ValueOf(&p).Elem())
+		providers[name] = p
+	}
+	if c.OIDC != nil {
+		c.OIDC = providers
+	}
+	return c
+}
+
+func redactSecrets(v reflect.Value) {
+	for _, f := range fields(v, reflect.Value{}, nil, "") {
+		if f.secret && !f.value.IsZero() {
+			f.value.SetString(logging.Redacted)
+		}
+	}
+}
+
+// Writes the config as YAML with secrets redacted
+func (c Config) Print(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
@@ -0,0 +1,244 @@
+package cors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// What cross-origin browser requests may do. Origins are exact ("https://app.example.com"), with a
+// wildcard subdomain ("https://*.example.com", which doesn't match example.com itself) or any port
+// ("http://localhost:*"). "*" allows every origin and can't be combined with AllowCredentials
+type Policy struct {
+	AllowedOrigins []string
+	// Methods allowed in preflight requests
+	AllowedMethods []string
+	// Request headers allowed in preflight requests, "*" allows any
+	AllowedHeaders []string
+	// Response headers scripts can read besides the CORS safelisted ones
+	ExposedHeaders []string
+	// How long browsers may cache a preflight response, 0 leaves it to the browser
+	MaxAge           time.Duration
+	AllowCredentials bool
+}
+
+// Applies a default policy, or the policy of the longest route prefix matching the request path
+type Handler struct {
+	def    *policy
+	routes []route
+}
+
+type route struct {
+	prefix string
+	// nil turns CORS off for the route
+	policy *policy
+}
+
+// Routes maps path prefixes (e.g. "/api/v1/admin/") to the policy used for them, a nil policy turns
+// CORS off below that prefix
+func New(def Policy, routes map[string]*Policy) (*Handler, error) {
+	h := &Handler{}
+	var err error
+	if h.def, err = compile(def); err != nil {
+		return nil, err
+	}
+	for prefix, p := range routes {
+		if !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("cors route %q must start with /", prefix)
+		}
+		r := route{prefix: prefix}
+		if p != nil {
+			if r.policy, err = compile(*p); err != nil {
+				return nil, fmt.Errorf("cors route %s: %w", prefix, err)
+			}
+		}
+		h.routes = append(h.routes, r)
+	}
+	//longest first so the first match is the most specific
+	sort.Slice(h.routes, func(i, j int) bool { return len(h.routes[i].prefix) > len(h.routes[j].prefix) })
+	return h, nil
+}
+
+func (h *Handler) policyFor(path string) *policy {
+	for _, r := range h.routes {
+		if path == r.prefix || strings.HasPrefix(path, strings.TrimSuffix(r.prefix, "/")+"/") {
+			return r.policy
+		}
+	}
+	return h.def
+}
+
+// Adds CORS headers to responses for allowed origins and answers preflight requests. OPTIONS
+// requests that aren't preflights (no Origin or Access-Control-Request-Method) go to next as usual
+func (h *Handler) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := h.policyFor(r.URL.Path)
+		if p == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && origin != "" && r.Header.Get("Access-Control-Request-Method") != ""
+		if preflight {
+			w.Header().Add("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+			//a preflight the policy doesn't allow is answered without CORS headers, the browser then
+			//blocks the actual request
+			p.preflight(w.Header(), origin, r.Header.Get("Access-Control-Request-Method"), r.Header.Values("Access-Control-Request-Headers"))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		if origin != "" && p.allowsOrigin(origin) {
+			p.setOrigin(w.Header(), origin)
+			if len(p.exposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", p.exposedHeaders)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type policy struct {
+	anyOrigin        bool
+	origins          []originPattern
+	methods          []string
+	anyHeader        bool
+	headers          []string
+	allowMethods     string
+	exposedHeaders   string
+	maxAge           string
+	allowCredentials bool
+}
+
+func compile(p Policy) (*policy, error) {
+	c := &policy{allowCredentials: p.AllowCredentials}
+	for _, o := range p.AllowedOrigins {
+		if o == "*" {
+			c.anyOrigin = true
+			continue
+		}
+		pattern, err := parseOrigin(o)
+		if err != nil {
+			return nil, err
+		}
+		c.origins = append(c.origins, pattern)
+	}
+	if c.anyOrigin && c.allowCredentials {
+		return nil, errors.New(`cors origin "*" can't be combined with credentials, list the origins instead`)
+	}
+	for _, m := range p.AllowedMethods {
+		c.methods = append(c.methods, strings.ToUpper(m))
+	}
+	c.allowMethods = strings.Join(c.methods, ", ")
+	for _, h := range p.AllowedHeaders {
+		if h == "*" {
+			c.anyHeader = true
+			continue
+		}
+		c.headers = append(c.headers, strings.ToLower(h))
+	}
+	c.exposedHeaders = strings.Join(p.ExposedHeaders, ", ")
+	if p.MaxAge < 0 {
+		return nil, errors.New("cors max age can't be negative")
+	}
+	if p.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(int(p.MaxAge.Seconds()))
+	}
+	return c, nil
+}
+
+func (p *policy) allowsOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	o, err := parseOrigin(origin)
+	if err != nil || strings.Contains(o.host, "*") || o.port == "*" {
+		return false
+	}
+	for _, pattern := range p.origins {
+		if pattern.matches(o) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *policy) setOrigin(h http.Header, origin string) {
+	if p.anyOrigin {
+		h.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+	if p.allowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (p *policy) preflight(h http.Header, origin, method string, requestHeaders []string) {
+	if !p.allowsOrigin(origin) || !slices.Contains(p.methods, strings.ToUpper(method)) {
+		return
+	}
+	var headers []string
+	for _, line := range requestHeaders {
+		for _, name := range strings.Split(line, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if !p.anyHeader && !slices.Contains(p.headers, name) {
+				return
+			}
+			headers = append(headers, name)
+		}
+	}
+	p.setOrigin(h, origin)
+	h.Set("Access-Control-Allow-Methods", p.allowMethods)
+	if len(headers) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+	}
+	if p.maxAge != "" {
+		h.Set("Access-Control-Max-Age", p.maxAge)
+	}
+}
+
+type originPattern struct {
+	scheme string
+	// May start with "*." for any subdomain
+	host string
+	// "*" for any port, empty for the default one
+	port string
+}
+
+// Parses scheme://host[:port], url.Parse rejects the wildcard port
+func parseOrigin(s string) (originPattern, error) {
+	scheme, rest, ok := strings.Cut(strings.ToLower(s), "://")
+	if !ok || scheme == "" || rest == "" || strings.ContainsAny(rest, "/?#@") {
+		return originPattern{}, fmt.Errorf("invalid cors origin %q, expected scheme://host[:port]", s)
+	}
+	o := originPattern{scheme: scheme, host: rest}
+	if i := strings.LastIndex(rest, ":"); i != -1 && !strings.HasSuffix(rest, "]") {
+		o.host, o.port = rest[:i], rest[i+1:]
+		if _, err := strconv.Atoi(o.port); err != nil && o.port != "*" {
+			return originPattern{}, fmt.Errorf("invalid port in cors origin %q", s)
+		}
+	}
+	if o.host == "" || strings.Contains(strings.TrimPrefix(o.host, "*."), "*") {
+		return originPattern{}, fmt.Errorf("invalid host in cors origin %q, only a leading *. is allowed", s)
+	}
+	return o, nil
+}
+
+func (p originPattern) matches(o originPattern) bool {
+	if p.scheme != o.scheme || (p.port != "*" && p.port != o.port) {
+		return false
+	}
+	if suffix, ok := strings.CutPrefix(p.host, "*"); ok {
+		return strings.HasSuffix(o.host, suffix) && len(o.host) > len(suffix)
+	}
+	return p.host == o.host
+}
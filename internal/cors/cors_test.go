@@ -0,0 +1,199 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	AllowedOrigins:   []string{"https://app.example.com", "https://*.znotes.dev", "http://localhost:*"},
+	AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE"},
+	AllowedHeaders:   []string{"Content-Type", "Authorization"},
+	ExposedHeaders:   []string{"ETag", "X-Request-ID"},
+	MaxAge:           10 * time.Minute,
+	AllowCredentials: true,
+}
+
+func newTestHandler(t *testing.T, routes map[string]*Policy) http.Handler {
+	t.Helper()
+	h, err := New(testPolicy, routes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return h.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Handled", r.Method)
+		w.WriteHeader(http.StatusTeapot)
+	}))
+}
+
+func TestOrigins(t *testing.T) {
+	tests := []struct {
+		name     string
+		origin   string
+		expected bool
+	}{
+		{name: "Exact", origin: "https://app.example.com", expected: true},
+		{name: "Exact Upper Case", origin: "https://APP.example.com", expected: true},
+		{name: "Wrong Scheme", origin: "http://app.example.com", expected: false},
+		{name: "Other Port", origin: "https://app.example.com:8443", expected: false},
+		{name: "Subdomain", origin: "https://preview-42.znotes.dev", expected: true},
+		{name: "Nested Subdomain", origin: "https://a.b.znotes.dev", expected: true},
+		{name: "Wildcard Parent", origin: "https://znotes.dev", expected: false},
+		{name: "Suffix Lookalike", origin: "https://evilznotes.dev", expected: false},
+		{name: "Any Port", origin: "http://localhost:5173", expected: true},
+		{name: "No Port", origin: "http://localhost", expected: true},
+		{name: "Localhost Prefix", origin: "http://localhost.evil.com", expected: false},
+		{name: "Null", origin: "null", expected: false},
+	}
+	handler := newTestHandler(t, nil)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/notes", nil)
+			req.Header.Set("Origin", tt.origin)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			got := rec.Header().Get("Access-Control-Allow-Origin") == tt.origin
+			if got != tt.expected {
+				t.Errorf("expected allowed %v, got headers %v", tt.expected, rec.Header())
+			}
+			if rec.Code != http.StatusTeapot {
+				t.Errorf("expected request to reach the handler, got %d", rec.Code)
+			}
+			if got && (rec.Header().Get("Access-Control-Expose-Headers") != "ETag, X-Request-ID" || rec.Header().Get("Access-Control-Allow-Credentials") != "true") {
+				t.Errorf("unexpected headers: %v", rec.Header())
+			}
+			if rec.Header().Get("Vary") != "Origin" {
+				t.Errorf("expected Vary: Origin, got %q", rec.Header().Get("Vary"))
+			}
+		})
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	tests := []struct {
+		name     string
+		origin   string
+		method   string
+		headers  string
+		expected bool
+	}{
+		{name: "Allowed", origin: "https://app.example.com", method: "PUT", headers: "content-type, Authorization", expected: true},
+		{name: "No Headers", origin: "https://app.example.com", method: "DELETE", expected: true},
+		{name: "Disallowed Origin", origin: "https://evil.com", method: "PUT", expected: false},
+		{name: "Disallowed Method", origin: "https://app.example.com", method: "PATCH", expected: false},
+		{name: "Disallowed Header", origin: "https://app.example.com", method: "POST", headers: "Content-Type, X-Debug", expected: false},
+	}
+	handler := newTestHandler(t, nil)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("OPTIONS", "/api/v1/notes/1", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", tt.method)
+			if tt.headers != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.headers)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusNoContent || rec.Header().Get("X-Handled") != "" {
+				t.Fatalf("expected preflight to be answered with 204, got %d %v", rec.Code, rec.Header())
+			}
+			allowed := rec.Header().Get("Access-Control-Allow-Origin") == tt.origin
+			if allowed != tt.expected {
+				t.Fatalf("expected allowed %v, got headers %v", tt.expected, rec.Header())
+			}
+			if allowed && (rec.Header().Get("Access-Control-Allow-Methods") != "GET, POST, PUT, DELETE" || rec.Header().Get("Access-Control-Max-Age") != "600") {
+				t.Errorf("unexpected headers: %v", rec.Header())
+			}
+			if allowed && tt.headers != "" && rec.Header().Get("Access-Control-Allow-Headers") != "content-type, authorization" {
+				t.Errorf("unexpected allowed headers %q", rec.Header().Get("Access-Control-Allow-Headers"))
+			}
+		})
+	}
+}
+
+func TestPlainOptionsReachesHandler(t *testing.T) {
+	handler := newTestHandler(t, nil)
+	tests := []struct {
+		name   string
+		header string
+		value  string
+	}{
+		{name: "No Origin", header: "Access-Control-Request-Method", value: "PUT"},
+		{name: "No Request Method", header: "Origin", value: "https://app.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("OPTIONS", "/api/v1/notes", nil)
+			req.Header.Set(tt.header, tt.value)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Header().Get("X-Handled") != "OPTIONS" {
+				t.Errorf("expected OPTIONS request to reach the handler, got %d %v", rec.Code, rec.Header())
+			}
+		})
+	}
+}
+
+func TestRouteOverrides(t *testing.T) {
+	webhooks := testPolicy
+	webhooks.AllowedOrigins = []string{"*"}
+	webhooks.AllowCredentials = false
+	handler := newTestHandler(t, map[string]*Policy{
+		"/api/v1/admin/":           nil,
+		"/api/v1/payment/webhooks": &webhooks,
+	})
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		expected string
+	}{
+		{name: "Default", method: "GET", path: "/api/v1/notes", expected: "https://app.example.com"},
+		{name: "Disabled", method: "GET", path: "/api/v1/admin/lockouts", expected: ""},
+		{name: "Disabled Preflight", method: "OPTIONS", path: "/api/v1/admin/lockouts", expected: ""},
+		{name: "Prefix Boundary", method: "GET", path: "/api/v1/payment/webhooksx", expected: "https://app.example.com"},
+		{name: "Any Origin", method: "OPTIONS", path: "/api/v1/payment/webhooks", expected: "*"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Origin", "https://app.example.com")
+			req.Header.Set("Access-Control-Request-Method", "POST")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+			if tt.name == "Disabled Preflight" && rec.Header().Get("X-Handled") != "OPTIONS" {
+				t.Error("expected preflight of a disabled route to reach the handler")
+			}
+		})
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+	}{
+		{name: "Path", policy: Policy{AllowedOrigins: []string{"https://app.example.com/"}}},
+		{name: "No Scheme", policy: Policy{AllowedOrigins: []string{"app.example.com"}}},
+		{name: "Inner Wildcard", policy: Policy{AllowedOrigins: []string{"https://app.*.example.com"}}},
+		{name: "Bad Port", policy: Policy{AllowedOrigins: []string{"https://example.com:http"}}},
+		{name: "Any Origin With Credentials", policy: Policy{AllowedOrigins: []string{"*"}, AllowCredentials: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.policy, nil); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,357 @@
+package memdb
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/F0RG-2142/capstone-1/internal/database"
+	"github.com/google/uuid"
+)
+
+// sql.ErrNoRows when the id is taken, like ON CONFLICT DO NOTHING returning nothing
+func (s *Store) NewPaymentEvent(ctx context.Context, arg database.NewPaymentEventParams) (database.PaymentEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if index(s.paymentEvents, func(e database.PaymentEvent) bool { return e.ID == arg.ID }) != -1 {
+		return database.PaymentEvent{}, sql.ErrNoRows
+	}
+	now := s.now()
+	e := database.PaymentEvent{
+		ID:        arg.ID,
+		CreatedAt: now,
+		UpdatedAt: now,
+		EventType: arg.EventType,
+		Payload:   slices.Clone(arg.Payload),
+		Status:    "received",
+	}
+	s.paymentEvents = append(s.paymentEvents, e)
+	return paymentEvent(e), nil
+}
+
+// Copy that doesn't share the payload with the stored row
+func paymentEvent(e database.PaymentEvent) database.PaymentEvent {
+	e.Payload = slices.Clone(e.Payload)
+	return e
+}
+
+func (s *Store) GetPaymentEvent(ctx context.Context, id string) (database.PaymentEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := first(s.paymentEvents, func(e database.PaymentEvent) bool { return e.ID == id })
+	return paymentEvent(e), err
+}
+
+func (s *Store) GetPaymentEvents(ctx context.Context, arg database.GetPaymentEventsParams) ([]database.PaymentEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := filter(s.paymentEvents, func(e database.PaymentEvent) bool {
+		return !arg.Status.Valid || e.Status == arg.Status.String
+	})
+	//newest first, ties in insertion order reversed like an index scan backwards
+	slices.Reverse(events)
+	slices.SortStableFunc(events, func(a, b database.PaymentEvent) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	if len(events) > int(arg.MaxEvents) {
+		events = events[:max(arg.MaxEvents, 0)]
+	}
+	for i := range events {
+		events[i] = paymentEvent(events[i])
+	}
+	return events, nil
+}
+
+// Takes events that are received, failed or claimed more than 5 minutes ago
+func (s *Store) ClaimPaymentEvent(ctx context.Context, id string) (database.PaymentEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	i := index(s.paymentEvents, func(e database.PaymentEvent) bool {
+		return e.ID == id && (e.Status == "received" || e.Status == "failed" ||
+			e.Status == "processing" && e.UpdatedAt.Before(now.Add(-5*time.Minute)))
+	})
+	if i == -1 {
+		return database.PaymentEvent{}, sql.ErrNoRows
+	}
+	e := &s.paymentEvents[i]
+	e.UpdatedAt = now
+	e.Status = "processing"
+	return paymentEvent(*e), nil
+}
+
+func (s *Store) FinishPaymentEvent(ctx context.Context, arg database.FinishPaymentEventParams) (database.PaymentEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !slices.Contains([]string{"received", "processing", "processed", "ignored", "failed"}, arg.Status) {
+		return database.PaymentEvent{}, checkViolation("payment_events", "payment_events_status_check")
+	}
+	i := index(s.paymentEvents, func(e database.PaymentEvent) bool { return e.ID == arg.ID })
+	if i == -1 {
+		return database.PaymentEvent{}, sql.ErrNoRows
+	}
+	now := s.now()
+	e := &s.paymentEvents[i]
+	e.UpdatedAt = now
+	e.Status = arg.Status
+	e.Attempts++
+	if arg.Status != "failed" {
+		e.ProcessedAt = nullTime(now)
+	}
+	e.LastError = arg.LastError
+	return paymentEvent(*e), nil
+}
+
+func (s *Store) UpsertSubscription(ctx context.Context, arg database.UpsertSubscriptionParams) (database.Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !validStatus(arg.Status) {
+		return database.Subscription{}, checkViolation("subscriptions", "subscriptions_status_check")
+	}
+	if !s.userExists(arg.UserID) {
+		return database.Subscription{}, foreignKeyViolation("subscriptions", "subscriptions_user_id_fkey")
+	}
+	now := s.now()
+	i := index(s.subscriptions, func(sub database.Subscription) bool { return sub.UserID == arg.UserID })
+	if i == -1 {
+		sub := database.Subscription{
+			ID:                     uuid.New(),
+			CreatedAt:              now,
+			UpdatedAt:              now,
+			UserID:                 arg.UserID,
+			ProviderSubscriptionID: arg.ProviderSubscriptionID,
+			Plan:                   arg.Plan,
+			Status:                 arg.Status,
+			CurrentPeriodEnd:       arg.CurrentPeriodEnd,
+		}
+		s.subscriptions = append(s.subscriptions, sub)
+		return sub, nil
+	}
+	sub := &s.subscriptions[i]
+	sub.UpdatedAt = now
+	if arg.ProviderSubscriptionID.Valid {
+		sub.ProviderSubscriptionID = arg.ProviderSubscriptionID
+	}
+	sub.Plan = arg.Plan
+	sub.Status = arg.Status
+	sub.CurrentPeriodEnd = arg.CurrentPeriodEnd
+	sub.GracePeriodEnd = sql.NullTime{}
+	sub.CancelAtPeriodEnd = false
+	sub.CanceledAt = sql.NullTime{}
+	return *sub, nil
+}
+
+func (s *Store) GetSubscriptionByUser(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return first(s.subscriptions, func(sub database.Subscription) bool { return sub.UserID == userID })
+}
+
+// Applies update to the user's subscription if where accepts it, sql.ErrNoRows otherwise
+func (s *Store) updateSubscription(userId uuid.UUID, where func(database.Subscription) bool, update func(*database.Subscription, time.Time)) (database.Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := index(s.subscriptions, func(sub database.Subscription) bool { return sub.UserID == userId && where(sub) })
+	if i == -1 {
+		return database.Subscription{}, sql.ErrNoRows
+	}
+	now := s.now()
+	s.subscriptions[i].UpdatedAt = now
+	update(&s.subscriptions[i], now)
+	return s.subscriptions[i], nil
+}
+
+func anySubscription(database.Subscription) bool { return true }
+
+func notCanceled(sub database.Subscription) bool { return sub.Status != "canceled" }
+
+func (s *Store) RenewSubscription(ctx context.Context, arg database.RenewSubscriptionParams) (database.Subscription, error) {
+	return s.updateSubscription(arg.UserID, notCanceled, func(sub *database.Subscription, now time.Time) {
+		sub.Status = "active"
+		sub.CurrentPeriodEnd = arg.CurrentPeriodEnd
+		sub.GracePeriodEnd = sql.NullTime{}
+	})
+}
+
+func (s *Store) MarkSubscriptionPastDue(ctx context.Context, arg database.MarkSubscriptionPastDueParams) (database.Subscription, error) {
+	return s.updateSubscription(arg.UserID, notCanceled, func(sub *database.Subscription, now time.Time) {
+		sub.Status = "past_due"
+		sub.GracePeriodEnd = arg.GracePeriodEnd
+	})
+}
+
+func (s *Store) CancelSubscriptionAtPeriodEnd(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	return s.updateSubscription(userID, notCanceled, func(sub *database.Subscription, now time.Time) {
+		sub.CancelAtPeriodEnd = true
+	})
+}
+
+func (s *Store) CancelSubscription(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	return s.updateSubscription(userID, anySubscription, cancelSubscription)
+}
+
+func cancelSubscription(sub *database.Subscription, now time.Time) {
+	sub.Status = "canceled"
+	sub.GracePeriodEnd = sql.NullTime{}
+	sub.CancelAtPeriodEnd = false
+	sub.CanceledAt = nullTime(now)
+}
+
+// NULL grace periods never compare as lapsed
+func beforeNull(t sql.NullTime, than time.Time) bool {
+	return t.Valid && t.Time.Before(than)
+}
+
+func (s *Store) ExpireLapsedSubscriptions(ctx context.Context, arg database.ExpireLapsedSubscriptionsParams) ([]database.Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	var expired []database.Subscription
+	for i, sub := range s.subscriptions {
+		if sub.Status == "canceled" {
+			continue
+		}
+		lapsed := (sub.CancelAtPeriodEnd && sub.CurrentPeriodEnd.Before(arg.Now)) ||
+			(sub.Status == "past_due" && beforeNull(sub.GracePeriodEnd, arg.Now)) ||
+			((sub.Status == "active" || sub.Status == "trialing") && sub.CurrentPeriodEnd.Before(arg.LapsedBefore))
+		if !lapsed {
+			continue
+		}
+		s.subscriptions[i].UpdatedAt = now
+		cancelSubscription(&s.subscriptions[i], now)
+		expired = append(expired, s.subscriptions[i])
+	}
+	return expired, nil
+}
+
+func (s *Store) UpsertTeamSubscription(ctx context.Context, arg database.UpsertTeamSubscriptionParams) (database.TeamSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !validStatus(arg.Status) {
+		return database.TeamSubscription{}, checkViolation("team_subscriptions", "team_subscriptions_status_check")
+	}
+	if arg.Seats <= 0 {
+		return database.TeamSubscription{}, checkViolation("team_subscriptions", "team_subscriptions_seats_check")
+	}
+	if !s.teamExists(arg.TeamID) {
+		return database.TeamSubscription{}, foreignKeyViolation("team_subscriptions", "team_subscriptions_team_id_fkey")
+	}
+	now := s.now()
+	i := index(s.teamSubs, func(sub database.TeamSubscription) bool { return sub.TeamID == arg.TeamID })
+	if i == -1 {
+		sub := database.TeamSubscription{
+			ID:                     uuid.New(),
+			CreatedAt:              now,
+			UpdatedAt:              now,
+			TeamID:                 arg.TeamID,
+			ProviderSubscriptionID: arg.ProviderSubscriptionID,
+			Plan:                   arg.Plan,
+			Status:                 arg.Status,
+			Seats:                  arg.Seats,
+			CurrentPeriodEnd:       arg.CurrentPeriodEnd,
+		}
+		s.teamSubs = append(s.teamSubs, sub)
+		return sub, nil
+	}
+	sub := &s.teamSubs[i]
+	sub.UpdatedAt = now
+	if arg.ProviderSubscriptionID.Valid {
+		sub.ProviderSubscriptionID = arg.ProviderSubscriptionID
+	}
+	sub.Plan = arg.Plan
+	sub.Status = arg.Status
+	sub.Seats = arg.Seats
+	sub.CurrentPeriodEnd = arg.CurrentPeriodEnd
+	sub.GracePeriodEnd = sql.NullTime{}
+	sub.CanceledAt = sql.NullTime{}
+	return *sub, nil
+}
+
+func (s *Store) GetTeamSubscription(ctx context.Context, teamID uuid.UUID) (database.TeamSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return first(s.teamSubs, func(sub database.TeamSubscription) bool { return sub.TeamID == teamID })
+}
+
+// Like updateSubscription for the team's subscription
+func (s *Store) updateTeamSubscription(teamId uuid.UUID, where func(database.TeamSubscription) bool, update func(*database.TeamSubscription, time.Time)) (database.TeamSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := index(s.teamSubs, func(sub database.TeamSubscription) bool { return sub.TeamID == teamId && where(sub) })
+	if i == -1 {
+		return database.TeamSubscription{}, sql.ErrNoRows
+	}
+	now := s.now()
+	s.teamSubs[i].UpdatedAt = now
+	update(&s.teamSubs[i], now)
+	return s.teamSubs[i], nil
+}
+
+func anyTeamSubscription(database.TeamSubscription) bool { return true }
+
+func teamNotCanceled(sub database.TeamSubscription) bool { return sub.Status != "canceled" }
+
+func (s *Store) SetTeamSubscriptionSeats(ctx context.Context, arg database.SetTeamSubscriptionSeatsParams) (database.TeamSubscription, error) {
+	if arg.Seats <= 0 {
+		return database.TeamSubscription{}, checkViolation("team_subscriptions", "team_subscriptions_seats_check")
+	}
+	return s.updateTeamSubscription(arg.TeamID, teamNotCanceled, func(sub *database.TeamSubscription, now time.Time) {
+		sub.Seats = arg.Seats
+	})
+}
+
+func (s *Store) RenewTeamSubscription(ctx context.Context, arg database.RenewTeamSubscriptionParams) (database.TeamSubscription, error) {
+	return s.updateTeamSubscription(arg.TeamID, teamNotCanceled, func(sub *database.TeamSubscription, now time.Time) {
+		sub.Status = "active"
+		sub.CurrentPeriodEnd = arg.CurrentPeriodEnd
+		sub.GracePeriodEnd = sql.NullTime{}
+	})
+}
+
+func (s *Store) MarkTeamSubscriptionPastDue(ctx context.Context, arg database.MarkTeamSubscriptionPastDueParams) (database.TeamSubscription, error) {
+	return s.updateTeamSubscription(arg.TeamID, teamNotCanceled, func(sub *database.TeamSubscription, now time.Time) {
+		sub.Status = "past_due"
+		sub.GracePeriodEnd = arg.GracePeriodEnd
+	})
+}
+
+func (s *Store) CancelTeamSubscription(ctx context.Context, teamID uuid.UUID) (database.TeamSubscription, error) {
+	return s.updateTeamSubscription(teamID, anyTeamSubscription, cancelTeamSubscription)
+}
+
+func cancelTeamSubscription(sub *database.TeamSubscription, now time.Time) {
+	sub.Status = "canceled"
+	sub.GracePeriodEnd = sql.NullTime{}
+	sub.CanceledAt = nullTime(now)
+}
+
+func (s *Store) ExpireLapsedTeamSubscriptions(ctx context.Context, arg database.ExpireLapsedTeamSubscriptionsParams) ([]database.TeamSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	var expired []database.TeamSubscription
+	for i, sub := range s.teamSubs {
+		if sub.Status == "canceled" {
+			continue
+		}
+		lapsed := (sub.Status == "past_due" && beforeNull(sub.GracePeriodEnd, arg.Now)) ||
+			((sub.Status == "active" || sub.Status == "trialing") && sub.CurrentPeriodEnd.Before(arg.LapsedBefore))
+		if !lapsed {
+			continue
+		}
+		s.teamSubs[i].UpdatedAt = now
+		cancelTeamSubscription(&s.teamSubs[i], now)
+		expired = append(expired, s.teamSubs[i])
+	}
+	return expired, nil
+}
+
+func (s *Store) GetBusinessCounts(ctx context.Context) (database.GetBusinessCountsRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return database.GetBusinessCountsRow{
+		Users:        int64(len(s.users)),
+		PremiumUsers: count(s.users, func(u database.User) bool { return u.HasNotesPremium }),
+		Notes:        int64(len(s.notes)),
+		Teams:        int64(len(s.teams)),
+	}, nil
+}
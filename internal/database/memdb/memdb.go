@@ -0,0 +1,201 @@
+// Package memdb keeps the tables in process memory and implements database.Querier the way
+// the queries in sql/queries behave on Postgres: rows that don't match are sql.ErrNoRows,
+// constraint violations are *pq.Error with the Postgres error code and foreign keys cascade
+// as declared in sql/schema. Meant for tests and local experiments, not for production
+package memdb
+
+import (
+	"database/sql"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/F0RG-2142/capstone-1/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var _ database.Querier = (*Store)(nil)
+
+// Postgres error codes returned for constraint violations
+const (
+	codeForeignKeyViolation = "23503"
+	codeUniqueViolation     = "23505"
+	codeCheckViolation      = "23514"
+)
+
+type Store struct {
+	// Current time, what NOW() returns. time.Now when nil
+	Now func() time.Time
+
+	mu sync.Mutex
+	//rows are kept in insertion order, queries without ORDER BY return them in that order
+	users         []database.User
+	notes         []database.Note
+	teams         []database.Team
+	userTeams     []database.UserTeam
+	noteTeams     []database.NoteTeam
+	refreshTokens []database.RefreshToken
+	identities    []database.UserIdentity
+	oidcStates    []database.OidcLoginState
+	apiTokens     []database.ApiToken
+	throttles     []database.LoginThrottle
+	unlockTokens  []database.UnlockToken
+	rateLimits    []database.RateLimit
+	paymentEvents []database.PaymentEvent
+	subscriptions []database.Subscription
+	teamSubs      []database.TeamSubscription
+}
+
+func New() *Store {
+	return &Store{}
+}
+
+// NOW() in the database, timestamps are stored without a time zone
+func (s *Store) now() time.Time {
+	if s.Now != nil {
+		return s.Now().UTC()
+	}
+	return time.Now().UTC()
+}
+
+func foreignKeyViolation(table, constraint string) error {
+	return &pq.Error{
+		Code:       codeForeignKeyViolation,
+		Table:      table,
+		Constraint: constraint,
+		Message:    `insert or update on table "` + table + `" violates foreign key constraint "` + constraint + `"`,
+	}
+}
+
+func restrictViolation(table, constraint string) error {
+	return &pq.Error{
+		Code:       codeForeignKeyViolation,
+		Table:      table,
+		Constraint: constraint,
+		Message:    `update or delete on table "` + table + `" violates foreign key constraint "` + constraint + `"`,
+	}
+}
+
+func uniqueViolation(table, constraint string) error {
+	return &pq.Error{
+		Code:       codeUniqueViolation,
+		Table:      table,
+		Constraint: constraint,
+		Message:    `duplicate key value violates unique constraint "` + constraint + `"`,
+	}
+}
+
+func checkViolation(table, constraint string) error {
+	return &pq.Error{
+		Code:       codeCheckViolation,
+		Table:      table,
+		Constraint: constraint,
+		Message:    `new row for relation "` + table + `" violates check constraint "` + constraint + `"`,
+	}
+}
+
+// First row matching, sql.ErrNoRows like a :one query without a result otherwise
+func first[T any](rows []T, match func(T) bool) (T, error) {
+	for _, row := range rows {
+		if match(row) {
+			return row, nil
+		}
+	}
+	var zero T
+	return zero, sql.ErrNoRows
+}
+
+func index[T any](rows []T, match func(T) bool) int {
+	return slices.IndexFunc(rows, match)
+}
+
+func filter[T any](rows []T, match func(T) bool) []T {
+	var items []T
+	for _, row := range rows {
+		if match(row) {
+			items = append(items, row)
+		}
+	}
+	return items
+}
+
+func count[T any](rows []T, match func(T) bool) int64 {
+	var n int64
+	for _, row := range rows {
+		if match(row) {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Store) userExists(id uuid.UUID) bool {
+	return index(s.users, func(u database.User) bool { return u.ID == id }) != -1
+}
+
+func (s *Store) teamExists(id uuid.UUID) bool {
+	return index(s.teams, func(t database.Team) bool { return t.ID == id }) != -1
+}
+
+func (s *Store) member(userId, teamId uuid.UUID) (database.UserTeam, bool) {
+	m, err := first(s.userTeams, func(ut database.UserTeam) bool { return ut.UserID == userId && ut.TeamID == teamId })
+	return m, err == nil
+}
+
+// Deletes users and everything referencing them. Teams they created block it (ON DELETE RESTRICT)
+func (s *Store) deleteUsers(match func(database.User) bool) error {
+	var ids []uuid.UUID
+	for _, u := range s.users {
+		if match(u) {
+			ids = append(ids, u.ID)
+		}
+	}
+	for _, t := range s.teams {
+		if slices.Contains(ids, t.CreatedBy) {
+			return restrictViolation("users", "teams_created_by_fkey")
+		}
+	}
+	s.users = slices.DeleteFunc(s.users, match)
+	s.deleteNotes(func(n database.Note) bool { return slices.Contains(ids, n.UserID) })
+	s.userTeams = slices.DeleteFunc(s.userTeams, func(ut database.UserTeam) bool { return slices.Contains(ids, ut.UserID) })
+	s.refreshTokens = slices.DeleteFunc(s.refreshTokens, func(t database.RefreshToken) bool { return slices.Contains(ids, t.UserID) })
+	s.identities = slices.DeleteFunc(s.identities, func(i database.UserIdentity) bool { return slices.Contains(ids, i.UserID) })
+	s.apiTokens = slices.DeleteFunc(s.apiTokens, func(t database.ApiToken) bool { return slices.Contains(ids, t.UserID) })
+	s.subscriptions = slices.DeleteFunc(s.subscriptions, func(sub database.Subscription) bool { return slices.Contains(ids, sub.UserID) })
+	return nil
+}
+
+func (s *Store) deleteNotes(match func(database.Note) bool) int64 {
+	var ids []uuid.UUID
+	for _, n := range s.notes {
+		if match(n) {
+			ids = append(ids, n.ID)
+		}
+	}
+	s.notes = slices.DeleteFunc(s.notes, match)
+	s.noteTeams = slices.DeleteFunc(s.noteTeams, func(nt database.NoteTeam) bool { return slices.Contains(ids, nt.NoteID) })
+	return int64(len(ids))
+}
+
+func (s *Store) deleteTeams(match func(database.Team) bool) int64 {
+	var ids []uuid.UUID
+	for _, t := range s.teams {
+		if match(t) {
+			ids = append(ids, t.ID)
+		}
+	}
+	s.teams = slices.DeleteFunc(s.teams, match)
+	s.userTeams = slices.DeleteFunc(s.userTeams, func(ut database.UserTeam) bool { return slices.Contains(ids, ut.TeamID) })
+	s.noteTeams = slices.DeleteFunc(s.noteTeams, func(nt database.NoteTeam) bool { return slices.Contains(ids, nt.TeamID) })
+	s.teamSubs = slices.DeleteFunc(s.teamSubs, func(sub database.TeamSubscription) bool { return slices.Contains(ids, sub.TeamID) })
+	return int64(len(ids))
+}
+
+func validStatus(status string) bool {
+	return slices.Contains([]string{"trialing", "active", "past_due", "canceled"}, status)
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: true}
+}
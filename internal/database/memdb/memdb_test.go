@@ -0,0 +1,213 @@
+package memdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/F0RG-2142/capstone-1/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+func errorCode(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return string(pqErr.Code)
+	}
+	return ""
+}
+
+// Store with a team created by admin, editor and viewer as members and a note shared with it
+type fixture struct {
+	db                    *Store
+	admin, editor, viewer database.User
+	team                  database.Team
+	note                  uuid.UUID
+}
+
+func newFixture(t *testing.T) fixture {
+	t.Helper()
+	ctx := context.Background()
+	f := fixture{db: New()}
+	var err error
+	for _, u := range []*database.User{&f.admin, &f.editor, &f.viewer} {
+		if *u, err = f.db.CreateUser(ctx, database.CreateUserParams{Email: uuid.NewString() + "@example.com"}); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+	if f.team, err = f.db.NewTeam(ctx, database.NewTeamParams{TeamName: "team", CreatedBy: f.admin.ID}); err != nil {
+		t.Fatalf("failed to create team: %v", err)
+	}
+	//the creator is already the admin
+	for user, role := range map[uuid.UUID]string{f.editor.ID: "editor", f.viewer.ID: "viewer"} {
+		if err := f.db.AddUserToTeam(ctx, database.AddUserToTeamParams{UserID: user, TeamID: f.team.ID, Role: role}); err != nil {
+			t.Fatalf("failed to add member: %v", err)
+		}
+	}
+	if f.note, err = f.db.NewNote(ctx, database.NewNoteParams{Body: "shared", UserID: f.editor.ID}); err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	if err := f.db.AddNoteToTeam(ctx, database.AddNoteToTeamParams{NoteID: f.note, ID: f.team.ID, UserID: f.editor.ID}); err != nil {
+		t.Fatalf("failed to share note: %v", err)
+	}
+	return f
+}
+
+func TestConstraints(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		run      func() error
+		wantCode string
+	}{
+		{
+			name: "Unknown Role",
+			run: func() error {
+				return f.db.AddUserToTeam(ctx, database.AddUserToTeamParams{UserID: f.viewer.ID, TeamID: f.team.ID, Role: "owner"})
+			},
+			wantCode: codeCheckViolation,
+		},
+		{
+			name: "Existing Member",
+			run: func() error {
+				return f.db.AddUserToTeam(ctx, database.AddUserToTeamParams{UserID: f.viewer.ID, TeamID: f.team.ID, Role: "viewer"})
+			},
+			wantCode: codeUniqueViolation,
+		},
+		{
+			name: "Unknown User",
+			run: func() error {
+				return f.db.AddUserToTeam(ctx, database.AddUserToTeamParams{UserID: uuid.New(), TeamID: f.team.ID, Role: "viewer"})
+			},
+			wantCode: codeForeignKeyViolation,
+		},
+		{
+			name: "Note Of Unknown User",
+			run: func() error {
+				_, err := f.db.NewNote(ctx, database.NewNoteParams{UserID: uuid.New()})
+				return err
+			},
+			wantCode: codeForeignKeyViolation,
+		},
+		{
+			name:     "Delete Team Creator",
+			run:      func() error { return f.db.DeleteUser(ctx, f.admin.ID) },
+			wantCode: codeForeignKeyViolation,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := errorCode(tt.run()); code != tt.wantCode {
+				t.Errorf("expected error code %q, got %q", tt.wantCode, code)
+			}
+		})
+	}
+}
+
+func TestTeamRoles(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	//viewers can't share notes, the insert selects nothing
+	viewerNote, err := f.db.NewNote(ctx, database.NewNoteParams{Body: "viewer", UserID: f.viewer.ID})
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	if err := f.db.AddNoteToTeam(ctx, database.AddNoteToTeamParams{NoteID: viewerNote, ID: f.team.ID, UserID: f.viewer.ID}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	notes, _ := f.db.GetTeamNotes(ctx, database.GetTeamNotesParams{TeamID: f.team.ID, UserID: f.viewer.ID})
+	if len(notes) != 1 || notes[0].ID != f.note {
+		t.Errorf("expected only the shared note, got %+v", notes)
+	}
+
+	tests := []struct {
+		name   string
+		run    func() (int64, error)
+		want   int64
+		exists bool
+	}{
+		{
+			name: "Viewer Updates",
+			run: func() (int64, error) {
+				return f.db.UpdateTeamNote(ctx, database.UpdateTeamNoteParams{Body: "x", ID: f.note, TeamID: f.team.ID, UserID: f.viewer.ID})
+			},
+			want:   0,
+			exists: true,
+		},
+		{
+			name: "Editor Updates",
+			run: func() (int64, error) {
+				return f.db.UpdateTeamNote(ctx, database.UpdateTeamNoteParams{Body: "x", ID: f.note, TeamID: f.team.ID, UserID: f.editor.ID})
+			},
+			want:   1,
+			exists: true,
+		},
+		{
+			name: "Editor Deletes",
+			run: func() (int64, error) {
+				return f.db.RemoveNoteFromTeam(ctx, database.RemoveNoteFromTeamParams{NoteID: f.note, TeamID: f.team.ID, UserID: f.editor.ID})
+			},
+			want:   0,
+			exists: true,
+		},
+		{
+			name: "Admin Deletes",
+			run: func() (int64, error) {
+				return f.db.RemoveNoteFromTeam(ctx, database.RemoveNoteFromTeamParams{NoteID: f.note, TeamID: f.team.ID, UserID: f.admin.ID})
+			},
+			want:   1,
+			exists: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := tt.run()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if n != tt.want {
+				t.Errorf("expected %d rows, got %d", tt.want, n)
+			}
+			_, err = f.db.GetNoteByID(ctx, database.GetNoteByIDParams{ID: f.note, UserID: f.editor.ID})
+			if exists := err == nil; exists != tt.exists {
+				t.Errorf("expected note to exist: %v, got error %v", tt.exists, err)
+			}
+		})
+	}
+}
+
+func TestCascades(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	if deleted, _ := f.db.DeleteTeam(ctx, database.DeleteTeamParams{ID: f.team.ID, UserID: f.editor.ID}); deleted != 0 {
+		t.Fatal("only admins can delete the team")
+	}
+	if deleted, _ := f.db.DeleteTeam(ctx, database.DeleteTeamParams{ID: f.team.ID, UserID: f.admin.ID}); deleted != 1 {
+		t.Fatal("expected the admin to delete the team")
+	}
+	if members, _ := f.db.GetTeamMembers(ctx, f.team.ID); len(members) != 0 {
+		t.Errorf("expected memberships to be deleted, got %+v", members)
+	}
+	//the note only loses its sharing
+	if _, err := f.db.GetNoteByID(ctx, database.GetNoteByIDParams{ID: f.note, UserID: f.editor.ID}); err != nil {
+		t.Errorf("expected the note to be kept: %v", err)
+	}
+
+	if err := f.db.DeleteUser(ctx, f.editor.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := f.db.GetNoteByID(ctx, database.GetNoteByIDParams{ID: f.note, UserID: f.editor.ID}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the user's notes to be deleted, got %v", err)
+	}
+	if err := f.db.DeleteUser(ctx, f.admin.ID); err != nil {
+		t.Errorf("expected the admin to be deletable without teams: %v", err)
+	}
+}
@@ -0,0 +1,273 @@
+package memdb
+
+import (
+	"context"
+	"slices"
+
+	"github.com/F0RG-2142/capstone-1/internal/database"
+	"github.com/google/uuid"
+)
+
+func (s *Store) NewNote(ctx context.Context, arg database.NewNoteParams) (uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.userExists(arg.UserID) {
+		return uuid.Nil, foreignKeyViolation("notes", "notes_user_id_fkey")
+	}
+	now := s.now()
+	n := database.Note{
+		ID:        uuid.New(),
+		Name:      "unset",
+		CreatedAt: now,
+		UpdatedAt: now,
+		Body:      arg.Body,
+		UserID:    arg.UserID,
+	}
+	s.notes = append(s.notes, n)
+	return n.ID, nil
+}
+
+func (s *Store) GetAllNotes(ctx context.Context, userID uuid.UUID) ([]database.Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	notes := filter(s.notes, func(n database.Note) bool { return n.UserID == userID })
+	slices.SortStableFunc(notes, func(a, b database.Note) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return notes, nil
+}
+
+func (s *Store) GetNoteByID(ctx context.Context, arg database.GetNoteByIDParams) (database.Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return first(s.notes, func(n database.Note) bool { return n.ID == arg.ID && n.UserID == arg.UserID })
+}
+
+func (s *Store) DeleteNote(ctx context.Context, arg database.DeleteNoteParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deleteNotes(func(n database.Note) bool { return n.ID == arg.ID && n.UserID == arg.UserID }), nil
+}
+
+func (s *Store) UpdateNote(ctx context.Context, arg database.UpdateNoteParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := index(s.notes, func(n database.Note) bool { return n.ID == arg.ID }); i != -1 {
+		s.notes[i].UpdatedAt = s.now()
+		s.notes[i].Body = arg.Body
+		s.notes[i].Name = arg.Name
+	}
+	return nil
+}
+
+func (s *Store) CountNotes(ctx context.Context, userID uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return count(s.notes, func(n database.Note) bool { return n.UserID == userID }), nil
+}
+
+func (s *Store) NewTeam(ctx context.Context, arg database.NewTeamParams) (database.Team, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.userExists(arg.CreatedBy) {
+		return database.Team{}, foreignKeyViolation("teams", "teams_created_by_fkey")
+	}
+	now := s.now()
+	t := database.Team{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		TeamName:  arg.TeamName,
+		CreatedBy: arg.CreatedBy,
+		IsPrivate: arg.IsPrivate,
+	}
+	s.teams = append(s.teams, t)
+	s.userTeams = append(s.userTeams, database.UserTeam{
+		UserID:   arg.CreatedBy,
+		TeamID:   t.ID,
+		Role:     "admin",
+		JoinedAt: now,
+	})
+	return t, nil
+}
+
+func (s *Store) GetAllTeams(ctx context.Context, userID uuid.UUID) ([]database.Team, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return filter(s.teams, func(t database.Team) bool {
+		_, ok := s.member(userID, t.ID)
+		return ok
+	}), nil
+}
+
+func (s *Store) GetTeamById(ctx context.Context, arg database.GetTeamByIdParams) (database.Team, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return first(s.teams, func(t database.Team) bool {
+		_, ok := s.member(arg.UserID, t.ID)
+		return t.ID == arg.TeamID && ok
+	})
+}
+
+func (s *Store) DeleteTeam(ctx context.Context, arg database.DeleteTeamParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deleteTeams(func(t database.Team) bool {
+		m, ok := s.member(arg.UserID, t.ID)
+		return t.ID == arg.ID && ok && m.Role == "admin"
+	}), nil
+}
+
+func (s *Store) AddUserToTeam(ctx context.Context, arg database.AddUserToTeamParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !slices.Contains([]string{"admin", "editor", "viewer"}, arg.Role) {
+		return checkViolation("user_teams", "user_teams_role_check")
+	}
+	if !s.userExists(arg.UserID) {
+		return foreignKeyViolation("user_teams", "user_teams_user_id_fkey")
+	}
+	if !s.teamExists(arg.TeamID) {
+		return foreignKeyViolation("user_teams", "user_teams_team_id_fkey")
+	}
+	if _, ok := s.member(arg.UserID, arg.TeamID); ok {
+		return uniqueViolation("user_teams", "user_teams_pkey")
+	}
+	s.userTeams = append(s.userTeams, database.UserTeam{
+		UserID:   arg.UserID,
+		TeamID:   arg.TeamID,
+		Role:     arg.Role,
+		JoinedAt: s.now(),
+	})
+	return nil
+}
+
+func (s *Store) RemoveUserFromTeam(ctx context.Context, arg database.RemoveUserFromTeamParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.userTeams = slices.DeleteFunc(s.userTeams, func(ut database.UserTeam) bool {
+		return ut.UserID == arg.UserID && ut.TeamID == arg.TeamID
+	})
+	return nil
+}
+
+func (s *Store) GetTeamMember(ctx context.Context, arg database.GetTeamMemberParams) (database.UserTeam, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return first(s.userTeams, func(ut database.UserTeam) bool { return ut.UserID == arg.UserID && ut.TeamID == arg.TeamID })
+}
+
+func (s *Store) GetTeamMembers(ctx context.Context, teamID uuid.UUID) ([]database.UserTeam, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	members := filter(s.userTeams, func(ut database.UserTeam) bool { return ut.TeamID == teamID })
+	slices.SortStableFunc(members, func(a, b database.UserTeam) int { return a.JoinedAt.Compare(b.JoinedAt) })
+	return members, nil
+}
+
+func (s *Store) CountTeamMembers(ctx context.Context, teamID uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return count(s.userTeams, func(ut database.UserTeam) bool { return ut.TeamID == teamID }), nil
+}
+
+func (s *Store) CountTeamsCreated(ctx context.Context, createdBy uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return count(s.teams, func(t database.Team) bool { return t.CreatedBy == createdBy }), nil
+}
+
+func (s *Store) GetLargestCreatedTeamSize(ctx context.Context, createdBy uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var largest int64
+	for _, t := range s.teams {
+		if t.CreatedBy != createdBy {
+			continue
+		}
+		largest = max(largest, count(s.userTeams, func(ut database.UserTeam) bool { return ut.TeamID == t.ID }))
+	}
+	return largest, nil
+}
+
+func (s *Store) GetTeamCreatorPremium(ctx context.Context, id uuid.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := first(s.teams, func(t database.Team) bool { return t.ID == id })
+	if err != nil {
+		return false, err
+	}
+	u, err := first(s.users, func(u database.User) bool { return u.ID == t.CreatedBy })
+	return u.HasNotesPremium, err
+}
+
+// Only admins and editors of the team share notes with it, for anyone else nothing is inserted
+func (s *Store) AddNoteToTeam(ctx context.Context, arg database.AddNoteToTeamParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.member(arg.UserID, arg.ID)
+	if !ok || (m.Role != "admin" && m.Role != "editor") {
+		return nil
+	}
+	if index(s.notes, func(n database.Note) bool { return n.ID == arg.NoteID }) == -1 {
+		return foreignKeyViolation("note_teams", "note_teams_note_id_fkey")
+	}
+	if s.sharedWith(arg.NoteID, arg.ID) {
+		return uniqueViolation("note_teams", "note_teams_pkey")
+	}
+	s.noteTeams = append(s.noteTeams, database.NoteTeam{
+		NoteID:   arg.NoteID,
+		TeamID:   arg.ID,
+		SharedAt: s.now(),
+	})
+	return nil
+}
+
+func (s *Store) sharedWith(noteId, teamId uuid.UUID) bool {
+	return index(s.noteTeams, func(nt database.NoteTeam) bool { return nt.NoteID == noteId && nt.TeamID == teamId }) != -1
+}
+
+// Deletes the note itself, not only its sharing, when the caller is an admin of the team
+func (s *Store) RemoveNoteFromTeam(ctx context.Context, arg database.RemoveNoteFromTeamParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.member(arg.UserID, arg.TeamID)
+	if !ok || m.Role != "admin" || !s.sharedWith(arg.NoteID, arg.TeamID) {
+		return 0, nil
+	}
+	return s.deleteNotes(func(n database.Note) bool { return n.ID == arg.NoteID }), nil
+}
+
+// Team notes the user can see in the team
+func (s *Store) teamNotes(teamId, userId uuid.UUID) []database.Note {
+	if _, ok := s.member(userId, teamId); !ok {
+		return nil
+	}
+	return filter(s.notes, func(n database.Note) bool { return s.sharedWith(n.ID, teamId) })
+}
+
+func (s *Store) GetTeamNote(ctx context.Context, arg database.GetTeamNoteParams) (database.Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return first(s.teamNotes(arg.TeamID, arg.UserID), func(n database.Note) bool { return n.ID == arg.ID })
+}
+
+func (s *Store) GetTeamNotes(ctx context.Context, arg database.GetTeamNotesParams) ([]database.Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.teamNotes(arg.TeamID, arg.UserID), nil
+}
+
+func (s *Store) UpdateTeamNote(ctx context.Context, arg database.UpdateTeamNoteParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.member(arg.UserID, arg.TeamID)
+	if !ok || (m.Role != "admin" && m.Role != "editor") || !s.sharedWith(arg.ID, arg.TeamID) {
+		return 0, nil
+	}
+	i := index(s.notes, func(n database.Note) bool { return n.ID == arg.ID })
+	if i == -1 {
+		return 0, nil
+	}
+	s.notes[i].Body = arg.Body
+	s.notes[i].UpdatedAt = s.now()
+	return 1, nil
+}
@@ -0,0 +1,164 @@
+package memdb
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/F0RG-2142/capstone-1/internal/database"
+)
+
+func (s *Store) GetLoginThrottle(ctx context.Context, key string) (database.LoginThrottle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return first(s.throttles, func(t database.LoginThrottle) bool { return t.Key == key })
+}
+
+// sql.ErrNoRows while the key is blocked, like the conditional upsert returning nothing
+func (s *Store) RecordLoginAttempt(ctx context.Context, arg database.RecordLoginAttemptParams) (database.LoginThrottle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	i := index(s.throttles, func(t database.LoginThrottle) bool { return t.Key == arg.Key })
+	if i == -1 {
+		s.throttles = append(s.throttles, database.LoginThrottle{Key: arg.Key, CreatedAt: now})
+		i = len(s.throttles) - 1
+	} else if s.throttles[i].BlockedUntil.After(now) {
+		return database.LoginThrottle{}, sql.ErrNoRows
+	}
+	t := &s.throttles[i]
+	if t.Failures == 0 || t.LastFailureAt.Before(arg.WindowStart) && !t.Locked {
+		t.Failures = 1
+	} else {
+		t.Failures++
+	}
+	t.UpdatedAt = now
+	t.LastFailureAt = now
+	t.Locked = arg.LockoutAfter > 0 && t.Failures >= arg.LockoutAfter
+	t.BlockedUntil = now.Add(attemptDelay(arg, t.Failures))
+	return *t, nil
+}
+
+// Block after failures, the CASE of RecordLoginAttempt
+func attemptDelay(arg database.RecordLoginAttemptParams, failures int32) time.Duration {
+	seconds := 0.0
+	switch {
+	case arg.LockoutAfter > 0 && failures >= arg.LockoutAfter:
+		seconds = arg.LockoutSeconds
+	case failures > arg.FreeAttempts:
+		seconds = min(arg.BaseDelaySeconds*math.Pow(2, float64(min(failures-arg.FreeAttempts-1, 60))), arg.MaxDelaySeconds)
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+func (s *Store) RefundLoginAttempt(ctx context.Context, arg database.RefundLoginAttemptParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := index(s.throttles, func(t database.LoginThrottle) bool { return t.Key == arg.Key }); i != -1 {
+		t := &s.throttles[i]
+		t.UpdatedAt = s.now()
+		if t.Failures == arg.Failures {
+			t.BlockedUntil = t.UpdatedAt
+			t.Locked = arg.Locked
+		}
+		t.Failures = max(t.Failures-1, 0)
+	}
+	return nil
+}
+
+func (s *Store) ClearLoginThrottle(ctx context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cleared := count(s.throttles, func(t database.LoginThrottle) bool { return t.Key == key })
+	s.throttles = slices.DeleteFunc(s.throttles, func(t database.LoginThrottle) bool { return t.Key == key })
+	s.unlockTokens = slices.DeleteFunc(s.unlockTokens, func(t database.UnlockToken) bool { return t.ThrottleKey == key })
+	return cleared, nil
+}
+
+func (s *Store) GetBlockedLoginThrottles(ctx context.Context) ([]database.LoginThrottle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	blocked := filter(s.throttles, func(t database.LoginThrottle) bool { return t.BlockedUntil.After(now) || t.Locked })
+	slices.SortStableFunc(blocked, func(a, b database.LoginThrottle) int { return b.UpdatedAt.Compare(a.UpdatedAt) })
+	return blocked, nil
+}
+
+func (s *Store) NewUnlockToken(ctx context.Context, arg database.NewUnlockTokenParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if index(s.throttles, func(t database.LoginThrottle) bool { return t.Key == arg.ThrottleKey }) == -1 {
+		return foreignKeyViolation("unlock_tokens", "unlock_tokens_throttle_key_fkey")
+	}
+	if index(s.unlockTokens, func(t database.UnlockToken) bool { return t.TokenHash == arg.TokenHash }) != -1 {
+		return uniqueViolation("unlock_tokens", "unlock_tokens_pkey")
+	}
+	now := s.now()
+	s.unlockTokens = append(s.unlockTokens, database.UnlockToken{
+		TokenHash:   arg.TokenHash,
+		CreatedAt:   now,
+		ThrottleKey: arg.ThrottleKey,
+		ExpiresAt:   now.Add(24 * time.Hour),
+	})
+	return nil
+}
+
+func (s *Store) ConsumeUnlockToken(ctx context.Context, tokenHash string) (database.UnlockToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	match := func(t database.UnlockToken) bool { return t.TokenHash == tokenHash && t.ExpiresAt.After(now) }
+	token, err := first(s.unlockTokens, match)
+	if err != nil {
+		return token, err
+	}
+	s.unlockTokens = slices.DeleteFunc(s.unlockTokens, match)
+	return token, nil
+}
+
+// Tokens in the bucket after refilling it up to now
+func refilled(b database.RateLimit, burst, rate float64, now time.Time) float64 {
+	elapsed := max(now.Sub(b.UpdatedAt).Seconds(), 0)
+	return min(burst, b.Tokens+elapsed*rate)
+}
+
+// sql.ErrNoRows when the bucket is empty, like the conditional upsert returning nothing
+func (s *Store) TakeRateLimitToken(ctx context.Context, arg database.TakeRateLimitTokenParams) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	i := index(s.rateLimits, func(b database.RateLimit) bool { return b.Key == arg.Key })
+	if i == -1 {
+		s.rateLimits = append(s.rateLimits, database.RateLimit{Key: arg.Key, Tokens: arg.Burst - 1, UpdatedAt: now})
+		return arg.Burst - 1, nil
+	}
+	tokens := refilled(s.rateLimits[i], arg.Burst, arg.Rate, now)
+	if tokens < 1 {
+		return 0, sql.ErrNoRows
+	}
+	s.rateLimits[i].Tokens = tokens - 1
+	s.rateLimits[i].UpdatedAt = now
+	return tokens - 1, nil
+}
+
+func (s *Store) PeekRateLimitTokens(ctx context.Context, arg database.PeekRateLimitTokensParams) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := first(s.rateLimits, func(b database.RateLimit) bool { return b.Key == arg.Key })
+	if err != nil {
+		return 0, err
+	}
+	return refilled(b, arg.Burst, arg.Rate, s.now()), nil
+}
+
+func (s *Store) DeleteIdleRateLimits(ctx context.Context, idleSeconds float64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cutoff := s.now().Add(-time.Duration(idleSeconds * float64(time.Second)))
+	idle := func(b database.RateLimit) bool { return b.UpdatedAt.Before(cutoff) }
+	deleted := count(s.rateLimits, idle)
+	s.rateLimits = slices.DeleteFunc(s.rateLimits, idle)
+	return deleted, nil
+}
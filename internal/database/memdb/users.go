@@ -0,0 +1,285 @@
+package memdb
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/F0RG-2142/capstone-1/internal/database"
+	"github.com/google/uuid"
+)
+
+func (s *Store) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	u := database.User{
+		ID:             uuid.New(),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+	}
+	s.users = append(s.users, u)
+	return u, nil
+}
+
+func (s *Store) CreateExternalUser(ctx context.Context, email string) (database.User, error) {
+	return s.CreateUser(ctx, database.CreateUserParams{Email: email, HashedPassword: "unset"})
+}
+
+func (s *Store) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deleteUsers(func(u database.User) bool { return u.ID == id })
+}
+
+func (s *Store) DeleteAllUsers(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deleteUsers(func(database.User) bool { return true })
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return first(s.users, func(u database.User) bool { return u.Email == email })
+}
+
+func (s *Store) GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return first(s.users, func(u database.User) bool { return u.ID == id })
+}
+
+func (s *Store) updateUser(id uuid.UUID, update func(*database.User)) {
+	if i := index(s.users, func(u database.User) bool { return u.ID == id }); i != -1 {
+		update(&s.users[i])
+	}
+}
+
+func (s *Store) UpdateUser(ctx context.Context, arg database.UpdateUserParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updateUser(arg.ID, func(u *database.User) {
+		u.UpdatedAt = s.now()
+		u.Email = arg.Email
+		u.HashedPassword = arg.HashedPassword
+	})
+	return nil
+}
+
+func (s *Store) GivePremium(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updateUser(id, func(u *database.User) { u.HasNotesPremium = true })
+	return nil
+}
+
+func (s *Store) SetPremium(ctx context.Context, arg database.SetPremiumParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updateUser(arg.ID, func(u *database.User) {
+		u.UpdatedAt = s.now()
+		u.HasNotesPremium = arg.HasNotesPremium
+	})
+	return nil
+}
+
+func (s *Store) NewRefreshToken(ctx context.Context, arg database.NewRefreshTokenParams) (database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.userExists(arg.UserID) {
+		return database.RefreshToken{}, foreignKeyViolation("refresh_tokens", "refresh_tokens_user_id_fkey")
+	}
+	if index(s.refreshTokens, func(t database.RefreshToken) bool { return t.Token == arg.Token }) != -1 {
+		return database.RefreshToken{}, uniqueViolation("refresh_tokens", "refresh_tokens_pkey")
+	}
+	now := s.now()
+	t := database.RefreshToken{
+		Token:     arg.Token,
+		CreatedAt: now,
+		UpdatedAt: now,
+		UserID:    arg.UserID,
+		ExpiresAt: now.Add(60 * 24 * time.Hour),
+	}
+	s.refreshTokens = append(s.refreshTokens, t)
+	return t, nil
+}
+
+func (s *Store) GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return first(s.refreshTokens, func(t database.RefreshToken) bool { return t.Token == token })
+}
+
+func (s *Store) RevokeRefreshToken(ctx context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := index(s.refreshTokens, func(t database.RefreshToken) bool { return t.Token == token }); i != -1 {
+		now := s.now()
+		s.refreshTokens[i].UpdatedAt = now
+		s.refreshTokens[i].RevokedAt = nullTime(now)
+	}
+	return nil
+}
+
+func (s *Store) NewUserIdentity(ctx context.Context, arg database.NewUserIdentityParams) (database.UserIdentity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.userExists(arg.UserID) {
+		return database.UserIdentity{}, foreignKeyViolation("user_identities", "user_identities_user_id_fkey")
+	}
+	taken := func(i database.UserIdentity) bool { return i.Provider == arg.Provider && i.Subject == arg.Subject }
+	if index(s.identities, taken) != -1 {
+		return database.UserIdentity{}, uniqueViolation("user_identities", "user_identities_provider_subject_key")
+	}
+	now := s.now()
+	identity := database.UserIdentity{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		UserID:    arg.UserID,
+		Provider:  arg.Provider,
+		Subject:   arg.Subject,
+		Email:     arg.Email,
+	}
+	s.identities = append(s.identities, identity)
+	return identity, nil
+}
+
+func (s *Store) GetUserIdentity(ctx context.Context, arg database.GetUserIdentityParams) (database.UserIdentity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return first(s.identities, func(i database.UserIdentity) bool { return i.Provider == arg.Provider && i.Subject == arg.Subject })
+}
+
+func (s *Store) NewOIDCLoginState(ctx context.Context, arg database.NewOIDCLoginStateParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if index(s.oidcStates, func(st database.OidcLoginState) bool { return st.State == arg.State }) != -1 {
+		return uniqueViolation("oidc_login_states", "oidc_login_states_pkey")
+	}
+	if arg.LinkUserID.Valid && !s.userExists(arg.LinkUserID.UUID) {
+		return foreignKeyViolation("oidc_login_states", "oidc_login_states_link_user_id_fkey")
+	}
+	now := s.now()
+	s.oidcStates = append(s.oidcStates, database.OidcLoginState{
+		State:        arg.State,
+		CreatedAt:    now,
+		Provider:     arg.Provider,
+		Nonce:        arg.Nonce,
+		CodeVerifier: arg.CodeVerifier,
+		ExpiresAt:    now.Add(10 * time.Minute),
+		LinkUserID:   arg.LinkUserID,
+	})
+	return nil
+}
+
+func (s *Store) ConsumeOIDCLoginState(ctx context.Context, arg database.ConsumeOIDCLoginStateParams) (database.OidcLoginState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	match := func(st database.OidcLoginState) bool {
+		return st.State == arg.State && st.Provider == arg.Provider && st.ExpiresAt.After(now)
+	}
+	state, err := first(s.oidcStates, match)
+	if err != nil {
+		return state, err
+	}
+	s.oidcStates = slices.DeleteFunc(s.oidcStates, match)
+	return state, nil
+}
+
+func (s *Store) DeleteExpiredOIDCLoginStates(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.oidcStates = slices.DeleteFunc(s.oidcStates, func(st database.OidcLoginState) bool { return !st.ExpiresAt.After(now) })
+	return nil
+}
+
+func (s *Store) NewAPIToken(ctx context.Context, arg database.NewAPITokenParams) (database.ApiToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.userExists(arg.UserID) {
+		return database.ApiToken{}, foreignKeyViolation("api_tokens", "api_tokens_user_id_fkey")
+	}
+	if index(s.apiTokens, func(t database.ApiToken) bool { return t.TokenHash == arg.TokenHash }) != -1 {
+		return database.ApiToken{}, uniqueViolation("api_tokens", "api_tokens_token_hash_key")
+	}
+	now := s.now()
+	t := database.ApiToken{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		UserID:    arg.UserID,
+		Name:      arg.Name,
+		TokenHash: arg.TokenHash,
+		TokenHint: arg.TokenHint,
+		Scopes:    slices.Clone(arg.Scopes),
+		ExpiresAt: arg.ExpiresAt,
+	}
+	s.apiTokens = append(s.apiTokens, t)
+	return apiToken(t), nil
+}
+
+// Copy that doesn't share the scopes with the stored row
+func apiToken(t database.ApiToken) database.ApiToken {
+	t.Scopes = slices.Clone(t.Scopes)
+	return t
+}
+
+func (s *Store) GetAPITokenByHash(ctx context.Context, tokenHash string) (database.ApiToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := first(s.apiTokens, func(t database.ApiToken) bool { return t.TokenHash == tokenHash })
+	return apiToken(t), err
+}
+
+func (s *Store) GetAPITokens(ctx context.Context, userID uuid.UUID) ([]database.ApiToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens := filter(s.apiTokens, func(t database.ApiToken) bool { return t.UserID == userID })
+	for i := range tokens {
+		tokens[i] = apiToken(tokens[i])
+	}
+	slices.SortStableFunc(tokens, func(a, b database.ApiToken) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return tokens, nil
+}
+
+func (s *Store) RevokeAPIToken(ctx context.Context, arg database.RevokeAPITokenParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var revoked int64
+	now := s.now()
+	for i, t := range s.apiTokens {
+		if t.ID == arg.ID && t.UserID == arg.UserID && !t.RevokedAt.Valid {
+			s.apiTokens[i].UpdatedAt = now
+			s.apiTokens[i].RevokedAt = nullTime(now)
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+func (s *Store) TouchAPIToken(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for i, t := range s.apiTokens {
+		if t.ID == id && (!t.LastUsedAt.Valid || t.LastUsedAt.Time.Before(now.Add(-time.Minute))) {
+			s.apiTokens[i].LastUsedAt = nullTime(now)
+		}
+	}
+	return nil
+}
+
+func (s *Store) CountActiveAPITokens(ctx context.Context, userID uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	return count(s.apiTokens, func(t database.ApiToken) bool {
+		return t.UserID == userID && !t.RevokedAt.Valid && (!t.ExpiresAt.Valid || t.ExpiresAt.Time.After(now))
+	}), nil
+}
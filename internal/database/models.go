@@ -6,11 +6,36 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type ApiToken struct {
+	ID         uuid.UUID    `json:"token_id"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+	UserID     uuid.UUID    `json:"user_id"`
+	Name       string       `json:"name"`
+	TokenHash  string       `json:"-"`
+	TokenHint  string       `json:"token_hint"`
+	Scopes     []string     `json:"scopes"`
+	ExpiresAt  sql.NullTime `json:"expires_at"`
+	LastUsedAt sql.NullTime `json:"last_used_at"`
+	RevokedAt  sql.NullTime `json:"revoked_at"`
+}
+
+type LoginThrottle struct {
+	Key           string    `json:"key"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Failures      int32     `json:"failures"`
+	LastFailureAt time.Time `json:"last_failure_at"`
+	BlockedUntil  time.Time `json:"blocked_until"`
+	Locked        bool      `json:"locked"`
+}
+
 type Note struct {
 	ID        uuid.UUID `json:"note_id"`
 	Name      string    `json:"note_name"`
@@ -26,6 +51,34 @@ type NoteTeam struct {
 	SharedAt time.Time `json:"shared_at"`
 }
 
+type OidcLoginState struct {
+	State        string        `json:"state"`
+	CreatedAt    time.Time     `json:"created_at"`
+	Provider     string        `json:"provider"`
+	Nonce        string        `json:"nonce"`
+	CodeVerifier string        `json:"code_verifier"`
+	ExpiresAt    time.Time     `json:"expires_at"`
+	LinkUserID   uuid.NullUUID `json:"link_user_id"`
+}
+
+type PaymentEvent struct {
+	ID          string          `json:"event_id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	EventType   string          `json:"event_type"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int32           `json:"attempts"`
+	ProcessedAt sql.NullTime    `json:"processed_at"`
+	LastError   sql.NullString  `json:"last_error"`
+}
+
+type RateLimit struct {
+	Key       string    `json:"key"`
+	Tokens    float64   `json:"tokens"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
 type RefreshToken struct {
 	Token     string       `json:"refresh_token"`
 	CreatedAt time.Time    `json:"created_at"`
@@ -35,6 +88,20 @@ type RefreshToken struct {
 	RevokedAt sql.NullTime `json:"revoked_at"`
 }
 
+type Subscription struct {
+	ID                     uuid.UUID      `json:"subscription_id"`
+	CreatedAt              time.Time      `json:"created_at"`
+	UpdatedAt              time.Time      `json:"updated_at"`
+	UserID                 uuid.UUID      `json:"user_id"`
+	ProviderSubscriptionID sql.NullString `json:"provider_subscription_id"`
+	Plan                   string         `json:"plan"`
+	Status                 string         `json:"status"`
+	CurrentPeriodEnd       time.Time      `json:"current_period_end"`
+	GracePeriodEnd         sql.NullTime   `json:"grace_period_end"`
+	CancelAtPeriodEnd      bool           `json:"cancel_at_period_end"`
+	CanceledAt             sql.NullTime   `json:"canceled_at"`
+}
+
 type Team struct {
 	ID        uuid.UUID `json:"team_id"`
 	CreatedAt time.Time `json:"created_at"`
@@ -44,6 +111,27 @@ type Team struct {
 	IsPrivate bool      `json:"is_private"`
 }
 
+type TeamSubscription struct {
+	ID                     uuid.UUID      `json:"subscription_id"`
+	CreatedAt              time.Time      `json:"created_at"`
+	UpdatedAt              time.Time      `json:"updated_at"`
+	TeamID                 uuid.UUID      `json:"team_id"`
+	ProviderSubscriptionID sql.NullString `json:"provider_subscription_id"`
+	Plan                   string         `json:"plan"`
+	Status                 string         `json:"status"`
+	Seats                  int32          `json:"seats"`
+	CurrentPeriodEnd       time.Time      `json:"current_period_end"`
+	GracePeriodEnd         sql.NullTime   `json:"grace_period_end"`
+	CanceledAt             sql.NullTime   `json:"canceled_at"`
+}
+
+type UnlockToken struct {
+	TokenHash   string    `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	ThrottleKey string    `json:"throttle_key"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
 type User struct {
 	ID              uuid.UUID `json:"user_id"`
 	CreatedAt       time.Time `json:"created_at"`
@@ -53,6 +141,16 @@ type User struct {
 	HasNotesPremium bool      `json:"has_premium"`
 }
 
+type UserIdentity struct {
+	ID        uuid.UUID `json:"identity_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uuid.UUID `json:"user_id"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+}
+
 type UserTeam struct {
 	UserID   uuid.UUID `json:"user_id"`
 	TeamID   uuid.UUID `json:"team_id"`
@@ -11,7 +11,18 @@ import (
 	"github.com/google/uuid"
 )
 
-const deleteNote = `-- name: DeleteNote :exec
+const countNotes = `-- name: CountNotes :one
+SELECT COUNT(*) FROM notes WHERE user_id = $1
+`
+
+func (q *Queries) CountNotes(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countNotes, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const deleteNote = `-- name: DeleteNote :execrows
 DELETE FROM notes WHERE id = $1 AND user_id = $2
 `
 
@@ -20,9 +31,12 @@ type DeleteNoteParams struct {
 	UserID uuid.UUID
 }
 
-func (q *Queries) DeleteNote(ctx context.Context, arg DeleteNoteParams) error {
-	_, err := q.db.ExecContext(ctx, deleteNote, arg.ID, arg.UserID)
-	return err
+func (q *Queries) DeleteNote(ctx context.Context, arg DeleteNoteParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteNote, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 const getAllNotes = `-- name: GetAllNotes :many
@@ -53,7 +53,29 @@ func (q *Queries) AddUserToTeam(ctx context.Context, arg AddUserToTeamParams) er
 	return err
 }
 
-const deleteTeam = `-- name: DeleteTeam :exec
+const countTeamMembers = `-- name: CountTeamMembers :one
+SELECT COUNT(*) FROM user_teams WHERE team_id = $1
+`
+
+func (q *Queries) CountTeamMembers(ctx context.Context, teamID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countTeamMembers, teamID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countTeamsCreated = `-- name: CountTeamsCreated :one
+SELECT COUNT(*) FROM teams WHERE created_by = $1
+`
+
+func (q *Queries) CountTeamsCreated(ctx context.Context, createdBy uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countTeamsCreated, createdBy)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const deleteTeam = `-- name: DeleteTeam :execrows
 DELETE FROM Teams t
 USING User_Teams ut
 WHERE t.id = ut.team_id
@@ -67,9 +89,12 @@ type DeleteTeamParams struct {
 	ID     uuid.UUID
 }
 
-func (q *Queries) DeleteTeam(ctx context.Context, arg DeleteTeamParams) error {
-	_, err := q.db.ExecContext(ctx, deleteTeam, arg.UserID, arg.ID)
-	return err
+func (q *Queries) DeleteTeam(ctx context.Context, arg DeleteTeamParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteTeam, arg.UserID, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 const getAllTeams = `-- name: GetAllTeams :many
@@ -109,6 +134,24 @@ func (q *Queries) GetAllTeams(ctx context.Context, userID uuid.UUID) ([]Team, er
 	return items, nil
 }
 
+const getLargestCreatedTeamSize = `-- name: GetLargestCreatedTeamSize :one
+SELECT COALESCE(MAX(member_count), 0)::bigint
+FROM (
+    SELECT COUNT(ut.user_id) AS member_count
+    FROM teams t
+    LEFT JOIN user_teams ut ON t.id = ut.team_id
+    WHERE t.created_by = $1
+    GROUP BY t.id
+) AS team_sizes
+`
+
+func (q *Queries) GetLargestCreatedTeamSize(ctx context.Context, createdBy uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, getLargestCreatedTeamSize, createdBy)
+	var column_1 int64
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
 const getTeamById = `-- name: GetTeamById :one
 SELECT t.id, t.created_at, t.updated_at, t.team_name, t.created_by, t.is_private
 FROM Teams t
@@ -135,6 +178,20 @@ func (q *Queries) GetTeamById(ctx context.Context, arg GetTeamByIdParams) (Team,
 	return i, err
 }
 
+const getTeamCreatorPremium = `-- name: GetTeamCreatorPremium :one
+SELECT u.has_notes_premium
+FROM teams t
+JOIN users u ON u.id = t.created_by
+WHERE t.id = $1
+`
+
+func (q *Queries) GetTeamCreatorPremium(ctx context.Context, id uuid.UUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, getTeamCreatorPremium, id)
+	var has_notes_premium bool
+	err := row.Scan(&has_notes_premium)
+	return has_notes_premium, err
+}
+
 const getTeamMember = `-- name: GetTeamMember :one
 SELECT user_id, team_id, role, joined_at FROM User_Teams WHERE user_id = $1 AND team_id = $2
 `
@@ -157,25 +214,23 @@ func (q *Queries) GetTeamMember(ctx context.Context, arg GetTeamMemberParams) (U
 }
 
 const getTeamMembers = `-- name: GetTeamMembers :many
-SELECT id, created_at, updated_at, team_name, created_by, is_private FROM teams WHERE id = $1
+SELECT user_id, team_id, role, joined_at FROM user_teams WHERE team_id = $1 ORDER BY joined_at ASC
 `
 
-func (q *Queries) GetTeamMembers(ctx context.Context, id uuid.UUID) ([]Team, error) {
-	rows, err := q.db.QueryContext(ctx, getTeamMembers, id)
+func (q *Queries) GetTeamMembers(ctx context.Context, teamID uuid.UUID) ([]UserTeam, error) {
+	rows, err := q.db.QueryContext(ctx, getTeamMembers, teamID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Team
+	var items []UserTeam
 	for rows.Next() {
-		var i Team
+		var i UserTeam
 		if err := rows.Scan(
-			&i.ID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.TeamName,
-			&i.CreatedBy,
-			&i.IsPrivate,
+			&i.UserID,
+			&i.TeamID,
+			&i.Role,
+			&i.JoinedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -264,16 +319,23 @@ func (q *Queries) GetTeamNotes(ctx context.Context, arg GetTeamNotesParams) ([]N
 	return items, nil
 }
 
-const newTeam = `-- name: NewTeam :exec
-INSERT INTO teams (id, created_at, updated_at, team_name, created_by, is_private)
-VALUES(
-    gen_random_uuid (),
-    NOW(),
-    NOW(),
-    $1,
-    $2,
-    $3
+const newTeam = `-- name: NewTeam :one
+WITH team AS (
+    INSERT INTO teams (id, created_at, updated_at, team_name, created_by, is_private)
+    VALUES(
+        gen_random_uuid (),
+        NOW(),
+        NOW(),
+        $1,
+        $2,
+        $3
+    )
+    RETURNING id, created_at, updated_at, team_name, created_by, is_private
+), creator AS (
+    INSERT INTO user_teams (user_id, team_id, role, joined_at)
+    SELECT created_by, id, 'admin', NOW() FROM team
 )
+SELECT id, created_at, updated_at, team_name, created_by, is_private FROM team
 `
 
 type NewTeamParams struct {
@@ -282,29 +344,44 @@ type NewTeamParams struct {
 	IsPrivate bool
 }
 
-func (q *Queries) NewTeam(ctx context.Context, arg NewTeamParams) error {
-	_, err := q.db.ExecContext(ctx, newTeam, arg.TeamName, arg.CreatedBy, arg.IsPrivate)
-	return err
+// Creates the team and makes its creator an admin in one statement, so a team never ends up without one
+func (q *Queries) NewTeam(ctx context.Context, arg NewTeamParams) (Team, error) {
+	row := q.db.QueryRowContext(ctx, newTeam, arg.TeamName, arg.CreatedBy, arg.IsPrivate)
+	var i Team
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TeamName,
+		&i.CreatedBy,
+		&i.IsPrivate,
+	)
+	return i, err
 }
 
-const removeNoteFromTeam = `-- name: RemoveNoteFromTeam :exec
+const removeNoteFromTeam = `-- name: RemoveNoteFromTeam :execrows
 DELETE FROM Notes n
 USING Note_Teams nt
 JOIN User_Teams ut ON nt.team_id = ut.team_id
 WHERE n.id = nt.note_id
 AND nt.note_id = $1
-AND ut.user_id = $2
+AND nt.team_id = $2
+AND ut.user_id = $3
 AND ut.role = 'admin'
 `
 
 type RemoveNoteFromTeamParams struct {
 	NoteID uuid.UUID
+	TeamID uuid.UUID
 	UserID uuid.UUID
 }
 
-func (q *Queries) RemoveNoteFromTeam(ctx context.Context, arg RemoveNoteFromTeamParams) error {
-	_, err := q.db.ExecContext(ctx, removeNoteFromTeam, arg.NoteID, arg.UserID)
-	return err
+func (q *Queries) RemoveNoteFromTeam(ctx context.Context, arg RemoveNoteFromTeamParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, removeNoteFromTeam, arg.NoteID, arg.TeamID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 const removeUserFromTeam = `-- name: RemoveUserFromTeam :exec
@@ -321,7 +398,7 @@ func (q *Queries) RemoveUserFromTeam(ctx context.Context, arg RemoveUserFromTeam
 	return err
 }
 
-const updateTeamNote = `-- name: UpdateTeamNote :exec
+const updateTeamNote = `-- name: UpdateTeamNote :execrows
 UPDATE Notes n
 SET body = $1, updated_at = NOW()
 FROM Note_Teams nt
@@ -330,6 +407,7 @@ WHERE n.id = nt.note_id
 AND n.id = $2
 AND nt.team_id = $3
 AND ut.user_id = $4
+AND ut.role IN ('admin', 'editor')
 `
 
 type UpdateTeamNoteParams struct {
@@ -339,12 +417,15 @@ type UpdateTeamNoteParams struct {
 	UserID uuid.UUID
 }
 
-func (q *Queries) UpdateTeamNote(ctx context.Context, arg UpdateTeamNoteParams) error {
-	_, err := q.db.ExecContext(ctx, updateTeamNote,
+func (q *Queries) UpdateTeamNote(ctx context.Context, arg UpdateTeamNoteParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateTeamNote,
 		arg.Body,
 		arg.ID,
 		arg.TeamID,
 		arg.UserID,
 	)
-	return err
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
@@ -11,6 +11,31 @@ import (
 	"github.com/google/uuid"
 )
 
+const createExternalUser = `-- name: CreateExternalUser :one
+INSERT INTO users (id, created_at, updated_at, email)
+VALUES (
+    gen_random_uuid (),
+    NOW(),
+    NOW(),
+    $1
+)
+RETURNING id, created_at, updated_at, email, hashed_password, has_notes_premium
+`
+
+func (q *Queries) CreateExternalUser(ctx context.Context, email string) (User, error) {
+	row := q.db.QueryRowContext(ctx, createExternalUser, email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.HasNotesPremium,
+	)
+	return i, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, created_at, updated_at, email, hashed_password)
 VALUES (
@@ -78,6 +103,24 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 	return i, err
 }
 
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, has_notes_premium FROM users WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.HasNotesPremium,
+	)
+	return i, err
+}
+
 const givePremium = `-- name: GivePremium :exec
 UPDATE users
 SET 
@@ -91,6 +134,25 @@ func (q *Queries) GivePremium(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const setPremium = `-- name: SetPremium :exec
+UPDATE users
+SET
+    updated_at = NOW(),
+    has_notes_premium = $2
+WHERE
+    id = $1
+`
+
+type SetPremiumParams struct {
+	ID              uuid.UUID
+	HasNotesPremium bool
+}
+
+func (q *Queries) SetPremium(ctx context.Context, arg SetPremiumParams) error {
+	_, err := q.db.ExecContext(ctx, setPremium, arg.ID, arg.HasNotesPremium)
+	return err
+}
+
 const updateUser = `-- name: UpdateUser :exec
 UPDATE users
 SET
@@ -0,0 +1,110 @@
+package entitlements
+
+import (
+	"fmt"
+	"maps"
+)
+
+// Names of the limits, used in error responses and the usage endpoint
+const (
+	LimitNotes             = "max_notes"
+	LimitTeamsCreated      = "max_teams_created"
+	LimitTeamMembers       = "max_team_members"
+	LimitAttachmentStorage = "attachment_storage_bytes"
+	LimitRevisionHistory   = "revision_history_depth"
+	LimitAPITokens         = "max_api_tokens"
+)
+
+// All limit names in the order they are reported
+var LimitNames = []string{
+	LimitNotes,
+	LimitTeamsCreated,
+	LimitTeamMembers,
+	LimitAttachmentStorage,
+	LimitRevisionHistory,
+	LimitAPITokens,
+}
+
+// Value of a limit that doesn't apply
+const Unlimited int64 = -1
+
+// What a plan allows. Team members are counted per team and limited by the seats of the team's
+// subscription, or by the plan of the team's creator when the team has none
+type Limits struct {
+	Plan   string
+	values map[string]int64
+}
+
+var Free = Limits{Plan: "free", values: map[string]int64{
+	LimitNotes:             100,
+	LimitTeamsCreated:      1,
+	LimitTeamMembers:       5,
+	LimitAttachmentStorage: 100 << 20,
+	LimitRevisionHistory:   10,
+	LimitAPITokens:         2,
+}}
+
+var Premium = Limits{Plan: "premium", values: map[string]int64{
+	LimitNotes:             Unlimited,
+	LimitTeamsCreated:      25,
+	LimitTeamMembers:       100,
+	LimitAttachmentStorage: 10 << 30,
+	LimitRevisionHistory:   Unlimited,
+	LimitAPITokens:         25,
+}}
+
+// Limits inside a team with a paid team subscription: premium limits, with the team's size
+// limited to the seats bought
+func ForTeam(seats int64) Limits {
+	values := maps.Clone(Premium.values)
+	values[LimitTeamMembers] = seats
+	return Limits{Plan: "team", values: values}
+}
+
+func ForPremium(premium bool) Limits {
+	if premium {
+		return Premium
+	}
+	return Free
+}
+
+// Value of the named limit, Unlimited if the plan doesn't limit it
+func (l Limits) Get(name string) int64 {
+	v, ok := l.values[name]
+	if !ok {
+		return Unlimited
+	}
+	return v
+}
+
+// Returned when an action would go over a plan limit
+type ExceededError struct {
+	Limit string
+	Max   int64
+	Plan  string
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%s plan limit %s (%d) reached", e.Plan, e.Limit, e.Max)
+}
+
+// Checks that adding n to current stays within the named limit
+func (l Limits) Check(name string, current, n int64) error {
+	max := l.Get(name)
+	if max == Unlimited || current+n <= max {
+		return nil
+	}
+	return &ExceededError{Limit: name, Max: max, Plan: l.Plan}
+}
+
+// Whether upgrading to premium (or buying more seats for a team) would raise the named limit
+func (l Limits) CanUpgrade(name string) bool {
+	if l.Plan == "team" {
+		return name == LimitTeamMembers
+	}
+	if l.Plan == Premium.Plan {
+		return false
+	}
+	premium := Premium.Get(name)
+	return premium == Unlimited || premium > l.Get(name)
+}
@@ -0,0 +1,57 @@
+package entitlements
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		limits      Limits
+		limit       string
+		current     int64
+		expectError bool
+	}{
+		{name: "Below Limit", limits: Free, limit: LimitNotes, current: 10},
+		{name: "Last One Allowed", limits: Free, limit: LimitNotes, current: 99},
+		{name: "At Limit", limits: Free, limit: LimitNotes, current: 100, expectError: true},
+		{name: "Unlimited", limits: Premium, limit: LimitNotes, current: 1_000_000},
+		{name: "Premium At Limit", limits: Premium, limit: LimitAPITokens, current: 25, expectError: true},
+		{name: "Unknown Limit", limits: Free, limit: "max_unknown", current: 1_000_000},
+		{name: "Team Seats Left", limits: ForTeam(10), limit: LimitTeamMembers, current: 9},
+		{name: "Team Seats Used Up", limits: ForTeam(10), limit: LimitTeamMembers, current: 10, expectError: true},
+		{name: "Team Inherits Premium", limits: ForTeam(10), limit: LimitNotes, current: 1_000_000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.limits.Check(tt.limit, tt.current, 1)
+			if !tt.expectError {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			var exceeded *ExceededError
+			if !errors.As(err, &exceeded) {
+				t.Fatalf("expected an ExceededError, got %v", err)
+			}
+			if exceeded.Limit != tt.limit || exceeded.Plan != tt.limits.Plan {
+				t.Errorf("unexpected error details %+v", exceeded)
+			}
+		})
+	}
+}
+
+func TestCanUpgrade(t *testing.T) {
+	if !Free.CanUpgrade(LimitNotes) {
+		t.Error("free users should be able to upgrade for more notes")
+	}
+	if Premium.CanUpgrade(LimitNotes) {
+		t.Error("premium users have nothing to upgrade to")
+	}
+	if !ForTeam(10).CanUpgrade(LimitTeamMembers) {
+		t.Error("teams should be able to buy more seats")
+	}
+}
@@ -0,0 +1,94 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Timeout for a check that doesn't set one
+const DefaultTimeout = 2 * time.Second
+
+// A dependency or piece of internal state readiness depends on
+type Check struct {
+	Name    string
+	Timeout time.Duration
+	// Returns an error when the check fails. The message ends up in the probe response, so it
+	// must not contain connection strings or other internals
+	Run func(ctx context.Context) error
+}
+
+type Result struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+func (r Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+// Runs every check concurrently, each under its own timeout. Results keep the order of checks
+func Run(ctx context.Context, checks []Check) Report {
+	report := Report{Status: StatusOK, Checks: make([]Result, len(checks))}
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = run(ctx, check)
+		}()
+	}
+	wg.Wait()
+	for _, result := range report.Checks {
+		if result.Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+func run(ctx context.Context, check Check) Result {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	errc := make(chan error, 1)
+	//a check that ignores ctx still can't hold up the probe
+	go func() {
+		errc <- check.Run(ctx)
+	}()
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	result := Result{
+		Name:      check.Name,
+		Status:    StatusOK,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+		if ctx.Err() == context.DeadlineExceeded {
+			result.Error = "timed out after " + timeout.String()
+		}
+	}
+	return result
+}
@@ -0,0 +1,61 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	ok := func(ctx context.Context) error { return nil }
+	failing := func(ctx context.Context) error { return errors.New("database unreachable") }
+	stuck := func(ctx context.Context) error { time.Sleep(time.Second); return nil }
+
+	tests := []struct {
+		name           string
+		checks         []Check
+		expectedStatus string
+		expectedChecks []string
+		expectedErrors []string
+	}{
+		{
+			name:           "All Pass",
+			checks:         []Check{{Name: "a", Run: ok}, {Name: "b", Run: ok}},
+			expectedStatus: StatusOK,
+			expectedChecks: []string{StatusOK, StatusOK},
+			expectedErrors: []string{"", ""},
+		},
+		{
+			name:           "One Fails",
+			checks:         []Check{{Name: "a", Run: ok}, {Name: "b", Run: failing}},
+			expectedStatus: StatusFail,
+			expectedChecks: []string{StatusOK, StatusFail},
+			expectedErrors: []string{"", "database unreachable"},
+		},
+		{
+			name:           "Timeout",
+			checks:         []Check{{Name: "a", Timeout: 10 * time.Millisecond, Run: stuck}},
+			expectedStatus: StatusFail,
+			expectedChecks: []string{StatusFail},
+			expectedErrors: []string{"timed out after 10ms"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := Run(context.Background(), tt.checks)
+			if report.Status != tt.expectedStatus {
+				t.Errorf("expected status %s, got %s", tt.expectedStatus, report.Status)
+			}
+			for i, result := range report.Checks {
+				if result.Name != tt.checks[i].Name {
+					t.Errorf("expected check %s at %d, got %s", tt.checks[i].Name, i, result.Name)
+				}
+				if result.Status != tt.expectedChecks[i] || result.Error != tt.expectedErrors[i] {
+					t.Errorf("expected %s %q, got %s %q", tt.expectedChecks[i], tt.expectedErrors[i], result.Status, result.Error)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package lockout
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// How failed logins are throttled for one key (an account or a client IP)
+type Policy struct {
+	// Failures allowed before any delay is enforced
+	FreeAttempts int
+	// Delay after the first throttled failure, doubled for every failure after that
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Failures after which a CAPTCHA must be solved (0 disables)
+	CaptchaAfter int
+	// Failures after which the key is locked for LockoutFor (0 disables)
+	LockoutAfter int
+	LockoutFor   time.Duration
+	// Failures older than this are forgotten
+	Window time.Duration
+}
+
+var AccountPolicy = Policy{
+	FreeAttempts: 3,
+	BaseDelay:    time.Second,
+	MaxDelay:     5 * time.Minute,
+	CaptchaAfter: 3,
+	LockoutAfter: 10,
+	LockoutFor:   time.Hour,
+	Window:       time.Hour,
+}
+
+// IPs get more attempts since many users can share one (offices, NAT), but no unlock email
+var IPPolicy = Policy{
+	FreeAttempts: 10,
+	BaseDelay:    time.Second,
+	MaxDelay:     15 * time.Minute,
+	CaptchaAfter: 10,
+	LockoutAfter: 100,
+	LockoutFor:   time.Hour,
+	Window:       time.Hour,
+}
+
+const (
+	AccountKeyPrefix = "account:"
+	IPKeyPrefix      = "ip:"
+)
+
+func AccountKey(email string) string {
+	return AccountKeyPrefix + strings.ToLower(strings.TrimSpace(email))
+}
+
+func IPKey(ip string) string {
+	return IPKeyPrefix + ip
+}
+
+// Exponential backoff after the given number of consecutive failures
+func (p Policy) Delay(failures int) time.Duration {
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// Time until which the key is blocked after failures, and whether that is a full lockout
+func (p Policy) BlockedUntil(failures int, now time.Time) (time.Time, bool) {
+	if p.LockoutAfter > 0 && failures >= p.LockoutAfter {
+		return now.Add(p.LockoutFor), true
+	}
+	return now.Add(p.Delay(failures)), false
+}
+
+func (p Policy) NeedsCaptcha(failures int) bool {
+	return p.CaptchaAfter > 0 && failures >= p.CaptchaAfter
+}
+
+// Start of the window failures are counted in
+func (p Policy) WindowStart(now time.Time) time.Time {
+	return now.Add(-p.Window)
+}
+
+// IP of the client. Only RemoteAddr is used, proxies in front of the server must be trusted
+// to set it (X-Forwarded-For can be forged by an attacker to dodge per IP limits)
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,97 @@
+package lockout
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPolicyDelay(t *testing.T) {
+	policy := Policy{FreeAttempts: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	tests := []struct {
+		name     string
+		failures int
+		expected time.Duration
+	}{
+		{name: "No Failures", failures: 0, expected: 0},
+		{name: "Within Free Attempts", failures: 3, expected: 0},
+		{name: "First Throttled Failure", failures: 4, expected: time.Second},
+		{name: "Doubles", failures: 6, expected: 4 * time.Second},
+		{name: "Capped", failures: 20, expected: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Delay(tt.failures); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestPolicyBlockedUntil(t *testing.T) {
+	now := time.Now()
+	policy := Policy{FreeAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute, LockoutAfter: 5, LockoutFor: time.Hour}
+
+	until, locked := policy.BlockedUntil(4, now)
+	if locked || !until.Equal(now.Add(time.Second)) {
+		t.Errorf("expected a one second backoff without lockout, got %v locked=%v", until.Sub(now), locked)
+	}
+	until, locked = policy.BlockedUntil(5, now)
+	if !locked || !until.Equal(now.Add(time.Hour)) {
+		t.Errorf("expected a one hour lockout, got %v locked=%v", until.Sub(now), locked)
+	}
+}
+
+func TestAccountKey(t *testing.T) {
+	if AccountKey(" User@Example.com ") != AccountKey("user@example.com") {
+		t.Error("expected account keys to ignore case and surrounding spaces")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/login", nil)
+	r.RemoteAddr = "203.0.113.7:51234"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	if ip := ClientIP(r); ip != "203.0.113.7" {
+		t.Errorf("expected 203.0.113.7, got %s", ip)
+	}
+}
+
+func TestSiteVerifyCaptcha(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		success := r.PostForm.Get("secret") == "secret" && r.PostForm.Get("response") == "solved"
+		json.NewEncoder(w).Encode(map[string]bool{"success": success})
+	}))
+	defer server.Close()
+	captcha := &SiteVerifyCaptcha{VerifyURL: server.URL, Secret: "secret"}
+
+	tests := []struct {
+		name        string
+		token       string
+		expectError bool
+	}{
+		{name: "Solved", token: "solved", expectError: false},
+		{name: "Wrong Solution", token: "guess", expectError: true},
+		{name: "Missing Token", token: "", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := captcha.Verify(context.Background(), tt.token, "203.0.113.7")
+			if tt.expectError && err == nil {
+				t.Error("expected error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package lockout
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Checks a CAPTCHA solution sent by the client after too many failed logins
+type CaptchaVerifier interface {
+	Verify(ctx context.Context, token, remoteIP string) error
+}
+
+var ErrCaptchaFailed = errors.New("captcha verification failed")
+
+// Verifier for the "siteverify" API shared by hCaptcha, reCAPTCHA and Cloudflare Turnstile
+type SiteVerifyCaptcha struct {
+	VerifyURL string
+	Secret    string
+	Client    *http.Client
+}
+
+func (c *SiteVerifyCaptcha) Verify(ctx context.Context, token, remoteIP string) error {
+	if token == "" {
+		return ErrCaptchaFailed
+	}
+	form := url.Values{}
+	form.Set("secret", c.Secret)
+	form.Set("response", token)
+	form.Set("remoteip", remoteIP)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.VerifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("captcha verification: %w", err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("captcha verification: decoding response: %w", err)
+	}
+	if !result.Success {
+		return ErrCaptchaFailed
+	}
+	return nil
+}
+
+// Sends the email that lets a user unlock their account after a lockout
+type Mailer interface {
+	SendUnlockEmail(ctx context.Context, to, unlockURL string) error
+}
+
+type SMTPMailer struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) SendUnlockEmail(ctx context.Context, to, unlockURL string) error {
+	host, _, err := net.SplitHostPort(m.Addr)
+	if err != nil {
+		return err
+	}
+	//addresses come from user input, don't let them inject headers
+	to = strings.NewReplacer("\r", "", "\n", "").Replace(to)
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	msg := "From: " + m.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: Your ZNotes account was locked\r\n" +
+		"\r\n" +
+		"There were too many failed login attempts on your account, so it has been locked for a while.\r\n" +
+		"If this was you, unlock it with the link below. If it wasn't, consider changing your password.\r\n" +
+		"\r\n" + unlockURL + "\r\n"
+	return smtp.SendMail(m.Addr, auth, m.From, []string{to}, []byte(msg))
+}
+
+// Used when no SMTP server is configured. Only logs the link itself when ShowLinks is set
+// (development), otherwise the lockout has to be cleared by an admin
+type LogMailer struct {
+	ShowLinks bool
+}
+
+func (m *LogMailer) SendUnlockEmail(ctx context.Context, to, unlockURL string) error {
+	if m.ShowLinks {
+		slog.InfoContext(ctx, "Unlock email", "to", to, "unlock_url", unlockURL)
+		return nil
+	}
+	slog.WarnContext(ctx, "Account was locked but no mailer is configured to send an unlock email", "to", to)
+	return nil
+}
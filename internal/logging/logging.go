@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Header a request id is read from and echoed back in
+const RequestIDHeader = "X-Request-ID"
+
+// Value logged in place of secrets
+const Redacted = "[REDACTED]"
+
+// JSON logger that redacts secrets (see IsSensitive) wherever they show up, including inside groups
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact,
+	}))
+}
+
+// Parses LOG_LEVEL style names (debug, info, warn, error). Empty means info
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q (use debug, info, warn or error)", s)
+	}
+	return level, nil
+}
+
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if IsSensitive(a.Key) && a.Value.Kind() != slog.KindGroup {
+		return slog.String(a.Key, Redacted)
+	}
+	return a
+}
+
+// Whether values logged under key are secrets: tokens, passwords, secrets, cookies and the
+// Authorization header. Ids and hints of tokens (token_id, token_hint) are fine to log
+func IsSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, part := range []string{"password", "secret", "authorization", "cookie"} {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return strings.HasSuffix(key, "token")
+}
+
+type loggerKey struct{}
+
+type requestIDKey struct{}
+
+func ContextWithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// Logger of the request, or the default logger outside of one
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// Adds attributes to the logger in ctx, e.g. the user once they are authenticated
+func With(ctx context.Context, args ...any) context.Context {
+	return ContextWithLogger(ctx, FromContext(ctx).With(args...))
+}
+
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Id for requests that came without a (usable) X-Request-ID
+func NewRequestID() string {
+	return uuid.NewString()
+}
+
+// Request ids from clients are only reused when they are short and plain, so they can't be used
+// to forge log lines or bloat them
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
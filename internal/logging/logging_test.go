@@ -0,0 +1,115 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestIsSensitive(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		expected bool
+	}{
+		{name: "Token", key: "token", expected: true},
+		{name: "Refresh Token", key: "refresh_token", expected: true},
+		{name: "Captcha Token", key: "captchaToken", expected: true},
+		{name: "Password", key: "password", expected: true},
+		{name: "Hashed Password", key: "hashed_password", expected: true},
+		{name: "Authorization Header", key: "Authorization", expected: true},
+		{name: "Webhook Secret", key: "webhook_secret", expected: true},
+		{name: "Cookie", key: "Set-Cookie", expected: true},
+		{name: "Token ID", key: "token_id", expected: false},
+		{name: "Token Hint", key: "token_hint", expected: false},
+		{name: "User ID", key: "user_id", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsSensitive(tt.key); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestNewRedacts(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo)
+	logger.Info("login",
+		"password", "hunter2",
+		"user_id", "42",
+		slog.Group("headers", "Authorization", "Bearer abc", "Accept", "application/json"),
+	)
+	if strings.Contains(buf.String(), "hunter2") || strings.Contains(buf.String(), "Bearer abc") {
+		t.Fatalf("secret was logged: %s", buf.String())
+	}
+	var line struct {
+		Password string `json:"password"`
+		UserID   string `json:"user_id"`
+		Headers  struct {
+			Authorization string `json:"Authorization"`
+			Accept        string `json:"Accept"`
+		} `json:"headers"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("log line is not JSON: %v", err)
+	}
+	if line.Password != Redacted || line.Headers.Authorization != Redacted {
+		t.Errorf("expected secrets to be redacted, got %+v", line)
+	}
+	if line.UserID != "42" || line.Headers.Accept != "application/json" {
+		t.Errorf("expected other fields to be kept, got %+v", line)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected slog.Level
+		wantErr  bool
+	}{
+		{name: "Empty", input: "", expected: slog.LevelInfo},
+		{name: "Debug", input: "debug", expected: slog.LevelDebug},
+		{name: "Upper Case", input: "WARN", expected: slog.LevelWarn},
+		{name: "Invalid", input: "loud", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLevel(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		id       string
+		expected bool
+	}{
+		{name: "UUID", id: "7f1c8a9e-1b2c-4d3e-8f4a-5b6c7d8e9f00", expected: true},
+		{name: "Trace Style", id: "req_01:abc.def", expected: true},
+		{name: "Empty", id: "", expected: false},
+		{name: "Newline", id: "abc\n{\"level\":\"ERROR\"}", expected: false},
+		{name: "Too Long", id: strings.Repeat("a", 129), expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidRequestID(tt.id); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
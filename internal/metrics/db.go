@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/F0RG-2142/capstone-1/internal/database"
+)
+
+// Wraps the connection sqlc queries run on and times every query by its sqlc name. For queries
+// returning rows the time until the first row is ready is measured, not the time to read them all
+type DB struct {
+	database.DBTX
+}
+
+func InstrumentDB(db database.DBTX) *DB {
+	return &DB{DBTX: db}
+}
+
+func (d *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	defer observeQuery(query, time.Now())
+	return d.DBTX.ExecContext(ctx, query, args...)
+}
+
+func (d *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	defer observeQuery(query, time.Now())
+	return d.DBTX.QueryContext(ctx, query, args...)
+}
+
+func (d *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	defer observeQuery(query, time.Now())
+	return d.DBTX.QueryRowContext(ctx, query, args...)
+}
+
+func observeQuery(query string, start time.Time) {
+	DBQueryDuration.WithLabelValues(QueryName(query)).Observe(time.Since(start).Seconds())
+}
+
+// Name of a sqlc generated query, taken from its "-- name: X :kind" header
+func QueryName(query string) string {
+	rest, ok := strings.CutPrefix(query, "-- name: ")
+	if !ok {
+		return "other"
+	}
+	name, _, _ := strings.Cut(rest, " ")
+	return name
+}
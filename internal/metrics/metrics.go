@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/F0RG-2142/capstone-1/internal/database"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "znotes"
+
+// Registry everything below is registered with, served by the admin metrics endpoint
+var Registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route pattern and status code.",
+	}, []string{"route", "status"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route pattern and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "status"})
+
+	HTTPInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "http_requests_in_flight",
+		Help:      "HTTP requests currently being served.",
+	})
+
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Latency of database queries by sqlc query name.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"query"})
+
+	AuthFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_failures_total",
+		Help:      "Rejected authentication attempts by reason.",
+	}, []string{"reason"})
+)
+
+// Reasons AuthFailures is labelled with
+const (
+	AuthMissingCredentials = "missing_credentials"
+	AuthInvalidToken       = "invalid_token"
+	AuthInsufficientScope  = "insufficient_scope"
+	AuthSessionRequired    = "session_required"
+	AuthInvalidAdminToken  = "invalid_admin_token"
+	AuthClientCertMissing  = "client_cert_missing"
+	AuthLoginFailed        = "login_failed"
+	AuthLoginThrottled     = "login_throttled"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		HTTPInFlight,
+		DBQueryDuration,
+		AuthFailures,
+	)
+}
+
+// Registers connection pool stats of db and the business gauges counted with queries
+func RegisterDB(db *sql.DB, queries *database.Queries) {
+	Registry.MustRegister(
+		collectors.NewDBStatsCollector(db, "znotes"),
+		&businessCollector{queries: queries},
+	)
+}
+
+// Counts users, premium users, notes and teams on every scrape
+type businessCollector struct {
+	queries *database.Queries
+}
+
+var (
+	usersDesc        = prometheus.NewDesc(namespace+"_users", "Registered users.", nil, nil)
+	premiumUsersDesc = prometheus.NewDesc(namespace+"_premium_users", "Users with notes premium.", nil, nil)
+	notesDesc        = prometheus.NewDesc(namespace+"_notes", "Stored notes, private and team.", nil, nil)
+	teamsDesc        = prometheus.NewDesc(namespace+"_teams", "Teams.", nil, nil)
+)
+
+func (c *businessCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- usersDesc
+	ch <- premiumUsersDesc
+	ch <- notesDesc
+	ch <- teamsDesc
+}
+
+func (c *businessCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	counts, err := c.queries.GetBusinessCounts(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error collecting business metrics", "err", err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(usersDesc, prometheus.GaugeValue, float64(counts.Users))
+	ch <- prometheus.MustNewConstMetric(premiumUsersDesc, prometheus.GaugeValue, float64(counts.PremiumUsers))
+	ch <- prometheus.MustNewConstMetric(notesDesc, prometheus.GaugeValue, float64(counts.Notes))
+	ch <- prometheus.MustNewConstMetric(teamsDesc, prometheus.GaugeValue, float64(counts.Teams))
+}
@@ -0,0 +1,23 @@
+package metrics
+
+import "testing"
+
+func TestQueryName(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{name: "One", query: "-- name: GetUserByID :one\nSELECT * FROM users WHERE id = $1", expected: "GetUserByID"},
+		{name: "Exec Rows", query: "-- name: RevokeAPIToken :execrows\nUPDATE api_tokens", expected: "RevokeAPIToken"},
+		{name: "Not Generated", query: "SELECT 1", expected: "other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := QueryName(tt.query); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
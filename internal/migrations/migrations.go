@@ -0,0 +1,170 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/F0RG-2142/capstone-1/sql/schema"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+var ErrSchemaBehind = errors.New("database schema is behind")
+
+// Version of the newest migration the binary was built with, taken from the "NN_name.sql" file names
+func Latest() (int64, error) {
+	files, err := fs.Glob(schema.FS, "*.sql")
+	if err != nil {
+		return 0, err
+	}
+	var latest int64
+	for _, file := range files {
+		prefix, _, ok := strings.Cut(file, "_")
+		if !ok {
+			return 0, fmt.Errorf("migration %s has no version prefix", file)
+		}
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("migration %s has no version prefix", file)
+		}
+		latest = max(latest, version)
+	}
+	return latest, nil
+}
+
+// Version the database is migrated to, according to goose's version table (0 before the first
+// migration). Only reads, so unlike goose it neither creates the table nor waits for a running
+// migration. A version rolled back by the goose CLI gets a newer row with is_applied false, so only
+// the newest row of each version counts
+func Current(ctx context.Context, db *sql.DB) (int64, error) {
+	var exists bool
+	if err := db.QueryRowContext(ctx, `SELECT to_regclass('goose_db_version') IS NOT NULL`).Scan(&exists); err != nil {
+		return 0, fmt.Errorf("reading schema version: %w", err)
+	}
+	if !exists {
+		return 0, nil
+	}
+	var version int64
+	err := db.QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(version_id), 0) FROM (
+			SELECT DISTINCT ON (version_id) version_id, is_applied
+			FROM goose_db_version
+			ORDER BY version_id, id DESC
+		) versions
+		WHERE is_applied`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("reading schema version: %w", err)
+	}
+	return version, nil
+}
+
+// Fails with ErrSchemaBehind when the database is missing migrations the binary was built with
+func Check(ctx context.Context, db *sql.DB) error {
+	expected, err := Latest()
+	if err != nil {
+		return err
+	}
+	current, err := Current(ctx, db)
+	if err != nil {
+		return err
+	}
+	if current < expected {
+		return fmt.Errorf("%w: it is at version %d, this build needs %d (run \"migrate up\" or start with -auto-migrate)", ErrSchemaBehind, current, expected)
+	}
+	return nil
+}
+
+// Goose provider over the embedded migrations. Changes take a Postgres advisory lock, so replicas
+// starting with -auto-migrate at the same time apply them one after the other
+func newProvider(db *sql.DB) (*goose.Provider, error) {
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(goose.DialectPostgres, db, schema.FS, goose.WithSessionLocker(locker))
+}
+
+// Applies every pending migration
+func Up(ctx context.Context, db *sql.DB) error {
+	provider, err := newProvider(db)
+	if err != nil {
+		return err
+	}
+	results, err := provider.Up(ctx)
+	logResults(ctx, results...)
+	if len(results) == 0 && err == nil {
+		slog.InfoContext(ctx, "Schema is up to date")
+	}
+	return err
+}
+
+// Rolls back the newest applied migration
+func Down(ctx context.Context, db *sql.DB) error {
+	provider, err := newProvider(db)
+	if err != nil {
+		return err
+	}
+	result, err := provider.Down(ctx)
+	logResults(ctx, result)
+	return err
+}
+
+// Rolls back the newest applied migration and applies it again
+func Redo(ctx context.Context, db *sql.DB) error {
+	provider, err := newProvider(db)
+	if err != nil {
+		return err
+	}
+	down, err := provider.Down(ctx)
+	logResults(ctx, down)
+	if err != nil {
+		return err
+	}
+	up, err := provider.UpByOne(ctx)
+	logResults(ctx, up)
+	return err
+}
+
+// Writes a table of every migration and whether it is applied
+func Status(ctx context.Context, db *sql.DB, w io.Writer) error {
+	provider, err := newProvider(db)
+	if err != nil {
+		return err
+	}
+	statuses, err := provider.Status(ctx)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tSTATE\tAPPLIED AT\tMIGRATION")
+	for _, s := range statuses {
+		appliedAt := "-"
+		if s.State == goose.StateApplied {
+			appliedAt = s.AppliedAt.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", s.Source.Version, s.State, appliedAt, s.Source.Path)
+	}
+	return tw.Flush()
+}
+
+func logResults(ctx context.Context, results ...*goose.MigrationResult) {
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+		if r.Error != nil {
+			slog.ErrorContext(ctx, "Migration failed", "version", r.Source.Version, "direction", r.Direction, "migration", r.Source.Path, "err", r.Error)
+			continue
+		}
+		slog.InfoContext(ctx, "Migrated", "version", r.Source.Version, "direction", r.Direction, "migration", r.Source.Path, "duration", r.Duration.String())
+	}
+}
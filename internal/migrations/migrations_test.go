@@ -0,0 +1,44 @@
+package migrations
+
+import (
+	"database/sql"
+	"io/fs"
+	"testing"
+
+	"github.com/F0RG-2142/capstone-1/sql/schema"
+
+	_ "github.com/lib/pq"
+)
+
+func TestLatest(t *testing.T) {
+	files, err := fs.Glob(schema.FS, "*.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("expected embedded migrations, got %v (%v)", files, err)
+	}
+	latest, err := Latest()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	//migrations are numbered without gaps
+	if latest != int64(len(files)) {
+		t.Errorf("expected latest version %d, got %d", len(files), latest)
+	}
+}
+
+func TestProviderLoadsEmbeddedMigrations(t *testing.T) {
+	//sql.Open doesn't connect, collecting the migrations needs no database
+	db, err := sql.Open("postgres", "postgres://localhost/unused")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	provider, err := newProvider(db)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	latest, _ := Latest()
+	sources := provider.ListSources()
+	if len(sources) == 0 || sources[len(sources)-1].Version != latest {
+		t.Errorf("expected migrations up to version %d, got %d migrations", latest, len(sources))
+	}
+}
@@ -0,0 +1,207 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// In-process identity provider serving discovery, a JWKS and a token endpoint that checks PKCE
+type mockIdP struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	kid       string
+	challenge string
+	idToken   string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	idp := &mockIdP{key: key, kid: "test-key"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Discovery{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JWKSURI:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jsonWebKeySet{Keys: []jsonWebKey{{
+			Kty: "RSA",
+			Kid: idp.kid,
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.PostForm.Get("code") != "good-code" || CodeChallenge(r.PostForm.Get("code_verifier")) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(tokenResponse{Error: "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(tokenResponse{AccessToken: "access", TokenType: "Bearer", IDToken: idp.idToken})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *mockIdP) sign(t *testing.T, claims IDTokenClaims, kid string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(idp.key)
+	if err != nil {
+		t.Fatalf("failed to sign id token: %v", err)
+	}
+	return signed
+}
+
+func (idp *mockIdP) claims(nonce string) IDTokenClaims {
+	return IDTokenClaims{
+		Email:         "user@example.com",
+		EmailVerified: true,
+		Nonce:         nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    idp.server.URL,
+			Subject:   "subject-123",
+			Audience:  jwt.ClaimStrings{"znotes"},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := &Provider{Name: "mock", IssuerURL: idp.server.URL, ClientID: "znotes", RedirectURL: "http://localhost/cb"}
+
+	wrongAudience := idp.claims("nonce")
+	wrongAudience.Audience = jwt.ClaimStrings{"someone-else"}
+	expired := idp.claims("nonce")
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+	wrongIssuer := idp.claims("nonce")
+	wrongIssuer.Issuer = "https://evil.example.com"
+
+	tests := []struct {
+		name        string
+		token       string
+		nonce       string
+		expectError bool
+	}{
+		{
+			name:        "Valid Token",
+			token:       idp.sign(t, idp.claims("nonce"), idp.kid),
+			nonce:       "nonce",
+			expectError: false,
+		},
+		{
+			name:        "Nonce Mismatch",
+			token:       idp.sign(t, idp.claims("other"), idp.kid),
+			nonce:       "nonce",
+			expectError: true,
+		},
+		{
+			name:        "Wrong Audience",
+			token:       idp.sign(t, wrongAudience, idp.kid),
+			nonce:       "nonce",
+			expectError: true,
+		},
+		{
+			name:        "Expired Token",
+			token:       idp.sign(t, expired, idp.kid),
+			nonce:       "nonce",
+			expectError: true,
+		},
+		{
+			name:        "Wrong Issuer",
+			token:       idp.sign(t, wrongIssuer, idp.kid),
+			nonce:       "nonce",
+			expectError: true,
+		},
+		{
+			name:        "Unknown Key",
+			token:       idp.sign(t, idp.claims("nonce"), "rotated-away"),
+			nonce:       "nonce",
+			expectError: true,
+		},
+		{
+			name:        "Garbage Token",
+			token:       "not.a.token",
+			nonce:       "nonce",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := provider.VerifyIDToken(context.Background(), tt.token, tt.nonce)
+			if tt.expectError && err == nil {
+				t.Error("expected error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tt.expectError && err == nil && claims.Subject != "subject-123" {
+				t.Errorf("expected subject %q, got %q", "subject-123", claims.Subject)
+			}
+		})
+	}
+}
+
+func TestAuthCodeFlow(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := &Provider{Name: "mock", IssuerURL: idp.server.URL, ClientID: "znotes", RedirectURL: "http://localhost/cb"}
+	verifier, err := RandomString()
+	if err != nil {
+		t.Fatalf("failed to make verifier: %v", err)
+	}
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "state", "nonce", verifier)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("invalid auth url: %v", err)
+	}
+	q := parsed.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("state") != "state" || q.Get("nonce") != "nonce" {
+		t.Errorf("auth url is missing pkce, state or nonce: %s", authURL)
+	}
+	idp.challenge = q.Get("code_challenge")
+	idp.idToken = idp.sign(t, idp.claims("nonce"), idp.kid)
+
+	if _, err := provider.Exchange(context.Background(), "good-code", "wrong-verifier", "nonce"); err == nil {
+		t.Error("expected error for wrong code verifier, got nil")
+	}
+	claims, err := provider.Exchange(context.Background(), "good-code", verifier, "nonce")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.Email != "user@example.com" || !claims.EmailVerified {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+}
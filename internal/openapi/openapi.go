@@ -0,0 +1,200 @@
+// Package openapi builds an OpenAPI 3.1 document out of Go types and serves it with a docs page.
+// Schemas are reflected from the `json` and `validate` struct tags, so the document describes
+// exactly what validate.DecodeJSON accepts and what the handlers marshal:
+//
+//	doc := openapi.New(openapi.Info{Title: "API", Version: "1"})
+//	doc.Add("POST /api/v1/notes", &openapi.Operation{
+//		Summary:     "Create a note",
+//		RequestBody: openapi.JSONBody(doc.Request(newNoteRequest{})),
+//		Responses: map[string]*openapi.Response{
+//			"201": openapi.JSONResponse("The note", doc.Response(database.Note{})),
+//		},
+//	})
+//
+// Operations are added with the same "METHOD /path/{param}" patterns http.ServeMux uses
+package openapi
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const Version = "3.1.0"
+
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Tags       []Tag                `json:"tags,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+
+	//component name of every reflected struct, per mode
+	names map[componentKey]string
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// Operations of one path by lower case method, the way OpenAPI keys them
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string               `json:"operationId,omitempty"`
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+	// Alternatives, any one of them is enough. Public operations have none
+	Security []SecurityRequirement `json:"security,omitempty"`
+}
+
+// Scheme name to the scopes (or roles) it needs
+type SecurityRequirement map[string][]string
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Description string                `json:"description,omitempty"`
+	Required    bool                  `json:"required,omitempty"`
+	Content     map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Headers     map[string]*Header    `json:"headers,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Description  string `json:"description,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	// For apiKey schemes
+	Name string `json:"name,omitempty"`
+	In   string `json:"in,omitempty"`
+}
+
+func New(info Info) *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   map[string]*PathItem{},
+		Components: Components{
+			Schemas:         map[string]*Schema{},
+			SecuritySchemes: map[string]*SecurityScheme{},
+		},
+		names: map[componentKey]string{},
+	}
+}
+
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+// Adds op under a ServeMux pattern like "GET /api/v1/notes/{noteID}". Path parameters op doesn't
+// declare itself are added as required strings. Panics on a malformed or duplicate pattern, the
+// document is built once at startup
+func (d *Document) Add(pattern string, op *Operation) {
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok || method == "" || !strings.HasPrefix(path, "/") {
+		panic(fmt.Sprintf("openapi: pattern %q needs a method and a path", pattern))
+	}
+	item := d.Paths[path]
+	if item == nil {
+		item = &PathItem{}
+		d.Paths[path] = item
+	}
+	method = strings.ToLower(method)
+	if _, ok := (*item)[method]; ok {
+		panic(fmt.Sprintf("openapi: %q added twice", pattern))
+	}
+	for _, m := range pathParam.FindAllStringSubmatch(path, -1) {
+		if op.Parameter(m[1], "path") == nil {
+			op.Parameters = append(op.Parameters, &Parameter{Name: m[1], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+	}
+	if op.Responses == nil {
+		op.Responses = map[string]*Response{}
+	}
+	(*item)[method] = op
+}
+
+// The operation added for method and the path template, nil if there is none
+func (d *Document) Operation(method, path string) *Operation {
+	item := d.Paths[path]
+	if item == nil {
+		return nil
+	}
+	return (*item)[strings.ToLower(method)]
+}
+
+// Every operation as a ServeMux pattern, sorted
+func (d *Document) Patterns() []string {
+	var patterns []string
+	for path, item := range d.Paths {
+		for method := range *item {
+			patterns = append(patterns, strings.ToUpper(method)+" "+path)
+		}
+	}
+	slices.Sort(patterns)
+	return patterns
+}
+
+// The parameter named name in "path", "query" or "header", nil if op doesn't have it
+func (op *Operation) Parameter(name, in string) *Parameter {
+	for _, p := range op.Parameters {
+		if p.Name == name && p.In == in {
+			return p
+		}
+	}
+	return nil
+}
+
+// Required application/json request body
+func JSONBody(schema *Schema) *RequestBody {
+	return &RequestBody{Required: true, Content: map[string]*MediaType{"application/json": {Schema: schema}}}
+}
+
+// Response with an application/json body, or none when schema is nil
+func JSONResponse(description string, schema *Schema) *Response {
+	return ContentResponse(description, "application/json", schema)
+}
+
+func ContentResponse(description, contentType string, schema *Schema) *Response {
+	resp := &Response{Description: description}
+	if schema != nil {
+		resp.Content = map[string]*MediaType{contentType: {Schema: schema}}
+	}
+	return resp
+}
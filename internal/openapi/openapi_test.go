@@ -0,0 +1,156 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type member struct {
+	UserID uuid.UUID `json:"user_id" validate:"required"`
+	Role   string    `json:"role" validate:"required,oneof=admin editor viewer"`
+}
+
+type tokenRequest struct {
+	Email  string   `json:"email" validate:"required,email,max=254"`
+	Days   int      `json:"days" validate:"omitempty,min=1,max=366"`
+	Scopes []string `json:"scopes" validate:"required,max=20"`
+	Member member   `json:"member"`
+	Secret string   `json:"-"`
+	Note   string   `json:"note" validate:"maxbytes=72"`
+}
+
+type tokenResponse struct {
+	ID        uuid.UUID        `json:"id"`
+	CreatedAt time.Time        `json:"created_at"`
+	Token     string           `json:"token,omitempty"`
+	ExpiresAt *time.Time       `json:"expires_at"`
+	Member    *member          `json:"member"`
+	Usage     map[string]int64 `json:"usage"`
+	Payload   json.RawMessage  `json:"payload"`
+}
+
+func marshal(t *testing.T, v any) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	return string(b)
+}
+
+func TestSchemas(t *testing.T) {
+	doc := New(Info{Title: "test", Version: "1"})
+	tests := []struct {
+		name string
+		got  *Schema
+		want string
+	}{
+		{
+			name: "Request Reference",
+			got:  doc.Request(tokenRequest{}),
+			want: `{"$ref":"#/components/schemas/TokenRequest"}`,
+		},
+		{
+			name: "Request Component",
+			got:  doc.Components.Schemas["TokenRequest"],
+			want: `{"type":"object","properties":{"days":{"anyOf":[{"type":"integer","format":"int64","minimum":1,"maximum":366},{"enum":[0]}]},` +
+				`"email":{"type":"string","format":"email","minLength":1,"maxLength":254},` +
+				`"member":{"$ref":"#/components/schemas/Member"},` +
+				`"note":{"description":"At most 72 bytes of UTF-8","type":"string","maxLength":72},` +
+				`"scopes":{"type":"array","items":{"type":"string"},"minItems":1,"maxItems":20}},` +
+				`"required":["email","scopes"],"additionalProperties":false}`,
+		},
+		{
+			name: "Nested Request Component",
+			got:  doc.Components.Schemas["Member"],
+			want: `{"type":"object","properties":{"role":{"type":"string","enum":["admin","editor","viewer"],"minLength":1},` +
+				`"user_id":{"type":"string","format":"uuid"}},"required":["user_id","role"],"additionalProperties":false}`,
+		},
+		{
+			name: "Response List",
+			got:  doc.Response([]tokenResponse{}),
+			want: `{"type":"array","items":{"$ref":"#/components/schemas/TokenResponse"}}`,
+		},
+		{
+			name: "Response Component",
+			got:  doc.Components.Schemas["TokenResponse"],
+			want: `{"type":"object","properties":{"created_at":{"type":"string","format":"date-time"},` +
+				`"expires_at":{"type":["string","null"],"format":"date-time"},"id":{"type":"string","format":"uuid"},` +
+				`"member":{"anyOf":[{"$ref":"#/components/schemas/MemberResponse"},{"type":"null"}]},` +
+				`"payload":{},"token":{"type":"string"},` +
+				`"usage":{"type":"object","additionalProperties":{"type":"integer","format":"int64"}}},` +
+				`"required":["id","created_at","expires_at","member","usage","payload"]}`,
+		},
+		{
+			name: "Same Type As Response",
+			got:  doc.Components.Schemas["MemberResponse"],
+			want: `{"type":"object","properties":{"role":{"type":"string","enum":["admin","editor","viewer"],"minLength":1},` +
+				`"user_id":{"type":"string","format":"uuid"}},"required":["user_id","role"]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := marshal(t, tt.got); got != tt.want {
+				t.Errorf("expected\n%s\ngot\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAdd(t *testing.T) {
+	doc := New(Info{Title: "test", Version: "1"})
+	doc.Add("GET /teams/{teamID}/notes/{noteID}", &Operation{
+		Parameters: []*Parameter{{Name: "teamID", In: "path", Required: true, Schema: &Schema{Type: "string", Format: "uuid"}}},
+	})
+	doc.Add("DELETE /teams/{teamID}/notes/{noteID}", &Operation{})
+
+	op := doc.Operation("GET", "/teams/{teamID}/notes/{noteID}")
+	if op == nil {
+		t.Fatal("expected the operation to be found by method and path")
+	}
+	if len(op.Parameters) != 2 || op.Parameter("teamID", "path").Schema.Format != "uuid" || !op.Parameter("noteID", "path").Required {
+		t.Errorf("expected declared parameters to be kept and missing ones added, got %s", marshal(t, op.Parameters))
+	}
+	if got := doc.Patterns(); !reflect.DeepEqual(got, []string{"DELETE /teams/{teamID}/notes/{noteID}", "GET /teams/{teamID}/notes/{noteID}"}) {
+		t.Errorf("unexpected patterns %v", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected adding a pattern twice to panic")
+		}
+	}()
+	doc.Add("GET /teams/{teamID}/notes/{noteID}", &Operation{})
+}
+
+func TestHandlers(t *testing.T) {
+	doc := New(Info{Title: "test", Version: "1"})
+	doc.Add("GET /notes", &Operation{Summary: "List notes"})
+
+	rec := httptest.NewRecorder()
+	Handler(doc).ServeHTTP(rec, httptest.NewRequest("GET", "/openapi.json", nil))
+	var got Document
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode document: %v", err)
+	}
+	if got.OpenAPI != Version || (*got.Paths["/notes"])["get"].Summary != "List notes" {
+		t.Errorf("unexpected document %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	DocsHandler(`<script>"`, "/openapi.json").ServeHTTP(rec, httptest.NewRequest("GET", "/docs", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `const specURL = "/openapi.json";`) {
+		t.Errorf("expected the page to load /openapi.json, got %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), `<script>"</title>`) {
+		t.Error("expected the title to be escaped")
+	}
+}
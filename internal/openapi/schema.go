@@ -0,0 +1,305 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// A JSON Schema (draft 2020-12, the dialect of OpenAPI 3.1). Only the keywords the reflected
+// schemas use
+type Schema struct {
+	Ref         string `json:"$ref,omitempty"`
+	Description string `json:"description,omitempty"`
+	// A type name, or a list of them for nullable values ("string", "null")
+	Type   any    `json:"type,omitempty"`
+	Format string `json:"format,omitempty"`
+	Enum   []any  `json:"enum,omitempty"`
+	// Objects
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	// false or a *Schema every other property must match
+	AdditionalProperties any `json:"additionalProperties,omitempty"`
+	// Arrays
+	Items    *Schema `json:"items,omitempty"`
+	MinItems *int    `json:"minItems,omitempty"`
+	MaxItems *int    `json:"maxItems,omitempty"`
+	// Strings, in characters
+	MinLength *int `json:"minLength,omitempty"`
+	MaxLength *int `json:"maxLength,omitempty"`
+	// Numbers
+	Minimum *float64 `json:"minimum,omitempty"`
+	Maximum *float64 `json:"maximum,omitempty"`
+	// Matches if any of these does, used for nullable references
+	AnyOf []*Schema `json:"anyOf,omitempty"`
+}
+
+// Type names of s, empty when s allows any type
+func (s *Schema) Types() []string {
+	switch t := s.Type.(type) {
+	case string:
+		return []string{t}
+	case []string:
+		return t
+	}
+	return nil
+}
+
+// Requests reject unknown fields and need what `validate` requires, responses always have
+// every field that isn't omitempty
+type mode int
+
+const (
+	request mode = iota
+	response
+)
+
+type componentKey struct {
+	t reflect.Type
+	m mode
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	uuidType = reflect.TypeOf(uuid.UUID{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// Schema of a request body shaped like v. Named structs become components
+func (d *Document) Request(v any) *Schema {
+	return d.schemaFor(reflect.TypeOf(v), request)
+}
+
+// Schema of a response body shaped like v. Named structs become components
+func (d *Document) Response(v any) *Schema {
+	return d.schemaFor(reflect.TypeOf(v), response)
+}
+
+func (d *Document) schemaFor(t reflect.Type, m mode) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case uuidType:
+		return &Schema{Type: "string", Format: "uuid"}
+	case rawType:
+		return &Schema{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return nullable(d.schemaFor(t.Elem(), m))
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Minimum: float(0)}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		//encoding/json writes nil slices as null
+		return &Schema{Type: "array", Items: d.schemaFor(t.Elem(), m)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schemaFor(t.Elem(), m)}
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.structSchema(t, m)
+		}
+		return &Schema{Ref: "#/components/schemas/" + d.component(t, m)}
+	}
+	panic(fmt.Sprintf("openapi: can't describe %s", t))
+}
+
+func nullable(s *Schema) *Schema {
+	if s.Ref != "" {
+		return &Schema{AnyOf: []*Schema{s, {Type: "null"}}}
+	}
+	if t, ok := s.Type.(string); ok {
+		s.Type = []string{t, "null"}
+	}
+	return s
+}
+
+// Name of the component for t, added on first use. Names are the Go type name, prefixed with
+// the package when two packages have the same one and suffixed when a type is used in both a
+// request and a response
+func (d *Document) component(t reflect.Type, m mode) string {
+	key := componentKey{t, m}
+	if name, ok := d.names[key]; ok {
+		return name
+	}
+	name := exported(t.Name())
+	if _, ok := d.names[componentKey{t, 1 - m}]; ok {
+		//the same type on the other side of a request
+		if m == request {
+			name += "Request"
+		} else {
+			name += "Response"
+		}
+	} else if d.Components.Schemas[name] != nil {
+		pkg := t.PkgPath()
+		name = exported(pkg[strings.LastIndex(pkg, "/")+1:]) + name
+	}
+	if d.Components.Schemas[name] != nil {
+		panic(fmt.Sprintf("openapi: no free component name for %s", t))
+	}
+	d.names[key] = name
+	//placeholder so recursive types find the name
+	d.Components.Schemas[name] = &Schema{}
+	*d.Components.Schemas[name] = *d.structSchema(t, m)
+	return name
+}
+
+func exported(name string) string {
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+func (d *Document) structSchema(t reflect.Type, m mode) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	if m == request {
+		s.AdditionalProperties = false
+	}
+	d.addFields(s, t, m)
+	return s
+}
+
+func (d *Document) addFields(s *Schema, t reflect.Type, m mode) {
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		name, opts, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		//embedded structs without a name are flattened by encoding/json
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			d.addFields(s, sf.Type, m)
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fs := d.schemaFor(sf.Type, m)
+		rules := sf.Tag.Get("validate")
+		applyRules(fs, sf.Type, rules)
+		s.Properties[name] = fs
+		if m == request && hasRule(rules, "required") || m == response && !hasRule(opts, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+func hasRule(rules, name string) bool {
+	for _, rule := range strings.Split(rules, ",") {
+		if n, _, _ := strings.Cut(strings.TrimSpace(rule), "="); n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Turns the rules of internal/validate into schema keywords
+func applyRules(s *Schema, t reflect.Type, rules string) {
+	if rules == "" || s.Ref != "" || s.AnyOf != nil {
+		return
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch name {
+		case "required":
+			//validate counts empty strings and slices as missing
+			switch {
+			case t.Kind() == reflect.String && s.MinLength == nil:
+				s.MinLength = integer(1)
+			case t.Kind() == reflect.Slice && s.MinItems == nil:
+				s.MinItems = integer(1)
+			}
+		case "email", "uuid":
+			s.Format = name
+		case "maxbytes":
+			//JSON Schema counts characters, a string over n characters is always over n bytes
+			limit, err := strconv.Atoi(arg)
+			if err != nil {
+				panic(fmt.Sprintf("openapi: bad %s rule %q", name, rule))
+			}
+			s.MaxLength = integer(limit)
+			s.Description = fmt.Sprintf("At most %d bytes of UTF-8", limit)
+		case "oneof":
+			for _, v := range strings.Fields(arg) {
+				if t.Kind() == reflect.String {
+					s.Enum = append(s.Enum, v)
+				} else if n, err := strconv.ParseFloat(v, 64); err == nil {
+					s.Enum = append(s.Enum, n)
+				}
+			}
+		case "min", "max":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				panic(fmt.Sprintf("openapi: bad %s rule %q", name, rule))
+			}
+			switch t.Kind() {
+			case reflect.String:
+				setLimit(name, &s.MinLength, &s.MaxLength, integer(int(limit)))
+			case reflect.Slice, reflect.Array:
+				setLimit(name, &s.MinItems, &s.MaxItems, integer(int(limit)))
+			case reflect.Map:
+			default:
+				setLimit(name, &s.Minimum, &s.Maximum, float(limit))
+			}
+		}
+	}
+	//omitempty skips the other rules for the zero value, so it has to be allowed on its own
+	if hasRule(rules, "omitempty") && (s.Enum != nil || s.Format != "" || s.MinLength != nil || s.MaxLength != nil || s.Minimum != nil || s.Maximum != nil) {
+		var zero any
+		switch t.Kind() {
+		case reflect.String:
+			zero = ""
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+			zero = 0
+		default:
+			return
+		}
+		checked := *s
+		*s = Schema{AnyOf: []*Schema{&checked, {Enum: []any{zero}}}}
+	}
+}
+
+func setLimit[T any](rule string, min, max **T, v *T) {
+	if rule == "min" {
+		*min = v
+	} else {
+		*max = v
+	}
+}
+
+func integer(n int) *int {
+	return &n
+}
+
+func float(f float64) *float64 {
+	return &f
+}
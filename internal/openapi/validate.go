@@ -0,0 +1,251 @@
+package openapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/F0RG-2142/capstone-1/internal/apierror"
+	"github.com/F0RG-2142/capstone-1/internal/validate"
+	"github.com/google/uuid"
+)
+
+// Checks v against s and returns every value that doesn't match, nil when v does. v is what
+// encoding/json decodes into an `any` with UseNumber: nil, bool, json.Number, string, []any and
+// map[string]any. Fields are named like validate names them ("team.role", "scopes[1]") with the
+// same codes, an empty field is v itself
+func (d *Document) Validate(s *Schema, v any) []apierror.FieldError {
+	var errs []apierror.FieldError
+	d.check(s, v, "", &errs)
+	slices.SortStableFunc(errs, func(a, b apierror.FieldError) int {
+		return strings.Compare(a.Field, b.Field)
+	})
+	return errs
+}
+
+// Checks a path, query or header parameter. They always arrive as strings, numbers and booleans
+// are parsed before they are checked
+func (d *Document) ValidateParameter(p *Parameter, raw string) []apierror.FieldError {
+	var v any = raw
+	s := d.resolve(p.Schema)
+	if s != nil {
+		switch {
+		case slices.Contains(s.Types(), "integer"), slices.Contains(s.Types(), "number"):
+			if _, err := strconv.ParseFloat(raw, 64); err == nil {
+				v = json.Number(raw)
+			}
+		case slices.Contains(s.Types(), "boolean"):
+			if b, err := strconv.ParseBool(raw); err == nil {
+				v = b
+			}
+		}
+	}
+	errs := d.Validate(p.Schema, v)
+	for i := range errs {
+		errs[i].Field = p.Name + errs[i].Field
+	}
+	return errs
+}
+
+// The component s refers to, s itself when it isn't a reference
+func (d *Document) resolve(s *Schema) *Schema {
+	for s != nil && s.Ref != "" {
+		s = d.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	}
+	return s
+}
+
+func (d *Document) check(s *Schema, v any, path string, errs *[]apierror.FieldError) {
+	s = d.resolve(s)
+	if s == nil {
+		return
+	}
+	fail := func(code, message string) {
+		*errs = append(*errs, apierror.FieldError{Field: path, Code: code, Message: message})
+	}
+	if len(s.AnyOf) > 0 {
+		//the first branch's errors are the ones worth showing, the rest is usually {type: null}
+		var first []apierror.FieldError
+		for i, branch := range s.AnyOf {
+			var branchErrs []apierror.FieldError
+			d.check(branch, v, path, &branchErrs)
+			if len(branchErrs) == 0 {
+				return
+			}
+			if i == 0 {
+				first = branchErrs
+			}
+		}
+		*errs = append(*errs, first...)
+		return
+	}
+	if types := s.Types(); len(types) > 0 && !slices.ContainsFunc(types, func(t string) bool { return isType(v, t) }) {
+		fail(validate.CodeType, "must be "+typeNames(types))
+		return
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return equal(e, v) }) {
+		allowed := make([]string, len(s.Enum))
+		for i, e := range s.Enum {
+			allowed[i] = fmt.Sprint(e)
+		}
+		fail("oneof", "must be one of "+strings.Join(allowed, ", "))
+		return
+	}
+	switch v := v.(type) {
+	case string:
+		n := utf8.RuneCountInString(v)
+		//validate's required counts empty strings as missing, the schema says it with minLength 1
+		if n == 0 && s.MinLength != nil && *s.MinLength > 0 {
+			fail("required", "is required")
+			return
+		}
+		if s.MinLength != nil && n < *s.MinLength {
+			fail("min", fmt.Sprintf("must be at least %d characters", *s.MinLength))
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("max", fmt.Sprintf("must be at most %d characters", *s.MaxLength))
+		}
+		if code, message, ok := checkFormat(s.Format, v); !ok {
+			fail(code, message)
+		}
+	case json.Number:
+		n, _ := v.Float64()
+		if s.Minimum != nil && n < *s.Minimum {
+			fail("min", "must be at least "+strconv.FormatFloat(*s.Minimum, 'f', -1, 64))
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			fail("max", "must be at most "+strconv.FormatFloat(*s.Maximum, 'f', -1, 64))
+		}
+	case []any:
+		if len(v) == 0 && s.MinItems != nil && *s.MinItems > 0 {
+			fail("required", "is required")
+			return
+		}
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("min", fmt.Sprintf("must be at least %d items", *s.MinItems))
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("max", fmt.Sprintf("must be at most %d items", *s.MaxItems))
+		}
+		for i, item := range v {
+			d.check(s.Items, item, path+"["+strconv.Itoa(i)+"]", errs)
+		}
+	case map[string]any:
+		prefix := path
+		if prefix != "" {
+			prefix += "."
+		}
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				*errs = append(*errs, apierror.FieldError{Field: prefix + name, Code: "required", Message: "is required"})
+			}
+		}
+		for name, value := range v {
+			if prop, ok := s.Properties[name]; ok {
+				d.check(prop, value, prefix+name, errs)
+				continue
+			}
+			switch extra := s.AdditionalProperties.(type) {
+			case bool:
+				if !extra {
+					*errs = append(*errs, apierror.FieldError{Field: prefix + name, Code: validate.CodeUnknownField, Message: "is not a known field"})
+				}
+			case *Schema:
+				d.check(extra, value, prefix+name, errs)
+			}
+		}
+	}
+}
+
+func isType(v any, t string) bool {
+	switch t {
+	case "null":
+		return v == nil
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := v.(json.Number)
+		return ok
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		if _, err := n.Int64(); err == nil {
+			return true
+		}
+		//1.0 and 1e3 are integers too
+		f, err := n.Float64()
+		return err == nil && f == float64(int64(f))
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	}
+	return false
+}
+
+// "a string or null"
+func typeNames(types []string) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		switch t {
+		case "null":
+			names[i] = "null"
+		case "array", "integer", "object":
+			names[i] = "an " + t
+		default:
+			names[i] = "a " + t
+		}
+	}
+	return strings.Join(names, " or ")
+}
+
+// Enum values are strings and float64s, decoded numbers are compared by value
+func equal(e, v any) bool {
+	if n, ok := v.(json.Number); ok {
+		f, err := n.Float64()
+		switch e := e.(type) {
+		case float64:
+			return err == nil && f == e
+		case int:
+			return err == nil && f == float64(e)
+		}
+		return false
+	}
+	return e == v
+}
+
+// Formats the reflected schemas use, any other format is only a hint
+func checkFormat(format, v string) (code, message string, ok bool) {
+	switch format {
+	case "email":
+		if !validate.IsEmail(v) {
+			return "email", "must be an email address", false
+		}
+	case "uuid":
+		if err := uuid.Validate(v); err != nil {
+			return "uuid", "must be a uuid", false
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339Nano, v); err != nil {
+			return "format", "must be an RFC 3339 date-time", false
+		}
+	case "byte":
+		if _, err := base64.StdEncoding.DecodeString(v); err != nil {
+			return "format", "must be base64", false
+		}
+	}
+	return "", "", true
+}
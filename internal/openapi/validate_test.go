@@ -0,0 +1,139 @@
+package openapi
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func decode(t *testing.T, body string) any {
+	t.Helper()
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		t.Fatalf("failed to decode %s: %v", body, err)
+	}
+	return v
+}
+
+func TestValidate(t *testing.T) {
+	doc := New(Info{Title: "test", Version: "1"})
+	req := doc.Request(tokenRequest{})
+	resp := doc.Response(tokenResponse{})
+	const id = "0b5e5d1c-1c4e-4b8e-9a53-3a0c4f0f0a11"
+	tests := []struct {
+		name   string
+		schema *Schema
+		body   string
+		// "field:code" of every error, in order
+		want []string
+	}{
+		{
+			name:   "Valid Request",
+			schema: req,
+			body:   `{"email":"a@example.com","days":30,"scopes":["notes:read"],"member":{"user_id":"` + id + `","role":"admin"}}`,
+		},
+		{
+			name:   "Missing Fields",
+			schema: req,
+			body:   `{"days":30}`,
+			want:   []string{"email:required", "scopes:required"},
+		},
+		{
+			name:   "Empty Values Count As Missing",
+			schema: req,
+			body:   `{"email":"","scopes":[]}`,
+			want:   []string{"email:required", "scopes:required"},
+		},
+		{
+			name:   "Zero Skips Omitempty Rules",
+			schema: req,
+			body:   `{"email":"a@example.com","days":0,"scopes":["a"]}`,
+		},
+		{
+			name:   "Bad Values",
+			schema: req,
+			body:   `{"email":"nope","days":400,"scopes":["a"],"member":{"user_id":"x","role":"owner"}}`,
+			want:   []string{"days:max", "email:email", "member.role:oneof", "member.user_id:uuid"},
+		},
+		{
+			name:   "Wrong Types",
+			schema: req,
+			body:   `{"email":1,"days":1.5,"scopes":[true]}`,
+			want:   []string{"days:type", "email:type", "scopes[0]:type"},
+		},
+		{
+			name:   "Unknown Field",
+			schema: req,
+			body:   `{"email":"a@example.com","scopes":["a"],"owner":"me"}`,
+			want:   []string{"owner:unknown_field"},
+		},
+		{
+			name:   "Not An Object",
+			schema: req,
+			body:   `[]`,
+			want:   []string{":type"},
+		},
+		{
+			name:   "Valid Response",
+			schema: resp,
+			body:   `{"id":"` + id + `","created_at":"2025-01-02T03:04:05Z","expires_at":null,"member":null,"usage":{"notes":3},"payload":[1]}`,
+		},
+		{
+			name:   "Response Missing Field",
+			schema: resp,
+			body:   `{"id":"` + id + `","created_at":"2025-01-02T03:04:05Z","member":null,"usage":{},"payload":null}`,
+			want:   []string{"expires_at:required"},
+		},
+		{
+			name:   "Response Bad Values",
+			schema: resp,
+			body:   `{"id":"` + id + `","created_at":"yesterday","expires_at":null,"member":{"role":"admin"},"usage":{"notes":"3"},"payload":{}}`,
+			want:   []string{"created_at:format", "member.user_id:required", "usage.notes:type"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, e := range doc.Validate(tt.schema, decode(t, tt.body)) {
+				if e.Message == "" {
+					t.Errorf("%s has no message", e.Field)
+				}
+				got = append(got, e.Field+":"+e.Code)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestValidateParameter(t *testing.T) {
+	doc := New(Info{Title: "test", Version: "1"})
+	tests := []struct {
+		name  string
+		param *Parameter
+		raw   string
+		want  string
+	}{
+		{name: "Valid UUID", param: &Parameter{Name: "noteID", Schema: &Schema{Type: "string", Format: "uuid"}}, raw: "0b5e5d1c-1c4e-4b8e-9a53-3a0c4f0f0a11"},
+		{name: "Bad UUID", param: &Parameter{Name: "noteID", Schema: &Schema{Type: "string", Format: "uuid"}}, raw: "1", want: "noteID:uuid"},
+		{name: "Valid Integer", param: &Parameter{Name: "limit", Schema: &Schema{Type: "integer", Minimum: float(1)}}, raw: "10"},
+		{name: "Integer Below Minimum", param: &Parameter{Name: "limit", Schema: &Schema{Type: "integer", Minimum: float(1)}}, raw: "0", want: "limit:min"},
+		{name: "Not An Integer", param: &Parameter{Name: "limit", Schema: &Schema{Type: "integer"}}, raw: "ten", want: "limit:type"},
+		{name: "Valid Boolean", param: &Parameter{Name: "all", Schema: &Schema{Type: "boolean"}}, raw: "true"},
+		{name: "Not In Enum", param: &Parameter{Name: "status", Schema: &Schema{Type: "string", Enum: []any{"failed", "processed"}}}, raw: "lost", want: "status:oneof"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, e := range doc.ValidateParameter(tt.param, tt.raw) {
+				got = append(got, e.Field+":"+e.Code)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("expected %q, got %v", tt.want, got)
+			}
+		})
+	}
+}
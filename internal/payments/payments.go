@@ -0,0 +1,133 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Header the payment platform signs webhooks in, formatted "t=<unix seconds>,v1=<hex hmac>".
+// Several v1 entries may be present while the platform rotates its secret
+const SignatureHeader = "Payment-Signature"
+
+// How far the signed timestamp may be from our clock before a delivery is treated as a replay
+const DefaultTolerance = 5 * time.Minute
+
+// Event types sent by the payment platform
+const (
+	EventUserUpgraded         = "user.upgraded"
+	EventUserDowngraded       = "user.downgraded"
+	EventSubscriptionRenewed  = "subscription.renewed"
+	EventSubscriptionCanceled = "subscription.canceled"
+	EventInvoicePaid          = "invoice.paid"
+	EventInvoicePaymentFailed = "invoice.payment_failed"
+	// Team subscriptions. Renewals and failed payments of a team subscription use the invoice and
+	// subscription.renewed events above with data.team_id set
+	EventTeamSubscriptionCreated  = "team_subscription.created"
+	EventTeamSeatsChanged         = "team_subscription.seats_changed"
+	EventTeamSubscriptionCanceled = "team_subscription.canceled"
+)
+
+var (
+	ErrMissingSignature = errors.New("missing or malformed signature header")
+	ErrInvalidSignature = errors.New("signature does not match payload")
+	ErrStaleTimestamp   = errors.New("signature timestamp outside of tolerance")
+)
+
+// A webhook event. ID is assigned by the payment platform and is the same for every
+// delivery of one event
+type Event struct {
+	ID   string `json:"id"`
+	Type string `json:"event"`
+	Data struct {
+		UserID uuid.UUID `json:"user_id"`
+		// Set instead of user_id for team subscriptions
+		TeamID         uuid.UUID `json:"team_id"`
+		Seats          int32     `json:"seats"`
+		SubscriptionID string    `json:"subscription_id"`
+		Plan           string    `json:"plan"`
+		// "trialing" for upgrades that start with a trial
+		Status string `json:"status"`
+		// End of the period that was just paid for (or of the trial)
+		CurrentPeriodEnd *time.Time `json:"current_period_end"`
+	} `json:"data"`
+}
+
+func ParseEvent(payload []byte) (Event, error) {
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return Event{}, err
+	}
+	if event.ID == "" {
+		return Event{}, errors.New("event has no id")
+	}
+	if event.Type == "" {
+		return Event{}, errors.New("event has no type")
+	}
+	return event, nil
+}
+
+// Checks the signature header against the raw request body. The signed message is
+// "<timestamp>.<body>" so a captured signature can't be reused with another timestamp
+func VerifySignature(payload []byte, header, secret string, tolerance time.Duration, now time.Time) error {
+	if secret == "" {
+		return errors.New("no webhook secret configured")
+	}
+	var timestamp string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			sig, err := hex.DecodeString(value)
+			if err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return ErrMissingSignature
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrMissingSignature
+	}
+	signedAt := time.Unix(unix, 0)
+	if now.Sub(signedAt) > tolerance || signedAt.Sub(now) > tolerance {
+		return ErrStaleTimestamp
+	}
+	expected := computeSignature(payload, timestamp, secret)
+	for _, sig := range signatures {
+		if hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// Builds a signature header for payload, as the payment platform would
+func Sign(payload []byte, secret string, t time.Time) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", timestamp, hex.EncodeToString(computeSignature(payload, timestamp, secret)))
+}
+
+func computeSignature(payload []byte, timestamp, secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,52 @@
+package payments
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifySignature(t *testing.T) {
+	payload := []byte(`{"id":"evt_1","event":"user.upgraded","data":{"user_id":"00000000-0000-0000-0000-000000000001"}}`)
+	secret := "whsec_test"
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name     string
+		payload  []byte
+		header   string
+		expected error
+	}{
+		{name: "Valid Signature", payload: payload, header: Sign(payload, secret, now)},
+		{name: "One Of Several Signatures", payload: payload, header: Sign(payload, "old_secret", now) + ",v1=" + Sign(payload, secret, now)[len("t=1700000000,v1="):]},
+		{name: "Within Tolerance", payload: payload, header: Sign(payload, secret, now.Add(-4*time.Minute))},
+		{name: "Wrong Secret", payload: payload, header: Sign(payload, "other", now), expected: ErrInvalidSignature},
+		{name: "Tampered Payload", payload: []byte(`{"id":"evt_2"}`), header: Sign(payload, secret, now), expected: ErrInvalidSignature},
+		{name: "Old Timestamp", payload: payload, header: Sign(payload, secret, now.Add(-10*time.Minute)), expected: ErrStaleTimestamp},
+		{name: "Future Timestamp", payload: payload, header: Sign(payload, secret, now.Add(10*time.Minute)), expected: ErrStaleTimestamp},
+		{name: "Missing Header", payload: payload, header: "", expected: ErrMissingSignature},
+		{name: "No Signature", payload: payload, header: "t=1700000000", expected: ErrMissingSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifySignature(tt.payload, tt.header, secret, DefaultTolerance, now)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestParseEvent(t *testing.T) {
+	event, err := ParseEvent([]byte(`{"id":"evt_1","event":"user.upgraded","data":{"user_id":"00000000-0000-0000-0000-000000000001"}}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.ID != "evt_1" || event.Type != EventUserUpgraded || event.Data.UserID.String() != "00000000-0000-0000-0000-000000000001" {
+		t.Errorf("unexpected event %+v", event)
+	}
+	if _, err := ParseEvent([]byte(`{"event":"user.upgraded"}`)); err == nil {
+		t.Error("expected an error for an event without id")
+	}
+}
@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/F0RG-2142/capstone-1/internal/database"
+)
+
+// Keeps buckets in the rate_limits table so every instance shares them. Refills are computed
+// with the database clock, instance clocks don't have to agree
+type PostgresStore struct {
+	DB database.Querier
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (float64, bool, error) {
+	tokens, err := s.DB.TakeRateLimitToken(ctx, database.TakeRateLimitTokenParams{
+		Key:   key,
+		Burst: float64(limit.Burst),
+		Rate:  limit.Rate,
+	})
+	if err == nil {
+		return tokens, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, false, err
+	}
+	//the update was skipped because the bucket is empty, look at how far it has refilled
+	tokens, err = s.DB.PeekRateLimitTokens(ctx, database.PeekRateLimitTokensParams{
+		Burst: float64(limit.Burst),
+		Rate:  limit.Rate,
+		Key:   key,
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	return tokens, false, nil
+}
+
+// Deletes buckets that haven't been used for longer than idle (they are full by then) every
+// interval. Blocks until ctx is cancelled
+func (s *PostgresStore) Prune(ctx context.Context, interval, idle time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.DB.DeleteIdleRateLimits(ctx, idle.Seconds()); err != nil {
+				slog.ErrorContext(ctx, "Error pruning rate limits", "err", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Token bucket: up to Burst requests at once, refilled at Rate requests per second
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+func PerMinute(n int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: n}
+}
+
+// Parses limits like "60/m", "10/s" or "1000/h". The burst is the request count itself
+func ParseLimit(s string) (Limit, error) {
+	count, unit, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, expected e.g. 60/m", s)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, count must be a positive number", s)
+	}
+	var per time.Duration
+	switch unit {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		return Limit{}, fmt.Errorf("invalid rate limit %q, unit must be s, m or h", s)
+	}
+	return Limit{Rate: float64(n) / per.Seconds(), Burst: n}, nil
+}
+
+// Time for an empty bucket to fill up again
+func (l Limit) Window() time.Duration {
+	return time.Duration(float64(l.Burst) / l.Rate * float64(time.Second))
+}
+
+// Where buckets are kept. Take removes one token from the bucket at key if there is one, and
+// returns the tokens left afterwards
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (remaining float64, allowed bool, err error)
+}
+
+// Limits for a group of routes, premium users get their own (usually higher) limit
+type Group struct {
+	Free    Limit
+	Premium Limit
+}
+
+// Route groups used in main.go
+const (
+	GroupAuth  = "auth"
+	GroupRead  = "read"
+	GroupWrite = "write"
+)
+
+// Login and registration are keyed by ip, so premium doesn't apply there
+var DefaultGroups = map[string]Group{
+	GroupAuth:  {Free: PerMinute(20), Premium: PerMinute(20)},
+	GroupRead:  {Free: PerMinute(300), Premium: PerMinute(1200)},
+	GroupWrite: {Free: PerMinute(60), Premium: PerMinute(300)},
+}
+
+type Limiter struct {
+	Store  Store
+	Groups map[string]Group
+}
+
+// Outcome of a request against its bucket, used for the RateLimit-* headers
+type Result struct {
+	Limit     Limit
+	Allowed   bool
+	Remaining int
+	// Until the bucket is full again
+	Reset time.Duration
+	// Until the next request is allowed, 0 if this one was
+	RetryAfter time.Duration
+}
+
+// Takes a token for key from the group's bucket. Groups without limits always allow
+func (l *Limiter) Allow(ctx context.Context, group, key string, premium bool) (Result, error) {
+	g, ok := l.Groups[group]
+	if !ok {
+		return Result{Allowed: true}, nil
+	}
+	limit := g.Free
+	if premium {
+		limit = g.Premium
+	}
+	if limit.Burst <= 0 || limit.Rate <= 0 {
+		return Result{Allowed: true}, nil
+	}
+	remaining, allowed, err := l.Store.Take(ctx, group+"/"+key, limit)
+	if err != nil {
+		return Result{Allowed: true}, err
+	}
+	remaining = max(remaining, 0)
+	res := Result{
+		Limit:     limit,
+		Allowed:   allowed,
+		Remaining: int(math.Floor(remaining)),
+		Reset:     seconds((float64(limit.Burst) - remaining) / limit.Rate),
+	}
+	if !allowed {
+		res.RetryAfter = seconds((1 - remaining) / limit.Rate)
+	}
+	return res, nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expected    Limit
+		expectError bool
+	}{
+		{name: "Per Second", input: "10/s", expected: Limit{Rate: 10, Burst: 10}},
+		{name: "Per Minute", input: "60/m", expected: Limit{Rate: 1, Burst: 60}},
+		{name: "Per Hour", input: "3600/h", expected: Limit{Rate: 1, Burst: 3600}},
+		{name: "Missing Unit", input: "60", expectError: true},
+		{name: "Unknown Unit", input: "60/d", expectError: true},
+		{name: "Zero", input: "0/m", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit, err := ParseLimit(tt.input)
+			if tt.expectError {
+				if err == nil {
+					t.Error("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if limit != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, limit)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreTokenBucket(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limit := Limit{Rate: 1, Burst: 3}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, allowed, _ := store.Take(ctx, "key", limit); !allowed {
+			t.Fatalf("request %d should be allowed within the burst", i+1)
+		}
+	}
+	if _, allowed, _ := store.Take(ctx, "key", limit); allowed {
+		t.Fatal("request past the burst should be refused")
+	}
+	if _, allowed, _ := store.Take(ctx, "other", limit); !allowed {
+		t.Fatal("other keys should have their own bucket")
+	}
+
+	now = now.Add(time.Second)
+	remaining, allowed, _ := store.Take(ctx, "key", limit)
+	if !allowed || remaining != 0 {
+		t.Fatalf("expected one refilled token to be taken, got allowed=%v remaining=%v", allowed, remaining)
+	}
+
+	now = now.Add(time.Hour)
+	remaining, _, _ = store.Take(ctx, "key", limit)
+	if remaining != 2 {
+		t.Errorf("bucket should refill up to the burst only, got %v remaining", remaining)
+	}
+}
+
+func TestLimiterAllow(t *testing.T) {
+	limiter := &Limiter{
+		Store: NewMemoryStore(),
+		Groups: map[string]Group{
+			GroupWrite: {Free: PerMinute(1), Premium: PerMinute(2)},
+		},
+	}
+	ctx := context.Background()
+
+	res, _ := limiter.Allow(ctx, GroupWrite, "user:free", false)
+	if !res.Allowed || res.Remaining != 0 || res.Limit.Burst != 1 {
+		t.Fatalf("unexpected first result %+v", res)
+	}
+	res, _ = limiter.Allow(ctx, GroupWrite, "user:free", false)
+	if res.Allowed {
+		t.Fatal("free user should be limited after one request")
+	}
+	if res.RetryAfter <= 0 || res.RetryAfter > time.Minute {
+		t.Errorf("expected a retry after of up to a minute, got %v", res.RetryAfter)
+	}
+
+	for i := 0; i < 2; i++ {
+		if res, _ := limiter.Allow(ctx, GroupWrite, "user:premium", true); !res.Allowed {
+			t.Fatalf("premium request %d should be allowed", i+1)
+		}
+	}
+
+	if res, _ := limiter.Allow(ctx, "unknown", "user:free", false); !res.Allowed {
+		t.Error("groups without limits should always allow")
+	}
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/F0RG-2142/capstone-1/internal/apierror"
+)
+
+type Config struct {
+	// Address to listen on, e.g. ":8080"
+	Addr              string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	// Largest request body handlers can read, bigger bodies fail to read with *http.MaxBytesError
+	MaxBodyBytes int64
+	// How long to keep serving after reporting not ready, so load balancers stop sending traffic
+	// before connections are closed
+	ShutdownDelay time.Duration
+	// Deadline for in-flight requests and background workers to finish
+	ShutdownTimeout time.Duration
+	// Serves HTTPS (and HTTP/2) with it when set, see NewTLSConfig
+	TLS *tls.Config
+	// Plain HTTP address redirecting every request to HTTPS, e.g. ":80". Only used with TLS
+	RedirectAddr string
+}
+
+var DefaultConfig = Config{
+	Addr:              ":8080",
+	ReadTimeout:       15 * time.Second,
+	ReadHeaderTimeout: 5 * time.Second,
+	WriteTimeout:      30 * time.Second,
+	IdleTimeout:       2 * time.Minute,
+	MaxHeaderBytes:    64 << 10,
+	MaxBodyBytes:      1 << 20,
+	ShutdownDelay:     5 * time.Second,
+	ShutdownTimeout:   30 * time.Second,
+}
+
+// Liveness and readiness of the process. Live means the process works at all (restart it if not),
+// ready means it should be sent traffic. Readiness is dropped as soon as shutdown starts
+type Health struct {
+	live  atomic.Bool
+	ready atomic.Bool
+}
+
+func (h *Health) Live() bool {
+	return h.live.Load()
+}
+
+func (h *Health) Ready() bool {
+	return h.ready.Load()
+}
+
+func (h *Health) SetReady(ready bool) {
+	h.ready.Store(ready)
+}
+
+// Serves handler until ctx is cancelled (e.g. on SIGTERM), then shuts down gracefully: reports not
+// ready, waits ShutdownDelay, stops accepting connections and waits for in-flight requests and
+// workers until ShutdownTimeout runs out
+func Run(ctx context.Context, cfg Config, handler http.Handler, health *Health, workers *Workers) error {
+	servers := []*http.Server{newHTTPServer(cfg, LimitBody(handler, cfg.MaxBodyBytes))}
+	servers[0].TLSConfig = cfg.TLS
+	addrs := []string{cfg.Addr}
+	if cfg.TLS != nil && cfg.RedirectAddr != "" {
+		servers = append(servers, newHTTPServer(cfg, RedirectHTTPS(cfg.Addr)))
+		addrs = append(addrs, cfg.RedirectAddr)
+	}
+	var listeners []net.Listener
+	for _, addr := range addrs {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, ln := range listeners {
+				ln.Close()
+			}
+			return fmt.Errorf("listening on %s: %w", addr, err)
+		}
+		listeners = append(listeners, ln)
+	}
+	serveErr := make(chan error, len(servers))
+	for i, srv := range servers {
+		go func() {
+			if srv.TLSConfig != nil {
+				//certificates come from TLSConfig.GetCertificate
+				serveErr <- srv.ServeTLS(listeners[i], "", "")
+				return
+			}
+			serveErr <- srv.Serve(listeners[i])
+		}()
+	}
+	health.live.Store(true)
+	health.SetReady(true)
+	slog.Info("Listening", "addr", listeners[0].Addr().String(), "tls", cfg.TLS != nil)
+	if len(listeners) > 1 {
+		slog.Info("Redirecting to HTTPS", "addr", listeners[1].Addr().String())
+	}
+
+	pending := len(servers)
+	select {
+	case err := <-serveErr:
+		pending--
+		if !errors.Is(err, http.ErrServerClosed) {
+			//one server failing takes the others down with it
+			health.SetReady(false)
+			for _, srv := range servers {
+				srv.Close()
+			}
+			for range pending {
+				<-serveErr
+			}
+			workers.Stop(context.Background())
+			health.live.Store(false)
+			return err
+		}
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down", "delay", cfg.ShutdownDelay.String(), "timeout", cfg.ShutdownTimeout.String())
+	health.SetReady(false)
+	time.Sleep(cfg.ShutdownDelay)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	var errs []error
+	for _, srv := range servers {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			errs = append(errs, fmt.Errorf("draining connections: %w", err))
+			//whatever is left is cut off
+			srv.Close()
+		}
+	}
+	if err := workers.Stop(shutdownCtx); err != nil {
+		errs = append(errs, err)
+	}
+	for range pending {
+		if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+			errs = append(errs, err)
+		}
+	}
+	health.live.Store(false)
+	return errors.Join(errs...)
+}
+
+func newHTTPServer(cfg Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+}
+
+// Caps how much of a request body handlers can read. 0 or less means no limit
+func LimitBody(next http.Handler, maxBytes int64) http.Handler {
+	if maxBytes <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > maxBytes {
+			apierror.Write(w, r, apierror.New(http.StatusRequestEntityTooLarge, apierror.CodeBodyTooLarge, "Request body too large").With("max_bytes", maxBytes))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWorkersStop(t *testing.T) {
+	tests := []struct {
+		name        string
+		worker      func(ctx context.Context)
+		expectError bool
+	}{
+		{name: "Returns On Cancel", worker: func(ctx context.Context) { <-ctx.Done() }, expectError: false},
+		{name: "Ignores Cancel", worker: func(ctx context.Context) { time.Sleep(time.Second) }, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workers := NewWorkers()
+			workers.Go("test", tt.worker)
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			err := workers.Stop(ctx)
+			if tt.expectError && err == nil {
+				t.Error("expected error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLimitBody(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{name: "Within Limit", body: "0123456789", expectedStatus: http.StatusOK},
+		{name: "Too Large", body: strings.Repeat("x", 11), expectedStatus: http.StatusRequestEntityTooLarge},
+	}
+
+	handler := LimitBody(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		}
+	}), 10)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			//unknown length, so the limit is only hit while reading
+			req.ContentLength = -1
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected %d, got %d", tt.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
+
+// In-flight requests finish during shutdown and readiness drops before the listener closes
+func TestRunDrains(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		_, _ = w.Write([]byte("done"))
+	})
+	cfg := DefaultConfig
+	cfg.Addr = addr
+	cfg.ShutdownDelay = 0
+	cfg.ShutdownTimeout = 2 * time.Second
+	ctx, cancel := context.WithCancel(context.Background())
+	health := &Health{}
+	workers := NewWorkers()
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- Run(ctx, cfg, handler, health, workers)
+	}()
+
+	var resp *http.Response
+	respErr := make(chan error, 1)
+	go func() {
+		for i := 0; i < 50; i++ {
+			resp, err = http.Get("http://" + addr)
+			if err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		respErr <- err
+	}()
+	<-started
+	if !health.Ready() {
+		t.Error("expected server to be ready while serving")
+	}
+	cancel()
+	if err := <-respErr; err != nil {
+		t.Fatalf("in-flight request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "done" {
+		t.Errorf("expected in-flight request to finish, got %q", body)
+	}
+	if err := <-runErr; err != nil {
+		t.Errorf("expected clean shutdown, got %v", err)
+	}
+	if health.Ready() || health.Live() {
+		t.Error("expected server to be neither ready nor live after shutdown")
+	}
+}
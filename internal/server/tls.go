@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Certificate and key read from disk and re-read when either file changes, so renewed
+// certificates (e.g. from cert-manager or certbot) are picked up without a restart
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	c := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// For tls.Config.GetCertificate
+func (c *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// Loads the pair again if either file changed since the last load. A pair that fails to load is
+// reported and the previous certificate is kept
+func (c *CertReloader) Reload() (bool, error) {
+	modTime, err := c.latestModTime()
+	if err != nil {
+		return false, err
+	}
+	c.mu.RLock()
+	unchanged := c.cert != nil && modTime.Equal(c.modTime)
+	c.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	c.mu.Lock()
+	c.cert = &cert
+	c.modTime = modTime
+	c.mu.Unlock()
+	return true, nil
+}
+
+func (c *CertReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("loading TLS certificate: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// Checks the files for changes every interval. Blocks until ctx is cancelled
+func (c *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := c.Reload()
+			if err != nil {
+				slog.ErrorContext(ctx, "Error reloading TLS certificate, keeping the current one", "err", err)
+			} else if reloaded {
+				slog.InfoContext(ctx, "Reloaded TLS certificate", "cert_file", c.certFile)
+			}
+		}
+	}
+}
+
+// "1.2" or "1.3", empty means 1.2
+func ParseTLSVersion(s string) (uint16, error) {
+	switch s {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS version %q, use 1.2 or 1.3", s)
+	}
+}
+
+// Cipher suites by their Go names (e.g. TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256). Only suites Go
+// considers secure are accepted. They only apply to TLS 1.2, TLS 1.3 suites aren't configurable
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	var ids []uint16
+	for _, name := range names {
+		id, ok := cipherSuiteID(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func cipherSuiteID(name string) (uint16, bool) {
+	for _, suite := range tls.CipherSuites() {
+		if strings.EqualFold(suite.Name, name) {
+			return suite.ID, true
+		}
+	}
+	return 0, false
+}
+
+type TLSOptions struct {
+	MinVersion   string
+	CipherSuites []string
+	// PEM bundle of CAs client certificates are verified against. Clients may then present a
+	// certificate, whether a route requires one is up to its handler (see tls.ConnectionState)
+	ClientCAFile string
+}
+
+// Server TLS config serving the reloader's certificate
+func NewTLSConfig(certs *CertReloader, opts TLSOptions) (*tls.Config, error) {
+	minVersion, err := ParseTLSVersion(opts.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	suites, err := ParseCipherSuites(opts.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		GetCertificate: certs.GetCertificate,
+		MinVersion:     minVersion,
+		CipherSuites:   suites,
+	}
+	if opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(opts.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("client CA file contains no certificates")
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return cfg, nil
+}
+
+// Sets Strict-Transport-Security on responses sent over TLS. 0 or less turns it off
+func HSTS(next http.Handler, maxAge time.Duration, includeSubdomains bool) http.Handler {
+	if maxAge <= 0 {
+		return next
+	}
+	value := "max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+	if includeSubdomains {
+		value += "; includeSubDomains"
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			w.Header().Set("Strict-Transport-Security", value)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Redirects every request to the same URL on https. httpsAddr is the TLS listen address, its port
+// is added to the host unless it is 443
+func RedirectHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			//bare IPv6 address
+			host = "[" + host + "]"
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		//308 keeps the method and body, unlike 301
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
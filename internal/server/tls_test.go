@@ -0,0 +1,296 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Writes a self-signed certificate for 127.0.0.1 and its key to dir and returns the certificate
+func writeTestCert(t *testing.T, dir, commonName string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(filepath.Join(dir, "tls.crt"), certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "tls.key"), keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// Moves the modification time of the pair forward, writes within the same clock tick would
+// otherwise look unchanged
+func touch(t *testing.T, dir string, at time.Time) {
+	t.Helper()
+	for _, name := range []string{"tls.crt", "tls.key"} {
+		if err := os.Chtimes(filepath.Join(dir, name), at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func servedCommonName(t *testing.T, c *CertReloader) string {
+	t.Helper()
+	cert, err := c.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	writeTestCert(t, dir, "first")
+	certs, err := NewCertReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reloaded, err := certs.Reload(); reloaded || err != nil {
+		t.Errorf("expected no reload for unchanged files, got %v, %v", reloaded, err)
+	}
+
+	writeTestCert(t, dir, "second")
+	touch(t, dir, time.Now().Add(time.Minute))
+	if reloaded, err := certs.Reload(); !reloaded || err != nil {
+		t.Fatalf("expected reload, got %v, %v", reloaded, err)
+	}
+	if name := servedCommonName(t, certs); name != "second" {
+		t.Errorf("expected the new certificate, got %q", name)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "tls.crt"), []byte("half written"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, dir, time.Now().Add(2*time.Minute))
+	if _, err := certs.Reload(); err == nil {
+		t.Error("expected error for a broken certificate, got nil")
+	}
+	if name := servedCommonName(t, certs); name != "second" {
+		t.Errorf("expected the previous certificate to be kept, got %q", name)
+	}
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected uint16
+		wantErr  bool
+	}{
+		{name: "Default", input: "", expected: tls.VersionTLS12},
+		{name: "TLS 1.3", input: "1.3", expected: tls.VersionTLS13},
+		{name: "TLS 1.1", input: "1.1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTLSVersion(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %x, got %x", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []string
+		wantErr bool
+	}{
+		{name: "Secure", input: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "tls_ecdhe_rsa_with_chacha20_poly1305_sha256"}},
+		{name: "Insecure", input: []string{"TLS_RSA_WITH_RC4_128_SHA"}, wantErr: true},
+		{name: "Unknown", input: []string{"TLS_FAST"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCipherSuites(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && len(got) != len(tt.input) {
+				t.Errorf("expected %d suites, got %v", len(tt.input), got)
+			}
+		})
+	}
+}
+
+func TestRedirectHTTPS(t *testing.T) {
+	tests := []struct {
+		name      string
+		httpsAddr string
+		host      string
+		expected  string
+	}{
+		{name: "Default Port", httpsAddr: ":443", host: "notes.example.com", expected: "https://notes.example.com/api/v1/notes?page=2"},
+		{name: "Drops HTTP Port", httpsAddr: ":443", host: "notes.example.com:80", expected: "https://notes.example.com/api/v1/notes?page=2"},
+		{name: "Custom Port", httpsAddr: ":8443", host: "localhost:8080", expected: "https://localhost:8443/api/v1/notes?page=2"},
+		{name: "IPv6", httpsAddr: ":443", host: "[::1]:80", expected: "https://[::1]/api/v1/notes?page=2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/notes?page=2", nil)
+			req.Host = tt.host
+			rec := httptest.NewRecorder()
+			RedirectHTTPS(tt.httpsAddr).ServeHTTP(rec, req)
+			if rec.Code != http.StatusPermanentRedirect {
+				t.Errorf("expected 308, got %d", rec.Code)
+			}
+			if got := rec.Header().Get("Location"); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestHSTS(t *testing.T) {
+	handler := HSTS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), 365*24*time.Hour, true)
+	tests := []struct {
+		name     string
+		tls      *tls.ConnectionState
+		expected string
+	}{
+		{name: "HTTPS", tls: &tls.ConnectionState{}, expected: "max-age=31536000; includeSubDomains"},
+		{name: "Plain HTTP", tls: nil, expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.TLS = tt.tls
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if got := rec.Header().Get("Strict-Transport-Security"); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// Serves HTTP/2 over TLS with the client CA requested but optional, and redirects plain HTTP
+func TestRunTLS(t *testing.T) {
+	dir := t.TempDir()
+	serverCert := writeTestCert(t, dir, "server")
+	certs, err := NewCertReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig, err := NewTLSConfig(certs, TLSOptions{MinVersion: "1.2", ClientCAFile: filepath.Join(dir, "tls.crt")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig.ClientAuth != tls.VerifyClientCertIfGiven {
+		t.Errorf("expected client certificates to be optional, got %v", tlsConfig.ClientAuth)
+	}
+
+	cfg := DefaultConfig
+	cfg.Addr = freeAddr(t)
+	cfg.RedirectAddr = freeAddr(t)
+	cfg.TLS = tlsConfig
+	cfg.ShutdownDelay = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	health := &Health{}
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- Run(ctx, cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Proto", r.Proto)
+		}), health, NewWorkers())
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for !health.Ready() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(serverCert)
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}, ForceAttemptHTTP2: true},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get("https://" + cfg.Addr + "/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("X-Proto") != "HTTP/2.0" {
+		t.Errorf("expected HTTP/2, got %q", resp.Header.Get("X-Proto"))
+	}
+
+	resp, err = client.Get("http://" + cfg.RedirectAddr + "/api/v1/notes")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	_, port, _ := net.SplitHostPort(cfg.Addr)
+	if expected := "https://127.0.0.1:" + port + "/api/v1/notes"; resp.Header.Get("Location") != expected {
+		t.Errorf("expected redirect to %q, got %d %q", expected, resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	cancel()
+	if err := <-runErr; err != nil {
+		t.Errorf("expected clean shutdown, got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Background jobs that run for the lifetime of the server (key rotation, subscription expiry, rate
+// limit pruning). They get a context that is cancelled on shutdown and are waited for
+type Workers struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+func NewWorkers() *Workers {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Workers{ctx: ctx, cancel: cancel, running: map[string]bool{}}
+}
+
+// Runs fn in its own goroutine until it returns, fn must return once ctx is cancelled
+func (w *Workers) Go(name string, fn func(ctx context.Context)) {
+	w.mu.Lock()
+	w.running[name] = true
+	w.mu.Unlock()
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer func() {
+			w.mu.Lock()
+			w.running[name] = false
+			w.mu.Unlock()
+		}()
+		fn(w.ctx)
+	}()
+}
+
+// Names of workers that have returned, sorted. Outside of shutdown that means a worker died
+func (w *Workers) Stopped() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var stopped []string
+	for name, running := range w.running {
+		if !running {
+			stopped = append(stopped, name)
+		}
+	}
+	sort.Strings(stopped)
+	return stopped
+}
+
+// Cancels the workers and waits for them to return or ctx to run out
+func (w *Workers) Stop(ctx context.Context) error {
+	w.cancel()
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		var stuck []string
+		w.mu.Lock()
+		for name, running := range w.running {
+			if running {
+				stuck = append(stuck, name)
+			}
+		}
+		w.mu.Unlock()
+		sort.Strings(stuck)
+		slog.Warn("Background workers did not stop in time", "workers", stuck)
+		return fmt.Errorf("workers still running: %s", strings.Join(stuck, ", "))
+	}
+}
@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/F0RG-2142/capstone-1/internal/database"
+	"github.com/F0RG-2142/capstone-1/internal/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Wraps the connection sqlc queries run on and records a client span per query, named after the
+// sqlc query. Like metrics.DB, spans of queries returning rows end once the first row is ready
+type DB struct {
+	database.DBTX
+}
+
+func TraceDB(db database.DBTX) *DB {
+	return &DB{DBTX: db}
+}
+
+func (d *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuery(ctx, query)
+	res, err := d.DBTX.ExecContext(ctx, query, args...)
+	endQuery(span, err)
+	return res, err
+}
+
+func (d *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startQuery(ctx, query)
+	rows, err := d.DBTX.QueryContext(ctx, query, args...)
+	endQuery(span, err)
+	return rows, err
+}
+
+func (d *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startQuery(ctx, query)
+	row := d.DBTX.QueryRowContext(ctx, query, args...)
+	endQuery(span, row.Err())
+	return row
+}
+
+// Only the query text is recorded, never the arguments (they hold passwords and tokens)
+func startQuery(ctx context.Context, query string) (context.Context, trace.Span) {
+	name := metrics.QueryName(query)
+	return Tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system.name", "postgresql"),
+			attribute.String("db.operation.name", name),
+			attribute.String("db.query.text", query),
+		),
+	)
+}
+
+func endQuery(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
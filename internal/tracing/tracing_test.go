@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// DBTX that fails every call with err
+type fakeDB struct {
+	err error
+}
+
+func (f fakeDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return nil, f.err
+}
+
+func (f fakeDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return nil, f.err
+}
+
+func (f fakeDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, f.err
+}
+
+func (f fakeDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return nil
+}
+
+func TestTraceDB(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		err          error
+		expectedName string
+		expectedCode codes.Code
+	}{
+		{name: "Success", query: "-- name: DeleteNote :exec\nDELETE FROM notes", expectedName: "DeleteNote", expectedCode: codes.Unset},
+		{name: "Failure", query: "-- name: NewNote :exec\nINSERT INTO notes", err: errors.New("connection reset"), expectedName: "NewNote", expectedCode: codes.Error},
+		{name: "No Rows Is Not An Error", query: "-- name: GetNote :exec\nSELECT 1", err: sql.ErrNoRows, expectedName: "GetNote", expectedCode: codes.Unset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+			_, _ = TraceDB(fakeDB{err: tt.err}).ExecContext(context.Background(), tt.query)
+			spans := recorder.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("expected 1 span, got %d", len(spans))
+			}
+			if spans[0].Name() != tt.expectedName {
+				t.Errorf("expected span %s, got %s", tt.expectedName, spans[0].Name())
+			}
+			if spans[0].Status().Code != tt.expectedCode {
+				t.Errorf("expected status %v, got %v", tt.expectedCode, spans[0].Status().Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+// Package validate decodes JSON request bodies strictly and checks them against `validate` struct
+// tags, so handlers don't hand-roll their own checks:
+//
+//	var req struct {
+//		Email string    `json:"email" validate:"required,email,max=254"`
+//		Role  string    `json:"role" validate:"required,oneof=admin editor viewer"`
+//		Team  uuid.UUID `json:"team_id" validate:"required"`
+//	}
+//
+// Rules are separated by commas and checked in order, the first one a field fails is reported:
+//
+//	required     not the zero value (non-empty string or slice, non-nil uuid)
+//	omitempty    skip the other rules when the field is the zero value
+//	email        an address like user@example.com
+//	uuid         a string holding a uuid
+//	oneof=a b c  one of the space separated values
+//	min=n max=n  length in characters for strings, number of items for slices, value for numbers
+//	maxbytes=n   length of a string in bytes, reported as max (bcrypt's 72 byte password limit)
+//
+// Nested structs are checked too, their fields are reported as "parent.child"
+package validate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/F0RG-2142/capstone-1/internal/apierror"
+	"github.com/google/uuid"
+)
+
+// Largest body DecodeJSON reads, on top of whatever limit the server has
+const MaxBodyBytes = 1 << 20
+
+// Codes of the field errors, next to the rule names
+const (
+	CodeUnknownField = "unknown_field"
+	CodeType         = "type"
+)
+
+// Decodes the JSON body of r into v and validates it. The body may hold only one object and no
+// fields v doesn't have. Returns an *apierror.Error: 400 for bodies that aren't JSON, 413 when the
+// body is too large and 422 listing every invalid field, unknown and mistyped ones first
+func DecodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	if r.Body == nil {
+		return apierror.InvalidBody(io.EOF)
+	}
+	defer r.Body.Close()
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxBodyBytes))
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return apierror.InvalidBody(err)
+	}
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return apierror.InvalidBody(errors.New("body must hold a single JSON object"))
+	}
+	//encoding/json carries on past a bad field but only returns the first one
+	err := decodeStrict(raw, v)
+	var fields []apierror.FieldError
+	if err != nil {
+		fields = fieldErrors(reflect.TypeOf(v), raw, "")
+		if len(fields) == 0 {
+			return apierror.InvalidBody(err)
+		}
+	}
+	//a mistyped field is left empty, its rules would only repeat the error
+	for _, fe := range Struct(v) {
+		if !slices.ContainsFunc(fields, func(d apierror.FieldError) bool {
+			return fe.Field == d.Field || strings.HasPrefix(fe.Field, d.Field+".")
+		}) {
+			fields = append(fields, fe)
+		}
+	}
+	if len(fields) > 0 {
+		e := apierror.Validation(fields...)
+		e.Err = err
+		return e
+	}
+	return nil
+}
+
+func decodeStrict(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// Every unknown and mistyped field of data decoded into a t, found by decoding the keys of objects
+// one at a time. Keys are reported in sorted order
+func fieldErrors(t reflect.Type, data json.RawMessage, prefix string) []apierror.FieldError {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var obj map[string]json.RawMessage
+	if t.Kind() != reflect.Struct || reflect.PointerTo(t).Implements(unmarshalerType) || json.Unmarshal(data, &obj) != nil || obj == nil {
+		if fe, ok := fieldError(decodeStrict(data, reflect.New(t).Interface()), prefix); ok {
+			return []apierror.FieldError{fe}
+		}
+		return nil
+	}
+	var fields []apierror.FieldError
+	for _, key := range slices.Sorted(maps.Keys(obj)) {
+		one, _ := json.Marshal(map[string]json.RawMessage{key: obj[key]})
+		err := decodeStrict(one, reflect.New(t).Interface())
+		if err == nil {
+			continue
+		}
+		if sf, ok := fieldByKey(t, key); ok {
+			if nested := fieldErrors(sf.Type, obj[key], joinField(prefix, jsonName(sf))); len(nested) > 0 {
+				fields = append(fields, nested...)
+				continue
+			}
+		}
+		if fe, ok := fieldError(err, prefix); ok {
+			fields = append(fields, fe)
+		}
+	}
+	return fields
+}
+
+// The field encoding/json puts key in, an exact match first and then one ignoring case
+func fieldByKey(t reflect.Type, key string) (reflect.StructField, bool) {
+	for _, match := range []func(a, b string) bool{func(a, b string) bool { return a == b }, strings.EqualFold} {
+		for i := range t.NumField() {
+			sf := t.Field(i)
+			if sf.IsExported() && !sf.Anonymous && jsonName(sf) != "-" && match(jsonName(sf), key) {
+				return sf, true
+			}
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func joinField(prefix, name string) string {
+	if prefix == "" || name == "" {
+		return prefix + name
+	}
+	return prefix + "." + name
+}
+
+// Decoding errors that can be pinned on a field are a 422 like failed rules, anything else means
+// the body isn't JSON
+func fieldError(err error, prefix string) (apierror.FieldError, bool) {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		if field := joinField(prefix, typeErr.Field); field != "" {
+			return apierror.FieldError{Field: field, Code: CodeType, Message: "must be " + jsonType(typeErr.Type)}, true
+		}
+		return apierror.FieldError{}, false
+	}
+	//encoding/json doesn't have a type for it
+	if err != nil {
+		if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			name, _ = strconv.Unquote(name)
+			return apierror.FieldError{Field: joinField(prefix, name), Code: CodeUnknownField, Message: "is not a known field"}, true
+		}
+	}
+	return apierror.FieldError{}, false
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		if t == reflect.TypeOf(uuid.UUID{}) {
+			return "a uuid"
+		}
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	}
+	return "a " + t.Kind().String()
+}
+
+// Checks the `validate` tags of v, a struct or a pointer to one, and returns every failing field
+func Struct(v any) []apierror.FieldError {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	var fields []apierror.FieldError
+	checkStruct(rv, "", &fields)
+	return fields
+}
+
+func checkStruct(rv reflect.Value, prefix string, fields *[]apierror.FieldError) {
+	rt := rv.Type()
+	for i := range rt.NumField() {
+		sf := rt.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name := jsonName(sf)
+		if name == "-" {
+			continue
+		}
+		name = prefix + name
+		fv := rv.Field(i)
+		if tag := sf.Tag.Get("validate"); tag != "" {
+			if fe, ok := checkField(fv, tag); !ok {
+				fe.Field = name
+				*fields = append(*fields, fe)
+				continue
+			}
+		}
+		for fv.Kind() == reflect.Pointer && !fv.IsNil() {
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Struct && fv.Type() != reflect.TypeOf(uuid.UUID{}) {
+			checkStruct(fv, name+".", fields)
+		}
+	}
+}
+
+func jsonName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" {
+		return sf.Name
+	}
+	return name
+}
+
+// Runs the rules of tag against v, stops at the first that fails
+func checkField(v reflect.Value, tag string) (apierror.FieldError, bool) {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v = reflect.Zero(v.Type().Elem())
+			break
+		}
+		v = v.Elem()
+	}
+	for _, rule := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch name {
+		case "omitempty":
+			if v.IsZero() {
+				return apierror.FieldError{}, true
+			}
+		case "required":
+			if v.IsZero() || (v.Kind() == reflect.Slice && v.Len() == 0) {
+				return fail(name, "is required")
+			}
+		case "email":
+			if !IsEmail(v.String()) {
+				return fail(name, "must be an email address")
+			}
+		case "uuid":
+			if err := uuid.Validate(v.String()); err != nil {
+				return fail(name, "must be a uuid")
+			}
+		case "oneof":
+			allowed := strings.Fields(arg)
+			if !slices.Contains(allowed, fmt.Sprint(v.Interface())) {
+				return fail(name, "must be one of "+strings.Join(allowed, ", "))
+			}
+		case "min", "max":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				panic(fmt.Sprintf("validate: bad %s rule %q", name, rule))
+			}
+			size, unit := measure(v)
+			if name == "min" && size < limit {
+				return fail(name, fmt.Sprintf("must be at least %s%s", arg, unit))
+			}
+			if name == "max" && size > limit {
+				return fail(name, fmt.Sprintf("must be at most %s%s", arg, unit))
+			}
+		case "maxbytes":
+			limit, err := strconv.Atoi(arg)
+			if err != nil {
+				panic(fmt.Sprintf("validate: bad %s rule %q", name, rule))
+			}
+			if len(v.String()) > limit {
+				return fail("max", fmt.Sprintf("must be at most %s bytes", arg))
+			}
+		default:
+			panic(fmt.Sprintf("validate: unknown rule %q", rule))
+		}
+	}
+	return apierror.FieldError{}, true
+}
+
+func fail(code, message string) (apierror.FieldError, bool) {
+	return apierror.FieldError{Code: code, Message: message}, false
+}
+
+// Size min and max compare against, with the unit to put in the message
+func measure(v reflect.Value) (float64, string) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), ""
+	}
+	panic(fmt.Sprintf("validate: min and max don't apply to %s", v.Kind()))
+}
+
+// Whether s is a bare address, no display name or angle brackets, with a dot in the domain
+func IsEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s || addr.Name != "" {
+		return false
+	}
+	_, domain, _ := strings.Cut(s, "@")
+	return strings.Contains(domain, ".") && !strings.HasSuffix(domain, ".")
+}
@@ -0,0 +1,126 @@
+package validate
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/F0RG-2142/capstone-1/internal/apierror"
+	"github.com/google/uuid"
+)
+
+type member struct {
+	UserID uuid.UUID `json:"user_id" validate:"required"`
+	Role   string    `json:"role" validate:"required,oneof=admin editor viewer"`
+}
+
+type request struct {
+	Email   string   `json:"email" validate:"required,email,max=254"`
+	Name    string   `json:"name" validate:"omitempty,min=2,max=5"`
+	TeamID  string   `json:"team_id" validate:"omitempty,uuid"`
+	Days    int      `json:"days" validate:"omitempty,min=1,max=366"`
+	Scopes  []string `json:"scopes" validate:"required,max=2"`
+	Member  member   `json:"member"`
+	Comment *string  `json:"comment" validate:"omitempty,max=3"`
+	Secret  string   `json:"secret" validate:"maxbytes=4"`
+}
+
+func valid() request {
+	return request{
+		Email:  "user@example.com",
+		Scopes: []string{"notes:read"},
+		Member: member{UserID: uuid.New(), Role: "viewer"},
+	}
+}
+
+func TestStruct(t *testing.T) {
+	long := "long comment"
+	tests := []struct {
+		name   string
+		modify func(*request)
+		want   []string
+	}{
+		{name: "Valid", modify: func(r *request) {}},
+		{name: "Missing Required", modify: func(r *request) { r.Email, r.Scopes = "", nil }, want: []string{"email:required", "scopes:required"}},
+		{name: "Invalid Email", modify: func(r *request) { r.Email = "Name <user@example.com>" }, want: []string{"email:email"}},
+		{name: "Email Without Domain Dot", modify: func(r *request) { r.Email = "user@localhost" }, want: []string{"email:email"}},
+		{name: "Too Short", modify: func(r *request) { r.Name = "a" }, want: []string{"name:min"}},
+		{name: "Too Long In Characters", modify: func(r *request) { r.Name = "héllos" }, want: []string{"name:max"}},
+		{name: "Multibyte Within Max", modify: func(r *request) { r.Name = "héllo" }},
+		{name: "Bad UUID", modify: func(r *request) { r.TeamID = "team-1" }, want: []string{"team_id:uuid"}},
+		{name: "Number Out Of Range", modify: func(r *request) { r.Days = 400 }, want: []string{"days:max"}},
+		{name: "Negative Number", modify: func(r *request) { r.Days = -1 }, want: []string{"days:min"}},
+		{name: "Too Many Items", modify: func(r *request) { r.Scopes = []string{"a", "b", "c"} }, want: []string{"scopes:max"}},
+		{name: "Nested", modify: func(r *request) { r.Member = member{Role: "owner"} }, want: []string{"member.user_id:required", "member.role:oneof"}},
+		{name: "Multibyte Within Max Bytes", modify: func(r *request) { r.Secret = "héy" }},
+		{name: "Too Long In Bytes", modify: func(r *request) { r.Secret = "héyy" }, want: []string{"secret:max"}},
+		{name: "Pointer", modify: func(r *request) { r.Comment = &long }, want: []string{"comment:max"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid()
+			tt.modify(&req)
+			var got []string
+			for _, fe := range Struct(&req) {
+				got = append(got, fe.Field+":"+fe.Code)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	member := `{"user_id":"` + uuid.NewString() + `","role":"admin"}`
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantFields []string
+	}{
+		{name: "Valid", body: `{"email":"user@example.com","scopes":["a"],"member":` + member + `}`},
+		{name: "Empty Body", body: ``, wantStatus: http.StatusBadRequest},
+		{name: "Malformed", body: `{"email":`, wantStatus: http.StatusBadRequest},
+		{name: "Trailing Data", body: `{"email":"user@example.com"} {}`, wantStatus: http.StatusBadRequest},
+		{name: "Unknown Field", body: `{"email":"user@example.com","scopes":["a"],"member":` + member + `,"admin":true}`, wantStatus: http.StatusUnprocessableEntity, wantFields: []string{"admin"}},
+		{name: "Wrong Type", body: `{"email":"user@example.com","scopes":["a"],"member":` + member + `,"days":"ten"}`, wantStatus: http.StatusUnprocessableEntity, wantFields: []string{"days"}},
+		{name: "Every Failing Field", body: `{"email":"nope","member":{"role":"owner"}}`, wantStatus: http.StatusUnprocessableEntity, wantFields: []string{"email", "scopes", "member.user_id", "member.role"}},
+		{name: "Every Unknown And Mistyped Field", body: `{"email":1,"days":"ten","admin":true,"scopes":["a"],"member":{"user_id":"` + uuid.NewString() + `","role":2,"owner":true}}`, wantStatus: http.StatusUnprocessableEntity, wantFields: []string{"admin", "days", "email", "member.owner", "member.role"}},
+		{name: "Mistyped Object", body: `{"email":"user@example.com","scopes":["a"],"member":5}`, wantStatus: http.StatusUnprocessableEntity, wantFields: []string{"member"}},
+		{name: "Not An Object", body: `[]`, wantStatus: http.StatusBadRequest},
+		{name: "Too Large", body: `{"email":"` + strings.Repeat("a", MaxBodyBytes) + `"}`, wantStatus: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			var req request
+			err := DecodeJSON(httptest.NewRecorder(), r, &req)
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var apiErr *apierror.Error
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("expected an *apierror.Error, got %v", err)
+			}
+			if apiErr.Status != tt.wantStatus {
+				t.Errorf("expected status %d, got %d (%v)", tt.wantStatus, apiErr.Status, err)
+			}
+			var fields []string
+			for _, fe := range apiErr.Fields {
+				fields = append(fields, fe.Field)
+			}
+			if !slices.Equal(fields, tt.wantFields) {
+				t.Errorf("expected fields %v, got %+v", tt.wantFields, apiErr.Fields)
+			}
+		})
+	}
+}
@@ -1,155 +1,376 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"database/sql"
-	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io/fs"
 	"log"
-	"net/http"
+	"log/slog"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/F0RG-2142/capstone-1/handlers"
 	"github.com/F0RG-2142/capstone-1/internal/auth"
+	"github.com/F0RG-2142/capstone-1/internal/billing"
+	"github.com/F0RG-2142/capstone-1/internal/config"
+	"github.com/F0RG-2142/capstone-1/internal/cors"
 	"github.com/F0RG-2142/capstone-1/internal/database"
-	"github.com/F0RG-2142/capstone-1/models"
-	"github.com/google/uuid"
+	"github.com/F0RG-2142/capstone-1/internal/health"
+	"github.com/F0RG-2142/capstone-1/internal/lockout"
+	"github.com/F0RG-2142/capstone-1/internal/logging"
+	"github.com/F0RG-2142/capstone-1/internal/metrics"
+	"github.com/F0RG-2142/capstone-1/internal/migrations"
+	"github.com/F0RG-2142/capstone-1/internal/oidc"
+	"github.com/F0RG-2142/capstone-1/internal/ratelimit"
+	"github.com/F0RG-2142/capstone-1/internal/server"
+	"github.com/F0RG-2142/capstone-1/internal/tracing"
 	"github.com/joho/godotenv"
 
 	_ "github.com/lib/pq"
 )
 
 func main() {
-	err := godotenv.Load()
+	//a .env file is a convenience for local development, deployments set real environment variables
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Fatal("Failed to load .env:", err)
+	}
+	loaded, err := config.Load(os.Args[0], os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		log.Fatal("Failed to load env:", err)
+		log.Fatal(err)
+	}
+	cfg := loaded.Config
+	if loaded.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
 		return
 	}
-	db, err := sql.Open("postgres", os.Getenv("DB_URL"))
+	//validated already
+	level, _ := logging.ParseLevel(cfg.LogLevel)
+	//also routes the standard log package through the JSON handler
+	slog.SetDefault(logging.New(os.Stdout, level))
+	if loaded.File != "" {
+		slog.Info("Loaded config file", "path", loaded.File)
+	}
+
+	//SIGTERM (e.g. from Kubernetes) or Ctrl+C starts a graceful shutdown,
+	//a second one kills the process since the handler is gone by then
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	db, err := sql.Open("postgres", cfg.DatabaseURL)
 	if err != nil {
-		log.Fatal("Failed to connect to db:", err)
+		fatal("Failed to connect to db", err)
 	}
-	defer db.Close()
 	if err := db.Ping(); err != nil {
-		log.Fatal("Failed to ping database:", err)
-	}
-	queries := database.New(db)
-	models.Cfg.DB = queries
-	models.Cfg.Platform = os.Getenv("PLATFORM")
-	models.Cfg.Secret = os.Getenv("JWT_SECRET")
-
-	mux := http.NewServeMux()
-	//Utility and admin
-	mux.Handle("GET /api/v1/healthz", http.HandlerFunc(readiness))         //Check if server is ready //Done
-	mux.Handle("GET /api/v1/admin/metrics", http.HandlerFunc(metrics))     //Server metrics endpoint //---
-	mux.Handle("POST /api/v1/payment/webhooks", http.HandlerFunc(payment)) //Payment platform webhook //---
-	//Users and auth
-	mux.Handle("POST /api/v1/register", Chain(http.HandlerFunc(handlers.HandleNewUser)))          //New User Registration
-	mux.Handle("POST /api/v1/login", Chain(http.HandlerFunc(handlers.HandleLogin)))               //Login to profile
-	mux.Handle("POST /api/v1/logout", Chain(http.HandlerFunc(handlers.HandleRevokeRefreshToken))) //Revoke refresh tok
-	mux.Handle("POST /api/v1/token/refresh", Chain(http.HandlerFunc(handlers.HandleRefreshJWT)))  //Refresh JWT
-	mux.Handle("PUT /api/v1/user/me", Chain(http.HandlerFunc(handlers.HandleUpdateUser)))         //Update user details
-	//Private Notes
-	mux.Handle("POST /api/v1/notes", Chain(http.HandlerFunc(handlers.HandleNotes)))                 //Post Private Note //Done
-	mux.Handle("GET /api/v1/notes", Chain(http.HandlerFunc(handlers.HandleGetNotes)))               //Get all private notes //Done
-	mux.Handle("GET /api/v1/notes/{noteID}", Chain(http.HandlerFunc(handlers.HandleGetNote)))       //Get one private note //Done
-	mux.Handle("PUT /api/v1/notes/{noteID}", Chain(http.HandlerFunc(handlers.HandleUpdateNote)))    //Update private note //Done
-	mux.Handle("DELETE /api/v1/notes/{noteID}", Chain(http.HandlerFunc(handlers.HandleDeleteNote))) //Delete note based on id //Done
-	//Teams
-	mux.Handle("POST /api/v1/teams", Chain(http.HandlerFunc(handlers.HandleNewTeam)))                                          //Create new team
-	mux.Handle("GET /api/v1/teams", Chain(http.HandlerFunc(handlers.HandleGetTeams)))                                          //List all teams a user is part of
-	mux.Handle("GET /api/v1/teams/{teamID}", Chain(http.HandlerFunc(handlers.HandleGetTeam)))                                  //Get specific team details
-	mux.Handle("DELETE /api/v1/teams/{teamID}", Chain(http.HandlerFunc(handlers.HandleDeleteTeam)))                            //Delete team
-	mux.Handle("POST /api/v1/teams/{teamID}/members", Chain(http.HandlerFunc(handlers.HandleAddUserToTeam)))                   //Add new user to team
-	mux.Handle("DELETE /api/v1/teams/{teamID}/members/{memberID}", Chain(http.HandlerFunc(handlers.HandleRemoveUserFromTeam))) //Remove user from team
-	mux.Handle("GET /api/v1/teams/{teamID}/members", Chain(http.HandlerFunc(handlers.HandleGetTeamMembers)))                   //Get all users in team
-	//Team Notes
-	mux.Handle("POST /api/v1/teams/{teamID}/notes", Chain(http.HandlerFunc(handlers.HandleTeamNotes)))                 //Post team Note
-	mux.Handle("GET /api/v1/teams/{teamID}/notes", Chain(http.HandlerFunc(handlers.HandleGetTeamNotes)))               //Get all team notes
-	mux.Handle("GET /api/v1/teams/{teamID}/notes/{noteID}", Chain(http.HandlerFunc(handlers.HandleGetTeamNote)))       //Get one team note
-	mux.Handle("PUT /api/v1/teams/{teamID}/notes/{noteID}", Chain(http.HandlerFunc(handlers.HandleUpdateTeamNote)))    //Update team Note
-	mux.Handle("DELETE /api/v1/teams/{teamID}/notes/{noteID}", Chain(http.HandlerFunc(handlers.HandleDeleteTeamNote))) //Delete team note based on id
-
-	fmt.Println("Listening on http://localhost:8080/")
-	if err = http.ListenAndServe(":8080", corsMiddleware(mux)); err != nil {
-		log.Fatal("Server failed:", err)
+		fatal("Failed to ping database", err)
 	}
-}
+	if len(loaded.Args) > 0 && loaded.Args[0] == "migrate" {
+		if err := migrate(ctx, db, loaded.Args[1:]); err != nil {
+			fatal("Migration failed", err)
+		}
+		db.Close()
+		return
+	}
+	if cfg.AutoMigrate {
+		if err := migrations.Up(ctx, db); err != nil {
+			fatal("Failed to migrate database", err)
+		}
+	}
+	if err := migrations.Check(ctx, db); err != nil {
+		fatal("Refusing to start", err)
+	}
+	workers := server.NewWorkers()
+	state := &server.Health{}
 
-func readiness(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	_, err := w.Write([]byte("Server is good to go"))
+	shutdownTracing, err := tracing.Setup(ctx, tracingConfig(cfg.Tracing))
 	if err != nil {
-		w.WriteHeader(http.StatusBadGateway)
-		return
+		fatal("Failed to configure tracing", err)
+	}
+	queries := database.New(tracing.TraceDB(metrics.InstrumentDB(db)))
+	metrics.RegisterDB(db, queries)
+	tokens, err := tokenIssuer(cfg.JWT, workers)
+	if err != nil {
+		fatal("Failed to load JWT signing keys", err)
+	}
+	limiter, err := rateLimiter(cfg.RateLimit, queries, workers)
+	if err != nil {
+		fatal("Failed to configure rate limits", err)
+	}
+	//validated with the rest of the config
+	corsHandler, err := cors.New(cfg.CORS.Policies())
+	if err != nil {
+		fatal("Failed to configure CORS", err)
 	}
+	captcha, mailer := lockoutNotifiers(cfg)
+
+	//the handlers and the expiry job agree on the time
+	clock := time.Now
+	//cancel subscriptions that ran out and take premium away
+	workers.Go("subscription-expiry", func(ctx context.Context) {
+		billing.RunExpiry(ctx, queries, 10*time.Minute, clock)
+	})
+
+	api := &handlers.Server{
+		DB:                   queries,
+		Clock:                clock,
+		Logger:               slog.Default(),
+		Tokens:               tokens,
+		Platform:             cfg.Platform,
+		Contract:             handlers.ContractMode(cfg.ContractValidation),
+		OIDC:                 oidcProviders(cfg.OIDC),
+		AdminToken:           cfg.AdminToken,
+		AdminClientCert:      cfg.TLS.ClientCAFile != "",
+		Captcha:              captcha,
+		Mailer:               mailer,
+		UnlockURL:            cfg.UnlockURL,
+		InsecureCookies:      cfg.InsecureCookies,
+		RateLimiter:          limiter,
+		PaymentWebhookSecret: cfg.Payments.WebhookSecret,
+		CORS:                 corsHandler,
+		Health:               state,
+		ReadyChecks:          readinessChecks(db, state, workers),
+	}
+	handler := server.HSTS(api.Handler(), cfg.TLS.HSTSMaxAge, cfg.TLS.HSTSIncludeSubdomains)
+	serverCfg := serverConfig(cfg.HTTP)
+	if cfg.TLS.Enabled() {
+		serverCfg.TLS, err = tlsConfig(cfg.TLS, workers)
+		if err != nil {
+			fatal("Failed to configure TLS", err)
+		}
+		serverCfg.RedirectAddr = cfg.TLS.RedirectAddr
+	}
+	err = server.Run(ctx, serverCfg, handler, state, workers)
+	//workers are stopped by now, nothing uses the db or tracer anymore
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("Failed to flush traces", "err", err)
+	}
+	db.Close()
+	if err != nil {
+		fatal("Server failed", err)
+	}
+	slog.Info("Server stopped")
 }
 
-func metrics(w http.ResponseWriter, r *http.Request) {
+// Runs the "migrate" subcommand
+func migrate(ctx context.Context, db *sql.DB, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: migrate up|down|status|redo")
+	}
+	switch args[0] {
+	case "up":
+		return migrations.Up(ctx, db)
+	case "down":
+		return migrations.Down(ctx, db)
+	case "redo":
+		return migrations.Redo(ctx, db)
+	case "status":
+		return migrations.Status(ctx, db, os.Stdout)
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down, status or redo", args[0])
+	}
 }
 
-func payment(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	apiKey, err := auth.GetAPIKey(r.Header)
-	if err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusFailedDependency)
-	}
-	if apiKey != os.Getenv("PP_KEY") {
-		http.Error(w, "Unauthorized Endpoint", http.StatusUnauthorized)
-	}
-	req := struct {
-		Event string `json:"event"`
-		Data  struct {
-			UserId uuid.UUID `json:"user_id"`
-		} `json:"data"`
-	}{
-		Event: "",
-		Data: struct {
-			UserId uuid.UUID `json:"user_id"`
-		}{
-			UserId: uuid.Nil,
-		},
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Error decoding request: %v", err)
-		http.Error(w, `{"error":"Invalid request body"}`, http.StatusBadRequest)
-		return
+// Logs the error and exits, for startup failures
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
+}
+
+// Tracing is off when no endpoint is set or it is disabled
+func tracingConfig(c config.Tracing) tracing.Config {
+	cfg := tracing.Config{
+		Endpoint:    c.Endpoint,
+		ServiceName: c.ServiceName,
+		SampleRatio: c.SampleRatio,
 	}
-	if req.Event != "user.upgraded" {
-		http.Error(w, "", http.StatusNoContent)
+	if c.Disabled {
+		cfg.Endpoint = ""
 	}
+	return cfg
+}
 
-	err = models.Cfg.DB.GivePremium(r.Context(), req.Data.UserId)
+// Tokens are signed with asymmetric keys from the key dir when it is set, otherwise with the secret.
+// Retired keys are kept for verification until every token they signed has expired
+func tokenIssuer(c config.JWT, workers *server.Workers) (*auth.TokenIssuer, error) {
+	issuer := &auth.TokenIssuer{
+		Secret:   c.Secret,
+		Issuer:   c.Issuer,
+		Audience: c.Audience,
+	}
+	if c.KeyDir == "" {
+		return issuer, nil
+	}
+	keys, err := auth.LoadKeySet(c.KeyDir, c.KeyAlgorithm)
 	if err != nil {
-		http.Error(w, "User Not Found", http.StatusNotFound)
+		return nil, err
 	}
-	w.WriteHeader(http.StatusNoContent)
+	issuer.Keys = keys
+	//access tokens live for an hour, keep old keys around a bit longer than that
+	workers.Go("jwt-keys", func(ctx context.Context) {
+		keys.Watch(ctx, time.Minute, c.RotateEvery, 2*time.Hour)
+	})
+	return issuer, nil
 }
 
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
+func oidcProviders(configs map[string]config.OIDCProvider) map[string]*oidc.Provider {
+	providers := map[string]*oidc.Provider{}
+	for name, c := range configs {
+		providers[name] = &oidc.Provider{
+			Name:         name,
+			IssuerURL:    c.IssuerURL,
+			ClientID:     c.ClientID,
+			ClientSecret: c.ClientSecret,
+			RedirectURL:  c.RedirectURL,
+			Scopes:       c.Scopes,
+		}
+	}
+	return providers
+}
 
-		if strings.HasPrefix(strings.ToLower(origin), "http://localhost") ||
-			strings.HasPrefix(strings.ToLower(origin), "https://localhost") {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
+// A CAPTCHA is only enforced when it is configured. Unlock emails are only logged without SMTP
+func lockoutNotifiers(cfg config.Config) (lockout.CaptchaVerifier, lockout.Mailer) {
+	var captcha lockout.CaptchaVerifier
+	if cfg.Captcha.VerifyURL != "" {
+		captcha = &lockout.SiteVerifyCaptcha{
+			VerifyURL: cfg.Captcha.VerifyURL,
+			Secret:    cfg.Captcha.Secret,
 		}
+	}
+	var mailer lockout.Mailer = &lockout.LogMailer{ShowLinks: cfg.Platform == "dev"}
+	if cfg.SMTP.Addr != "" {
+		mailer = &lockout.SMTPMailer{
+			Addr:     cfg.SMTP.Addr,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+			From:     cfg.SMTP.From,
+		}
+	}
+	return captcha, mailer
+}
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+// Nil when rate limiting is disabled. Configured limits replace the defaults of their group
+func rateLimiter(c config.RateLimit, queries *database.Queries, workers *server.Workers) (*ratelimit.Limiter, error) {
+	if c.Disabled {
+		return nil, nil
+	}
+	overrides := c.Overrides()
+	groups := map[string]ratelimit.Group{}
+	for name, group := range ratelimit.DefaultGroups {
+		if v, ok := overrides[name]; ok {
+			limit, err := ratelimit.ParseLimit(v)
+			if err != nil {
+				return nil, err
+			}
+			group.Free = limit
 		}
+		if v, ok := overrides[name+"_premium"]; ok {
+			limit, err := ratelimit.ParseLimit(v)
+			if err != nil {
+				return nil, err
+			}
+			group.Premium = limit
+		}
+		groups[name] = group
+	}
+	limiter := &ratelimit.Limiter{Groups: groups}
+	switch c.Store {
+	case "memory":
+		limiter.Store = ratelimit.NewMemoryStore()
+	case "postgres":
+		store := &ratelimit.PostgresStore{DB: queries}
+		//buckets are full again after at most an hour with the default limits
+		workers.Go("rate-limit-prune", func(ctx context.Context) {
+			store.Prune(ctx, 10*time.Minute, 2*time.Hour)
+		})
+		limiter.Store = store
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", c.Store)
+	}
+	return limiter, nil
+}
 
-		next.ServeHTTP(w, r)
+// The certificate is reloaded in the background when its files change
+func tlsConfig(c config.TLS, workers *server.Workers) (*tls.Config, error) {
+	certs, err := server.NewCertReloader(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	workers.Go("tls-reload", func(ctx context.Context) {
+		certs.Watch(ctx, c.ReloadInterval)
+	})
+	return server.NewTLSConfig(certs, server.TLSOptions{
+		MinVersion:   c.MinVersion,
+		CipherSuites: c.CipherSuites,
+		ClientCAFile: c.ClientCAFile,
 	})
 }
 
-func Chain(h http.Handler, middlewares ...models.Middleware) http.Handler {
-	for _, m := range middlewares {
-		h = m(h)
+func serverConfig(c config.HTTP) server.Config {
+	return server.Config{
+		Addr:              c.Addr,
+		ReadTimeout:       c.ReadTimeout,
+		ReadHeaderTimeout: c.ReadHeaderTimeout,
+		WriteTimeout:      c.WriteTimeout,
+		IdleTimeout:       c.IdleTimeout,
+		MaxHeaderBytes:    c.MaxHeaderBytes,
+		MaxBodyBytes:      c.MaxBodyBytes,
+		ShutdownDelay:     c.ShutdownDelay,
+		ShutdownTimeout:   c.ShutdownTimeout,
+	}
+}
+
+// What /readyz checks: the server isn't shutting down, the database answers, its schema isn't behind
+// the migrations the binary was built with and no background worker has died
+func readinessChecks(db *sql.DB, state *server.Health, workers *server.Workers) []health.Check {
+	return []health.Check{
+		{Name: "server", Run: func(ctx context.Context) error {
+			if !state.Ready() {
+				return errors.New("server is shutting down")
+			}
+			return nil
+		}},
+		{Name: "database", Run: func(ctx context.Context) error {
+			if err := db.PingContext(ctx); err != nil {
+				slog.ErrorContext(ctx, "Database ping failed", "err", err)
+				return errors.New("database unreachable")
+			}
+			return nil
+		}},
+		{Name: "migrations", Run: func(ctx context.Context) error {
+			expected, err := migrations.Latest()
+			if err != nil {
+				return err
+			}
+			current, err := migrations.Current(ctx, db)
+			if err != nil {
+				slog.ErrorContext(ctx, "Reading schema version failed", "err", err)
+				return errors.New("could not read schema version")
+			}
+			//a newer schema is fine, it's what older instances see during a rolling deploy
+			if current < expected {
+				return fmt.Errorf("schema is at version %d, expected %d", current, expected)
+			}
+			return nil
+		}},
+		{Name: "workers", Run: func(ctx context.Context) error {
+			if stopped := workers.Stopped(); len(stopped) > 0 {
+				return fmt.Errorf("background workers stopped: %s", strings.Join(stopped, ", "))
+			}
+			return nil
+		}},
 	}
-	return h
 }
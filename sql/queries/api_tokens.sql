@@ -0,0 +1,42 @@
+-- name: NewAPIToken :one
+INSERT INTO api_tokens (id, created_at, updated_at, user_id, name, token_hash, token_hint, scopes, expires_at)
+VALUES (
+    gen_random_uuid (),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+RETURNING *;
+
+-- name: GetAPITokenByHash :one
+SELECT * FROM api_tokens WHERE token_hash = $1;
+
+-- name: GetAPITokens :many
+SELECT * FROM api_tokens WHERE user_id = $1 ORDER BY created_at ASC;
+
+-- name: RevokeAPIToken :execrows
+UPDATE api_tokens
+SET
+    updated_at = NOW(),
+    revoked_at = NOW()
+WHERE
+    id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: TouchAPIToken :exec
+UPDATE api_tokens
+SET
+    last_used_at = NOW()
+WHERE
+    id = $1
+    AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute');
+
+-- name: CountActiveAPITokens :one
+SELECT COUNT(*) FROM api_tokens
+WHERE user_id = $1
+AND revoked_at IS NULL
+AND (expires_at IS NULL OR expires_at > NOW());
@@ -0,0 +1,37 @@
+-- name: NewUserIdentity :one
+INSERT INTO user_identities (id, created_at, updated_at, user_id, provider, subject, email)
+VALUES (
+    gen_random_uuid (),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: GetUserIdentity :one
+SELECT * FROM user_identities WHERE provider = $1 AND subject = $2;
+
+-- name: NewOIDCLoginState :exec
+INSERT INTO oidc_login_states (state, created_at, provider, nonce, code_verifier, expires_at, link_user_id)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    NOW() + INTERVAL '10 minutes',
+    $5
+);
+
+-- name: ConsumeOIDCLoginState :one
+DELETE FROM oidc_login_states
+WHERE state = $1
+AND provider = $2
+AND expires_at > NOW()
+RETURNING *;
+
+-- name: DeleteExpiredOIDCLoginStates :exec
+DELETE FROM oidc_login_states WHERE expires_at <= NOW();
@@ -0,0 +1,78 @@
+-- name: GetLoginThrottle :one
+SELECT * FROM login_throttles WHERE key = $1;
+
+-- name: RecordLoginAttempt :one
+-- Counts the attempt as a failure before the password is checked and blocks the key as if it failed,
+-- so concurrent attempts each see the ones before them. The delay doubles like lockout.Policy.Delay.
+-- Returns nothing while the key is blocked
+INSERT INTO login_throttles (key, created_at, updated_at, failures, last_failure_at, blocked_until, locked)
+SELECT
+    sqlc.arg(key),
+    NOW(),
+    NOW(),
+    attempt.failures,
+    NOW(),
+    NOW() + make_interval(secs => CASE
+        WHEN sqlc.arg(lockout_after)::int > 0 AND attempt.failures >= sqlc.arg(lockout_after)::int THEN sqlc.arg(lockout_seconds)::float8
+        WHEN attempt.failures <= sqlc.arg(free_attempts)::int THEN 0
+        ELSE LEAST(sqlc.arg(base_delay_seconds)::float8 * POWER(2, LEAST(attempt.failures - sqlc.arg(free_attempts)::int - 1, 60)), sqlc.arg(max_delay_seconds)::float8)
+    END),
+    sqlc.arg(lockout_after)::int > 0 AND attempt.failures >= sqlc.arg(lockout_after)::int
+FROM (SELECT 1 AS failures) AS attempt
+ON CONFLICT (key) DO UPDATE
+SET
+    updated_at = NOW(),
+    last_failure_at = NOW(),
+    (failures, blocked_until, locked) = (
+        SELECT
+            attempt.failures,
+            NOW() + make_interval(secs => CASE
+                WHEN sqlc.arg(lockout_after)::int > 0 AND attempt.failures >= sqlc.arg(lockout_after)::int THEN sqlc.arg(lockout_seconds)::float8
+                WHEN attempt.failures <= sqlc.arg(free_attempts)::int THEN 0
+                ELSE LEAST(sqlc.arg(base_delay_seconds)::float8 * POWER(2, LEAST(attempt.failures - sqlc.arg(free_attempts)::int - 1, 60)), sqlc.arg(max_delay_seconds)::float8)
+            END),
+            sqlc.arg(lockout_after)::int > 0 AND attempt.failures >= sqlc.arg(lockout_after)::int
+        FROM (
+            SELECT CASE
+                WHEN login_throttles.last_failure_at < sqlc.arg(window_start)::timestamp AND NOT login_throttles.locked THEN 1
+                ELSE login_throttles.failures + 1
+            END AS failures
+        ) AS attempt
+    )
+WHERE login_throttles.blocked_until <= NOW()
+RETURNING *;
+
+-- name: RefundLoginAttempt :exec
+-- Takes back an attempt that turned out not to be a failure. Its block is only lifted when no
+-- attempt was recorded after it
+UPDATE login_throttles
+SET
+    updated_at = NOW(),
+    failures = GREATEST(failures - 1, 0),
+    blocked_until = CASE WHEN failures = sqlc.arg(failures) THEN NOW() ELSE blocked_until END,
+    locked = CASE WHEN failures = sqlc.arg(failures) THEN sqlc.arg(locked) ELSE locked END
+WHERE
+    key = sqlc.arg(key);
+
+-- name: ClearLoginThrottle :execrows
+DELETE FROM login_throttles WHERE key = $1;
+
+-- name: GetBlockedLoginThrottles :many
+SELECT * FROM login_throttles
+WHERE blocked_until > NOW() OR locked
+ORDER BY updated_at DESC;
+
+-- name: NewUnlockToken :exec
+INSERT INTO unlock_tokens (token_hash, created_at, throttle_key, expires_at)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    NOW() + INTERVAL '24 hours'
+);
+
+-- name: ConsumeUnlockToken :one
+DELETE FROM unlock_tokens
+WHERE token_hash = $1
+AND expires_at > NOW()
+RETURNING *;
@@ -0,0 +1,6 @@
+-- name: GetBusinessCounts :one
+SELECT
+    (SELECT COUNT(*) FROM users) AS users,
+    (SELECT COUNT(*) FROM users WHERE has_notes_premium) AS premium_users,
+    (SELECT COUNT(*) FROM notes) AS notes,
+    (SELECT COUNT(*) FROM teams) AS teams;
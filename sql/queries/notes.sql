@@ -15,7 +15,7 @@ SELECT * FROM notes WHERE user_id = $1 ORDER BY created_at ASC ;
 -- name: GetNoteByID :one
 SELECT * FROM notes WHERE id = $1 AND user_id = $2;
 
--- name: DeleteNote :exec
+-- name: DeleteNote :execrows
 DELETE FROM notes WHERE id = $1 AND user_id = $2;
 
 -- name: UpdateNote :exec
@@ -26,3 +26,6 @@ SET
     name = $2
 WHERE 
     id = $3;
+
+-- name: CountNotes :one
+SELECT COUNT(*) FROM notes WHERE user_id = $1;
@@ -0,0 +1,49 @@
+-- name: NewPaymentEvent :one
+INSERT INTO payment_events (id, created_at, updated_at, event_type, payload, status, attempts)
+VALUES (
+    $1,
+    NOW(),
+    NOW(),
+    $2,
+    $3,
+    'received',
+    0
+)
+ON CONFLICT (id) DO NOTHING
+RETURNING *;
+
+-- name: GetPaymentEvent :one
+SELECT * FROM payment_events WHERE id = $1;
+
+-- name: GetPaymentEvents :many
+SELECT * FROM payment_events
+WHERE sqlc.narg(status)::text IS NULL OR status = sqlc.narg(status)::text
+ORDER BY created_at DESC
+LIMIT sqlc.arg(max_events);
+
+-- name: ClaimPaymentEvent :one
+-- Only the delivery that gets the row applies the event. Claims older than 5 minutes were
+-- abandoned by a crashed process and can be taken over
+UPDATE payment_events
+SET
+    updated_at = NOW(),
+    status = 'processing'
+WHERE
+    id = $1
+AND (
+    status IN ('received', 'failed')
+    OR (status = 'processing' AND updated_at < NOW() - INTERVAL '5 minutes')
+)
+RETURNING *;
+
+-- name: FinishPaymentEvent :one
+UPDATE payment_events
+SET
+    updated_at = NOW(),
+    status = $2,
+    attempts = attempts + 1,
+    processed_at = CASE WHEN $2 = 'failed' THEN processed_at ELSE NOW() END,
+    last_error = $3
+WHERE
+    id = $1
+RETURNING *;
@@ -0,0 +1,22 @@
+-- name: TakeRateLimitToken :one
+INSERT INTO rate_limits (key, tokens, updated_at)
+VALUES (
+    sqlc.arg(key),
+    sqlc.arg(burst)::float8 - 1,
+    NOW()
+)
+ON CONFLICT (key) DO UPDATE
+SET
+    tokens = LEAST(sqlc.arg(burst)::float8, rate_limits.tokens + GREATEST(EXTRACT(EPOCH FROM (NOW() - rate_limits.updated_at))::float8, 0) * sqlc.arg(rate)::float8) - 1,
+    updated_at = NOW()
+WHERE LEAST(sqlc.arg(burst)::float8, rate_limits.tokens + GREATEST(EXTRACT(EPOCH FROM (NOW() - rate_limits.updated_at))::float8, 0) * sqlc.arg(rate)::float8) >= 1
+RETURNING tokens;
+
+-- name: PeekRateLimitTokens :one
+SELECT LEAST(sqlc.arg(burst)::float8, tokens + GREATEST(EXTRACT(EPOCH FROM (NOW() - updated_at))::float8, 0) * sqlc.arg(rate)::float8)::float8 AS tokens
+FROM rate_limits
+WHERE key = sqlc.arg(key);
+
+-- name: DeleteIdleRateLimits :execrows
+DELETE FROM rate_limits
+WHERE updated_at < NOW() - make_interval(secs => sqlc.arg(idle_seconds)::float8);
@@ -0,0 +1,91 @@
+-- name: UpsertSubscription :one
+INSERT INTO subscriptions (id, created_at, updated_at, user_id, provider_subscription_id, plan, status, current_period_end, grace_period_end, cancel_at_period_end, canceled_at)
+VALUES (
+    gen_random_uuid (),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    NULL,
+    false,
+    NULL
+)
+ON CONFLICT (user_id) DO UPDATE
+SET
+    updated_at = NOW(),
+    provider_subscription_id = COALESCE(EXCLUDED.provider_subscription_id, subscriptions.provider_subscription_id),
+    plan = EXCLUDED.plan,
+    status = EXCLUDED.status,
+    current_period_end = EXCLUDED.current_period_end,
+    grace_period_end = NULL,
+    cancel_at_period_end = false,
+    canceled_at = NULL
+RETURNING *;
+
+-- name: GetSubscriptionByUser :one
+SELECT * FROM subscriptions WHERE user_id = $1;
+
+-- name: RenewSubscription :one
+UPDATE subscriptions
+SET
+    updated_at = NOW(),
+    status = 'active',
+    current_period_end = $2,
+    grace_period_end = NULL
+WHERE
+    user_id = $1
+AND status <> 'canceled'
+RETURNING *;
+
+-- name: MarkSubscriptionPastDue :one
+UPDATE subscriptions
+SET
+    updated_at = NOW(),
+    status = 'past_due',
+    grace_period_end = $2
+WHERE
+    user_id = $1
+AND status <> 'canceled'
+RETURNING *;
+
+-- name: CancelSubscriptionAtPeriodEnd :one
+UPDATE subscriptions
+SET
+    updated_at = NOW(),
+    cancel_at_period_end = true
+WHERE
+    user_id = $1
+AND status <> 'canceled'
+RETURNING *;
+
+-- name: CancelSubscription :one
+UPDATE subscriptions
+SET
+    updated_at = NOW(),
+    status = 'canceled',
+    grace_period_end = NULL,
+    cancel_at_period_end = false,
+    canceled_at = NOW()
+WHERE
+    user_id = $1
+RETURNING *;
+
+-- name: ExpireLapsedSubscriptions :many
+UPDATE subscriptions
+SET
+    updated_at = NOW(),
+    status = 'canceled',
+    grace_period_end = NULL,
+    cancel_at_period_end = false,
+    canceled_at = NOW()
+WHERE
+    status <> 'canceled'
+AND (
+    (cancel_at_period_end AND current_period_end < sqlc.arg(now)::timestamp)
+    OR (status = 'past_due' AND grace_period_end < sqlc.arg(now)::timestamp)
+    OR (status IN ('active', 'trialing') AND current_period_end < sqlc.arg(lapsed_before)::timestamp)
+)
+RETURNING *;
@@ -0,0 +1,88 @@
+-- name: UpsertTeamSubscription :one
+INSERT INTO team_subscriptions (id, created_at, updated_at, team_id, provider_subscription_id, plan, status, seats, current_period_end, grace_period_end, canceled_at)
+VALUES (
+    gen_random_uuid (),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    NULL,
+    NULL
+)
+ON CONFLICT (team_id) DO UPDATE
+SET
+    updated_at = NOW(),
+    provider_subscription_id = COALESCE(EXCLUDED.provider_subscription_id, team_subscriptions.provider_subscription_id),
+    plan = EXCLUDED.plan,
+    status = EXCLUDED.status,
+    seats = EXCLUDED.seats,
+    current_period_end = EXCLUDED.current_period_end,
+    grace_period_end = NULL,
+    canceled_at = NULL
+RETURNING *;
+
+-- name: GetTeamSubscription :one
+SELECT * FROM team_subscriptions WHERE team_id = $1;
+
+-- name: SetTeamSubscriptionSeats :one
+UPDATE team_subscriptions
+SET
+    updated_at = NOW(),
+    seats = $2
+WHERE
+    team_id = $1
+AND status <> 'canceled'
+RETURNING *;
+
+-- name: RenewTeamSubscription :one
+UPDATE team_subscriptions
+SET
+    updated_at = NOW(),
+    status = 'active',
+    current_period_end = $2,
+    grace_period_end = NULL
+WHERE
+    team_id = $1
+AND status <> 'canceled'
+RETURNING *;
+
+-- name: MarkTeamSubscriptionPastDue :one
+UPDATE team_subscriptions
+SET
+    updated_at = NOW(),
+    status = 'past_due',
+    grace_period_end = $2
+WHERE
+    team_id = $1
+AND status <> 'canceled'
+RETURNING *;
+
+-- name: CancelTeamSubscription :one
+UPDATE team_subscriptions
+SET
+    updated_at = NOW(),
+    status = 'canceled',
+    grace_period_end = NULL,
+    canceled_at = NOW()
+WHERE
+    team_id = $1
+RETURNING *;
+
+-- name: ExpireLapsedTeamSubscriptions :many
+UPDATE team_subscriptions
+SET
+    updated_at = NOW(),
+    status = 'canceled',
+    grace_period_end = NULL,
+    canceled_at = NOW()
+WHERE
+    status <> 'canceled'
+AND (
+    (status = 'past_due' AND grace_period_end < sqlc.arg(now)::timestamp)
+    OR (status IN ('active', 'trialing') AND current_period_end < sqlc.arg(lapsed_before)::timestamp)
+)
+RETURNING *;
@@ -1,13 +1,21 @@
--- name: NewTeam :exec
-INSERT INTO teams (id, created_at, updated_at, team_name, created_by, is_private)
-VALUES(
-    gen_random_uuid (),
-    NOW(),
-    NOW(),
-    $1,
-    $2,
-    $3
-);
+-- name: NewTeam :one
+-- Creates the team and makes its creator an admin in one statement, so a team never ends up without one
+WITH team AS (
+    INSERT INTO teams (id, created_at, updated_at, team_name, created_by, is_private)
+    VALUES(
+        gen_random_uuid (),
+        NOW(),
+        NOW(),
+        $1,
+        $2,
+        $3
+    )
+    RETURNING *
+), creator AS (
+    INSERT INTO user_teams (user_id, team_id, role, joined_at)
+    SELECT created_by, id, 'admin', NOW() FROM team
+)
+SELECT * FROM team;
 
 -- name: GetAllTeams :many
 SELECT t.*
@@ -21,7 +29,7 @@ FROM Teams t
 INNER JOIN User_Teams ut ON t.id = ut.team_id
 WHERE ut.user_id = $1 AND ut.team_id = $2;
 
--- name: DeleteTeam :exec
+-- name: DeleteTeam :execrows
 DELETE FROM Teams t
 USING User_Teams ut
 WHERE t.id = ut.team_id
@@ -42,7 +50,7 @@ VALUES (
 DELETE FROM user_teams WHERE user_id = $1 AND team_id = $2;
 
 -- name: GetTeamMembers :many
-SELECT * FROM teams WHERE id = $1;
+SELECT * FROM user_teams WHERE team_id = $1 ORDER BY joined_at ASC;
 
 -- name: GetTeamMember :one
 SELECT * FROM User_Teams WHERE user_id = $1 AND team_id = $2;
@@ -56,13 +64,14 @@ WHERE t.id = $2
 AND ut.user_id = $3
 AND ut.role IN ('admin', 'editor');
 
--- name: RemoveNoteFromTeam :exec
+-- name: RemoveNoteFromTeam :execrows
 DELETE FROM Notes n
 USING Note_Teams nt
 JOIN User_Teams ut ON nt.team_id = ut.team_id
 WHERE n.id = nt.note_id
 AND nt.note_id = $1
-AND ut.user_id = $2
+AND nt.team_id = $2
+AND ut.user_id = $3
 AND ut.role = 'admin';
 
 -- name: GetTeamNote :one
@@ -82,7 +91,7 @@ JOIN User_Teams ut ON nt.team_id = ut.team_id
 WHERE nt.team_id = $1
 AND ut.user_id = $2;
 
--- name: UpdateTeamNote :exec
+-- name: UpdateTeamNote :execrows
 UPDATE Notes n
 SET body = $1, updated_at = NOW()
 FROM Note_Teams nt
@@ -90,4 +99,27 @@ JOIN User_Teams ut ON nt.team_id = ut.team_id
 WHERE n.id = nt.note_id
 AND n.id = $2
 AND nt.team_id = $3
-AND ut.user_id = $4;
\ No newline at end of file
+AND ut.user_id = $4
+AND ut.role IN ('admin', 'editor');
+
+-- name: CountTeamsCreated :one
+SELECT COUNT(*) FROM teams WHERE created_by = $1;
+
+-- name: CountTeamMembers :one
+SELECT COUNT(*) FROM user_teams WHERE team_id = $1;
+
+-- name: GetLargestCreatedTeamSize :one
+SELECT COALESCE(MAX(member_count), 0)::bigint
+FROM (
+    SELECT COUNT(ut.user_id) AS member_count
+    FROM teams t
+    LEFT JOIN user_teams ut ON t.id = ut.team_id
+    WHERE t.created_by = $1
+    GROUP BY t.id
+) AS team_sizes;
+
+-- name: GetTeamCreatorPremium :one
+SELECT u.has_notes_premium
+FROM teams t
+JOIN users u ON u.id = t.created_by
+WHERE t.id = $1;
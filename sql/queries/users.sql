@@ -32,4 +32,25 @@ UPDATE users
 SET 
     has_notes_premium = 'true'
 WHERE
-    id = $1;
\ No newline at end of file
+    id = $1;
+
+-- name: CreateExternalUser :one
+INSERT INTO users (id, created_at, updated_at, email)
+VALUES (
+    gen_random_uuid (),
+    NOW(),
+    NOW(),
+    $1
+)
+RETURNING *;
+
+-- name: GetUserByID :one
+SELECT * FROM users WHERE id = $1;
+
+-- name: SetPremium :exec
+UPDATE users
+SET
+    updated_at = NOW(),
+    has_notes_premium = $2
+WHERE
+    id = $1;
@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS User_Identities (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT NOT NULL,
+    UNIQUE (provider, subject)
+);
+CREATE TABLE IF NOT EXISTS OIDC_Login_States (
+    state TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    provider TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_user_identities_user_id ON User_Identities (user_id);
+
+-- +goose Down
+DROP TABLE oidc_login_states;
+DROP TABLE user_identities;
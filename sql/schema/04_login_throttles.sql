@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS Login_Throttles (
+    key TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP NOT NULL,
+    blocked_until TIMESTAMP NOT NULL,
+    locked BOOLEAN NOT NULL DEFAULT false
+);
+CREATE TABLE IF NOT EXISTS Unlock_Tokens (
+    token_hash TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    throttle_key TEXT NOT NULL REFERENCES login_throttles(key) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_login_throttles_blocked_until ON Login_Throttles (blocked_until);
+
+-- +goose Down
+DROP TABLE unlock_tokens;
+DROP TABLE login_throttles;
@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS Rate_Limits (
+    key TEXT PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_rate_limits_updated_at ON Rate_Limits (updated_at);
+
+-- +goose Down
+DROP TABLE rate_limits;
@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS Subscriptions (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    provider_subscription_id TEXT,
+    plan TEXT NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('trialing', 'active', 'past_due', 'canceled')),
+    current_period_end TIMESTAMP NOT NULL,
+    grace_period_end TIMESTAMP,
+    cancel_at_period_end BOOLEAN NOT NULL DEFAULT false,
+    canceled_at TIMESTAMP
+);
+CREATE INDEX idx_subscriptions_status ON Subscriptions (status);
+
+-- +goose Down
+DROP TABLE subscriptions;
@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS Team_Subscriptions (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    team_id UUID NOT NULL UNIQUE REFERENCES teams(id) ON DELETE CASCADE,
+    provider_subscription_id TEXT,
+    plan TEXT NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('trialing', 'active', 'past_due', 'canceled')),
+    seats INTEGER NOT NULL CHECK (seats > 0),
+    current_period_end TIMESTAMP NOT NULL,
+    grace_period_end TIMESTAMP,
+    canceled_at TIMESTAMP
+);
+CREATE INDEX idx_team_subscriptions_status ON Team_Subscriptions (status);
+
+-- +goose Down
+DROP TABLE team_subscriptions;
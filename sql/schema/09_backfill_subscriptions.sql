@@ -0,0 +1,12 @@
+-- +goose Up
+-- Premium granted before subscriptions were tracked. Without a row downgrades and cancellations
+-- are ignored and the expiry job never sees these users
+INSERT INTO subscriptions (id, created_at, updated_at, user_id, plan, status, current_period_end)
+SELECT gen_random_uuid (), NOW(), NOW(), id, 'premium', 'active', NOW() + INTERVAL '30 days'
+FROM users
+WHERE has_notes_premium
+ON CONFLICT (user_id) DO NOTHING;
+
+-- +goose Down
+-- The backfilled rows can't be told apart from ones made by payment events, they stay
+SELECT 1;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Events are claimed before they are applied so concurrent deliveries don't both apply one
+ALTER TABLE payment_events DROP CONSTRAINT payment_events_status_check;
+ALTER TABLE payment_events ADD CONSTRAINT payment_events_status_check CHECK (status IN ('received', 'processing', 'processed', 'ignored', 'failed'));
+
+-- +goose Down
+UPDATE payment_events SET status = 'failed' WHERE status = 'processing';
+ALTER TABLE payment_events DROP CONSTRAINT payment_events_status_check;
+ALTER TABLE payment_events ADD CONSTRAINT payment_events_status_check CHECK (status IN ('received', 'processed', 'ignored', 'failed'));
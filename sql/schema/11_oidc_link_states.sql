@@ -0,0 +1,6 @@
+-- +goose Up
+-- Logins started from a signed in account link the identity to that account
+ALTER TABLE oidc_login_states ADD COLUMN link_user_id UUID REFERENCES users(id) ON DELETE CASCADE;
+
+-- +goose Down
+ALTER TABLE oidc_login_states DROP COLUMN link_user_id;
@@ -0,0 +1,7 @@
+// Package schema embeds the goose migrations so the binary can check and apply them on its own
+package schema
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS